@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/replay"
+	"xm-exercise/pkg/models"
+)
+
+// runAdmin runs an admin subcommand
+func runAdmin(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing admin command, expected provision-topics or replay")
+	}
+
+	switch args[0] {
+	case "provision-topics":
+		return provisionTopics(cfg, args[1:])
+	case "replay":
+		return replayEvents(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown admin command %q, expected provision-topics or replay", args[0])
+	}
+}
+
+// provisionTopics checks the Kafka brokers and creates the missing topics,
+// whatever KAFKA_CREATE_TOPICS says
+func provisionTopics(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("admin provision-topics", flag.ContinueOnError)
+	checkOnly := flags.Bool("check", false, "only check broker connectivity")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.EventBus.Backend != events.BackendKafka {
+		return fmt.Errorf("topic provisioning requires the kafka backend, EVENT_BUS_BACKEND is %s", cfg.EventBus.Backend)
+	}
+
+	encoder, err := events.NewEncoder(cfg.EventEncoding)
+	if err != nil {
+		return err
+	}
+
+	topics := requiredTopics(cfg, encoder)
+	if err := checkKafka(cfg, topics, !*checkOnly); err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		fmt.Fprintln(os.Stdout, topic)
+	}
+	return nil
+}
+
+// replayEvents publishes company events again, from the current companies or
+// the company event log, until done or interrupted by SIGINT or SIGTERM
+func replayEvents(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("admin replay", flag.ContinueOnError)
+	mode := flags.String("mode", models.ReplayModeSnapshot, "snapshot of the current companies, or history from the event log")
+	organizationID := flags.String("organization", "", "only events of this organization")
+	companyIDs := flags.String("company", "", "only events of these comma-separated companies")
+	eventTypes := flags.String("type", "", "only these comma-separated event types (history only)")
+	since := flags.String("since", "", "only events that occurred at or after this RFC 3339 time (history only)")
+	until := flags.String("until", "", "only events that occurred before this RFC 3339 time (history only)")
+	rate := flags.Int("rate", cfg.Replay.Rate, "events published per second")
+	dryRun := flags.Bool("dry-run", false, "count the matching events without publishing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	request := models.ReplayRequest{
+		Mode:           *mode,
+		OrganizationID: *organizationID,
+		CompanyIDs:     splitList(*companyIDs),
+		EventTypes:     splitList(*eventTypes),
+		Rate:           *rate,
+		DryRun:         *dryRun,
+	}
+	var err error
+	if request.Since, err = parseTime("since", *since); err != nil {
+		return err
+	}
+	if request.Until, err = parseTime("until", *until); err != nil {
+		return err
+	}
+	if err := request.Validate(); err != nil {
+		return err
+	}
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck // Shutdown errors are typically unrecoverable.
+	defer database.Close()
+
+	var producer events.KafkaProducerInterface
+	if !request.DryRun {
+		encoder, err := newEncoder(cfg)
+		if err != nil {
+			return err
+		}
+		backend, err := events.NewPublisher(cfg.EventBus)
+		if err != nil {
+			return err
+		}
+		publisher := events.NewAsyncPublisher(backend, cfg.EventBus.Publish)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := publisher.Shutdown(ctx); err != nil {
+				logger.Error("Failed to flush event publish queue", zap.Error(err))
+			}
+		}()
+		producer = events.NewProducer(publisher, encoder)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	id := uuid.New().String()
+	var total int64
+	published, err := replay.NewReplayer(database, producer, cfg.Replay).Run(ctx, id, request,
+		func(published, matching int64) {
+			total = matching
+			logger.Info("Replay progress", zap.Int64("published", published), zap.Int64("total", total))
+		})
+
+	verb := "published"
+	if request.DryRun {
+		verb = "would be published"
+	}
+	fmt.Fprintf(os.Stdout, "replay %s: %d of %d events %s\n", id, published, total, verb)
+	return err
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseTime parses an optional RFC 3339 flag value
+func parseTime(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("-%s must be an RFC 3339 time", name)
+	}
+	return &t, nil
+}
+
+// requiredTopics returns the topics the service publishes to
+func requiredTopics(cfg *config.Config, encoder *events.Encoder) []string {
+	topics := encoder.Topics()
+	if cfg.EventBus.Publish.DeadLetter.Target == events.DeadLetterTopic {
+		topics = append(topics, cfg.EventBus.Publish.DeadLetter.Topic)
+	}
+	if cfg.Consumer.Enabled {
+		topics = append(topics, cfg.Consumer.DeadLetterTopic)
+	}
+	return topics
+}
+
+// checkKafka verifies that the brokers are reachable within the health
+// timeout and, when createTopics is set, creates the missing topics
+func checkKafka(cfg *config.Config, topics []string, createTopics bool) error {
+	admin, err := events.NewKafkaAdmin(cfg.EventBus.Kafka)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.EventBus.Kafka.HealthTimeout)
+	defer cancel()
+
+	if err := admin.Ping(ctx); err != nil {
+		return err
+	}
+	logger.Info("Kafka brokers reachable", zap.Strings("brokers", cfg.EventBus.Kafka.Brokers))
+
+	if !createTopics {
+		return nil
+	}
+
+	created, err := admin.EnsureTopics(ctx, topics)
+	if err != nil {
+		return err
+	}
+	logger.Info("Kafka topics provisioned",
+		zap.Strings("topics", topics),
+		zap.Strings("created", created),
+		zap.Int("partitions", cfg.EventBus.Kafka.Provisioning.Partitions),
+		zap.Int("replication_factor", cfg.EventBus.Kafka.Provisioning.ReplicationFactor),
+	)
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/cache"
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/consumer"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/stream"
+)
+
+// consume runs the inbound company consumer until SIGINT or SIGTERM. The
+// events it records are relayed by the outbox relay of the API server.
+func consume(cfg *config.Config) {
+	database, err := openDatabase(cfg)
+	if err != nil {
+		logger.Fatal("Failed to open database", zap.Error(err))
+	}
+	//nolint:errcheck // Shutdown errors are typically unrecoverable.
+	defer database.Close()
+
+	encoder, err := events.NewEncoder(cfg.EventEncoding)
+	if err != nil {
+		logger.Fatal("Failed to initialize event encoder", zap.Error(err))
+	}
+
+	// A shared Redis cache must not keep serving the companies consumed here.
+	// The in-process caches of the API servers cannot be reached from here.
+	var changes stream.Publisher
+	if cfg.Cache.Backend == "redis" {
+		store, err := newCacheStore(cfg)
+		if err != nil {
+			logger.Fatal("Failed to initialize company cache", zap.Error(err))
+		}
+		if closer, ok := store.(io.Closer); ok {
+			//nolint:errcheck // Shutdown errors are typically unrecoverable.
+			defer closer.Close()
+		}
+		cached := cache.NewCompanyRepository(db.NewCompanyRepository(database), store, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+		changes = cache.NewInvalidator(cached, nil)
+	}
+
+	stopConsumer, failed, err := startConsumer(cfg, database, encoder, changes)
+	if err != nil {
+		logger.Fatal("Failed to start consumer", zap.Error(err))
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-quit:
+	case err := <-failed:
+		// Exiting lets the supervisor restart the consumer once the dead-letter topic is back
+		stopConsumer(context.Background())
+		logger.Fatal("Consumer failed", zap.Error(err))
+	}
+	logger.Info("Shutting down consumer...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	stopConsumer(ctx)
+}
+
+// startConsumer checks the brokers and runs the inbound company consumer in
+// the background, handing the changes it commits to changes if not nil. The
+// returned function stops it, waiting until ctx is done; the channel receives
+// the error the consumer stopped on by itself.
+func startConsumer(
+	cfg *config.Config,
+	database *db.Database,
+	encoder *events.Encoder,
+	changes stream.Publisher,
+) (func(ctx context.Context), <-chan error, error) {
+	if err := checkKafka(cfg, []string{cfg.Consumer.DeadLetterTopic}, cfg.EventBus.Kafka.Provisioning.CreateTopics); err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := events.NewKafkaReader(cfg.EventBus.Kafka, cfg.Consumer.GroupID, cfg.Consumer.Topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	deadLetter, err := events.NewKafkaProducer(cfg.EventBus.Kafka)
+	if err != nil {
+		//nolint:errcheck // The reader has not been used yet.
+		reader.Close()
+		return nil, nil, err
+	}
+
+	c := consumer.NewConsumer(reader, consumer.NewProcessor(database, encoder, changes), deadLetter, cfg.Consumer)
+	runCtx, stopRun := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	failed := make(chan error, 1)
+	go func() {
+		defer close(done)
+		if err := c.Run(runCtx); err != nil {
+			logger.Error("Consumer stopped on an error", zap.Error(err))
+			failed <- err
+		}
+	}()
+
+	return func(ctx context.Context) {
+		stopRun()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			logger.Warn("Consumer did not stop before the shutdown deadline")
+		}
+		if err := c.Close(); err != nil {
+			logger.Error("Failed to close consumer", zap.Error(err))
+		}
+		if err := deadLetter.Close(); err != nil {
+			logger.Error("Failed to close consumer dead-letter producer", zap.Error(err))
+		}
+	}, failed, nil
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/logger"
+)
+
+// AdminHandler handles operational endpoints
+type AdminHandler struct {
+	outboxRepo *db.OutboxRepository
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(outboxRepo *db.OutboxRepository) *AdminHandler {
+	return &AdminHandler{outboxRepo: outboxRepo}
+}
+
+// OutboxStats godoc
+// @Summary Get outbox lag
+// @Description Get the number of events waiting in the outbox and how far behind the relay is
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} models.OutboxStats "Outbox lag"
+// @Failure 401 {string} string "Invalid admin API key"
+// @Failure 403 {string} string "Admin API is disabled"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Router /admin/outbox [get]
+func (h *AdminHandler) OutboxStats(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	stats, err := h.outboxRepo.Stats(r.Context(), time.Now().UTC())
+	if err != nil {
+		writeError(w, r, err, "Error reading outbox stats")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(stats); err != nil {
+		log.Error("Failed to encode response data",
+			zap.Error(err),
+		)
+	}
+}
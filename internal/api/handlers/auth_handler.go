@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -17,21 +19,30 @@ import (
 
 // AuthHandler handles authentication requests
 type AuthHandler struct {
-	userRepo   *db.UserRepository
-	jwtService *auth.JWTService
+	userRepo     db.UserRepositoryInterface
+	transactions *db.TransactionManager
+	jwtService   *auth.JWTService
 }
 
-// NewAuthHandler creates a new auth handler
-func NewAuthHandler(userRepo *db.UserRepository, jwtService *auth.JWTService) *AuthHandler {
+// NewAuthHandler creates a new auth handler. Logins read users through
+// userRepo, while registrations create the user and its organization in one
+// transaction of transactions.
+func NewAuthHandler(
+	userRepo db.UserRepositoryInterface,
+	transactions *db.TransactionManager,
+	jwtService *auth.JWTService,
+) *AuthHandler {
 	return &AuthHandler{
-		userRepo:   userRepo,
-		jwtService: jwtService,
+		userRepo:     userRepo,
+		transactions: transactions,
+		jwtService:   jwtService,
 	}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user and return a JWT token
+// @Description Register a new user and return a JWT token. The user gets a new organization named by
+// @Description organization (defaults to the user's name).
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -40,6 +51,7 @@ func NewAuthHandler(userRepo *db.UserRepository, jwtService *auth.JWTService) *A
 // @Failure 400 {string} string "Invalid request body or validation error"
 // @Failure 409 {string} string "Name or email already taken"
 // @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -55,16 +67,6 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exists, err := h.userRepo.ExistsByEmail(creds.Email)
-	if err != nil {
-		http.Error(w, "Error checking email", http.StatusInternalServerError)
-		return
-	}
-	if exists {
-		http.Error(w, "Email already registered", http.StatusConflict)
-		return
-	}
-
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 	if err != nil {
 		http.Error(w, "Error creating user", http.StatusInternalServerError)
@@ -81,13 +83,33 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt:    now,
 	}
 
-	if err := h.userRepo.Create(user); err != nil {
-		http.Error(w, "Error creating user", http.StatusInternalServerError)
+	// Registering never joins an existing organization, which would let anyone
+	// into a tenant. The new organization is only kept if its first user is
+	// created, and a taken name or email is reported by the unique indexes.
+	err = h.transactions.Do(ctx, func(ctx context.Context, repos *db.Repositories) error {
+		organizationName := creds.Organization
+		if organizationName == "" {
+			organizationName = creds.Name
+		}
+		organization := models.Organization{
+			ID:        uuid.New().String(),
+			Name:      organizationName,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := repos.Organizations.Create(ctx, &organization); err != nil {
+			return err
+		}
+		user.OrganizationID = organization.ID
+		return repos.Users.Create(ctx, user)
+	})
+	if err != nil {
+		writeError(w, r, err, "Error creating user")
 		return
 	}
 
 	// Generate token
-	token, err := h.jwtService.GenerateToken(user.ID)
+	token, err := h.jwtService.GenerateToken(user.ID, user.OrganizationID)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -114,6 +136,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // @Failure 400 {string} string "Invalid request body"
 // @Failure 401 {string} string "Invalid credentials"
 // @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -124,18 +147,22 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userRepo.GetByEmail(creds.Email)
-	if err != nil {
+	user, err := h.userRepo.GetByEmail(ctx, creds.Email)
+	if errors.Is(err, db.ErrUserNotFound) {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
+	if err != nil {
+		writeError(w, r, err, "Error loading user")
+		return
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(creds.Password)); err != nil {
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := h.jwtService.GenerateToken(user.ID)
+	token, err := h.jwtService.GenerateToken(user.ID, user.OrganizationID)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
@@ -0,0 +1,58 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/api/handlers"
+	"xm-exercise/internal/auth"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/pkg/models"
+)
+
+func TestRegister(t *testing.T) {
+	database := dbtest.NewSQLite(t)
+
+	jwtService := auth.NewJWTService("secret", time.Hour)
+	handler := handlers.NewAuthHandler(db.NewUserRepository(database), db.NewTransactionManager(database), jwtService)
+	register := func(body any) (int, string) {
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		rr := httptest.NewRecorder()
+		handler.Register(rr, httptest.NewRequest(http.MethodPost, "/auth/register", &buf))
+		if rr.Code != http.StatusOK {
+			return rr.Code, ""
+		}
+		var response models.TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+		claims, err := jwtService.ValidateToken(response.Token)
+		require.NoError(t, err)
+		return rr.Code, claims.OrganizationID
+	}
+
+	code, victimOrganizationID := register(map[string]string{
+		"name": "victim", "email": "victim@example.com", "password": "password123",
+	})
+	require.Equal(t, http.StatusOK, code)
+
+	code, organizationID := register(map[string]string{
+		"name": "intruder", "email": "intruder@example.com", "password": "password123",
+		"organization_id": victimOrganizationID,
+	})
+	require.Equal(t, http.StatusOK, code)
+	assert.NotEqual(t, victimOrganizationID, organizationID, "registering never joins an existing organization")
+
+	code, organizationID = register(map[string]string{
+		"name": "other", "email": "other@example.com", "password": "password123", "organization": "victim",
+	})
+	require.Equal(t, http.StatusOK, code, "organization names may repeat, so taking one reveals nothing")
+	assert.NotEqual(t, victimOrganizationID, organizationID)
+}
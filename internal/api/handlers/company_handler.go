@@ -3,15 +3,14 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
-	"time"
+	"strconv"
 
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"xm-exercise/internal/api/middleware"
 	"xm-exercise/internal/db"
-	"xm-exercise/internal/events"
 	"xm-exercise/internal/logger"
+	"xm-exercise/internal/service"
 	"xm-exercise/internal/utils"
 	"xm-exercise/pkg/models"
 )
@@ -19,17 +18,18 @@ import (
 // CompanyHandler handles company-related requests
 type CompanyHandler struct {
 	companyRepo db.CompanyRepositoryInterface
-	producer    events.KafkaProducerInterface
+	companies   *service.CompanyService
 }
 
-// NewCompanyHandler creates a new company handler
+// NewCompanyHandler creates a new company handler. Reads go through companyRepo,
+// while changes and their events go through transactor.
 func NewCompanyHandler(
 	companyRepo db.CompanyRepositoryInterface,
-	producer events.KafkaProducerInterface,
+	transactor service.Transactor,
 ) *CompanyHandler {
 	return &CompanyHandler{
 		companyRepo: companyRepo,
-		producer:    producer,
+		companies:   service.NewCompanyService(transactor),
 	}
 }
 
@@ -46,6 +46,7 @@ func NewCompanyHandler(
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 409 {string} string "Company name already exists"
 // @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
 // @Security Bearer
 // @Router /companies [post]
 func (h *CompanyHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -59,6 +60,13 @@ func (h *CompanyHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		log.Warn("Company creation attempt without organization", zap.String("created_by", userID))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var companyCreateReq models.CompanyCreateRequest
 	if err := json.NewDecoder(r.Body).Decode(&companyCreateReq); err != nil {
 		log.Error("Failed to decode request body", zap.Error(err))
@@ -66,63 +74,12 @@ func (h *CompanyHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := companyCreateReq.Validate(); err != nil {
-		log.Warn("Company validation failed",
-			zap.Error(err),
-			zap.String("company_name", companyCreateReq.Name),
-			zap.String("created_by", userID),
-		)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	now := time.Now().UTC()
-	company := models.Company{
-		ID:            uuid.New().String(),
-		Name:          companyCreateReq.Name,
-		Description:   companyCreateReq.Description,
-		EmployeeCount: companyCreateReq.EmployeeCount,
-		Registered:    companyCreateReq.Registered,
-		Type:          companyCreateReq.Type,
-		CreatedAt:     now,
-		UpdatedAt:     now,
-	}
-
-	exists, err := h.companyRepo.ExistsByName(company.Name)
+	company, err := h.companies.Create(ctx, organizationID, "", companyCreateReq)
 	if err != nil {
-		log.Error("Failed to check name for uniqueness", zap.Error(err), zap.String("name", company.Name))
-		http.Error(w, "Error checking name for uniqueness", http.StatusInternalServerError)
-		return
-	}
-
-	if exists {
-		log.Warn("Company name already exists", zap.String("name", company.Name))
-		http.Error(w, "Company name already exists", http.StatusConflict)
-		return
-	}
-
-	if err := h.companyRepo.Create(&company); err != nil {
-		log.Error("Failed to create company",
-			zap.Error(err),
-			zap.String("company_name", company.Name),
-			zap.String("created_by", userID),
-		)
-		http.Error(w, "Error creating company", http.StatusInternalServerError)
+		writeError(w, r, err, "Error creating company")
 		return
 	}
 
-	if err := h.producer.PublishCompanyCreated(company); err != nil {
-		log.Error("Failed to publish company created event",
-			zap.Error(err),
-			zap.String("company_name", company.Name),
-		)
-	} else {
-		log.Info("Company created event published",
-			zap.String("company_id", company.ID),
-			zap.String("company_name", company.Name),
-		)
-	}
-
 	log.Info("Company created",
 		zap.String("company_id", company.ID),
 		zap.String("company_name", company.Name),
@@ -141,24 +98,43 @@ func (h *CompanyHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 // Get godoc
 // @Summary Get a company by ID
-// @Description Get detailed information about a company by its ID
+// @Description Get detailed information about a company by its ID. Responses carry a strong
+// @Description ETag and a Last-Modified date, and conditional requests are answered with 304.
 // @Tags companies
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token" example:"Bearer {token}"
 // @Param id path string true "Company ID" format(uuid)
+// @Param If-None-Match header string false "Entity tag of the copy the client has"
+// @Param If-Modified-Since header string false "Last-Modified date of the copy the client has"
 // @Success 200 {object} models.CompanyResponse "Company found"
+// @Success 304 "Company not modified"
 // @Failure 400 {string} string "Invalid company ID"
+// @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Company not found"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
 // @Security Bearer
 // @Router /companies/{id} [get]
 func (h *CompanyHandler) Get(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	log := logger.WithContext(ctx)
+
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	id := utils.ExtractIDFromPath(r)
-	company, err := h.companyRepo.GetByID(id)
+	company, err := h.companyRepo.ForOrganization(organizationID).GetByID(ctx, id)
 	if err != nil {
-		http.Error(w, "Company not found", http.StatusNotFound)
+		writeError(w, r, err, "Error loading company")
+		return
+	}
+
+	tag := entityTag(company.ID, strconv.FormatInt(company.UpdatedAt.UnixNano(), 10))
+	if notModified(w, r, tag, company.UpdatedAt) {
 		return
 	}
 
@@ -184,6 +160,7 @@ func (h *CompanyHandler) Get(w http.ResponseWriter, r *http.Request) {
 // @Failure 404 {string} string "Company not found"
 // @Failure 409 {string} string "Company name already exists"
 // @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
 // @Security Bearer
 // @Router /companies/{id} [patch]
 func (h *CompanyHandler) Patch(w http.ResponseWriter, r *http.Request) {
@@ -196,74 +173,47 @@ func (h *CompanyHandler) Patch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := utils.ExtractIDFromPath(r)
-	existingCompany, err := h.companyRepo.GetByID(id)
-	if err != nil {
-		http.Error(w, "Company not found", http.StatusNotFound)
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	id := utils.ExtractIDFromPath(r)
+
 	var updates models.CompanyUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if err := updates.Validate(); err != nil {
-		log.Warn("Company update validation failed",
-			zap.Error(err),
-		)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
 
-	if updates.Name != nil && *updates.Name != existingCompany.Name {
-		exists, err := h.companyRepo.ExistsByName(*updates.Name)
-		if err != nil {
-			http.Error(w, "Error checking name uniqueness", http.StatusInternalServerError)
-			return
-		}
-		if exists {
-			http.Error(w, "Company name already exists", http.StatusConflict)
-			return
-		}
+	company, changed, err := h.companies.Update(ctx, organizationID, id, updates)
+	if err != nil {
+		writeError(w, r, err, "Error updating company")
+		return
 	}
 
-	if updates.Name != nil {
-		existingCompany.Name = *updates.Name
-	}
-	if updates.Description != nil {
-		existingCompany.Description = updates.Description
-	}
-	if updates.EmployeeCount != nil {
-		existingCompany.EmployeeCount = *updates.EmployeeCount
-	}
-	if updates.Registered != nil {
-		existingCompany.Registered = updates.Registered
-	}
-	if updates.Type != "" {
-		existingCompany.Type = updates.Type
-	}
-	existingCompany.UpdatedAt = time.Now().UTC()
+	if !changed {
+		log.Info("Company unchanged, nothing to update",
+			zap.String("company_id", company.ID),
+		)
 
-	if err := h.companyRepo.Update(existingCompany); err != nil {
-		http.Error(w, "Error updating company", http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(company.ToResponse()); err != nil {
+			log.Error("Failed to encode response data",
+				zap.Error(err),
+			)
+		}
 		return
 	}
 
-	if err := h.producer.PublishCompanyUpdated(existingCompany); err != nil {
-		log.Error("Failed to publish company updated event",
-			zap.Error(err),
-			zap.String("company_name", existingCompany.Name),
-		)
-	} else {
-		log.Info("Company updated event published",
-			zap.String("company_id", existingCompany.ID),
-			zap.String("company_name", existingCompany.Name),
-		)
-	}
+	log.Info("Company updated",
+		zap.String("company_id", company.ID),
+		zap.String("company_name", company.Name),
+	)
 
 	w.Header().Set("Content-Type", "application/json")
-	if err = json.NewEncoder(w).Encode(existingCompany.ToResponse()); err != nil {
+	if err = json.NewEncoder(w).Encode(company.ToResponse()); err != nil {
 		log.Error("Failed to encode response data",
 			zap.Error(err),
 		)
@@ -282,6 +232,7 @@ func (h *CompanyHandler) Patch(w http.ResponseWriter, r *http.Request) {
 // @Failure 401 {string} string "Unauthorized"
 // @Failure 404 {string} string "Company not found"
 // @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
 // @Security Bearer
 // @Router /companies/{id} [delete]
 func (h *CompanyHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -293,33 +244,27 @@ func (h *CompanyHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	id := utils.ExtractIDFromPath(r)
-
-	existingCompany, err := h.companyRepo.GetByID(id)
-	if err != nil {
-		http.Error(w, "Company not found", http.StatusNotFound)
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	if err := h.companyRepo.Delete(id); err != nil {
-		http.Error(w, "Error deleting company", http.StatusInternalServerError)
+	id := utils.ExtractIDFromPath(r)
+
+	company, err := h.companies.Delete(ctx, organizationID, id)
+	if err != nil {
+		writeError(w, r, err, "Error deleting company")
 		return
 	}
 
-	if err := h.producer.PublishCompanyDeleted(id); err != nil {
-		log.Error("Failed to publish company deleted event",
-			zap.Error(err),
-			zap.String("company_name", existingCompany.Name),
-		)
-	} else {
-		log.Info("Company deleted event published",
-			zap.String("company_id", existingCompany.ID),
-			zap.String("company_name", existingCompany.Name),
-		)
-	}
+	log.Info("Company deleted",
+		zap.String("company_id", company.ID),
+		zap.String("company_name", company.Name),
+	)
 
 	w.Header().Set("Content-Type", "application/json")
-	if err = json.NewEncoder(w).Encode(existingCompany.ToResponse()); err != nil {
+	if err = json.NewEncoder(w).Encode(company.ToResponse()); err != nil {
 		log.Error("Failed to encode response data",
 			zap.Error(err),
 		)
@@ -2,8 +2,10 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -13,10 +15,12 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 
 	"xm-exercise/internal/api/handlers"
-	"xm-exercise/internal/api/middleware"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/memory"
 	"xm-exercise/internal/logger"
 	"xm-exercise/pkg/models"
 )
@@ -25,7 +29,7 @@ import (
 func newTestCompanyHandler() (*handlers.CompanyHandler, *MockCompanyRepository, *MockKafkaProducer) {
 	mockRepo := new(MockCompanyRepository)
 	mockProducer := new(MockKafkaProducer)
-	handler := handlers.NewCompanyHandler(mockRepo, mockProducer)
+	handler := handlers.NewCompanyHandler(mockRepo, passthroughTransactor{mockRepo, mockProducer})
 	return handler, mockRepo, mockProducer
 }
 
@@ -44,12 +48,11 @@ func TestCompanyHandler_Create(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(companyCreateReq)
 
-		mockRepo.On("ExistsByName", companyCreateReq.Name).Return(false, nil).Once()
 		mockRepo.On("Create", mock.AnythingOfType("*models.Company")).Return(nil).Once()
 		mockProducer.On("PublishCompanyCreated", mock.AnythingOfType("models.Company")).Return(nil).Once()
 
 		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 		handler.Create(rr, req)
 
@@ -78,7 +81,7 @@ func TestCompanyHandler_Create(t *testing.T) {
 
 		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
 		// Correctly add a mock user ID (as uuid.UUID) to the context for authentication
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Create(rr, req)
@@ -100,12 +103,11 @@ func TestCompanyHandler_Create(t *testing.T) {
 		jsonBody, _ := json.Marshal(companyCreateReq)
 
 		// No repository or producer methods should be called due to validation error
-		mockRepo.AssertNotCalled(t, "ExistsByName", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Create", mock.Anything)
 
 		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
 		// Correctly add a mock user ID (as uuid.UUID) to the context for authentication
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Create(rr, req)
@@ -126,16 +128,16 @@ func TestCompanyHandler_Create(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(companyCreateReq)
 
-		// Expectation: Check if company name exists (should return true)
-		mockRepo.On("ExistsByName", companyCreateReq.Name).Return(true, nil).Once()
-		// No create or publish methods should be called
-		mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+		// Expectation: The unique index rejects the name
+		mockRepo.On("Create", mock.AnythingOfType("*models.Company")).
+			Return(fmt.Errorf("%w: UNIQUE constraint failed", db.ErrCompanyNameExists)).Once()
+		// No update or publish methods should be called
 		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Delete", mock.Anything)
 
 		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
 		// Correctly add a mock user ID (as uuid.UUID) to the context for authentication
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Create(rr, req)
@@ -146,7 +148,7 @@ func TestCompanyHandler_Create(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 
-	t.Run("Repository Error on ExistsByName", func(t *testing.T) {
+	t.Run("Database Unavailable on Create", func(t *testing.T) {
 		handler, mockRepo, _ := newTestCompanyHandler()
 
 		companyCreateReq := models.CompanyCreateRequest{
@@ -158,22 +160,22 @@ func TestCompanyHandler_Create(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(companyCreateReq)
 
-		// Expectation: Error when checking if company name exists
-		mockRepo.On("ExistsByName", companyCreateReq.Name).Return(false, errors.New("database error")).Once()
-		// No create or publish methods should be called
-		mockRepo.AssertNotCalled(t, "Create", mock.Anything)
+		// Expectation: The database cannot be reached
+		mockRepo.On("Create", mock.AnythingOfType("*models.Company")).
+			Return(fmt.Errorf("%w: connection refused", db.ErrUnavailable)).Once()
+		// No update or publish methods should be called
 		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Delete", mock.Anything)
 
 		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
 		// Correctly add a mock user ID (as uuid.UUID) to the context for authentication
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Create(rr, req)
 
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Error checking name for uniqueness")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Service unavailable")
 
 		mockRepo.AssertExpectations(t)
 	})
@@ -190,15 +192,42 @@ func TestCompanyHandler_Create(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(companyCreateReq)
 
-		// Expectation: Check if company name exists (should return false)
-		mockRepo.On("ExistsByName", companyCreateReq.Name).Return(false, nil).Once()
 		// Expectation: Error when creating the company
 		mockRepo.On("Create", mock.AnythingOfType("*models.Company")).Return(errors.New("database error")).Once()
 		// No publish method should be called
 		mockProducer.AssertNotCalled(t, "PublishCompanyCreated", mock.Anything)
 
 		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
+		rr := httptest.NewRecorder()
+
+		handler.Create(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Error creating company")
+
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("Event Recording Error", func(t *testing.T) {
+		handler, mockRepo, mockProducer := newTestCompanyHandler()
+
+		companyCreateReq := models.CompanyCreateRequest{
+			Name:          "Test Company",
+			Description:   aws.String("A company for testing"),
+			EmployeeCount: 100,
+			Registered:    aws.Bool(true),
+			Type:          "Corporations",
+		}
+		jsonBody, _ := json.Marshal(companyCreateReq)
+
+		mockRepo.On("Create", mock.AnythingOfType("*models.Company")).Return(nil).Once()
+		// The event is written in the same transaction, so failing to record it fails the request
+		mockProducer.On("PublishCompanyCreated", mock.AnythingOfType("models.Company")).
+			Return(errors.New("outbox error")).Once()
+
+		req, _ := http.NewRequest("POST", "/companies", bytes.NewBuffer(jsonBody))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Create(rr, req)
@@ -207,6 +236,7 @@ func TestCompanyHandler_Create(t *testing.T) {
 		assert.Contains(t, rr.Body.String(), "Error creating company")
 
 		mockRepo.AssertExpectations(t)
+		mockProducer.AssertExpectations(t)
 	})
 
 	t.Run("Unauthorized Access", func(t *testing.T) {
@@ -222,7 +252,6 @@ func TestCompanyHandler_Create(t *testing.T) {
 		jsonBody, _ := json.Marshal(companyCreateReq)
 
 		// No repository or producer methods should be called if unauthorized
-		mockRepo.AssertNotCalled(t, "ExistsByName", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Create", mock.Anything)
 		mockProducer.AssertNotCalled(t, "PublishCompanyCreated", mock.Anything)
 
@@ -254,6 +283,7 @@ func TestCompanyHandler_Get(t *testing.T) {
 		mockRepo.On("GetByID", companyID).Return(expectedCompany, nil).Once()
 
 		req, _ := http.NewRequest("GET", "/companies/"+companyID, nil)
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 		handler.Get(rr, req)
 
@@ -271,13 +301,65 @@ func TestCompanyHandler_Get(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 
+	t.Run("Conditional Get", func(t *testing.T) {
+		handler, mockRepo, _ := newTestCompanyHandler()
+
+		companyID := uuid.New().String()
+		updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+		company := &models.Company{ID: companyID, Name: "Test Company", UpdatedAt: updatedAt}
+		mockRepo.On("GetByID", companyID).Return(company, nil)
+
+		get := func(header, value string) *httptest.ResponseRecorder {
+			req, _ := http.NewRequest("GET", "/companies/"+companyID, nil)
+			req = req.WithContext(authenticatedContext(req.Context()))
+			if header != "" {
+				req.Header.Set(header, value)
+			}
+			rr := httptest.NewRecorder()
+			handler.Get(rr, req)
+			return rr
+		}
+
+		rr := get("", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		etag := rr.Header().Get("ETag")
+		assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag, "a strong entity tag")
+		assert.Equal(t, "Tue, 02 Jan 2024 03:04:05 GMT", rr.Header().Get("Last-Modified"))
+
+		for _, tt := range []struct {
+			header, value string
+			status        int
+		}{
+			{"If-None-Match", etag, http.StatusNotModified},
+			{"If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+			{"If-None-Match", "*", http.StatusNotModified},
+			{"If-None-Match", `"other"`, http.StatusOK},
+			{"If-Modified-Since", "Tue, 02 Jan 2024 03:04:05 GMT", http.StatusNotModified},
+			{"If-Modified-Since", "Tue, 02 Jan 2024 03:04:04 GMT", http.StatusOK},
+			{"If-Modified-Since", "yesterday", http.StatusOK},
+		} {
+			rr := get(tt.header, tt.value)
+			assert.Equal(t, tt.status, rr.Code, tt.header+": "+tt.value)
+			assert.Equal(t, etag, rr.Header().Get("ETag"))
+			if tt.status == http.StatusNotModified {
+				assert.Empty(t, rr.Body.String())
+			}
+		}
+
+		company.UpdatedAt = updatedAt.Add(time.Millisecond)
+		rr = get("If-None-Match", etag)
+		assert.Equal(t, http.StatusOK, rr.Code, "an update changes the entity tag")
+		assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+	})
+
 	t.Run("Company Not Found", func(t *testing.T) {
 		handler, mockRepo, _ := newTestCompanyHandler()
 
 		companyID := uuid.New().String()
-		mockRepo.On("GetByID", companyID).Return(&models.Company{}, errors.New("company not found")).Once()
+		mockRepo.On("GetByID", companyID).Return(&models.Company{}, db.ErrCompanyNotFound).Once()
 
 		req, _ := http.NewRequest("GET", "/companies/"+companyID, nil)
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Get(rr, req)
@@ -287,6 +369,42 @@ func TestCompanyHandler_Get(t *testing.T) {
 
 		mockRepo.AssertExpectations(t)
 	})
+
+	t.Run("Request Ended", func(t *testing.T) {
+		for err, status := range map[error]int{
+			context.Canceled:         handlers.StatusClientClosedRequest,
+			context.DeadlineExceeded: http.StatusGatewayTimeout,
+		} {
+			handler, mockRepo, _ := newTestCompanyHandler()
+
+			companyID := uuid.New().String()
+			mockRepo.On("GetByID", companyID).Return(&models.Company{}, fmt.Errorf("query: %w", err)).Once()
+
+			req, _ := http.NewRequest("GET", "/companies/"+companyID, nil)
+			req = req.WithContext(authenticatedContext(req.Context()))
+			rr := httptest.NewRecorder()
+
+			handler.Get(rr, req)
+
+			assert.Equal(t, status, rr.Code, err)
+			mockRepo.AssertExpectations(t)
+		}
+	})
+
+	t.Run("Get Without Organization", func(t *testing.T) {
+		handler, mockRepo, _ := newTestCompanyHandler()
+
+		companyID := uuid.New().String()
+		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+
+		req, _ := http.NewRequest("GET", "/companies/"+companyID, nil)
+		rr := httptest.NewRecorder()
+
+		handler.Get(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Unauthorized")
+	})
 }
 
 func TestCompanyHandler_Patch(t *testing.T) {
@@ -315,13 +433,21 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		}
 
 		jsonBody, _ := json.Marshal(updates)
-		mockRepo.On("GetByID", companyID).Return(existingCompany, nil).Once()
-		mockRepo.On("ExistsByName", newName).Return(false, nil).Once()
-		mockRepo.On("Update", mock.AnythingOfType("*models.Company")).Return(nil).Once()
-		mockProducer.On("PublishCompanyUpdated", mock.AnythingOfType("*models.Company")).Return(nil).Once()
+		mockRepo.On("GetForUpdate", companyID).Return(existingCompany, nil).Once()
+		// Only the changed fields are written, leaving the others to concurrent updates
+		mockRepo.On("Update", mock.MatchedBy(func(update *models.Company) bool {
+			return update.ID == companyID && update.Name == newName && update.EmployeeCount == updatedEmployeeCount &&
+				update.Description == nil && update.Registered == nil && update.Type == ""
+		})).Return(nil).Once()
+		mockProducer.On("PublishCompanyUpdated",
+			mock.MatchedBy(func(before *models.Company) bool { return before.Name == "OName" }),
+			mock.MatchedBy(func(after *models.Company) bool {
+				return after.Name == newName && after.EmployeeCount == updatedEmployeeCount
+			}),
+		).Return(nil).Once()
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
@@ -338,15 +464,55 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		mockProducer.AssertExpectations(t)
 	})
 
+	t.Run("Patch Without Changes", func(t *testing.T) {
+		handler, mockRepo, mockProducer := newTestCompanyHandler()
+
+		companyID := uuid.New().String()
+		updatedAt := time.Now().UTC().Add(-time.Hour)
+		existingCompany := &models.Company{
+			ID:            companyID,
+			Name:          "OName",
+			Description:   aws.String("Original Description"),
+			EmployeeCount: 50,
+			Registered:    aws.Bool(false),
+			Type:          models.TypeSoleProprietor,
+			CreatedAt:     updatedAt,
+			UpdatedAt:     updatedAt,
+		}
+
+		sameName := "OName"
+		jsonBody, _ := json.Marshal(models.CompanyUpdateRequest{
+			Name:        &sameName,
+			Description: aws.String("Original Description"),
+			Registered:  aws.Bool(false),
+		})
+		mockRepo.On("GetForUpdate", companyID).Return(existingCompany, nil).Once()
+
+		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
+		req = req.WithContext(authenticatedContext(req.Context()))
+		rr := httptest.NewRecorder()
+
+		handler.Patch(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var companyRes models.CompanyResponse
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&companyRes))
+		assert.True(t, updatedAt.Equal(companyRes.UpdatedAt))
+
+		mockRepo.AssertExpectations(t)
+		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+		mockProducer.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything, mock.Anything)
+	})
+
 	t.Run("Patch with Invalid Request Body", func(t *testing.T) {
 		handler, mockRepo, _ := newTestCompanyHandler()
 		companyID := uuid.New().String()
 		jsonBody := []byte(`{"name": "Test Company", "invalid_field": true`)
 
-		mockRepo.On("GetByID", companyID).Return(&models.Company{}, nil).Once()
+		mockRepo.AssertNotCalled(t, "GetForUpdate", mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
@@ -359,29 +525,18 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		handler, mockRepo, _ := newTestCompanyHandler()
 
 		companyID := uuid.New().String()
-		existingCompany := &models.Company{
-			ID:            companyID,
-			Name:          "Original Name",
-			Description:   aws.String("Original Description"),
-			EmployeeCount: 50,
-			Registered:    aws.Bool(false),
-			Type:          models.TypeSoleProprietor,
-			CreatedAt:     time.Now().UTC().Add(-time.Hour),
-			UpdatedAt:     time.Now().UTC().Add(-time.Hour),
-		}
 		longName := "This name is way too long for the 15 character limit"
 		updates := models.CompanyUpdateRequest{
 			Name: &longName,
 		}
 		jsonBody, _ := json.Marshal(updates)
 
-		mockRepo.On("GetByID", companyID).Return(existingCompany, nil).Once()
-		mockRepo.AssertNotCalled(t, "ExistsByName", mock.Anything)
+		mockRepo.AssertNotCalled(t, "GetForUpdate", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
 		mockRepo.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
@@ -402,13 +557,12 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(updates)
 
-		mockRepo.On("GetByID", companyID).Return(&models.Company{}, errors.New("company not found")).Once()
-		mockRepo.AssertNotCalled(t, "ExistsByName", mock.Anything)
+		mockRepo.On("GetForUpdate", companyID).Return(&models.Company{}, db.ErrCompanyNotFound).Once()
 		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
 		mockRepo.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
@@ -439,13 +593,13 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(updates)
 
-		mockRepo.On("GetByID", companyID).Return(existingCompany, nil).Once()
-		mockRepo.On("ExistsByName", duplicateName).Return(true, nil).Once()
-		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+		mockRepo.On("GetForUpdate", companyID).Return(existingCompany, nil).Once()
+		mockRepo.On("Update", mock.AnythingOfType("*models.Company")).
+			Return(fmt.Errorf("%w: UNIQUE constraint failed", db.ErrCompanyNameExists)).Once()
 		mockRepo.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
@@ -456,34 +610,33 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		mockRepo.AssertExpectations(t)
 	})
 
-	t.Run("Patch Repository Error on GetByID", func(t *testing.T) {
+	t.Run("Patch Repository Error on GetForUpdate", func(t *testing.T) {
 		handler, mockRepo, _ := newTestCompanyHandler()
 
 		companyID := uuid.New().String()
-		newName := "Updated Company Name"
+		newName := "Updated Name"
 		updates := models.CompanyUpdateRequest{
 			Name: &newName,
 		}
 		jsonBody, _ := json.Marshal(updates)
 
-		mockRepo.On("GetByID", companyID).Return(&models.Company{}, errors.New("database error")).Once()
-		mockRepo.AssertNotCalled(t, "ExistsByName", mock.Anything)
+		mockRepo.On("GetForUpdate", companyID).Return(&models.Company{}, errors.New("database error")).Once()
 		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
 		mockRepo.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
 
-		assert.Equal(t, http.StatusNotFound, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Company not found")
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Error updating company")
 
 		mockRepo.AssertExpectations(t)
 	})
 
-	t.Run("Patch Repository Error on ExistsByName", func(t *testing.T) {
+	t.Run("Patch Database Unavailable on Update", func(t *testing.T) {
 		handler, mockRepo, _ := newTestCompanyHandler()
 
 		companyID := uuid.New().String()
@@ -502,19 +655,19 @@ func TestCompanyHandler_Patch(t *testing.T) {
 			Name: &newName,
 		}
 		jsonBody, _ := json.Marshal(updates)
-		mockRepo.On("GetByID", companyID).Return(existingCompany, nil).Once()
-		mockRepo.On("ExistsByName", newName).Return(false, errors.New("database error")).Once()
-		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
+		mockRepo.On("GetForUpdate", companyID).Return(existingCompany, nil).Once()
+		mockRepo.On("Update", mock.AnythingOfType("*models.Company")).
+			Return(fmt.Errorf("%w: connection refused", db.ErrUnavailable)).Once()
 		mockRepo.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Patch(rr, req)
 
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Error checking name uniqueness")
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Service unavailable")
 
 		mockRepo.AssertExpectations(t)
 	})
@@ -529,10 +682,9 @@ func TestCompanyHandler_Patch(t *testing.T) {
 		}
 		jsonBody, _ := json.Marshal(updates)
 
-		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything)
-		mockRepo.AssertNotCalled(t, "ExistsByName", mock.Anything)
+		mockRepo.AssertNotCalled(t, "GetForUpdate", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Update", mock.Anything)
-		mockProducer.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything)
+		mockProducer.AssertNotCalled(t, "PublishCompanyUpdated", mock.Anything, mock.Anything)
 
 		req, _ := http.NewRequest("PATCH", "/companies/"+companyID, bytes.NewBuffer(jsonBody))
 		rr := httptest.NewRecorder()
@@ -553,12 +705,14 @@ func TestCompanyHandler_Delete(t *testing.T) {
 
 		companyID := uuid.New().String()
 
-		mockRepo.On("GetByID", companyID).Return(&models.Company{}, nil).Once()
+		existingCompany := &models.Company{ID: companyID, Name: "Acme"}
+
+		mockRepo.On("GetForUpdate", companyID).Return(existingCompany, nil).Once()
 		mockRepo.On("Delete", companyID).Return(nil).Once()
-		mockProducer.On("PublishCompanyDeleted", companyID).Return(nil).Once()
+		mockProducer.On("PublishCompanyDeleted", existingCompany).Return(nil).Once()
 
 		req, _ := http.NewRequest("DELETE", "/companies/"+companyID, nil)
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Delete(rr, req)
@@ -574,9 +728,9 @@ func TestCompanyHandler_Delete(t *testing.T) {
 
 		companyID := uuid.New().String()
 
-		mockRepo.On("GetByID", companyID).Return(&models.Company{}, errors.New("company not found")).Once()
+		mockRepo.On("GetForUpdate", companyID).Return(&models.Company{}, db.ErrCompanyNotFound).Once()
 		req, _ := http.NewRequest("DELETE", "/companies/"+companyID, nil)
-		req = req.WithContext(middleware.SetUserID(req.Context(), uuid.New().String()))
+		req = req.WithContext(authenticatedContext(req.Context()))
 		rr := httptest.NewRecorder()
 
 		handler.Delete(rr, req)
@@ -593,7 +747,7 @@ func TestCompanyHandler_Delete(t *testing.T) {
 
 		companyID := uuid.New().String()
 
-		mockRepo.AssertNotCalled(t, "GetByID", mock.Anything)
+		mockRepo.AssertNotCalled(t, "GetForUpdate", mock.Anything)
 		mockRepo.AssertNotCalled(t, "Delete", mock.Anything)
 		mockProducer.AssertNotCalled(t, "PublishCompanyDeleted", mock.Anything)
 
@@ -606,3 +760,53 @@ func TestCompanyHandler_Delete(t *testing.T) {
 		assert.Contains(t, rr.Body.String(), "Unauthorized")
 	})
 }
+
+func TestCompanyHandler_InMemory(t *testing.T) {
+	err := logger.Init(zap.WarnLevel.String(), false)
+	assert.NoError(t, err)
+
+	companyRepo := memory.NewCompanyRepository()
+	mockProducer := new(MockKafkaProducer)
+	mockProducer.On("PublishCompanyCreated", mock.Anything).Return(nil)
+	mockProducer.On("PublishCompanyUpdated", mock.Anything, mock.Anything).Return(nil)
+	mockProducer.On("PublishCompanyDeleted", mock.Anything).Return(nil)
+	handler := handlers.NewCompanyHandler(companyRepo, passthroughTransactor{companyRepo, mockProducer})
+
+	ctx := authenticatedContext(context.Background())
+	request := func(handle http.HandlerFunc, method, path string, body any) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(body)
+		req, _ := http.NewRequestWithContext(ctx, method, path, bytes.NewBuffer(jsonBody))
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+	createReq := models.CompanyCreateRequest{
+		Name:          "Acme",
+		EmployeeCount: 100,
+		Registered:    aws.Bool(true),
+		Type:          models.TypeCorporation,
+	}
+
+	rr := request(handler.Create, "POST", "/companies", createReq)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created models.CompanyResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+
+	rr = request(handler.Create, "POST", "/companies", createReq)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Company name already exists")
+
+	rr = request(handler.Patch, "PATCH", "/companies/"+created.ID, models.CompanyUpdateRequest{Name: aws.String("Globex")})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = request(handler.Get, "GET", "/companies/"+created.ID, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"name":"Globex"`)
+
+	rr = request(handler.Delete, "DELETE", "/companies/"+created.ID, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = request(handler.Get, "GET", "/companies/"+created.ID, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	mockProducer.AssertNumberOfCalls(t, "PublishCompanyCreated", 1)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// entityTag returns a strong entity tag identifying the representation built from parts
+func entityTag(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
+
+// notModified sets the validators of a representation on w: its entity tag and,
+// unless zero, when it last changed. When the request's preconditions show the
+// client already has the representation it answers 304 Not Modified and
+// returns true, and the caller must not write a body.
+func notModified(w http.ResponseWriter, r *http.Request, tag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", tag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if !isFresh(r, tag, lastModified) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// isFresh evaluates If-None-Match or, when the request has none, If-Modified-Since
+func isFresh(r *http.Request, tag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		for _, candidate := range strings.Split(strings.Join(values, ","), ",") {
+			// If-None-Match uses the weak comparison
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == tag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || lastModified.IsZero() {
+		return false
+	}
+	// Last-Modified only has a precision of a second
+	return !lastModified.Truncate(time.Second).After(since)
+}
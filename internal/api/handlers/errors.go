@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/service"
+)
+
+// StatusClientClosedRequest is the non-standard status, borrowed from nginx,
+// recorded for requests the client abandoned before they were answered
+const StatusClientClosedRequest = 499
+
+// writeContextError writes the response for err if it reports the end of the
+// request context, and returns whether it did. A client that went away gets
+// 499, and a request that ran out of time or hit the query timeout gets 504.
+func writeContextError(w http.ResponseWriter, r *http.Request, err error) bool {
+	status := http.StatusGatewayTimeout
+	message := "Request timed out"
+	switch {
+	case errors.Is(err, context.Canceled):
+		status = StatusClientClosedRequest
+		message = "Client closed request"
+	case !errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+
+	logger.WithContext(r.Context()).Warn("Request ended before completion",
+		zap.Error(err),
+		zap.Int("status", status),
+	)
+	http.Error(w, message, status)
+	return true
+}
+
+// writeError writes the response for err, mapping the typed errors of the
+// service and repositories to their statuses. Validation errors get 400, missing
+// rows 404, clashing rows 409, and an unreachable database or a transaction that
+// kept failing to serialize 503; any other error is logged and answered with 500
+// and message.
+func writeError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if writeContextError(w, r, err) {
+		return
+	}
+
+	var validationErr *service.ValidationError
+	var dbErr *db.Error
+	switch {
+	case errors.As(err, &validationErr):
+		http.Error(w, validationErr.Error(), http.StatusBadRequest)
+	case errors.As(err, &dbErr):
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(dbErr, db.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(dbErr, db.ErrConflict):
+			status = http.StatusConflict
+		}
+		http.Error(w, capitalize(dbErr.Error()), status)
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrConflict):
+		http.Error(w, "Conflict", http.StatusConflict)
+	case errors.Is(err, db.ErrUnavailable), errors.Is(err, db.ErrSerialization):
+		logger.WithContext(r.Context()).Error("Database unavailable", zap.Error(err))
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+	default:
+		logger.WithContext(r.Context()).Error(message, zap.Error(err))
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// capitalize upper-cases the first letter of an error message for a response
+func capitalize(message string) string {
+	if message == "" {
+		return message
+	}
+	return strings.ToUpper(message[:1]) + message[1:]
+}
@@ -1,57 +1,86 @@
 package handlers_test
 
 import (
+	"context"
+
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/mock"
 
+	"xm-exercise/internal/api/middleware"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
 	"xm-exercise/pkg/models"
 )
 
+// passthroughTransactor hands the given repository and producer to the callback without a transaction
+type passthroughTransactor struct {
+	companyRepo db.CompanyRepositoryInterface
+	producer    events.KafkaProducerInterface
+}
+
+func (t passthroughTransactor) WithinTransaction(
+	_ context.Context,
+	fn func(companyRepo db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error,
+) error {
+	return fn(t.companyRepo, t.producer)
+}
+
+// authenticatedContext returns ctx carrying a random user and organization, as set by the auth middleware
+func authenticatedContext(ctx context.Context) context.Context {
+	ctx = middleware.SetUserID(ctx, uuid.New().String())
+	return middleware.SetOrganizationID(ctx, uuid.New().String())
+}
+
 // MockCompanyRepository is a mock implementation of db.CompanyRepository
 type MockCompanyRepository struct {
 	mock.Mock
 }
 
-func (m *MockCompanyRepository) Create(company *models.Company) error {
+func (m *MockCompanyRepository) ForOrganization(_ string) db.CompanyRepositoryInterface {
+	return m
+}
+
+func (m *MockCompanyRepository) Create(_ context.Context, company *models.Company) error {
 	args := m.Called(company)
 	return args.Error(0)
 }
 
-func (m *MockCompanyRepository) GetByID(id string) (*models.Company, error) {
+func (m *MockCompanyRepository) GetByID(_ context.Context, id string) (*models.Company, error) {
 	args := m.Called(id)
 	return args.Get(0).(*models.Company), args.Error(1)
 }
 
-func (m *MockCompanyRepository) Update(company *models.Company) error {
+func (m *MockCompanyRepository) GetForUpdate(_ context.Context, id string) (*models.Company, error) {
+	args := m.Called(id)
+	return args.Get(0).(*models.Company), args.Error(1)
+}
+
+func (m *MockCompanyRepository) Update(_ context.Context, company *models.Company) error {
 	args := m.Called(company)
 	return args.Error(0)
 }
 
-func (m *MockCompanyRepository) Delete(id string) error {
+func (m *MockCompanyRepository) Delete(_ context.Context, id string) error {
 	args := m.Called(id)
 	return args.Error(0)
 }
 
-func (m *MockCompanyRepository) ExistsByName(name string) (bool, error) {
-	args := m.Called(name)
-	return args.Bool(0), args.Error(1)
-}
-
 // MockKafkaProducer is a mock implementation of events.KafkaProducer
 type MockKafkaProducer struct {
 	mock.Mock
 }
 
-func (m *MockKafkaProducer) PublishCompanyUpdated(company *models.Company) error {
-	args := m.Called(company)
+func (m *MockKafkaProducer) PublishCompanyUpdated(_ context.Context, before, after *models.Company) error {
+	args := m.Called(before, after)
 	return args.Error(0)
 }
 
-func (m *MockKafkaProducer) PublishCompanyDeleted(companyID string) error {
-	args := m.Called(companyID)
+func (m *MockKafkaProducer) PublishCompanyDeleted(_ context.Context, company *models.Company) error {
+	args := m.Called(company)
 	return args.Error(0)
 }
 
-func (m *MockKafkaProducer) PublishCompanyCreated(company models.Company) error {
+func (m *MockKafkaProducer) PublishCompanyCreated(_ context.Context, company models.Company) error {
 	args := m.Called(company)
 	return args.Error(0)
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+// Readiness and check statuses
+const (
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusUp       = "up"
+	StatusDown     = "down"
+)
+
+// HealthCheck checks that a dependency is reachable
+type HealthCheck func(ctx context.Context) error
+
+// PoolStatsFunc returns the statistics of a connection pool
+type PoolStatsFunc func() (models.PoolStats, error)
+
+// HealthHandler reports whether the service's dependencies are reachable
+type HealthHandler struct {
+	checks  map[string]HealthCheck
+	pools   map[string]PoolStatsFunc
+	timeout time.Duration
+}
+
+// NewHealthHandler creates a health handler running checks, by dependency
+// name, each bounded by timeout
+func NewHealthHandler(checks map[string]HealthCheck, timeout time.Duration) *HealthHandler {
+	return &HealthHandler{checks: checks, pools: make(map[string]PoolStatsFunc), timeout: timeout}
+}
+
+// ReportPool adds the statistics of stats to the result of the named check
+func (h *HealthHandler) ReportPool(name string, stats PoolStatsFunc) *HealthHandler {
+	h.pools[name] = stats
+	return h
+}
+
+// Ready runs every check and responds 200 when all pass and 503 otherwise.
+// It is served without authentication, so it only tells the status; the
+// failures are logged and the results of the checks are left to Details.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	readiness := h.check(r.Context())
+	h.write(w, r, models.Readiness{Status: readiness.Status})
+}
+
+// Details godoc
+// @Summary Get dependency health
+// @Description Run the readiness checks and report each one's error and connection pool statistics
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} models.Readiness "Every check passed"
+// @Failure 401 {string} string "Invalid admin API key"
+// @Failure 403 {string} string "Admin API is disabled"
+// @Failure 503 {object} models.Readiness "A check failed"
+// @Router /admin/health [get]
+func (h *HealthHandler) Details(w http.ResponseWriter, r *http.Request) {
+	h.write(w, r, h.check(r.Context()))
+}
+
+// check runs every check concurrently, each bounded by the handler's timeout
+func (h *HealthHandler) check(ctx context.Context) models.Readiness {
+	log := logger.WithContext(ctx)
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	readiness := models.Readiness{Status: StatusReady, Checks: make(map[string]models.CheckResult, len(h.checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			result := models.CheckResult{Status: StatusUp}
+			if err := check(ctx); err != nil {
+				log.Warn("Readiness check failed", zap.String("check", name), zap.Error(err))
+				result = models.CheckResult{Status: StatusDown, Error: err.Error()}
+			}
+			if stats, ok := h.pools[name]; ok {
+				if pool, err := stats(); err == nil {
+					result.Pool = &pool
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			readiness.Checks[name] = result
+			if result.Status == StatusDown {
+				readiness.Status = StatusNotReady
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return readiness
+}
+
+// write responds with readiness, with 503 unless it is ready
+func (h *HealthHandler) write(w http.ResponseWriter, r *http.Request, readiness models.Readiness) {
+	w.Header().Set("Content-Type", "application/json")
+	if readiness.Status != StatusReady {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(readiness); err != nil {
+		logger.WithContext(r.Context()).Error("Failed to encode response data",
+			zap.Error(err),
+		)
+	}
+}
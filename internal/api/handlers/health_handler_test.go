@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/api/handlers"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+func TestHealthHandler_Ready(t *testing.T) {
+	err := logger.Init(zap.WarnLevel.String(), false)
+	assert.NoError(t, err)
+
+	up := func(context.Context) error { return nil }
+
+	t.Run("All Checks Up", func(t *testing.T) {
+		handler := handlers.NewHealthHandler(map[string]handlers.HealthCheck{"database": up, "kafka": up}, time.Second)
+
+		rr := httptest.NewRecorder()
+		handler.Details(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/health", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var readiness models.Readiness
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&readiness))
+		assert.Equal(t, handlers.StatusReady, readiness.Status)
+		assert.Equal(t, models.CheckResult{Status: handlers.StatusUp}, readiness.Checks["kafka"])
+
+		rr = httptest.NewRecorder()
+		handler.Ready(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"status":"ready"}`, rr.Body.String())
+	})
+
+	t.Run("Broker Down", func(t *testing.T) {
+		down := func(context.Context) error { return errors.New("kafka brokers unreachable") }
+		handler := handlers.NewHealthHandler(map[string]handlers.HealthCheck{"database": up, "kafka": down}, time.Second)
+
+		rr := httptest.NewRecorder()
+		handler.Details(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/health", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		var readiness models.Readiness
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&readiness))
+		assert.Equal(t, handlers.StatusNotReady, readiness.Status)
+		assert.Equal(t, handlers.StatusUp, readiness.Checks["database"].Status)
+		assert.Equal(t, models.CheckResult{Status: handlers.StatusDown, Error: "kafka brokers unreachable"},
+			readiness.Checks["kafka"])
+
+		rr = httptest.NewRecorder()
+		handler.Ready(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		assert.JSONEq(t, `{"status":"not_ready"}`, rr.Body.String(), "the unauthenticated endpoint tells no errors")
+	})
+
+	t.Run("Pool Stats", func(t *testing.T) {
+		stats := models.PoolStats{MaxOpen: 100, Open: 3, InUse: 1, Idle: 2, WaitCount: 4, WaitDurationMs: 5}
+		handler := handlers.NewHealthHandler(map[string]handlers.HealthCheck{"database": up, "kafka": up}, time.Second).
+			ReportPool("database", func() (models.PoolStats, error) { return stats, nil })
+
+		rr := httptest.NewRecorder()
+		handler.Details(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/health", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var readiness models.Readiness
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&readiness))
+		assert.Equal(t, models.CheckResult{Status: handlers.StatusUp, Pool: &stats}, readiness.Checks["database"])
+		assert.Nil(t, readiness.Checks["kafka"].Pool)
+	})
+
+	t.Run("Check Timeout", func(t *testing.T) {
+		hanging := func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		handler := handlers.NewHealthHandler(map[string]handlers.HealthCheck{"kafka": hanging}, 10*time.Millisecond)
+
+		rr := httptest.NewRecorder()
+		handler.Ready(rr, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
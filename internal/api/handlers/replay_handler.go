@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/replay"
+	"xm-exercise/pkg/models"
+)
+
+// ReplayHandler handles event replay requests
+type ReplayHandler struct {
+	manager *replay.Manager
+}
+
+// NewReplayHandler creates a new replay handler
+func NewReplayHandler(manager *replay.Manager) *ReplayHandler {
+	return &ReplayHandler{manager: manager}
+}
+
+// Start godoc
+// @Summary Start an event replay
+// @Description Publish company events again, either a company.created snapshot of the current
+// @Description companies or the events of the company event log, optionally filtered. The replay
+// @Description runs in the background at the given rate; its progress is read from the returned
+// @Description job. Replayed events carry a replay-id header. Only one replay publishes at a time.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param replay body models.ReplayRequest true "Replay mode and filters"
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 202 {object} models.ReplayJob "Replay started"
+// @Failure 400 {string} string "Invalid request body or validation error"
+// @Failure 401 {string} string "Invalid admin API key"
+// @Failure 403 {string} string "Admin API is disabled"
+// @Failure 409 {string} string "A replay is already running"
+// @Router /admin/replay [post]
+func (h *ReplayHandler) Start(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	var req models.ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.manager.Start(req)
+	if errors.Is(err, replay.ErrReplayRunning) {
+		http.Error(w, "A replay is already running", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info("Replay requested",
+		zap.String("replay_id", job.ID),
+		zap.String("mode", req.Mode),
+		zap.Bool("dry_run", req.DryRun),
+	)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// List godoc
+// @Summary List event replays
+// @Description List the running and recent event replays, newest first
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {array} models.ReplayJob "Replays"
+// @Failure 401 {string} string "Invalid admin API key"
+// @Failure 403 {string} string "Admin API is disabled"
+// @Router /admin/replay [get]
+func (h *ReplayHandler) List(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, h.manager.List())
+}
+
+// Get godoc
+// @Summary Get an event replay
+// @Description Get the status and progress of an event replay
+// @Tags admin
+// @Produce json
+// @Param id path string true "Replay ID"
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} models.ReplayJob "Replay"
+// @Failure 401 {string} string "Invalid admin API key"
+// @Failure 403 {string} string "Admin API is disabled"
+// @Failure 404 {string} string "Replay not found"
+// @Router /admin/replay/{id} [get]
+func (h *ReplayHandler) Get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// Cancel godoc
+// @Summary Cancel an event replay
+// @Description Stop a running event replay. The events published so far are not retracted.
+// @Tags admin
+// @Produce json
+// @Param id path string true "Replay ID"
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 202 {object} models.ReplayJob "Cancellation requested"
+// @Failure 401 {string} string "Invalid admin API key"
+// @Failure 403 {string} string "Admin API is disabled"
+// @Failure 404 {string} string "Replay not found"
+// @Router /admin/replay/{id} [delete]
+func (h *ReplayHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.Cancel(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Replay not found", http.StatusNotFound)
+		return
+	}
+
+	logger.WithContext(r.Context()).Info("Replay cancellation requested", zap.String("replay_id", job.ID))
+	writeJSON(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/api/handlers"
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/replay"
+	"xm-exercise/pkg/models"
+)
+
+// newTestReplayRouter routes replay requests to a handler replaying from a
+// fresh database to a no-op event bus
+func newTestReplayRouter(t *testing.T) (http.Handler, *db.Database) {
+	t.Helper()
+	database := dbtest.NewSQLite(t)
+
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	producer := events.NewProducer(events.NewNoopPublisher(), encoder)
+	manager := replay.NewManager(replay.NewReplayer(database, producer, config.ReplayConfig{Rate: 1, BatchSize: 10}))
+	t.Cleanup(func() { _ = manager.Shutdown(context.Background()) })
+	handler := handlers.NewReplayHandler(manager)
+
+	r := chi.NewRouter()
+	r.Post("/replay", handler.Start)
+	r.Get("/replay", handler.List)
+	r.Get("/replay/{id}", handler.Get)
+	r.Delete("/replay/{id}", handler.Cancel)
+	return r, database
+}
+
+func TestReplayHandler(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+
+	t.Run("Replay Lifecycle", func(t *testing.T) {
+		router, _ := newTestReplayRouter(t)
+
+		rr := serve(router, http.MethodPost, "/replay", models.ReplayRequest{Mode: models.ReplayModeSnapshot, DryRun: true})
+		require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+		var started models.ReplayJob
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&started))
+		assert.Equal(t, models.ReplayRunning, started.Status)
+		assert.True(t, started.Request.DryRun)
+
+		require.Eventually(t, func() bool {
+			rr := serve(router, http.MethodGet, "/replay/"+started.ID, nil)
+			var job models.ReplayJob
+			return rr.Code == http.StatusOK &&
+				json.NewDecoder(rr.Body).Decode(&job) == nil &&
+				job.Status == models.ReplayCompleted
+		}, 5*time.Second, 10*time.Millisecond)
+
+		rr = serve(router, http.MethodGet, "/replay", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var jobs []models.ReplayJob
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&jobs))
+		require.Len(t, jobs, 1)
+		assert.Equal(t, started.ID, jobs[0].ID)
+
+		rr = serve(router, http.MethodDelete, "/replay/"+started.ID, nil)
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+	})
+
+	t.Run("One Replay at a Time", func(t *testing.T) {
+		router, database := newTestReplayRouter(t)
+		recorder := replay.NewRecorder(db.NewCompanyEventRepository(database))
+		require.NoError(t, recorder.PublishCompanyCreated(context.Background(), models.Company{
+			ID:             uuid.New().String(),
+			OrganizationID: uuid.New().String(),
+			Name:           "Acme",
+		}))
+
+		// At one event per second the replay waits for its first tick
+		rr := serve(router, http.MethodPost, "/replay", models.ReplayRequest{Mode: models.ReplayModeHistory})
+		require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+
+		rr = serve(router, http.MethodPost, "/replay", models.ReplayRequest{Mode: models.ReplayModeSnapshot})
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("Invalid Request", func(t *testing.T) {
+		router, _ := newTestReplayRouter(t)
+
+		for _, request := range []models.ReplayRequest{
+			{Mode: "everything"},
+			{Mode: models.ReplayModeSnapshot, EventTypes: []string{events.EventCompanyDeleted}},
+			{Mode: models.ReplayModeHistory, CompanyIDs: []string{"acme"}},
+			{Mode: models.ReplayModeHistory, Rate: -1},
+		} {
+			rr := serve(router, http.MethodPost, "/replay", request)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, request)
+		}
+
+		assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/replay/"+uuid.New().String(), nil).Code)
+		assert.Equal(t, http.StatusNotFound, serve(router, http.MethodDelete, "/replay/"+uuid.New().String(), nil).Code)
+	})
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"xm-exercise/internal/api/middleware"
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/stream"
+)
+
+// lastEventIDHeader is sent by EventSource clients when they reconnect
+const lastEventIDHeader = "Last-Event-ID"
+
+var streamEventTypes = []string{events.EventCompanyCreated, events.EventCompanyUpdated, events.EventCompanyDeleted}
+
+// StreamHandler serves the live company change feed
+type StreamHandler struct {
+	hub *stream.Hub
+	cfg config.StreamConfig
+}
+
+// NewStreamHandler creates a new stream handler
+func NewStreamHandler(hub *stream.Hub, cfg config.StreamConfig) *StreamHandler {
+	return &StreamHandler{hub: hub, cfg: cfg}
+}
+
+// Events godoc
+// @Summary Stream company changes
+// @Description Server-Sent Events feed of the organization's company changes. Every event has an
+// @Description `id`, its type as `event` and the change as JSON `data`. Clients resume with the
+// @Description Last-Event-ID header or the last_event_id parameter; a `stream.reset` event means
+// @Description changes were missed and the client should reload. EventSource clients may pass the
+// @Description token as access_token.
+// @Tags companies
+// @Produce text/event-stream
+// @Param company_id query []string false "Only changes of these companies" collectionFormat(multi)
+// @Param type query []string false "Only these event types" collectionFormat(multi)
+// @Param last_event_id query string false "Resume after this event"
+// @Param Last-Event-ID header string false "Resume after this event"
+// @Param Authorization header string false "Bearer token" example:"Bearer {token}"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {string} string "Invalid filter or event ID"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 503 {string} string "Server shutting down"
+// @Security Bearer
+// @Router /companies/stream [get]
+func (h *StreamHandler) Events(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.WithContext(ctx)
+
+	replay, subscription, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer subscription.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(write func() error) error {
+		// Every write gets its own deadline in place of the server's WriteTimeout,
+		// which would otherwise end the stream
+		if err := rc.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout)); err != nil &&
+			!errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if err := write(); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	sendEvent := func(event stream.Event) error {
+		return send(func() error { return writeSSE(w, event) })
+	}
+
+	log.Info("Stream opened", zap.Int("replayed", len(replay)))
+	if err := send(func() error { return nil }); err != nil {
+		return
+	}
+	for _, event := range replay {
+		if err := sendEvent(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(h.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				log.Info("Stream closed by server")
+				return
+			}
+			if err := sendEvent(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := send(func() error {
+				_, err := fmt.Fprint(w, ": keep-alive\n\n")
+				return err
+			}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// WebSocket godoc
+// @Summary Stream company changes over a WebSocket
+// @Description WebSocket equivalent of /companies/stream. Every message is a JSON event with its
+// @Description `id` and `type`; the filters, resumption and access_token work the same way.
+// @Tags companies
+// @Param company_id query []string false "Only changes of these companies" collectionFormat(multi)
+// @Param type query []string false "Only these event types" collectionFormat(multi)
+// @Param last_event_id query string false "Resume after this event"
+// @Param Authorization header string false "Bearer token" example:"Bearer {token}"
+// @Success 101 {string} string "Switching protocols"
+// @Failure 400 {string} string "Invalid filter, event ID or handshake"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 503 {string} string "Server shutting down"
+// @Security Bearer
+// @Router /companies/stream/ws [get]
+func (h *StreamHandler) WebSocket(w http.ResponseWriter, r *http.Request) {
+	replay, subscription, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer subscription.Close()
+
+	server := websocket.Server{
+		// The token authenticates the client, so any origin is accepted
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			h.serveWebSocket(conn, replay, subscription)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// serveWebSocket writes the replayed and live events to conn until either side closes
+func (h *StreamHandler) serveWebSocket(conn *websocket.Conn, replay []stream.Event, subscription *stream.Subscription) {
+	log := logger.WithContext(conn.Request().Context())
+	log.Info("WebSocket stream opened", zap.Int("replayed", len(replay)))
+	//nolint:errcheck // The connection is being abandoned either way.
+	defer conn.Close()
+
+	// Reading answers pings and notices the client going away; messages are ignored
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		var message []byte
+		for {
+			if err := websocket.Message.Receive(conn, &message); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(write func() error) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout)); err != nil {
+			return err
+		}
+		return write()
+	}
+	sendEvent := func(event stream.Event) error {
+		return send(func() error { return websocket.JSON.Send(conn, event) })
+	}
+
+	for _, event := range replay {
+		if err := sendEvent(event); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(h.cfg.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case event, ok := <-subscription.Events():
+			if !ok {
+				log.Info("WebSocket stream closed by server")
+				return
+			}
+			if err := sendEvent(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := send(func() error {
+				conn.PayloadType = websocket.PingFrame
+				defer func() { conn.PayloadType = websocket.TextFrame }()
+				_, err := conn.Write(nil)
+				return err
+			}); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// subscribe parses the filter and resume position of r and subscribes to the
+// hub, writing an error response and returning false when it cannot
+func (h *StreamHandler) subscribe(w http.ResponseWriter, r *http.Request) ([]stream.Event, *stream.Subscription, bool) {
+	organizationID, ok := middleware.GetOrganizationID(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil, false
+	}
+
+	filter := stream.Filter{
+		OrganizationID: organizationID,
+		CompanyIDs:     queryList(r, "company_id"),
+		Types:          queryList(r, "type"),
+	}
+	for _, companyID := range filter.CompanyIDs {
+		if _, err := uuid.Parse(companyID); err != nil {
+			http.Error(w, "company_id must be a UUID", http.StatusBadRequest)
+			return nil, nil, false
+		}
+	}
+	for _, eventType := range filter.Types {
+		if !slices.Contains(streamEventTypes, eventType) {
+			http.Error(w, "type must be one of "+strings.Join(streamEventTypes, ", "), http.StatusBadRequest)
+			return nil, nil, false
+		}
+	}
+
+	var lastEventID uint64
+	value := r.Header.Get(lastEventIDHeader)
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value != "" {
+		var err error
+		if lastEventID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			http.Error(w, "Invalid last event ID", http.StatusBadRequest)
+			return nil, nil, false
+		}
+	}
+
+	replay, subscription, err := h.hub.Subscribe(filter, lastEventID)
+	if errors.Is(err, stream.ErrClosed) {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	return replay, subscription, true
+}
+
+// queryList returns the values of a query parameter given repeatedly or comma-separated
+func queryList(r *http.Request, key string) []string {
+	var values []string
+	for _, value := range r.URL.Query()[key] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// writeSSE writes event in the Server-Sent Events format. Reset events have no
+// ID so that the client keeps its resume position.
+func writeSSE(w http.ResponseWriter, event stream.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if event.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,210 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+
+	"xm-exercise/internal/api/handlers"
+	"xm-exercise/internal/api/middleware"
+	"xm-exercise/internal/auth"
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/stream"
+)
+
+// newTestStreamServer serves the stream endpoints of hub behind the JWT
+// middleware and returns its URL with a token of organizationID
+func newTestStreamServer(t *testing.T, hub *stream.Hub, organizationID string) (*httptest.Server, string) {
+	t.Helper()
+	jwtService := auth.NewJWTService("secret", time.Hour)
+	token, err := jwtService.GenerateToken(uuid.New().String(), organizationID)
+	require.NoError(t, err)
+
+	handler := handlers.NewStreamHandler(hub, config.StreamConfig{
+		BufferSize:       10,
+		SubscriberBuffer: 10,
+		Heartbeat:        time.Hour,
+		WriteTimeout:     time.Second,
+	})
+	authMiddleware := middleware.NewAuthMiddleware(jwtService)
+	r := chi.NewRouter()
+	r.With(authMiddleware.AuthenticateQuery).Get("/stream", handler.Events)
+	r.With(authMiddleware.AuthenticateQuery).Get("/stream/ws", handler.WebSocket)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server, token
+}
+
+// sseEvent is one parsed Server-Sent Event
+type sseEvent struct {
+	id        string
+	eventType string
+	data      stream.Event
+}
+
+// readSSE reads the next event from the stream, skipping comments
+func readSSE(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.eventType != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.data))
+		}
+	}
+}
+
+// openSSE requests the event stream at rawURL with the given headers
+func openSSE(t *testing.T, ctx context.Context, rawURL string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	require.NoError(t, err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestStreamHandler(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	organizationID := uuid.New().String()
+	companyID := uuid.New().String()
+
+	t.Run("Server-Sent Events", func(t *testing.T) {
+		hub := stream.NewHub(10, 10)
+		server, token := newTestStreamServer(t, hub, organizationID)
+		hub.Publish(stream.Event{Type: events.EventCompanyCreated, OrganizationID: organizationID, CompanyID: companyID})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resp := openSSE(t, ctx, server.URL+"/stream?company_id="+companyID, http.Header{"Authorization": {"Bearer " + token}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		hub.Publish(
+			stream.Event{Type: events.EventCompanyUpdated, OrganizationID: organizationID, CompanyID: uuid.New().String()},
+			stream.Event{Type: events.EventCompanyUpdated, OrganizationID: uuid.New().String(), CompanyID: companyID},
+			stream.Event{Type: events.EventCompanyDeleted, OrganizationID: organizationID, CompanyID: companyID},
+		)
+		event := readSSE(t, bufio.NewReader(resp.Body))
+		assert.Equal(t, events.EventCompanyDeleted, event.eventType)
+		assert.Equal(t, companyID, event.data.CompanyID)
+		assert.Equal(t, strconv.FormatUint(event.data.ID, 10), event.id)
+	})
+
+	t.Run("Resume With Last-Event-ID", func(t *testing.T) {
+		hub := stream.NewHub(10, 10)
+		server, token := newTestStreamServer(t, hub, organizationID)
+		_, subscription, err := hub.Subscribe(stream.Filter{OrganizationID: organizationID}, 0)
+		require.NoError(t, err)
+		hub.Publish(
+			stream.Event{Type: events.EventCompanyCreated, OrganizationID: organizationID, CompanyID: companyID},
+			stream.Event{Type: events.EventCompanyUpdated, OrganizationID: organizationID, CompanyID: companyID},
+		)
+		first := <-subscription.Events()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		resp := openSSE(t, ctx, server.URL+"/stream?access_token="+url.QueryEscape(token), http.Header{
+			"Last-Event-ID": {strconv.FormatUint(first.ID, 10)},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		event := readSSE(t, bufio.NewReader(resp.Body))
+		assert.Equal(t, events.EventCompanyUpdated, event.eventType)
+		assert.Equal(t, first.ID+1, event.data.ID)
+	})
+
+	t.Run("Ends With the Hub", func(t *testing.T) {
+		hub := stream.NewHub(10, 10)
+		server, token := newTestStreamServer(t, hub, organizationID)
+
+		resp := openSSE(t, context.Background(), server.URL+"/stream", http.Header{"Authorization": {"Bearer " + token}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		hub.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = bufio.NewReader(resp.Body).ReadString(0)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("stream did not end when the hub closed")
+		}
+
+		resp = openSSE(t, context.Background(), server.URL+"/stream", http.Header{"Authorization": {"Bearer " + token}})
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("Invalid Request", func(t *testing.T) {
+		hub := stream.NewHub(10, 10)
+		server, token := newTestStreamServer(t, hub, organizationID)
+		authorized := http.Header{"Authorization": {"Bearer " + token}}
+
+		for _, query := range []string{"?company_id=acme", "?type=company.merged", "?last_event_id=abc"} {
+			resp := openSSE(t, context.Background(), server.URL+"/stream"+query, authorized)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+		resp := openSSE(t, context.Background(), server.URL+"/stream?access_token=invalid", nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("WebSocket", func(t *testing.T) {
+		hub := stream.NewHub(10, 10)
+		server, token := newTestStreamServer(t, hub, organizationID)
+		wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/stream/ws?type=company.updated&access_token=" + url.QueryEscape(token)
+
+		conn, err := websocket.Dial(wsURL, "", server.URL)
+		require.NoError(t, err)
+		defer conn.Close() //nolint:errcheck // Test cleanup.
+
+		// The subscription starts before the handshake completes
+		hub.Publish(
+			stream.Event{Type: events.EventCompanyCreated, OrganizationID: organizationID, CompanyID: companyID},
+			stream.Event{Type: events.EventCompanyUpdated, OrganizationID: organizationID, CompanyID: companyID},
+		)
+
+		var event stream.Event
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, websocket.JSON.Receive(conn, &event))
+		assert.Equal(t, events.EventCompanyUpdated, event.Type)
+		assert.Equal(t, companyID, event.CompanyID)
+
+		hub.Close()
+		var message []byte
+		assert.Error(t, websocket.Message.Receive(conn, &message), "the server closes the connection")
+	})
+}
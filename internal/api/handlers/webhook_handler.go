@@ -0,0 +1,448 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/api/middleware"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/webhook"
+	"xm-exercise/pkg/models"
+)
+
+const (
+	defaultDeliveryLimit = 50
+	maxDeliveryLimit     = 200
+)
+
+// WebhookHandler handles webhook subscription requests
+type WebhookHandler struct {
+	webhookRepo *db.WebhookRepository
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookRepo *db.WebhookRepository) *WebhookHandler {
+	return &WebhookHandler{webhookRepo: webhookRepo}
+}
+
+// Create godoc
+// @Summary Create a webhook subscription
+// @Description Subscribe an HTTP endpoint to company events. Requests are signed with the
+// @Description subscription secret, which is generated when not given and only returned here.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body models.WebhookCreateRequest true "Subscription details"
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Success 201 {object} models.WebhookResponse "Subscription created"
+// @Failure 400 {string} string "Invalid request body or validation error"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Security Bearer
+// @Router /webhooks [post]
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.WithContext(ctx)
+
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.WebhookCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = webhook.GenerateSecret(); err != nil {
+			log.Error("Failed to generate webhook secret", zap.Error(err))
+			http.Error(w, "Error creating webhook subscription", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	subscription := models.WebhookSubscription{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		URL:            req.URL,
+		EventTypes:     req.EventTypes,
+		Secret:         secret,
+		Enabled:        true,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := h.webhookRepo.CreateSubscription(ctx, &subscription); err != nil {
+		writeError(w, r, err, "Error creating webhook subscription")
+		return
+	}
+
+	log.Info("Webhook subscription created",
+		zap.String("subscription_id", subscription.ID),
+		zap.String("url", subscription.URL),
+	)
+
+	response := subscription.ToResponse()
+	response.Secret = subscription.Secret
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// List godoc
+// @Summary List webhook subscriptions
+// @Description List the webhook subscriptions of the organization. Responses carry an ETag,
+// @Description and requests with a matching If-None-Match are answered with 304.
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Param If-None-Match header string false "Entity tag of the listing the client has"
+// @Success 200 {array} models.WebhookResponse "Subscriptions"
+// @Success 304 "Subscriptions not modified"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Security Bearer
+// @Router /webhooks [get]
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	version, err := h.webhookRepo.SubscriptionsVersion(ctx, organizationID)
+	if err != nil {
+		writeError(w, r, err, "Error listing webhook subscriptions")
+		return
+	}
+	if notModified(w, r, entityTag("webhooks", organizationID, version), time.Time{}) {
+		return
+	}
+
+	subscriptions, err := h.webhookRepo.ListSubscriptions(ctx, organizationID)
+	if err != nil {
+		writeError(w, r, err, "Error listing webhook subscriptions")
+		return
+	}
+
+	responses := make([]*models.WebhookResponse, len(subscriptions))
+	for i := range subscriptions {
+		responses[i] = subscriptions[i].ToResponse()
+	}
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// Get godoc
+// @Summary Get a webhook subscription
+// @Description Get a webhook subscription by its ID. Responses carry a strong ETag and a
+// @Description Last-Modified date, and conditional requests are answered with 304.
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Param id path string true "Subscription ID" format(uuid)
+// @Param If-None-Match header string false "Entity tag of the copy the client has"
+// @Param If-Modified-Since header string false "Last-Modified date of the copy the client has"
+// @Success 200 {object} models.WebhookResponse "Subscription found"
+// @Success 304 "Subscription not modified"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Webhook subscription not found"
+// @Security Bearer
+// @Router /webhooks/{id} [get]
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	subscription, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+	tag := entityTag(subscription.ID, strconv.FormatInt(subscription.UpdatedAt.UnixNano(), 10))
+	if notModified(w, r, tag, subscription.UpdatedAt) {
+		return
+	}
+	writeJSON(w, http.StatusOK, subscription.ToResponse())
+}
+
+// Patch godoc
+// @Summary Update a webhook subscription
+// @Description Change the URL, event filter or secret of a subscription, or enable or disable
+// @Description it. Enabling a subscription resets its failure count.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Param id path string true "Subscription ID" format(uuid)
+// @Param webhook body models.WebhookUpdateRequest true "Fields to update"
+// @Success 200 {object} models.WebhookResponse "Subscription updated"
+// @Failure 400 {string} string "Invalid request body or validation error"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Webhook subscription not found"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Security Bearer
+// @Router /webhooks/{id} [patch]
+func (h *WebhookHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	subscription, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.WebhookUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.URL != nil {
+		subscription.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		subscription.EventTypes = *req.EventTypes
+	}
+	if req.Secret != nil {
+		subscription.Secret = *req.Secret
+	}
+	if req.Enabled != nil && *req.Enabled != subscription.Enabled {
+		subscription.Enabled = *req.Enabled
+		if subscription.Enabled {
+			subscription.ConsecutiveFailures = 0
+			subscription.DisabledAt = nil
+		} else {
+			now := time.Now().UTC()
+			subscription.DisabledAt = &now
+		}
+	}
+	subscription.UpdatedAt = time.Now().UTC()
+
+	if err := h.webhookRepo.UpdateSubscription(r.Context(), subscription); err != nil {
+		writeError(w, r, err, "Error updating webhook subscription")
+		return
+	}
+
+	log.Info("Webhook subscription updated",
+		zap.String("subscription_id", subscription.ID),
+		zap.Bool("enabled", subscription.Enabled),
+	)
+
+	response := subscription.ToResponse()
+	if req.Secret != nil {
+		response.Secret = subscription.Secret
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Delete godoc
+// @Summary Delete a webhook subscription
+// @Description Delete a webhook subscription and its delivery log
+// @Tags webhooks
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Param id path string true "Subscription ID" format(uuid)
+// @Success 204 "Subscription deleted"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Webhook subscription not found"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Security Bearer
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logger.WithContext(ctx)
+
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.webhookRepo.DeleteSubscription(ctx, organizationID, id)
+	if err != nil {
+		writeError(w, r, err, "Error deleting webhook subscription")
+		return
+	}
+
+	log.Info("Webhook subscription deleted", zap.String("subscription_id", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deliveries godoc
+// @Summary List webhook deliveries
+// @Description List the deliveries of a subscription with the outcome of their latest attempt,
+// @Description newest first. Responses carry an ETag, and requests with a matching
+// @Description If-None-Match are answered with 304.
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Param id path string true "Subscription ID" format(uuid)
+// @Param limit query int false "Maximum number of deliveries (default 50, at most 200)"
+// @Param If-None-Match header string false "Entity tag of the listing the client has"
+// @Success 200 {array} models.WebhookDeliveryResponse "Deliveries"
+// @Success 304 "Deliveries not modified"
+// @Failure 400 {string} string "Invalid limit"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Webhook subscription not found"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Security Bearer
+// @Router /webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxDeliveryLimit {
+			http.Error(w, "limit must be between 1 and 200", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	subscription, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := h.webhookRepo.DeliveriesVersion(r.Context(), subscription.ID)
+	if err != nil {
+		writeError(w, r, err, "Error listing webhook deliveries")
+		return
+	}
+	if notModified(w, r, entityTag("deliveries", subscription.ID, strconv.Itoa(limit), version), time.Time{}) {
+		return
+	}
+
+	deliveries, err := h.webhookRepo.ListDeliveries(r.Context(), subscription.ID, limit)
+	if err != nil {
+		writeError(w, r, err, "Error listing webhook deliveries")
+		return
+	}
+
+	responses := make([]*models.WebhookDeliveryResponse, len(deliveries))
+	for i := range deliveries {
+		responses[i] = deliveries[i].ToResponse()
+	}
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// Redeliver godoc
+// @Summary Redeliver a webhook
+// @Description Queue a new delivery of the same event to the subscription, whatever the
+// @Description outcome of the original one. The event ID is kept so receivers can deduplicate.
+// @Tags webhooks
+// @Produce json
+// @Param Authorization header string true "Bearer token" example:"Bearer {token}"
+// @Param id path string true "Subscription ID" format(uuid)
+// @Param deliveryID path string true "Delivery ID" format(uuid)
+// @Success 202 {object} models.WebhookDeliveryResponse "Delivery queued"
+// @Failure 401 {string} string "Unauthorized"
+// @Failure 404 {string} string "Webhook subscription or delivery not found"
+// @Failure 409 {string} string "Webhook subscription is disabled"
+// @Failure 500 {string} string "Internal server error"
+// @Failure 503 {string} string "Database unavailable"
+// @Security Bearer
+// @Router /webhooks/{id}/deliveries/{deliveryID}/redeliver [post]
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context())
+
+	subscription, ok := h.subscription(w, r)
+	if !ok {
+		return
+	}
+	if !subscription.Enabled {
+		http.Error(w, "Webhook subscription is disabled", http.StatusConflict)
+		return
+	}
+
+	deliveryID := chi.URLParam(r, "deliveryID")
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		return
+	}
+
+	original, err := h.webhookRepo.GetDelivery(r.Context(), subscription.ID, deliveryID)
+	if err != nil {
+		writeError(w, r, err, "Error redelivering webhook")
+		return
+	}
+
+	now := time.Now().UTC()
+	delivery := models.WebhookDelivery{
+		ID:             uuid.New().String(),
+		SubscriptionID: subscription.ID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Payload:        original.Payload,
+		Status:         models.DeliveryPending,
+		CreatedAt:      now,
+		NextAttemptAt:  now,
+	}
+	if err := h.webhookRepo.AddDelivery(r.Context(), &delivery); err != nil {
+		writeError(w, r, err, "Error redelivering webhook")
+		return
+	}
+
+	log.Info("Webhook redelivery queued",
+		zap.String("subscription_id", subscription.ID),
+		zap.String("original_delivery_id", original.ID),
+		zap.String("delivery_id", delivery.ID),
+	)
+	writeJSON(w, http.StatusAccepted, delivery.ToResponse())
+}
+
+// subscription loads the subscription named in the path, writing the error
+// response and returning false when it cannot
+func (h *WebhookHandler) subscription(w http.ResponseWriter, r *http.Request) (*models.WebhookSubscription, bool) {
+	ctx := r.Context()
+
+	organizationID, ok := middleware.GetOrganizationID(ctx)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	subscription, err := h.webhookRepo.GetSubscription(ctx, organizationID, id)
+	if err != nil {
+		writeError(w, r, err, "Error loading webhook subscription")
+		return nil, false
+	}
+	return subscription, true
+}
+
+// writeJSON writes body as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errcheck // The client has gone away if the response cannot be written.
+	json.NewEncoder(w).Encode(body)
+}
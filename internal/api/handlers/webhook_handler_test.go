@@ -0,0 +1,246 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/api/handlers"
+	"xm-exercise/internal/api/middleware"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+// newTestWebhookRouter routes webhook requests to a handler on a fresh
+// database, authenticating every request as a member of organizationID
+func newTestWebhookRouter(t *testing.T, organizationID string) (http.Handler, *db.WebhookRepository) {
+	t.Helper()
+	database := dbtest.NewSQLite(t)
+
+	repo := db.NewWebhookRepository(database)
+	handler := handlers.NewWebhookHandler(repo)
+
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := middleware.SetUserID(r.Context(), uuid.New().String())
+			next.ServeHTTP(w, r.WithContext(middleware.SetOrganizationID(ctx, organizationID)))
+		})
+	})
+	r.Post("/webhooks", handler.Create)
+	r.Get("/webhooks", handler.List)
+	r.Get("/webhooks/{id}", handler.Get)
+	r.Patch("/webhooks/{id}", handler.Patch)
+	r.Delete("/webhooks/{id}", handler.Delete)
+	r.Get("/webhooks/{id}/deliveries", handler.Deliveries)
+	r.Post("/webhooks/{id}/deliveries/{deliveryID}/redeliver", handler.Redeliver)
+	return r, repo
+}
+
+func serve(handler http.Handler, method, path string, body any) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf).WithContext(context.Background())
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestWebhookHandler(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	organizationID := uuid.New().String()
+
+	t.Run("Subscription Lifecycle", func(t *testing.T) {
+		router, _ := newTestWebhookRouter(t, organizationID)
+
+		rr := serve(router, http.MethodPost, "/webhooks", models.WebhookCreateRequest{
+			URL:        "https://partner.example.com/hooks",
+			EventTypes: []string{"company.deleted"},
+		})
+		require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+		var created models.WebhookResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+		assert.True(t, created.Enabled)
+		assert.Equal(t, []string{"company.deleted"}, created.EventTypes)
+		assert.Regexp(t, `^whsec_`, created.Secret)
+
+		rr = serve(router, http.MethodGet, "/webhooks/"+created.ID, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var fetched models.WebhookResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&fetched))
+		assert.Empty(t, fetched.Secret)
+
+		disabled := false
+		rr = serve(router, http.MethodPatch, "/webhooks/"+created.ID, models.WebhookUpdateRequest{Enabled: &disabled})
+		require.Equal(t, http.StatusOK, rr.Code)
+		var updated models.WebhookResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&updated))
+		assert.False(t, updated.Enabled)
+		assert.NotNil(t, updated.DisabledAt)
+
+		rr = serve(router, http.MethodGet, "/webhooks", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var listed []models.WebhookResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&listed))
+		assert.Len(t, listed, 1)
+
+		rr = serve(router, http.MethodDelete, "/webhooks/"+created.ID, nil)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		rr = serve(router, http.MethodGet, "/webhooks/"+created.ID, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Validation Error", func(t *testing.T) {
+		router, _ := newTestWebhookRouter(t, organizationID)
+
+		for _, req := range []models.WebhookCreateRequest{
+			{URL: "ftp://partner.example.com"},
+			{URL: "https://partner.example.com", EventTypes: []string{"company.merged"}},
+			{URL: "https://partner.example.com", Secret: "short"},
+		} {
+			rr := serve(router, http.MethodPost, "/webhooks", req)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, req)
+		}
+	})
+
+	t.Run("Other Organization", func(t *testing.T) {
+		router, repo := newTestWebhookRouter(t, organizationID)
+		subscription := models.WebhookSubscription{
+			ID:             uuid.New().String(),
+			OrganizationID: uuid.New().String(),
+			URL:            "https://partner.example.com",
+			Secret:         "0123456789abcdef",
+			Enabled:        true,
+		}
+		require.NoError(t, repo.CreateSubscription(context.Background(), &subscription))
+
+		rr := serve(router, http.MethodGet, "/webhooks/"+subscription.ID, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+		rr = serve(router, http.MethodDelete, "/webhooks/"+subscription.ID, nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("Delivery Log and Redelivery", func(t *testing.T) {
+		router, repo := newTestWebhookRouter(t, organizationID)
+		subscription := models.WebhookSubscription{
+			ID:             uuid.New().String(),
+			OrganizationID: organizationID,
+			URL:            "https://partner.example.com",
+			Secret:         "0123456789abcdef",
+			Enabled:        true,
+		}
+		require.NoError(t, repo.CreateSubscription(context.Background(), &subscription))
+		original := models.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			EventID:        uuid.New().String(),
+			EventType:      "company.created",
+			Payload:        []byte(`{"type":"company.created"}`),
+			Status:         models.DeliveryFailed,
+			Attempts:       10,
+		}
+		require.NoError(t, repo.AddDelivery(context.Background(), &original))
+
+		rr := serve(router, http.MethodPost, "/webhooks/"+subscription.ID+"/deliveries/"+original.ID+"/redeliver", nil)
+		require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+		var redelivery models.WebhookDeliveryResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&redelivery))
+		assert.NotEqual(t, original.ID, redelivery.ID)
+		assert.Equal(t, original.EventID, redelivery.EventID)
+		assert.Equal(t, models.DeliveryPending, redelivery.Status)
+		assert.JSONEq(t, `{"type":"company.created"}`, string(redelivery.Payload))
+
+		rr = serve(router, http.MethodGet, "/webhooks/"+subscription.ID+"/deliveries?limit=1", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var deliveries []models.WebhookDeliveryResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&deliveries))
+		assert.Len(t, deliveries, 1)
+
+		rr = serve(router, http.MethodGet, "/webhooks/"+subscription.ID+"/deliveries?limit=0", nil)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = serve(router, http.MethodPost, "/webhooks/"+subscription.ID+"/deliveries/"+uuid.New().String()+"/redeliver", nil)
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		subscription.Enabled = false
+		require.NoError(t, repo.UpdateSubscription(context.Background(), &subscription))
+		rr = serve(router, http.MethodPost, "/webhooks/"+subscription.ID+"/deliveries/"+original.ID+"/redeliver", nil)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+	t.Run("Conditional Listings", func(t *testing.T) {
+		router, repo := newTestWebhookRouter(t, organizationID)
+		get := func(path, etag string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set("If-None-Match", etag)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := serve(router, http.MethodPost, "/webhooks", models.WebhookCreateRequest{URL: "https://partner.example.com"})
+		require.Equal(t, http.StatusCreated, rr.Code)
+		var created models.WebhookResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&created))
+
+		rr = serve(router, http.MethodGet, "/webhooks", nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		listing := rr.Header().Get("ETag")
+		require.NotEmpty(t, listing)
+		assert.Equal(t, http.StatusNotModified, get("/webhooks", listing).Code)
+
+		time.Sleep(10 * time.Millisecond)
+		disabled := false
+		rr = serve(router, http.MethodPatch, "/webhooks/"+created.ID, models.WebhookUpdateRequest{Enabled: &disabled})
+		require.Equal(t, http.StatusOK, rr.Code)
+		rr = get("/webhooks", listing)
+		assert.Equal(t, http.StatusOK, rr.Code, "a changed subscription changes the listing")
+		listing = rr.Header().Get("ETag")
+
+		rr = serve(router, http.MethodDelete, "/webhooks/"+created.ID, nil)
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, http.StatusOK, get("/webhooks", listing).Code, "a removed subscription changes the listing")
+
+		subscription := models.WebhookSubscription{
+			ID:             uuid.New().String(),
+			OrganizationID: organizationID,
+			URL:            "https://partner.example.com",
+			Secret:         "0123456789abcdef",
+			Enabled:        true,
+		}
+		require.NoError(t, repo.CreateSubscription(context.Background(), &subscription))
+		delivery := models.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			EventID:        uuid.New().String(),
+			EventType:      "company.created",
+			Payload:        []byte(`{}`),
+			Status:         models.DeliveryPending,
+		}
+		require.NoError(t, repo.AddDelivery(context.Background(), &delivery))
+
+		path := "/webhooks/" + subscription.ID + "/deliveries"
+		rr = serve(router, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, rr.Code)
+		deliveries := rr.Header().Get("ETag")
+		assert.Equal(t, http.StatusNotModified, get(path, deliveries).Code)
+		assert.Equal(t, http.StatusOK, get(path+"?limit=1", deliveries).Code, "the limit is part of the listing")
+
+		require.NoError(t, repo.MarkAttemptFailed(
+			context.Background(), delivery.ID, nil, assert.AnError, time.Now(), nil))
+		assert.Equal(t, http.StatusOK, get(path, deliveries).Code, "an attempt changes the listing")
+	})
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"xm-exercise/internal/logger"
+)
+
+// AdminKeyHeader is the request header carrying the admin API key
+const AdminKeyHeader = "X-Admin-Key"
+
+// RequireAdminKey returns a middleware that only lets through requests carrying the
+// given admin API key. Admin endpoints are disabled when the key is empty.
+func RequireAdminKey(adminAPIKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminAPIKey == "" {
+				http.Error(w, "Admin API is disabled", http.StatusForbidden)
+				return
+			}
+
+			key := r.Header.Get(AdminKeyHeader)
+			if subtle.ConstantTimeCompare([]byte(key), []byte(adminAPIKey)) != 1 {
+				logger.WithContext(r.Context()).Warn("Invalid admin API key")
+				http.Error(w, "Invalid admin API key", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -21,7 +21,7 @@ func NewAuthMiddleware(jwtService *auth.JWTService) *AuthMiddleware {
 	return &AuthMiddleware{jwtService: jwtService}
 }
 
-// Authenticate middleware validates JWT tokens and adds user ID to context
+// Authenticate middleware validates JWT tokens and adds user and organization IDs to context
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log := logger.WithContext(r.Context())
@@ -48,12 +48,34 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		log.Info("User authenticated", zap.String("user_id", claims.UserID))
-		ctx := context.WithValue(r.Context(), logger.UserIDKey, claims.UserID)
+		log.Info("User authenticated",
+			zap.String("user_id", claims.UserID),
+			zap.String("organization_id", claims.OrganizationID),
+		)
+		ctx := SetUserID(r.Context(), claims.UserID)
+		ctx = SetOrganizationID(ctx, claims.OrganizationID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// TokenQueryParam is the query parameter AuthenticateQuery accepts the JWT in
+const TokenQueryParam = "access_token"
+
+// AuthenticateQuery works like Authenticate but also accepts the token in the
+// access_token query parameter, for clients such as EventSource and browser
+// WebSockets that cannot set request headers
+func (m *AuthMiddleware) AuthenticateQuery(next http.Handler) http.Handler {
+	authenticate := m.Authenticate(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get(TokenQueryParam)
+		if token != "" && r.Header.Get("Authorization") == "" {
+			r = r.Clone(r.Context())
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		authenticate.ServeHTTP(w, r)
+	})
+}
+
 // GetUserID extracts user ID from context
 func GetUserID(ctx context.Context) (string, bool) {
 	// fixme: Cast the context.Value result to interface{} before type assertion
@@ -69,3 +91,17 @@ func GetUserID(ctx context.Context) (string, bool) {
 func SetUserID(ctx context.Context, userID string) context.Context {
 	return context.WithValue(ctx, logger.UserIDKey, userID)
 }
+
+// GetOrganizationID extracts the organization (tenant) ID from context
+func GetOrganizationID(ctx context.Context) (string, bool) {
+	organizationID, ok := ctx.Value(logger.OrganizationIDKey).(string)
+	if !ok || organizationID == "" {
+		return "", false
+	}
+	return organizationID, true
+}
+
+// SetOrganizationID puts the organization (tenant) ID in context
+func SetOrganizationID(ctx context.Context, organizationID string) context.Context {
+	return context.WithValue(ctx, logger.OrganizationIDKey, organizationID)
+}
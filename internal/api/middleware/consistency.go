@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"xm-exercise/internal/db"
+)
+
+const (
+	// ReadPrimaryHeader asks for a request's reads to go to the primary database
+	ReadPrimaryHeader = "X-Read-Primary"
+	// ReadPrimaryCookie is set by mutations so that the client's next reads
+	// see them despite replication lag
+	ReadPrimaryCookie = "read_primary"
+)
+
+// ReadYourWrites sends the reads of a request to the primary database instead
+// of a replica when the request is a mutation, carries an X-Read-Primary: true
+// header, or carries the read_primary cookie. Mutations set that cookie for
+// window, so the client's following reads see what it wrote; a zero window sets
+// no cookie.
+func ReadYourWrites(window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutation := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+			if mutation && window > 0 {
+				http.SetCookie(w, &http.Cookie{
+					Name:     ReadPrimaryCookie,
+					Value:    "1",
+					Path:     "/",
+					MaxAge:   max(1, int(window.Seconds())),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			if mutation || strings.EqualFold(r.Header.Get(ReadPrimaryHeader), "true") || hasCookie(r, ReadPrimaryCookie) {
+				r = r.WithContext(db.ReadPrimary(r.Context()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasCookie reports whether the request carries the named cookie
+func hasCookie(r *http.Request, name string) bool {
+	_, err := r.Cookie(name)
+	return err == nil
+}
@@ -36,7 +36,7 @@ func LoggerMiddleware(next http.Handler) http.Handler {
 		log.Info("HTTP Request",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
-			zap.String("query", r.URL.RawQuery),
+			zap.String("query", redactedQuery(r)),
 			zap.String("remote_addr", r.RemoteAddr),
 			zap.String("user_agent", r.UserAgent()),
 			zap.Int("status", ww.Status()),
@@ -44,3 +44,13 @@ func LoggerMiddleware(next http.Handler) http.Handler {
 		)
 	})
 }
+
+// redactedQuery returns the request's query string with any access token masked
+func redactedQuery(r *http.Request) string {
+	query := r.URL.Query()
+	if !query.Has(TokenQueryParam) {
+		return r.URL.RawQuery
+	}
+	query.Set(TokenQueryParam, "REDACTED")
+	return query.Encode()
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"xm-exercise/internal/logger"
+)
+
+// W3C trace context headers
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+// traceParentPattern matches a version 00 traceparent: version, trace ID, parent ID and flags
+var traceParentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// TraceContext propagates the W3C trace context of incoming requests. The
+// request continues the caller's trace, or starts a new one when there is no
+// valid traceparent, under a span ID of its own. The resulting traceparent is
+// put in the context for downstream events and echoed in the response.
+func TraceContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID, flags, ok := parseTraceParent(r.Header.Get(TraceParentHeader))
+		traceState := ""
+		if ok {
+			traceState = strings.TrimSpace(r.Header.Get(TraceStateHeader))
+		} else {
+			traceID, flags = randomHex(16), "00"
+		}
+
+		traceParent := "00-" + traceID + "-" + randomHex(8) + "-" + flags
+		ctx := context.WithValue(r.Context(), logger.TraceParentKey, traceParent)
+		if traceState != "" {
+			ctx = context.WithValue(ctx, logger.TraceStateKey, traceState)
+		}
+
+		w.Header().Set(TraceParentHeader, traceParent)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// parseTraceParent returns the trace ID and flags of a valid traceparent
+func parseTraceParent(traceParent string) (string, string, bool) {
+	match := traceParentPattern.FindStringSubmatch(strings.TrimSpace(traceParent))
+	if match == nil {
+		return "", "", false
+	}
+	if match[1] == strings.Repeat("0", 32) || match[2] == strings.Repeat("0", 16) {
+		return "", "", false
+	}
+	return match[1], match[3], true
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	//nolint:errcheck // crypto/rand.Read does not fail on supported platforms.
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
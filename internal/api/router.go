@@ -1,10 +1,12 @@
 package api
 
 import (
+	"expvar"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
 
 	"xm-exercise/internal/api/handlers"
@@ -15,39 +17,112 @@ import (
 	_ "xm-exercise/internal/docs"
 	"xm-exercise/internal/events"
 	"xm-exercise/internal/logger"
+	"xm-exercise/internal/outbox"
+	"xm-exercise/internal/replay"
+	"xm-exercise/internal/stream"
+	"xm-exercise/pkg/models"
 )
 
-// NewRouter creates a new router with all application routes
-func NewRouter(database *db.Database, producer *events.KafkaProducer, cfg *config.Config) http.Handler {
+// NewRouter creates a new router with all application routes. Company reads go
+// through companies, which may be a repository on a driver other than GORM,
+// such as one on pgxPool, which the readiness checks cover when not nil; company
+// writes always go through database and the outbox. publisher is
+// only used to report the event bus status; committed company changes are
+// published to changes, which passes them on to hub for the change stream,
+// and replays runs the admin replays.
+func NewRouter(
+	database *db.Database,
+	pgxPool *pgxpool.Pool,
+	companies db.CompanyRepositoryInterface,
+	encoder *events.Encoder,
+	publisher events.Publisher,
+	hub *stream.Hub,
+	changes stream.Publisher,
+	replays *replay.Manager,
+	cfg *config.Config,
+) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
+	r.Use(appMiddleware.TraceContext)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.StripSlashes)
 
 	jwtService := auth.NewJWTService(cfg.JWTSecret, cfg.JWTExpiration)
 
-	companyRepo := db.NewCompanyRepository(database)
 	userRepo := db.NewUserRepository(database)
 
-	authHandler := handlers.NewAuthHandler(userRepo, jwtService)
-	companyHandler := handlers.NewCompanyHandler(companyRepo, producer)
+	authHandler := handlers.NewAuthHandler(userRepo, db.NewTransactionManager(database), jwtService)
+	companyHandler := handlers.NewCompanyHandler(
+		companies,
+		stream.NewTransactor(outbox.NewTransactor(database, encoder), changes),
+	)
+	streamHandler := handlers.NewStreamHandler(hub, cfg.Stream)
+	adminHandler := handlers.NewAdminHandler(db.NewOutboxRepository(database))
+	replayHandler := handlers.NewReplayHandler(replays)
+	webhookHandler := handlers.NewWebhookHandler(db.NewWebhookRepository(database))
+
+	checks := map[string]handlers.HealthCheck{"database": database.Ping}
+	if checker, ok := publisher.(events.HealthChecker); ok {
+		checks[cfg.EventBus.Backend] = checker.Ping
+	}
+	if pgxPool != nil {
+		checks["pgx"] = pgxPool.Ping
+	}
+	healthHandler := handlers.NewHealthHandler(checks, cfg.EventBus.Kafka.HealthTimeout).
+		ReportPool("database", database.PoolStats)
+	if pgxPool != nil {
+		healthHandler.ReportPool("pgx", func() (models.PoolStats, error) { return db.PgxPoolStats(pgxPool), nil })
+	}
 
 	authMiddleware := appMiddleware.NewAuthMiddleware(jwtService)
+	// Streams are long-lived, so only the other routes are bounded by the API timeout
+	timeout := appMiddleware.Timeout(cfg.APITimeout)
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Use(appMiddleware.LoggerMiddleware)
-		r.Post("/auth/register", authHandler.Register)
-		r.Post("/auth/login", authHandler.Login)
+		r.Use(appMiddleware.ReadYourWrites(cfg.Replicas.ReadYourWrites))
+		r.With(timeout).Post("/auth/register", authHandler.Register)
+		r.With(timeout).Post("/auth/login", authHandler.Login)
 
 		cr := chi.NewRouter()
-		cr.Get("/{id}", companyHandler.Get)
-		cr.With(authMiddleware.Authenticate).Post("/", companyHandler.Create)
-		cr.With(authMiddleware.Authenticate).Patch("/{id}", companyHandler.Patch)
-		cr.With(authMiddleware.Authenticate).Delete("/{id}", companyHandler.Delete)
+		cr.With(authMiddleware.AuthenticateQuery).Get("/stream", streamHandler.Events)
+		cr.With(authMiddleware.AuthenticateQuery).Get("/stream/ws", streamHandler.WebSocket)
+		cr.With(timeout, authMiddleware.Authenticate, appMiddleware.CacheControl(cfg.CacheControl.Company)).
+			Get("/{id}", companyHandler.Get)
+		cr.With(timeout, authMiddleware.Authenticate).Post("/", companyHandler.Create)
+		cr.With(timeout, authMiddleware.Authenticate).Patch("/{id}", companyHandler.Patch)
+		cr.With(timeout, authMiddleware.Authenticate).Delete("/{id}", companyHandler.Delete)
 		r.Mount("/companies", cr)
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(timeout)
+			r.Use(authMiddleware.Authenticate)
+			r.Post("/", webhookHandler.Create)
+			r.With(appMiddleware.CacheControl(cfg.CacheControl.Webhooks)).Get("/", webhookHandler.List)
+			r.With(appMiddleware.CacheControl(cfg.CacheControl.Webhooks)).Get("/{id}", webhookHandler.Get)
+			r.Patch("/{id}", webhookHandler.Patch)
+			r.Delete("/{id}", webhookHandler.Delete)
+			r.With(appMiddleware.CacheControl(cfg.CacheControl.WebhookDeliveries)).
+				Get("/{id}/deliveries", webhookHandler.Deliveries)
+			r.Post("/{id}/deliveries/{deliveryID}/redeliver", webhookHandler.Redeliver)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(timeout)
+			r.Use(appMiddleware.RequireAdminKey(cfg.AdminAPIKey))
+			r.Get("/outbox", adminHandler.OutboxStats)
+			r.Get("/health", healthHandler.Details)
+			r.Post("/replay", replayHandler.Start)
+			r.Get("/replay", replayHandler.List)
+			r.Get("/replay/{id}", replayHandler.Get)
+			r.Delete("/replay/{id}", replayHandler.Cancel)
+		})
 	})
 
+	// Metrics reveal traffic and backlog sizes, so they are only served with the admin key
+	r.With(appMiddleware.RequireAdminKey(cfg.AdminAPIKey)).Handle("/metrics", expvar.Handler())
+
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
 		httpSwagger.DeepLinking(true),
@@ -59,6 +134,7 @@ func NewRouter(database *db.Database, producer *events.KafkaProducer, cfg *confi
 		// reason: The response is simple and a failure is unlikely to be recoverable.
 		w.Write([]byte("OK"))
 	})
+	r.Get("/ready", healthHandler.Ready)
 
 	logger.Info("API routes initialized")
 	return r
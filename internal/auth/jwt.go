@@ -10,7 +10,8 @@ import (
 
 // JWTClaims represents the claims in the JWT
 type JWTClaims struct {
-	UserID string `json:"user_id"`
+	UserID         string `json:"user_id"`
+	OrganizationID string `json:"organization_id"`
 	jwt.RegisteredClaims
 }
 
@@ -28,10 +29,11 @@ func NewJWTService(secretKey string, expiration time.Duration) *JWTService {
 	}
 }
 
-// GenerateToken creates a new JWT token for a user
-func (s *JWTService) GenerateToken(userID string) (string, error) {
+// GenerateToken creates a new JWT token for a user of the given organization
+func (s *JWTService) GenerateToken(userID, organizationID string) (string, error) {
 	claims := JWTClaims{
-		UserID: userID,
+		UserID:         userID,
+		OrganizationID: organizationID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -68,5 +70,9 @@ func (s *JWTService) ValidateToken(tokenString string) (*JWTClaims, error) {
 		return nil, errors.New("invalid claims")
 	}
 
+	if claims.OrganizationID == "" {
+		return nil, errors.New("token has no organization")
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,240 @@
+// Package cache holds a read-through cache of companies in front of a
+// db.CompanyRepositoryInterface, backed by an in-process LRU or a
+// Redis-compatible server.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/stream"
+	"xm-exercise/pkg/models"
+)
+
+var (
+	hitsTotal      = expvar.NewInt("cache_hits_total")
+	missesTotal    = expvar.NewInt("cache_misses_total")
+	coalescedTotal = expvar.NewInt("cache_coalesced_total")
+	errorsTotal    = expvar.NewInt("cache_errors_total")
+)
+
+// companyCache is the state shared by the organization views of a CompanyRepository
+type companyCache struct {
+	next        db.CompanyRepositoryInterface
+	store       Store
+	ttl         time.Duration
+	negativeTTL time.Duration
+	loads       singleflight.Group
+}
+
+// CompanyRepository caches the companies read through another repository.
+// GetByID reads through the cache, keeping companies for ttl and the IDs of
+// missing companies for negativeTTL, and loads each key once however many
+// requests miss it at the same time. Writes through the repository and
+// Invalidate drop the cached company. Reads whose context is marked by
+// db.ReadPrimary bypass the cache.
+type CompanyRepository struct {
+	cache          *companyCache
+	organizationID string
+}
+
+// NewCompanyRepository creates a cache of the companies of next held in store
+func NewCompanyRepository(
+	next db.CompanyRepositoryInterface,
+	store Store,
+	ttl, negativeTTL time.Duration,
+) *CompanyRepository {
+	return &CompanyRepository{cache: &companyCache{next: next, store: store, ttl: ttl, negativeTTL: negativeTTL}}
+}
+
+// ForOrganization returns a view of the same cache scoped to the given organization
+func (r *CompanyRepository) ForOrganization(organizationID string) db.CompanyRepositoryInterface {
+	return &CompanyRepository{cache: r.cache, organizationID: organizationID}
+}
+
+// next returns the wrapped repository scoped to the repository's organization
+func (r *CompanyRepository) next() db.CompanyRepositoryInterface {
+	return r.cache.next.ForOrganization(r.organizationID)
+}
+
+// Create creates the company through the wrapped repository, dropping a cached miss
+func (r *CompanyRepository) Create(ctx context.Context, company *models.Company) error {
+	err := r.next().Create(ctx, company)
+	r.Invalidate(ctx, r.organizationID, company.ID)
+	return err
+}
+
+// GetByID returns the cached company, loading it on a miss
+func (r *CompanyRepository) GetByID(ctx context.Context, id string) (*models.Company, error) {
+	if db.ReadsPrimary(ctx) {
+		return r.next().GetByID(ctx, id)
+	}
+
+	key := companyKey(r.organizationID, id)
+	if company, found := r.lookup(ctx, key); found {
+		hitsTotal.Add(1)
+		if company == nil {
+			return nil, db.ErrCompanyNotFound
+		}
+		return company, nil
+	}
+	missesTotal.Add(1)
+
+	// The load outlives a caller that gives up, as others may be waiting for it
+	loaded := r.cache.loads.DoChan(key, func() (any, error) {
+		return r.load(context.WithoutCancel(ctx), key, id)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-loaded:
+		if result.Shared {
+			coalescedTotal.Add(1)
+		}
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		// Every caller gets a copy of its own
+		company := *result.Val.(*models.Company)
+		company.Description = clonePointer(company.Description)
+		company.Registered = clonePointer(company.Registered)
+		return &company, nil
+	}
+}
+
+// GetForUpdate reads and locks the company through the wrapped repository,
+// bypassing the cache
+func (r *CompanyRepository) GetForUpdate(ctx context.Context, id string) (*models.Company, error) {
+	return r.next().GetForUpdate(ctx, id)
+}
+
+// Update updates the company through the wrapped repository and drops it from the cache
+func (r *CompanyRepository) Update(ctx context.Context, company *models.Company) error {
+	err := r.next().Update(ctx, company)
+	r.Invalidate(ctx, r.organizationID, company.ID)
+	return err
+}
+
+// Delete deletes the company through the wrapped repository and drops it from the cache
+func (r *CompanyRepository) Delete(ctx context.Context, id string) error {
+	err := r.next().Delete(ctx, id)
+	r.Invalidate(ctx, r.organizationID, id)
+	return err
+}
+
+// Invalidate drops the company of the organization from the cache, for
+// changes made around the repository. Loads in progress are not cached.
+func (r *CompanyRepository) Invalidate(ctx context.Context, organizationID, companyID string) {
+	key := companyKey(organizationID, companyID)
+	r.cache.loads.Forget(key)
+	if err := r.cache.store.Delete(ctx, key); err != nil {
+		storeFailed(ctx, "delete", err)
+	}
+}
+
+// lookup returns the cached company, nil for a cached miss, and whether key
+// was cached at all
+func (r *CompanyRepository) lookup(ctx context.Context, key string) (*models.Company, bool) {
+	value, found, err := r.cache.store.Get(ctx, key)
+	if err != nil {
+		storeFailed(ctx, "get", err)
+		return nil, false
+	}
+	if !found || len(value) == 0 {
+		return nil, found
+	}
+	var company models.Company
+	if err := json.Unmarshal(value, &company); err != nil {
+		storeFailed(ctx, "decode", err)
+		return nil, false
+	}
+	return &company, true
+}
+
+// load reads the company from the wrapped repository and caches the outcome,
+// unless the key was invalidated in the meantime, by this process or another
+// sharing the store. The read goes to the primary, as a lagging replica could
+// return what a write just replaced and have it cached for the whole TTL.
+func (r *CompanyRepository) load(ctx context.Context, key, id string) (*models.Company, error) {
+	version, versionErr := r.cache.store.Version(ctx, key)
+	if versionErr != nil {
+		storeFailed(ctx, "version", versionErr)
+	}
+	company, err := r.next().GetByID(db.ReadPrimary(ctx), id)
+
+	// A miss is cached as an empty value
+	value, ttl := []byte{}, r.cache.negativeTTL
+	switch {
+	case err == nil:
+		if value, err = json.Marshal(company); err != nil {
+			return nil, err
+		}
+		ttl = r.cache.ttl
+	case !errors.Is(err, db.ErrCompanyNotFound):
+		return nil, err
+	}
+
+	// Without the version an invalidation could not be told apart
+	if ttl > 0 && versionErr == nil {
+		if err := r.cache.store.Set(ctx, key, version, value, ttl); err != nil {
+			storeFailed(ctx, "set", err)
+		}
+	}
+	if company == nil {
+		return nil, db.ErrCompanyNotFound
+	}
+	return company, nil
+}
+
+// Invalidator is a stream.Publisher dropping the companies of the events it
+// is handed from a cache before passing the events on, so that changes
+// committed outside the cached repository are not served stale
+type Invalidator struct {
+	cache *CompanyRepository
+	next  stream.Publisher
+}
+
+// NewInvalidator creates a publisher invalidating cache before publishing to
+// next, if not nil
+func NewInvalidator(cache *CompanyRepository, next stream.Publisher) *Invalidator {
+	return &Invalidator{cache: cache, next: next}
+}
+
+// Publish invalidates the companies of events and publishes them
+func (i *Invalidator) Publish(events ...stream.Event) {
+	for _, event := range events {
+		i.cache.Invalidate(context.Background(), event.OrganizationID, event.CompanyID)
+	}
+	if i.next != nil {
+		i.next.Publish(events...)
+	}
+}
+
+// companyKey is the cache key of a company of an organization
+func companyKey(organizationID, companyID string) string {
+	return "company:" + organizationID + ":" + companyID
+}
+
+// storeFailed records a failed store operation. The cache is bypassed rather
+// than failing the request.
+func storeFailed(ctx context.Context, operation string, err error) {
+	errorsTotal.Add(1)
+	logger.WithContext(ctx).Warn("Company cache unavailable", zap.String("operation", operation), zap.Error(err))
+}
+
+// clonePointer returns a pointer to a copy of the value p points to
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	clone := *p
+	return &clone
+}
@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/db/memory"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/stream"
+	"xm-exercise/pkg/models"
+)
+
+// countingRepository counts the reads reaching the wrapped repository,
+// holding them until gate is closed when set
+type countingRepository struct {
+	db.CompanyRepositoryInterface
+	reads *atomic.Int32
+	gate  chan struct{}
+}
+
+func (r *countingRepository) ForOrganization(organizationID string) db.CompanyRepositoryInterface {
+	return &countingRepository{r.CompanyRepositoryInterface.ForOrganization(organizationID), r.reads, r.gate}
+}
+
+func (r *countingRepository) GetByID(ctx context.Context, id string) (*models.Company, error) {
+	r.reads.Add(1)
+	if r.gate != nil {
+		<-r.gate
+	}
+	return r.CompanyRepositoryInterface.GetByID(ctx, id)
+}
+
+// primaryRecordingRepository records whether the last read was marked to go to the primary
+type primaryRecordingRepository struct {
+	db.CompanyRepositoryInterface
+	primary *atomic.Bool
+}
+
+func (r *primaryRecordingRepository) ForOrganization(organizationID string) db.CompanyRepositoryInterface {
+	return &primaryRecordingRepository{r.CompanyRepositoryInterface.ForOrganization(organizationID), r.primary}
+}
+
+func (r *primaryRecordingRepository) GetByID(ctx context.Context, id string) (*models.Company, error) {
+	r.primary.Store(db.ReadsPrimary(ctx))
+	return r.CompanyRepositoryInterface.GetByID(ctx, id)
+}
+
+// recordingPublisher records the events published to it
+type recordingPublisher struct {
+	events []stream.Event
+}
+
+func (p *recordingPublisher) Publish(events ...stream.Event) {
+	p.events = append(p.events, events...)
+}
+
+func TestCompanyRepositoryConformance(t *testing.T) {
+	dbtest.TestCompanyRepository(t, func(*testing.T) (db.CompanyRepositoryInterface, [2]string) {
+		store := NewCompanyRepository(memory.NewCompanyRepository(), NewLRUStore(100), time.Minute, time.Minute)
+		return store, [2]string{uuid.New().String(), uuid.New().String()}
+	})
+}
+
+func TestCompanyRepository(t *testing.T) {
+	ctx := context.Background()
+	organizationID := uuid.New().String()
+
+	newRepository := func(gate chan struct{}) (*CompanyRepository, db.CompanyRepositoryInterface, *atomic.Int32) {
+		reads := &atomic.Int32{}
+		next := &countingRepository{memory.NewCompanyRepository(), reads, gate}
+		return NewCompanyRepository(next, NewLRUStore(100), time.Minute, time.Minute),
+			next.ForOrganization(organizationID), reads
+	}
+
+	t.Run("reads through the cache", func(t *testing.T) {
+		repository, next, reads := newRepository(nil)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.Create(ctx, company))
+
+		hits, misses := hitsTotal.Value(), missesTotal.Value()
+		for range 3 {
+			cached, err := companies.GetByID(ctx, company.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Acme", cached.Name)
+		}
+		assert.Equal(t, int32(1), reads.Load())
+		assert.Equal(t, int64(2), hitsTotal.Value()-hits)
+		assert.Equal(t, int64(1), missesTotal.Value()-misses)
+	})
+
+	t.Run("caches missing companies", func(t *testing.T) {
+		repository, next, reads := newRepository(nil)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+
+		_, err := companies.GetByID(ctx, company.ID)
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+		require.NoError(t, next.Create(ctx, company), "created around the cache")
+		_, err = companies.GetByID(ctx, company.ID)
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+		assert.Equal(t, int32(1), reads.Load())
+
+		repository.Invalidate(ctx, organizationID, company.ID)
+		_, err = companies.GetByID(ctx, company.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalidates companies written through it", func(t *testing.T) {
+		repository, _, _ := newRepository(nil)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, companies.Create(ctx, company))
+		_, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+
+		update := *company
+		update.Name = "Globex"
+		require.NoError(t, companies.Update(ctx, &update))
+		cached, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Globex", cached.Name)
+
+		require.NoError(t, companies.Delete(ctx, company.ID))
+		_, err = companies.GetByID(ctx, company.ID)
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+	})
+
+	t.Run("invalidates the companies of published events", func(t *testing.T) {
+		repository, next, reads := newRepository(nil)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.Create(ctx, company))
+		_, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+
+		published := &recordingPublisher{}
+		event := stream.Event{Type: "company.updated", OrganizationID: organizationID, CompanyID: company.ID}
+		NewInvalidator(repository, published).Publish(event)
+		assert.Equal(t, []stream.Event{event}, published.events)
+
+		_, err = companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), reads.Load())
+
+		// The standalone consumer has nothing to publish to
+		NewInvalidator(repository, nil).Publish(event)
+		_, err = companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), reads.Load())
+	})
+
+	t.Run("loads each company once at a time", func(t *testing.T) {
+		gate := make(chan struct{})
+		repository, next, reads := newRepository(gate)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.Create(ctx, company))
+
+		var wg sync.WaitGroup
+		loaded := make([]*models.Company, 10)
+		for i := range loaded {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				loaded[i], _ = companies.GetByID(ctx, company.ID)
+			}()
+		}
+		// Let every request miss the cache before the load completes
+		time.Sleep(50 * time.Millisecond)
+		close(gate)
+		wg.Wait()
+
+		assert.Equal(t, int32(1), reads.Load())
+		for _, cached := range loaded {
+			require.NotNil(t, cached)
+			assert.Equal(t, "Acme", cached.Name)
+		}
+		assert.NotSame(t, loaded[0], loaded[1], "every caller gets a copy of its own")
+	})
+
+	t.Run("does not cache loads overtaken by an invalidation", func(t *testing.T) {
+		gate := make(chan struct{})
+		repository, next, reads := newRepository(gate)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.Create(ctx, company))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = companies.GetByID(ctx, company.ID)
+		}()
+		for reads.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		repository.Invalidate(ctx, organizationID, company.ID)
+		close(gate)
+		<-done
+
+		_, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), reads.Load())
+	})
+
+	t.Run("does not cache loads overtaken by another instance's invalidation", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		newStore := func() Store {
+			store, err := NewRedisStore("redis://"+server.Addr(), 2, time.Second)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = store.Close() })
+			return store
+		}
+		gate := make(chan struct{})
+		reads := &atomic.Int32{}
+		next := &countingRepository{memory.NewCompanyRepository(), reads, gate}
+		loading := NewCompanyRepository(next, newStore(), time.Minute, time.Minute)
+		invalidating := NewCompanyRepository(next, newStore(), time.Minute, time.Minute)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.ForOrganization(organizationID).Create(ctx, company))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = loading.ForOrganization(organizationID).GetByID(ctx, company.ID)
+		}()
+		for reads.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		invalidating.Invalidate(ctx, organizationID, company.ID)
+		close(gate)
+		<-done
+
+		assert.False(t, server.Exists(companyKey(organizationID, company.ID)))
+	})
+
+	t.Run("bypasses the cache for reads from the primary", func(t *testing.T) {
+		repository, next, reads := newRepository(nil)
+		companies := repository.ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.Create(ctx, company))
+
+		for range 2 {
+			_, err := companies.GetByID(db.ReadPrimary(ctx), company.ID)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(2), reads.Load())
+	})
+
+	t.Run("fills the cache from the primary", func(t *testing.T) {
+		primary := &atomic.Bool{}
+		next := &primaryRecordingRepository{memory.NewCompanyRepository(), primary}
+		companies := NewCompanyRepository(next, NewLRUStore(100), time.Minute, time.Minute).
+			ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.ForOrganization(organizationID).Create(ctx, company))
+
+		_, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.True(t, primary.Load(), "a replica lagging behind a write would have its stale read cached")
+	})
+
+	t.Run("bypasses an unavailable store", func(t *testing.T) {
+		require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+		store, err := NewRedisStore("redis://127.0.0.1:1", 1, 100*time.Millisecond)
+		require.NoError(t, err)
+		reads := &atomic.Int32{}
+		next := &countingRepository{memory.NewCompanyRepository(), reads, nil}
+		companies := NewCompanyRepository(next, store, time.Minute, time.Minute).ForOrganization(organizationID)
+		company := dbtest.NewCompany("Acme")
+		require.NoError(t, next.ForOrganization(organizationID).Create(ctx, company))
+
+		failures := errorsTotal.Value()
+		cached, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme", cached.Name)
+		assert.Equal(t, int64(2), errorsTotal.Value()-failures, "the get and the set failed")
+	})
+}
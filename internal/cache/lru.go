@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// Store keeps cached values by key, each for a limited time. Every key has a
+// version counting its deletions, so that a value read before a deletion is
+// not stored after it; the version is kept with the values, so that every
+// process sharing a store sees the deletions of the others.
+type Store interface {
+	// Get returns the value of key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Version returns the version of key
+	Version(ctx context.Context, key string) (uint64, error)
+	// Set stores value under key for ttl unless key was deleted since its
+	// version was version
+	Set(ctx context.Context, key string, version uint64, value []byte, ttl time.Duration) error
+	// Delete removes the keys and increments their versions
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// versionStripes is the number of version counters the keys of an LRUStore are spread over
+const versionStripes = 256
+
+// lruEntry is a value of an LRUStore and when it expires
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// LRUStore is an in-process Store holding up to a fixed number of values and
+// evicting the least recently used one to make room
+type LRUStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	// order holds the entries, most recently used first
+	order *list.List
+	// versions holds the versions of the keys of each stripe
+	versions [versionStripes]uint64
+	now      func() time.Time
+}
+
+// NewLRUStore creates an empty store holding up to capacity values
+func NewLRUStore(capacity int) *LRUStore {
+	return &LRUStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Get returns the value of key unless it has expired
+func (s *LRUStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*lruEntry)
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(element)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Version returns the version of key, which it shares with the other keys of its stripe
+func (s *LRUStore) Version(_ context.Context, key string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.version(key), nil
+}
+
+// Set stores value under key for ttl unless key was deleted since version,
+// evicting the least recently used value when full
+func (s *LRUStore) Set(_ context.Context, key string, version uint64, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *s.version(key) != version {
+		return nil
+	}
+	expiresAt := s.now().Add(ttl)
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		s.order.MoveToFront(element)
+		return nil
+	}
+
+	for s.order.Len() >= s.capacity && s.order.Len() > 0 {
+		s.remove(s.order.Back())
+	}
+	s.entries[key] = s.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	return nil
+}
+
+// Delete removes the keys and increments their versions
+func (s *LRUStore) Delete(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		*s.version(key)++
+		if element, ok := s.entries[key]; ok {
+			s.remove(element)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of values held, expired ones included
+func (s *LRUStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// version returns the version counter of key. The caller must hold mu.
+func (s *LRUStore) version(key string) *uint64 {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(key))
+	return &s.versions[hash.Sum32()%versionStripes]
+}
+
+// remove drops an entry. The caller must hold mu.
+func (s *LRUStore) remove(element *list.Element) {
+	s.order.Remove(element)
+	delete(s.entries, element.Value.(*lruEntry).key)
+}
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"xm-exercise/internal/logger"
+)
+
+// versionTTL is how long the version of a key is kept after its last
+// deletion. It must exceed the time a load takes, as a version that expired
+// during a load reads as 0 again.
+const versionTTL = time.Hour
+
+// setIfVersion sets KEYS[1] to ARGV[2] for ARGV[3] milliseconds if its
+// version, held in KEYS[2], is still ARGV[1]
+var setIfVersion = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// RedisStore is a Store on a Redis server. The version of a key is kept
+// under the key with a ":version" suffix.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a store on the server at rawURL, such as
+// redis://:password@localhost:6379/0, keeping up to poolSize connections and
+// bounding each command by timeout. Failed commands are not retried, since a
+// cache that is slow to answer is bypassed anyway.
+func NewRedisStore(rawURL string, poolSize int, timeout time.Duration) (*RedisStore, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	options.PoolSize = poolSize
+	options.MaxIdleConns = poolSize
+	options.DialTimeout = timeout
+	options.ReadTimeout = timeout
+	options.WriteTimeout = timeout
+	options.ContextTimeoutEnabled = true
+	options.MaxRetries = -1
+	redis.SetLogger(redisLogger{})
+	return &RedisStore{client: redis.NewClient(options)}, nil
+}
+
+// Get returns the value of key
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Version returns the version of key
+func (s *RedisStore) Version(ctx context.Context, key string) (uint64, error) {
+	version, err := s.client.Get(ctx, versionKey(key)).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// Set stores value under key for ttl, rounded to milliseconds, unless key was
+// deleted since version
+func (s *RedisStore) Set(ctx context.Context, key string, version uint64, value []byte, ttl time.Duration) error {
+	keys := []string{key, versionKey(key)}
+	return setIfVersion.Run(ctx, s.client, keys, version, value, max(ttl, time.Millisecond).Milliseconds()).Err()
+}
+
+// Delete removes the keys and increments their versions
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, keys...)
+		for _, key := range keys {
+			pipe.Incr(ctx, versionKey(key))
+			pipe.Expire(ctx, versionKey(key), versionTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// Ping checks that the server answers
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close closes the connections
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// versionKey is the key holding the version of key
+func versionKey(key string) string {
+	return key + ":version"
+}
+
+// redisLogger sends the client's own messages to the debug log, as the
+// failures behind them are already logged by the cache
+type redisLogger struct{}
+
+// Printf logs a message of the client
+func (redisLogger) Printf(ctx context.Context, format string, v ...any) {
+	logger.WithContext(ctx).Debug(fmt.Sprintf(format, v...))
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRUStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("evicts the least recently used value", func(t *testing.T) {
+		store := NewLRUStore(2)
+		require.NoError(t, store.Set(ctx, "a", 0, []byte("1"), time.Minute))
+		require.NoError(t, store.Set(ctx, "b", 0, []byte("2"), time.Minute))
+		_, _, _ = store.Get(ctx, "a")
+		require.NoError(t, store.Set(ctx, "c", 0, []byte("3"), time.Minute))
+
+		_, found, _ := store.Get(ctx, "b")
+		assert.False(t, found, "b was used least recently")
+		value, found, _ := store.Get(ctx, "a")
+		assert.True(t, found)
+		assert.Equal(t, []byte("1"), value)
+		assert.Equal(t, 2, store.Len())
+	})
+
+	t.Run("expires values", func(t *testing.T) {
+		store := NewLRUStore(2)
+		now := time.Now()
+		store.now = func() time.Time { return now }
+		require.NoError(t, store.Set(ctx, "a", 0, []byte("1"), time.Second))
+
+		_, found, _ := store.Get(ctx, "a")
+		assert.True(t, found)
+		now = now.Add(time.Second)
+		_, found, _ = store.Get(ctx, "a")
+		assert.False(t, found)
+		assert.Zero(t, store.Len(), "expired values are dropped when read")
+	})
+
+	t.Run("deletes values", func(t *testing.T) {
+		store := NewLRUStore(2)
+		require.NoError(t, store.Set(ctx, "a", 0, []byte("1"), time.Minute))
+		require.NoError(t, store.Delete(ctx, "a", "missing"))
+
+		_, found, _ := store.Get(ctx, "a")
+		assert.False(t, found)
+	})
+
+	t.Run("does not store values read before a deletion", func(t *testing.T) {
+		store := NewLRUStore(2)
+		version, err := store.Version(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, store.Delete(ctx, "a"))
+		require.NoError(t, store.Set(ctx, "a", version, []byte("1"), time.Minute))
+		_, found, _ := store.Get(ctx, "a")
+		assert.False(t, found)
+
+		version, err = store.Version(ctx, "a")
+		require.NoError(t, err)
+		require.NoError(t, store.Set(ctx, "a", version, []byte("1"), time.Minute))
+		_, found, _ = store.Get(ctx, "a")
+		assert.True(t, found)
+	})
+}
+
+func TestRedisStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("stores, expires and deletes values", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		server.RequireAuth("secret")
+		store, err := NewRedisStore("redis://:secret@"+server.Addr()+"/2", 2, time.Second)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		require.NoError(t, store.Ping(ctx))
+
+		require.NoError(t, store.Set(ctx, "a", 0, []byte("line\r\nbreak"), time.Minute))
+		value, found, err := store.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, []byte("line\r\nbreak"), value)
+		server.Select(2)
+		assert.True(t, server.Exists("a"), "the URL's database is used")
+
+		require.NoError(t, store.Set(ctx, "empty", 0, []byte{}, time.Minute))
+		value, found, err = store.Get(ctx, "empty")
+		require.NoError(t, err)
+		assert.True(t, found, "empty values are told apart from missing ones")
+		assert.Empty(t, value)
+
+		require.NoError(t, store.Delete(ctx, "a", "empty"))
+		_, found, err = store.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		require.NoError(t, store.Set(ctx, "short", 0, []byte("1"), time.Millisecond))
+		server.FastForward(time.Millisecond)
+		_, found, err = store.Get(ctx, "short")
+		require.NoError(t, err)
+		assert.False(t, found, "values expire")
+	})
+
+	t.Run("does not store values read before a deletion", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		store, err := NewRedisStore("redis://"+server.Addr(), 2, time.Second)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+
+		version, err := store.Version(ctx, "a")
+		require.NoError(t, err)
+		assert.Zero(t, version)
+		require.NoError(t, store.Delete(ctx, "a"))
+		require.NoError(t, store.Set(ctx, "a", version, []byte("1"), time.Minute))
+		_, found, err := store.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.False(t, found)
+
+		version, err = store.Version(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), version)
+		require.NoError(t, store.Set(ctx, "a", version, []byte("1"), time.Minute))
+		_, found, err = store.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.True(t, found)
+
+		assert.Equal(t, versionTTL, server.TTL("a:version"), "versions do not pile up")
+	})
+
+	t.Run("fails on an unreachable server", func(t *testing.T) {
+		store, err := NewRedisStore("redis://127.0.0.1:1", 2, time.Second)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = store.Close() })
+		assert.Error(t, store.Ping(ctx))
+	})
+
+	t.Run("rejects invalid URLs", func(t *testing.T) {
+		for _, rawURL := range []string{"localhost:6379", "http://localhost", "redis://localhost/db"} {
+			_, err := NewRedisStore(rawURL, 2, time.Second)
+			assert.Error(t, err, rawURL)
+		}
+	})
+}
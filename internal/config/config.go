@@ -2,6 +2,8 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
@@ -12,6 +14,8 @@ import (
 const (
 	DefaultDatabaseURL = "local.sql"
 	DefaultJWTSecret   = "super-secret-x-api-key"
+	// DefaultCacheControl lets clients keep responses but has them revalidate each use
+	DefaultCacheControl = "private, no-cache"
 )
 
 // Config holds application configuration
@@ -19,10 +23,282 @@ type Config struct {
 	Port            string
 	DatabaseURL     string
 	DatabaseDialect string
+	DatabaseDriver  string
+	Migrations      MigrationConfig
+	Replicas        ReplicaConfig
+	Pool            PoolConfig
+	ConnectTimeout  time.Duration
+	QueryTimeout    time.Duration
 	JWTSecret       string
 	JWTExpiration   time.Duration
-	KafkaBrokers    []string
 	APITimeout      time.Duration
+	AdminAPIKey     string
+	Outbox          OutboxConfig
+	EventBus        EventBusConfig
+	EventEncoding   EventEncodingConfig
+	Consumer        ConsumerConfig
+	Webhook         WebhookConfig
+	Stream          StreamConfig
+	Replay          ReplayConfig
+	Cache           CacheConfig
+	CacheControl    CacheControlConfig
+}
+
+// EventEncodingConfig controls the envelope events are emitted in
+type EventEncodingConfig struct {
+	// Format is "cloudevents" or "legacy"
+	Format string
+	// ContentMode is the CloudEvents content mode, "structured" or "binary"
+	ContentMode string
+	// Source is the CloudEvents source attribute
+	Source string
+	// DataSchemaBaseURL prefixes the dataschema attribute; no dataschema is set when empty
+	DataSchemaBaseURL string
+	// DataEncoding is the payload encoding, "json", "avro" or "protobuf"
+	DataEncoding   string
+	SchemaRegistry SchemaRegistryConfig
+	Topics         TopicsConfig
+}
+
+// TopicsConfig names the topic of each event, prefix included. Empty names
+// fall back to the event type.
+type TopicsConfig struct {
+	CompanyCreated string
+	CompanyUpdated string
+	CompanyDeleted string
+}
+
+// SchemaRegistryConfig holds configuration for the Confluent-compatible schema registry
+type SchemaRegistryConfig struct {
+	// URL of the registry; "memory" uses an in-process stub and empty disables the registry
+	URL      string
+	Username string
+	Password string
+}
+
+// EventBusConfig selects the event bus backend and holds each backend's settings
+type EventBusConfig struct {
+	Backend string
+	Kafka   KafkaConfig
+	Memory  MemoryBusConfig
+	File    FileSinkConfig
+	NATS    NATSConfig
+	Publish AsyncPublishConfig
+}
+
+// KafkaConfig holds configuration for the Kafka backend
+type KafkaConfig struct {
+	Brokers  []string
+	ClientID string
+	// RequiredAcks is "none", "leader" or "all"
+	RequiredAcks string
+	// Compression is "none", "gzip", "snappy", "lz4" or "zstd"
+	Compression  string
+	BatchSize    int
+	BatchTimeout time.Duration
+	TLS          KafkaTLSConfig
+	SASL         KafkaSASLConfig
+	// HealthTimeout bounds broker connectivity checks
+	HealthTimeout time.Duration
+	Provisioning  KafkaProvisioningConfig
+}
+
+// KafkaProvisioningConfig controls the creation of missing topics on startup
+type KafkaProvisioningConfig struct {
+	CreateTopics      bool
+	Partitions        int
+	ReplicationFactor int
+	// Retention is the topics' retention.ms; zero keeps the broker default
+	Retention time.Duration
+}
+
+// KafkaTLSConfig holds the TLS settings of the Kafka connection
+type KafkaTLSConfig struct {
+	Enabled bool
+	// CAFile is a PEM bundle of CAs trusted in addition to the system pool
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key, for mutual TLS
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+}
+
+// KafkaSASLConfig holds the SASL credentials of the Kafka connection
+type KafkaSASLConfig struct {
+	// Mechanism is "plain", "scram-sha-256" or "scram-sha-512"; empty disables SASL
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// AsyncPublishConfig holds configuration for the queue in front of the event bus
+type AsyncPublishConfig struct {
+	QueueSize int
+	BatchSize int
+	// Linger is how long a batch waits for more messages before it is sent
+	Linger     time.Duration
+	DeadLetter DeadLetterConfig
+}
+
+// DeadLetterConfig selects where outbox messages exhausting their attempts go
+type DeadLetterConfig struct {
+	// Target is "topic", "file" or "none"
+	Target string
+	// Topic receives dead-lettered messages through the event bus
+	Topic string
+	// Path is the NDJSON file receiving dead-lettered messages
+	Path string
+}
+
+// MemoryBusConfig holds configuration for the in-process channel backend
+type MemoryBusConfig struct {
+	BufferSize int
+}
+
+// FileSinkConfig holds configuration for the NDJSON file backend
+type FileSinkConfig struct {
+	Path string
+}
+
+// NATSConfig holds configuration for the NATS backend
+type NATSConfig struct {
+	URL            string
+	SubjectPrefix  string
+	ConnectTimeout time.Duration
+	// JetStream publishes with acknowledgements from a stream instead of core NATS
+	JetStream bool
+	// Stream, when set, is created or updated on startup to capture StreamSubjects
+	Stream         string
+	StreamSubjects []string
+}
+
+// OutboxConfig holds configuration for the outbox relay
+type OutboxConfig struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// MaxAttempts is the number of failed attempts after which a message is
+	// dead-lettered, when a dead-letter target is configured
+	MaxAttempts int
+	// Lease is how long a relay keeps the messages it claimed before another
+	// relay may claim them again
+	Lease time.Duration
+}
+
+// ConsumerConfig holds configuration for the consumer of inbound company
+// changes. It connects with the brokers and security settings of KafkaConfig.
+type ConsumerConfig struct {
+	// Enabled runs the consumer inside the API server
+	Enabled bool
+	Topic   string
+	GroupID string
+	// DeadLetterTopic receives messages that cannot be applied
+	DeadLetterTopic string
+	// MaxAttempts bounds how often a failing message is processed before it is
+	// dead-lettered, and how often publishing it to DeadLetterTopic is tried
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// WebhookConfig holds configuration for webhook delivery
+type WebhookConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	// Concurrency bounds the requests in flight at once
+	Concurrency    int
+	Timeout        time.Duration
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// DisableAfter is the number of consecutive failed attempts disabling a subscription
+	DisableAfter int
+	// Lease keeps claimed deliveries from other dispatchers; it must exceed the
+	// time a batch takes to send
+	Lease time.Duration
+	// AllowedNetworks are loopback, private or link-local networks webhooks may
+	// still be sent to, which are otherwise refused
+	AllowedNetworks []netip.Prefix
+}
+
+// StreamConfig holds configuration for the live company change feed
+type StreamConfig struct {
+	// BufferSize is the number of recent events kept for Last-Event-ID resumption
+	BufferSize int
+	// SubscriberBuffer is the number of events queued per client before it is
+	// disconnected as too slow
+	SubscriberBuffer int
+	// Heartbeat is the interval of keep-alive messages on idle streams
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+}
+
+// MigrationConfig controls how the schema migrations are handled on startup
+type MigrationConfig struct {
+	// Mode is up to apply pending migrations on startup, check to refuse to
+	// start while migrations are pending, or off
+	Mode string
+	// LockTimeout is how long to wait for migrations run by other processes
+	LockTimeout time.Duration
+}
+
+// PoolConfig holds the database connection pool configuration
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime closes connections left idle for longer; zero keeps them
+	ConnMaxIdleTime time.Duration
+	// StatementTimeout has the database abort statements running for longer; zero disables it
+	StatementTimeout time.Duration
+}
+
+// ReplicaConfig holds the read replica configuration
+type ReplicaConfig struct {
+	// URLs are the connection strings of the read replicas, of the primary's dialect
+	URLs []string
+	// HealthInterval is how often the replicas are pinged
+	HealthInterval time.Duration
+	// ReadYourWrites is how long a client's reads go to the primary after a mutation
+	ReadYourWrites time.Duration
+}
+
+// CacheConfig holds the company cache configuration
+type CacheConfig struct {
+	// Backend is memory for an in-process LRU, redis, or none
+	Backend string
+	// TTL is how long companies are cached
+	TTL time.Duration
+	// NegativeTTL is how long the IDs of missing companies are cached; zero disables it
+	NegativeTTL time.Duration
+	// Size is the number of companies the in-process LRU holds
+	Size int
+	// RedisURL is the redis:// or rediss:// URL of the server
+	RedisURL string
+	// RedisPoolSize is the number of connections kept to the server
+	RedisPoolSize int
+	// RedisTimeout bounds each command sent to the server
+	RedisTimeout time.Duration
+}
+
+// CacheControlConfig holds the Cache-Control header of the successful responses
+// of each cacheable route; an empty value sends none
+type CacheControlConfig struct {
+	// Company is sent by GET /companies/{id}
+	Company string
+	// Webhooks is sent by GET /webhooks and GET /webhooks/{id}
+	Webhooks string
+	// WebhookDeliveries is sent by GET /webhooks/{id}/deliveries
+	WebhookDeliveries string
+}
+
+// ReplayConfig holds configuration for event replays
+type ReplayConfig struct {
+	// Rate is the default number of events published per second
+	Rate int
+	// BatchSize is the number of companies or logged events read at once
+	BatchSize int
 }
 
 // Load loads configuration from environment variables
@@ -31,32 +307,788 @@ func Load() (*Config, error) {
 
 	dbURL := utils.GetEnv("DATABASE_URL", DefaultDatabaseURL)
 	dbDialect := utils.GetEnv("DATABASE_DIALECT", "sqlite")
+	dbDriver := strings.ToLower(utils.GetEnv("DATABASE_DRIVER", "gorm"))
+	switch {
+	case dbDriver != "gorm" && dbDriver != "pgx":
+		return nil, errors.New("DATABASE_DRIVER must be gorm or pgx")
+	case dbDriver == "pgx" && dbDialect != "postgres":
+		return nil, errors.New("DATABASE_DRIVER pgx requires DATABASE_DIALECT postgres")
+	}
 	jwtSecret := utils.GetEnv("JWT_SECRET", DefaultJWTSecret)
-	jwtExpirationStr := utils.GetEnv("JWT_EXPIRATION_HOURS", "24")
-	jwtExpiration, err := strconv.Atoi(jwtExpirationStr)
+	jwtExpiration, err := getEnvInt("JWT_EXPIRATION_HOURS", 24)
 	if err != nil {
-		return nil, errors.New("JWT_EXPIRATION_HOURS must be a valid integer")
+		return nil, err
 	}
 	if jwtExpiration == 0 {
 		jwtExpiration = 24
 	}
 
-	kafkaBrokersStr := utils.GetEnv("KAFKA_BROKERS", "localhost:9092")
-	kafkaBrokers := strings.Split(kafkaBrokersStr, ",")
+	apiTimeout, err := getEnvInt("API_TIMEOUT_SECONDS", 30)
+	if err != nil {
+		return nil, err
+	}
+
+	queryTimeout, err := getEnvInt("DATABASE_QUERY_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return nil, err
+	}
+	if apiTimeout < 0 || queryTimeout < 0 {
+		return nil, errors.New("API_TIMEOUT_SECONDS and DATABASE_QUERY_TIMEOUT_SECONDS must not be negative")
+	}
+
+	connectTimeout, err := getEnvInt("DATABASE_CONNECT_TIMEOUT_SECONDS", 60)
+	if err != nil {
+		return nil, err
+	}
+	if connectTimeout < 0 {
+		return nil, errors.New("DATABASE_CONNECT_TIMEOUT_SECONDS must not be negative")
+	}
 
-	apiTimeoutStr := utils.GetEnv("API_TIMEOUT_SECONDS", "30")
-	apiTimeout, err := strconv.Atoi(apiTimeoutStr)
+	pool, err := loadPoolConfig()
 	if err != nil {
-		return nil, errors.New("API_TIMEOUT_SECONDS must be a valid integer")
+		return nil, err
+	}
+
+	migrations, err := loadMigrationConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	replicas, err := loadReplicaConfig()
+	if err != nil {
+		return nil, err
+	}
+	// The pgx repository reads from the primary only
+	if dbDriver == "pgx" && len(replicas.URLs) > 0 {
+		return nil, errors.New("DATABASE_DRIVER pgx does not support DATABASE_REPLICA_URLS")
+	}
+
+	outbox, err := loadOutboxConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	eventBus, err := loadEventBusConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	eventEncoding, err := loadEventEncodingConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, err := loadConsumerConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := loadWebhookConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := loadStreamConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	replay, err := loadReplayConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := loadCacheConfig()
+	if err != nil {
+		return nil, err
 	}
 
 	return &Config{
 		Port:            port,
 		DatabaseURL:     dbURL,
 		DatabaseDialect: dbDialect,
+		DatabaseDriver:  dbDriver,
+		Migrations:      migrations,
+		Replicas:        replicas,
+		Pool:            pool,
+		ConnectTimeout:  time.Duration(connectTimeout) * time.Second,
+		QueryTimeout:    time.Duration(queryTimeout) * time.Second,
 		JWTSecret:       jwtSecret,
 		JWTExpiration:   time.Duration(jwtExpiration) * time.Hour,
-		KafkaBrokers:    kafkaBrokers,
 		APITimeout:      time.Duration(apiTimeout) * time.Second,
+		AdminAPIKey:     utils.GetEnv("ADMIN_API_KEY", ""),
+		Outbox:          outbox,
+		EventBus:        eventBus,
+		EventEncoding:   eventEncoding,
+		Consumer:        consumer,
+		Webhook:         webhook,
+		Stream:          stream,
+		Replay:          replay,
+		Cache:           cache,
+		CacheControl:    loadCacheControlConfig(),
+	}, nil
+}
+
+// loadEventEncodingConfig loads the event envelope configuration
+func loadEventEncodingConfig() (EventEncodingConfig, error) {
+	format := strings.ToLower(utils.GetEnv("EVENT_FORMAT", "cloudevents"))
+	if format != "cloudevents" && format != "legacy" {
+		return EventEncodingConfig{}, errors.New("EVENT_FORMAT must be cloudevents or legacy")
+	}
+
+	contentMode := strings.ToLower(utils.GetEnv("EVENT_CONTENT_MODE", "structured"))
+	if contentMode != "structured" && contentMode != "binary" {
+		return EventEncodingConfig{}, errors.New("EVENT_CONTENT_MODE must be structured or binary")
+	}
+
+	dataEncoding := strings.ToLower(utils.GetEnv("EVENT_DATA_ENCODING", "json"))
+	if dataEncoding != "json" && dataEncoding != "avro" && dataEncoding != "protobuf" {
+		return EventEncodingConfig{}, errors.New("EVENT_DATA_ENCODING must be json, avro or protobuf")
+	}
+
+	topicPrefix := utils.GetEnv("EVENT_TOPIC_PREFIX", "")
+
+	return EventEncodingConfig{
+		Format:            format,
+		ContentMode:       contentMode,
+		Source:            utils.GetEnv("EVENT_SOURCE", "/xm-exercise/companies"),
+		DataSchemaBaseURL: strings.TrimSuffix(utils.GetEnv("EVENT_DATASCHEMA_BASE_URL", ""), "/"),
+		DataEncoding:      dataEncoding,
+		SchemaRegistry: SchemaRegistryConfig{
+			URL:      utils.GetEnv("SCHEMA_REGISTRY_URL", ""),
+			Username: utils.GetEnv("SCHEMA_REGISTRY_USERNAME", ""),
+			Password: utils.GetEnv("SCHEMA_REGISTRY_PASSWORD", ""),
+		},
+		Topics: TopicsConfig{
+			CompanyCreated: topicPrefix + utils.GetEnv("EVENT_TOPIC_COMPANY_CREATED", "company.created"),
+			CompanyUpdated: topicPrefix + utils.GetEnv("EVENT_TOPIC_COMPANY_UPDATED", "company.updated"),
+			CompanyDeleted: topicPrefix + utils.GetEnv("EVENT_TOPIC_COMPANY_DELETED", "company.deleted"),
+		},
+	}, nil
+}
+
+// loadEventBusConfig loads the event bus backend configuration
+func loadEventBusConfig() (EventBusConfig, error) {
+	memoryBufferSize, err := getEnvInt("EVENT_BUS_MEMORY_BUFFER_SIZE", 1024)
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	natsConnectTimeout, err := getEnvInt("NATS_CONNECT_TIMEOUT_SECONDS", 5)
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	natsJetStream, err := getEnvBool("NATS_JETSTREAM", false)
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	natsSubjectPrefix := utils.GetEnv("NATS_SUBJECT_PREFIX", "")
+
+	requiredAcks := strings.ToLower(utils.GetEnv("KAFKA_REQUIRED_ACKS", "all"))
+	if requiredAcks != "none" && requiredAcks != "leader" && requiredAcks != "all" {
+		return EventBusConfig{}, errors.New("KAFKA_REQUIRED_ACKS must be none, leader or all")
+	}
+
+	compression := strings.ToLower(utils.GetEnv("KAFKA_COMPRESSION", "none"))
+	switch compression {
+	case "none", "gzip", "snappy", "lz4", "zstd":
+	default:
+		return EventBusConfig{}, errors.New("KAFKA_COMPRESSION must be none, gzip, snappy, lz4 or zstd")
+	}
+
+	kafkaBatchSize, err := getEnvInt("KAFKA_BATCH_SIZE", 100)
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	kafkaBatchTimeoutMS, err := getEnvInt("KAFKA_BATCH_TIMEOUT_MS", 1)
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	if kafkaBatchSize <= 0 || kafkaBatchTimeoutMS <= 0 {
+		return EventBusConfig{}, errors.New("KAFKA_BATCH_SIZE and KAFKA_BATCH_TIMEOUT_MS must be positive")
+	}
+
+	kafkaHealthTimeout, err := getEnvInt("KAFKA_HEALTH_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+	if kafkaHealthTimeout <= 0 {
+		return EventBusConfig{}, errors.New("KAFKA_HEALTH_TIMEOUT_SECONDS must be positive")
+	}
+
+	provisioning, err := loadKafkaProvisioningConfig()
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	kafkaTLS, err := loadKafkaTLSConfig()
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	saslMechanism := strings.ToLower(utils.GetEnv("KAFKA_SASL_MECHANISM", ""))
+	switch saslMechanism {
+	case "", "plain", "scram-sha-256", "scram-sha-512":
+	default:
+		return EventBusConfig{}, errors.New("KAFKA_SASL_MECHANISM must be plain, scram-sha-256 or scram-sha-512")
+	}
+
+	publish, err := loadAsyncPublishConfig()
+	if err != nil {
+		return EventBusConfig{}, err
+	}
+
+	topicPrefix := utils.GetEnv("EVENT_TOPIC_PREFIX", "")
+
+	return EventBusConfig{
+		Backend: strings.ToLower(utils.GetEnv("EVENT_BUS_BACKEND", "kafka")),
+		Kafka: KafkaConfig{
+			Brokers:      strings.Split(utils.GetEnv("KAFKA_BROKERS", "localhost:9092"), ","),
+			ClientID:     utils.GetEnv("KAFKA_CLIENT_ID", "xm-exercise"),
+			RequiredAcks: requiredAcks,
+			Compression:  compression,
+			BatchSize:    kafkaBatchSize,
+			BatchTimeout: time.Duration(kafkaBatchTimeoutMS) * time.Millisecond,
+			TLS:          kafkaTLS,
+			SASL: KafkaSASLConfig{
+				Mechanism: saslMechanism,
+				Username:  utils.GetEnv("KAFKA_SASL_USERNAME", ""),
+				Password:  utils.GetEnv("KAFKA_SASL_PASSWORD", ""),
+			},
+			HealthTimeout: time.Duration(kafkaHealthTimeout) * time.Second,
+			Provisioning:  provisioning,
+		},
+		Memory: MemoryBusConfig{
+			BufferSize: memoryBufferSize,
+		},
+		File: FileSinkConfig{
+			Path: utils.GetEnv("EVENT_BUS_FILE_PATH", "events.ndjson"),
+		},
+		NATS: NATSConfig{
+			URL:            utils.GetEnv("NATS_URL", "nats://localhost:4222"),
+			SubjectPrefix:  natsSubjectPrefix,
+			ConnectTimeout: time.Duration(natsConnectTimeout) * time.Second,
+			JetStream:      natsJetStream,
+			Stream:         utils.GetEnv("NATS_STREAM", ""),
+			StreamSubjects: strings.Split(utils.GetEnv("NATS_STREAM_SUBJECTS", natsSubjectPrefix+topicPrefix+"company.>"), ","),
+		},
+		Publish: publish,
+	}, nil
+}
+
+// loadKafkaProvisioningConfig loads the Kafka topic provisioning configuration
+func loadKafkaProvisioningConfig() (KafkaProvisioningConfig, error) {
+	createTopics, err := getEnvBool("KAFKA_CREATE_TOPICS", false)
+	if err != nil {
+		return KafkaProvisioningConfig{}, err
+	}
+
+	partitions, err := getEnvInt("KAFKA_TOPIC_PARTITIONS", 3)
+	if err != nil {
+		return KafkaProvisioningConfig{}, err
+	}
+
+	replicationFactor, err := getEnvInt("KAFKA_TOPIC_REPLICATION_FACTOR", 1)
+	if err != nil {
+		return KafkaProvisioningConfig{}, err
+	}
+
+	retentionHours, err := getEnvInt("KAFKA_TOPIC_RETENTION_HOURS", 0)
+	if err != nil {
+		return KafkaProvisioningConfig{}, err
+	}
+
+	if partitions <= 0 || replicationFactor <= 0 || retentionHours < 0 {
+		return KafkaProvisioningConfig{}, errors.New(
+			"KAFKA_TOPIC_PARTITIONS and KAFKA_TOPIC_REPLICATION_FACTOR must be positive " +
+				"and KAFKA_TOPIC_RETENTION_HOURS must not be negative")
+	}
+
+	return KafkaProvisioningConfig{
+		CreateTopics:      createTopics,
+		Partitions:        partitions,
+		ReplicationFactor: replicationFactor,
+		Retention:         time.Duration(retentionHours) * time.Hour,
+	}, nil
+}
+
+// loadKafkaTLSConfig loads the Kafka TLS configuration
+func loadKafkaTLSConfig() (KafkaTLSConfig, error) {
+	enabled, err := getEnvBool("KAFKA_TLS_ENABLED", false)
+	if err != nil {
+		return KafkaTLSConfig{}, err
+	}
+
+	insecureSkipVerify, err := getEnvBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false)
+	if err != nil {
+		return KafkaTLSConfig{}, err
+	}
+
+	certFile := utils.GetEnv("KAFKA_TLS_CERT_FILE", "")
+	keyFile := utils.GetEnv("KAFKA_TLS_KEY_FILE", "")
+	if (certFile == "") != (keyFile == "") {
+		return KafkaTLSConfig{}, errors.New("KAFKA_TLS_CERT_FILE and KAFKA_TLS_KEY_FILE must be set together")
+	}
+
+	return KafkaTLSConfig{
+		Enabled:            enabled,
+		CAFile:             utils.GetEnv("KAFKA_TLS_CA_FILE", ""),
+		CertFile:           certFile,
+		KeyFile:            keyFile,
+		InsecureSkipVerify: insecureSkipVerify,
+	}, nil
+}
+
+// loadAsyncPublishConfig loads the event publish queue configuration
+func loadAsyncPublishConfig() (AsyncPublishConfig, error) {
+	queueSize, err := getEnvInt("EVENT_PUBLISH_QUEUE_SIZE", 1000)
+	if err != nil {
+		return AsyncPublishConfig{}, err
+	}
+
+	batchSize, err := getEnvInt("EVENT_PUBLISH_BATCH_SIZE", 100)
+	if err != nil {
+		return AsyncPublishConfig{}, err
+	}
+
+	lingerMS, err := getEnvInt("EVENT_PUBLISH_LINGER_MS", 10)
+	if err != nil {
+		return AsyncPublishConfig{}, err
+	}
+
+	if queueSize <= 0 || batchSize <= 0 {
+		return AsyncPublishConfig{}, errors.New("EVENT_PUBLISH_QUEUE_SIZE and EVENT_PUBLISH_BATCH_SIZE must be positive")
+	}
+	if lingerMS < 0 {
+		return AsyncPublishConfig{}, errors.New("EVENT_PUBLISH_LINGER_MS must not be negative")
+	}
+
+	target := strings.ToLower(utils.GetEnv("EVENT_DEAD_LETTER", "topic"))
+	if target != "topic" && target != "file" && target != "none" {
+		return AsyncPublishConfig{}, errors.New("EVENT_DEAD_LETTER must be topic, file or none")
+	}
+
+	return AsyncPublishConfig{
+		QueueSize: queueSize,
+		BatchSize: batchSize,
+		Linger:    time.Duration(lingerMS) * time.Millisecond,
+		DeadLetter: DeadLetterConfig{
+			Target: target,
+			Topic:  utils.GetEnv("EVENT_TOPIC_PREFIX", "") + utils.GetEnv("EVENT_DEAD_LETTER_TOPIC", "company.dead-letter"),
+			Path:   utils.GetEnv("EVENT_DEAD_LETTER_FILE_PATH", "dead-letter.ndjson"),
+		},
+	}, nil
+}
+
+// loadOutboxConfig loads the outbox relay configuration
+func loadOutboxConfig() (OutboxConfig, error) {
+	pollIntervalMS, err := getEnvInt("OUTBOX_POLL_INTERVAL_MS", 1000)
+	if err != nil {
+		return OutboxConfig{}, err
+	}
+
+	batchSize, err := getEnvInt("OUTBOX_BATCH_SIZE", 100)
+	if err != nil {
+		return OutboxConfig{}, err
+	}
+
+	initialBackoffMS, err := getEnvInt("OUTBOX_INITIAL_BACKOFF_MS", 500)
+	if err != nil {
+		return OutboxConfig{}, err
+	}
+
+	maxBackoffSeconds, err := getEnvInt("OUTBOX_MAX_BACKOFF_SECONDS", 300)
+	if err != nil {
+		return OutboxConfig{}, err
+	}
+
+	maxAttempts, err := getEnvInt("OUTBOX_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return OutboxConfig{}, err
+	}
+
+	leaseSeconds, err := getEnvInt("OUTBOX_LEASE_SECONDS", 60)
+	if err != nil {
+		return OutboxConfig{}, err
+	}
+
+	if pollIntervalMS <= 0 || batchSize <= 0 || initialBackoffMS <= 0 || maxBackoffSeconds <= 0 ||
+		maxAttempts <= 0 || leaseSeconds <= 0 {
+		return OutboxConfig{}, fmt.Errorf("OUTBOX_* settings must be positive")
+	}
+
+	return OutboxConfig{
+		PollInterval:   time.Duration(pollIntervalMS) * time.Millisecond,
+		BatchSize:      batchSize,
+		InitialBackoff: time.Duration(initialBackoffMS) * time.Millisecond,
+		MaxBackoff:     time.Duration(maxBackoffSeconds) * time.Second,
+		MaxAttempts:    maxAttempts,
+		Lease:          time.Duration(leaseSeconds) * time.Second,
 	}, nil
 }
+
+// loadConsumerConfig loads the inbound company consumer configuration
+func loadConsumerConfig() (ConsumerConfig, error) {
+	enabled, err := getEnvBool("CONSUMER_ENABLED", false)
+	if err != nil {
+		return ConsumerConfig{}, err
+	}
+
+	maxAttempts, err := getEnvInt("CONSUMER_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return ConsumerConfig{}, err
+	}
+
+	initialBackoffMS, err := getEnvInt("CONSUMER_INITIAL_BACKOFF_MS", 100)
+	if err != nil {
+		return ConsumerConfig{}, err
+	}
+
+	maxBackoffMS, err := getEnvInt("CONSUMER_MAX_BACKOFF_MS", 5000)
+	if err != nil {
+		return ConsumerConfig{}, err
+	}
+
+	if maxAttempts <= 0 || initialBackoffMS <= 0 || maxBackoffMS <= 0 {
+		return ConsumerConfig{}, errors.New("CONSUMER_MAX_ATTEMPTS and CONSUMER_*_BACKOFF_MS must be positive")
+	}
+
+	cfg := ConsumerConfig{
+		Enabled:         enabled,
+		Topic:           utils.GetEnv("CONSUMER_TOPIC", "crm.company.changes"),
+		GroupID:         utils.GetEnv("CONSUMER_GROUP_ID", "xm-exercise"),
+		DeadLetterTopic: utils.GetEnv("CONSUMER_DEAD_LETTER_TOPIC", "crm.company.changes.dead-letter"),
+		MaxAttempts:     maxAttempts,
+		InitialBackoff:  time.Duration(initialBackoffMS) * time.Millisecond,
+		MaxBackoff:      time.Duration(maxBackoffMS) * time.Millisecond,
+	}
+	if cfg.Topic == "" || cfg.GroupID == "" || cfg.DeadLetterTopic == "" {
+		return ConsumerConfig{}, errors.New("CONSUMER_TOPIC, CONSUMER_GROUP_ID and CONSUMER_DEAD_LETTER_TOPIC must not be empty")
+	}
+
+	return cfg, nil
+}
+
+// loadWebhookConfig loads the webhook delivery configuration
+func loadWebhookConfig() (WebhookConfig, error) {
+	pollIntervalMS, err := getEnvInt("WEBHOOK_POLL_INTERVAL_MS", 1000)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	batchSize, err := getEnvInt("WEBHOOK_BATCH_SIZE", 50)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	concurrency, err := getEnvInt("WEBHOOK_CONCURRENCY", 10)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	timeoutSeconds, err := getEnvInt("WEBHOOK_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	maxAttempts, err := getEnvInt("WEBHOOK_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	initialBackoffSeconds, err := getEnvInt("WEBHOOK_INITIAL_BACKOFF_SECONDS", 10)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	maxBackoffSeconds, err := getEnvInt("WEBHOOK_MAX_BACKOFF_SECONDS", 3600)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	disableAfter, err := getEnvInt("WEBHOOK_DISABLE_AFTER_FAILURES", 50)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	leaseSeconds, err := getEnvInt("WEBHOOK_LEASE_SECONDS", 120)
+	if err != nil {
+		return WebhookConfig{}, err
+	}
+
+	if pollIntervalMS <= 0 || batchSize <= 0 || concurrency <= 0 || timeoutSeconds <= 0 ||
+		maxAttempts <= 0 || initialBackoffSeconds <= 0 || maxBackoffSeconds <= 0 || disableAfter <= 0 ||
+		leaseSeconds <= 0 {
+		return WebhookConfig{}, errors.New("WEBHOOK_* settings must be positive")
+	}
+
+	var allowedNetworks []netip.Prefix
+	for _, network := range strings.Split(utils.GetEnv("WEBHOOK_ALLOWED_NETWORKS", ""), ",") {
+		if network = strings.TrimSpace(network); network == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(network)
+			if addrErr != nil {
+				return WebhookConfig{}, fmt.Errorf("invalid WEBHOOK_ALLOWED_NETWORKS entry %q: %w", network, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		allowedNetworks = append(allowedNetworks, prefix.Masked())
+	}
+
+	return WebhookConfig{
+		PollInterval:    time.Duration(pollIntervalMS) * time.Millisecond,
+		BatchSize:       batchSize,
+		Concurrency:     concurrency,
+		Timeout:         time.Duration(timeoutSeconds) * time.Second,
+		MaxAttempts:     maxAttempts,
+		InitialBackoff:  time.Duration(initialBackoffSeconds) * time.Second,
+		MaxBackoff:      time.Duration(maxBackoffSeconds) * time.Second,
+		DisableAfter:    disableAfter,
+		Lease:           time.Duration(leaseSeconds) * time.Second,
+		AllowedNetworks: allowedNetworks,
+	}, nil
+}
+
+// loadStreamConfig loads the live change feed configuration
+func loadStreamConfig() (StreamConfig, error) {
+	bufferSize, err := getEnvInt("STREAM_BUFFER_SIZE", 1000)
+	if err != nil {
+		return StreamConfig{}, err
+	}
+
+	subscriberBuffer, err := getEnvInt("STREAM_SUBSCRIBER_BUFFER", 64)
+	if err != nil {
+		return StreamConfig{}, err
+	}
+
+	heartbeatSeconds, err := getEnvInt("STREAM_HEARTBEAT_SECONDS", 15)
+	if err != nil {
+		return StreamConfig{}, err
+	}
+
+	writeTimeoutSeconds, err := getEnvInt("STREAM_WRITE_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return StreamConfig{}, err
+	}
+
+	if bufferSize <= 0 || subscriberBuffer <= 0 || heartbeatSeconds <= 0 || writeTimeoutSeconds <= 0 {
+		return StreamConfig{}, errors.New("STREAM_* settings must be positive")
+	}
+
+	return StreamConfig{
+		BufferSize:       bufferSize,
+		SubscriberBuffer: subscriberBuffer,
+		Heartbeat:        time.Duration(heartbeatSeconds) * time.Second,
+		WriteTimeout:     time.Duration(writeTimeoutSeconds) * time.Second,
+	}, nil
+}
+
+// loadMigrationConfig loads the schema migration configuration
+func loadMigrationConfig() (MigrationConfig, error) {
+	mode := strings.ToLower(utils.GetEnv("DATABASE_MIGRATIONS", "up"))
+	if mode != "up" && mode != "check" && mode != "off" {
+		return MigrationConfig{}, errors.New("DATABASE_MIGRATIONS must be up, check or off")
+	}
+
+	lockTimeoutSeconds, err := getEnvInt("DATABASE_MIGRATION_LOCK_TIMEOUT_SECONDS", 60)
+	if err != nil {
+		return MigrationConfig{}, err
+	}
+	if lockTimeoutSeconds <= 0 {
+		return MigrationConfig{}, errors.New("DATABASE_MIGRATION_LOCK_TIMEOUT_SECONDS must be positive")
+	}
+
+	return MigrationConfig{Mode: mode, LockTimeout: time.Duration(lockTimeoutSeconds) * time.Second}, nil
+}
+
+// loadPoolConfig loads the database connection pool configuration
+func loadPoolConfig() (PoolConfig, error) {
+	maxOpenConns, err := getEnvInt("DATABASE_MAX_OPEN_CONNS", 100)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	if maxOpenConns <= 0 {
+		return PoolConfig{}, errors.New("DATABASE_MAX_OPEN_CONNS must be positive")
+	}
+
+	maxIdleConns, err := getEnvInt("DATABASE_MAX_IDLE_CONNS", 10)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	if maxIdleConns < 0 {
+		return PoolConfig{}, errors.New("DATABASE_MAX_IDLE_CONNS must not be negative")
+	}
+
+	connMaxLifetime, err := getEnvInt("DATABASE_CONN_MAX_LIFETIME_SECONDS", 3600)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	connMaxIdleTime, err := getEnvInt("DATABASE_CONN_MAX_IDLE_TIME_SECONDS", 300)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	statementTimeout, err := getEnvInt("DATABASE_STATEMENT_TIMEOUT_SECONDS", 0)
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	if connMaxLifetime < 0 || connMaxIdleTime < 0 || statementTimeout < 0 {
+		return PoolConfig{}, errors.New("DATABASE_CONN_MAX_LIFETIME_SECONDS, DATABASE_CONN_MAX_IDLE_TIME_SECONDS " +
+			"and DATABASE_STATEMENT_TIMEOUT_SECONDS must not be negative")
+	}
+
+	return PoolConfig{
+		MaxOpenConns:     maxOpenConns,
+		MaxIdleConns:     maxIdleConns,
+		ConnMaxLifetime:  time.Duration(connMaxLifetime) * time.Second,
+		ConnMaxIdleTime:  time.Duration(connMaxIdleTime) * time.Second,
+		StatementTimeout: time.Duration(statementTimeout) * time.Second,
+	}, nil
+}
+
+// loadReplicaConfig loads the read replica configuration
+func loadReplicaConfig() (ReplicaConfig, error) {
+	var urls []string
+	for _, url := range strings.Split(utils.GetEnv("DATABASE_REPLICA_URLS", ""), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			urls = append(urls, url)
+		}
+	}
+
+	healthInterval, err := getEnvInt("DATABASE_REPLICA_HEALTH_INTERVAL_SECONDS", 5)
+	if err != nil {
+		return ReplicaConfig{}, err
+	}
+	if healthInterval <= 0 {
+		return ReplicaConfig{}, errors.New("DATABASE_REPLICA_HEALTH_INTERVAL_SECONDS must be positive")
+	}
+
+	readYourWrites, err := getEnvInt("DATABASE_READ_YOUR_WRITES_SECONDS", 5)
+	if err != nil {
+		return ReplicaConfig{}, err
+	}
+	if readYourWrites < 0 {
+		return ReplicaConfig{}, errors.New("DATABASE_READ_YOUR_WRITES_SECONDS must not be negative")
+	}
+
+	return ReplicaConfig{
+		URLs:           urls,
+		HealthInterval: time.Duration(healthInterval) * time.Second,
+		ReadYourWrites: time.Duration(readYourWrites) * time.Second,
+	}, nil
+}
+
+// loadReplayConfig loads the event replay configuration
+func loadReplayConfig() (ReplayConfig, error) {
+	rate, err := getEnvInt("REPLAY_RATE", 100)
+	if err != nil {
+		return ReplayConfig{}, err
+	}
+
+	batchSize, err := getEnvInt("REPLAY_BATCH_SIZE", 500)
+	if err != nil {
+		return ReplayConfig{}, err
+	}
+
+	if rate <= 0 || batchSize <= 0 {
+		return ReplayConfig{}, errors.New("REPLAY_* settings must be positive")
+	}
+
+	return ReplayConfig{Rate: rate, BatchSize: batchSize}, nil
+}
+
+// getEnvBool reads a boolean environment variable, returning defaultValue when unset
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value, err := strconv.ParseBool(utils.GetEnv(key, strconv.FormatBool(defaultValue)))
+	if err != nil {
+		return false, fmt.Errorf("%s must be a valid boolean", key)
+	}
+	return value, nil
+}
+
+// getEnvInt reads an integer environment variable, returning defaultValue when unset
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value, err := strconv.Atoi(utils.GetEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a valid integer", key)
+	}
+	return value, nil
+}
+
+// loadCacheConfig loads the company cache configuration
+func loadCacheConfig() (CacheConfig, error) {
+	backend := strings.ToLower(utils.GetEnv("CACHE_BACKEND", "memory"))
+	if backend != "memory" && backend != "redis" && backend != "none" {
+		return CacheConfig{}, errors.New("CACHE_BACKEND must be memory, redis or none")
+	}
+
+	ttl, err := getEnvInt("CACHE_TTL_SECONDS", 60)
+	if err != nil {
+		return CacheConfig{}, err
+	}
+	if ttl <= 0 {
+		return CacheConfig{}, errors.New("CACHE_TTL_SECONDS must be positive")
+	}
+
+	negativeTTL, err := getEnvInt("CACHE_NEGATIVE_TTL_SECONDS", 5)
+	if err != nil {
+		return CacheConfig{}, err
+	}
+	if negativeTTL < 0 {
+		return CacheConfig{}, errors.New("CACHE_NEGATIVE_TTL_SECONDS must not be negative")
+	}
+
+	size, err := getEnvInt("CACHE_SIZE", 10000)
+	if err != nil {
+		return CacheConfig{}, err
+	}
+	redisPoolSize, err := getEnvInt("CACHE_REDIS_POOL_SIZE", 10)
+	if err != nil {
+		return CacheConfig{}, err
+	}
+	redisTimeout, err := getEnvInt("CACHE_REDIS_TIMEOUT_MS", 100)
+	if err != nil {
+		return CacheConfig{}, err
+	}
+	if size <= 0 || redisPoolSize <= 0 || redisTimeout <= 0 {
+		return CacheConfig{}, errors.New("CACHE_SIZE, CACHE_REDIS_POOL_SIZE and CACHE_REDIS_TIMEOUT_MS must be positive")
+	}
+
+	redisURL := utils.GetEnv("CACHE_REDIS_URL", "")
+	if backend == "redis" && redisURL == "" {
+		return CacheConfig{}, errors.New("CACHE_REDIS_URL is required with CACHE_BACKEND redis")
+	}
+
+	return CacheConfig{
+		Backend:       backend,
+		TTL:           time.Duration(ttl) * time.Second,
+		NegativeTTL:   time.Duration(negativeTTL) * time.Second,
+		Size:          size,
+		RedisURL:      redisURL,
+		RedisPoolSize: redisPoolSize,
+		RedisTimeout:  time.Duration(redisTimeout) * time.Millisecond,
+	}, nil
+}
+
+// loadCacheControlConfig loads the Cache-Control headers of the cacheable routes.
+// A value of none sends no header.
+func loadCacheControlConfig() CacheControlConfig {
+	cacheControl := func(key string) string {
+		value := utils.GetEnv(key, DefaultCacheControl)
+		if strings.EqualFold(value, "none") {
+			return ""
+		}
+		return value
+	}
+	return CacheControlConfig{
+		Company:           cacheControl("HTTP_CACHE_CONTROL_COMPANY"),
+		Webhooks:          cacheControl("HTTP_CACHE_CONTROL_WEBHOOKS"),
+		WebhookDeliveries: cacheControl("HTTP_CACHE_CONTROL_WEBHOOK_DELIVERIES"),
+	}
+}
@@ -0,0 +1,190 @@
+package consumer
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/utils"
+)
+
+var (
+	consumerProcessedTotal  = expvar.NewInt("consumer_processed_total")
+	consumerDuplicatesTotal = expvar.NewInt("consumer_duplicates_total")
+	consumerFailuresTotal   = expvar.NewInt("consumer_failures_total")
+	consumerDeadLettered    = expvar.NewInt("consumer_dead_lettered_total")
+)
+
+// Reader is the part of kafka.Reader used by the consumer
+type Reader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// Consumer reads upstream events and applies them with a Processor. A
+// message's offset is committed only once it is applied or dead-lettered, so
+// every message is processed at least once.
+type Consumer struct {
+	reader     Reader
+	processor  *Processor
+	deadLetter events.Publisher
+	cfg        config.ConsumerConfig
+}
+
+// NewConsumer creates a new consumer. Messages failing permanently or
+// MaxAttempts times are published to cfg.DeadLetterTopic through deadLetter,
+// which is tried as often.
+func NewConsumer(reader Reader, processor *Processor, deadLetter events.Publisher, cfg config.ConsumerConfig) *Consumer {
+	return &Consumer{
+		reader:     reader,
+		processor:  processor,
+		deadLetter: deadLetter,
+		cfg:        cfg,
+	}
+}
+
+// Run consumes messages until ctx is cancelled. The message being processed
+// at that point is left uncommitted and read again on the next start. A
+// message that can neither be applied nor dead-lettered stops the consumer
+// with an error, leaving it uncommitted rather than blocking forever.
+func (c *Consumer) Run(ctx context.Context) error {
+	logger.Info("Consumer started",
+		zap.String("topic", c.cfg.Topic),
+		zap.String("group_id", c.cfg.GroupID),
+	)
+
+	for failures := 0; ; {
+		message, err := c.reader.FetchMessage(ctx)
+		if err == nil {
+			if err := c.handle(ctx, message); err != nil {
+				if ctx.Err() != nil {
+					logger.Info("Consumer stopped")
+					return nil
+				}
+				return err
+			}
+			err = c.reader.CommitMessages(ctx, message)
+		}
+		if ctx.Err() != nil {
+			logger.Info("Consumer stopped")
+			return nil
+		}
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		failures++
+		logger.Error("Failed to consume message", zap.Error(err), zap.Int("failures", failures))
+		if !c.sleep(ctx, failures) {
+			logger.Info("Consumer stopped")
+			return nil
+		}
+	}
+}
+
+// Close closes the reader
+func (c *Consumer) Close() error {
+	return c.reader.Close()
+}
+
+// handle processes message, retrying failures and dead-lettering it once it
+// fails permanently or runs out of attempts
+func (c *Consumer) handle(ctx context.Context, message kafka.Message) error {
+	fields := []zap.Field{
+		zap.String("topic", message.Topic),
+		zap.Int("partition", message.Partition),
+		zap.Int64("offset", message.Offset),
+	}
+
+	for attempts := 1; ; attempts++ {
+		result, err := c.processor.Process(ctx, message.Topic, message.Value)
+		if err == nil {
+			if result == ResultDuplicate {
+				consumerDuplicatesTotal.Add(1)
+			} else {
+				consumerProcessedTotal.Add(1)
+			}
+			logger.Debug("Message processed", append(fields, zap.String("result", string(result)))...)
+			return nil
+		}
+
+		consumerFailuresTotal.Add(1)
+		if isPermanent(err) || attempts >= c.cfg.MaxAttempts {
+			return c.deadLetterMessage(ctx, message, err, attempts)
+		}
+
+		logger.Warn("Failed to process message, retrying",
+			append(fields, zap.Error(err), zap.Int("attempts", attempts))...)
+		if !c.sleep(ctx, attempts) {
+			return ctx.Err()
+		}
+	}
+}
+
+// deadLetterMessage publishes message to the dead-letter topic, trying up to
+// MaxAttempts times. No message is committed unhandled, so the error of the
+// last attempt is returned for the consumer to stop on.
+func (c *Consumer) deadLetterMessage(ctx context.Context, message kafka.Message, processErr error, attempts int) error {
+	headers := make(map[string]string, len(message.Headers)+3)
+	for _, header := range message.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	headers[events.DeadLetterTopicHeader] = message.Topic
+	headers[events.DeadLetterErrorHeader] = processErr.Error()
+	headers[events.DeadLetterAttemptsHeader] = fmt.Sprint(attempts)
+
+	deadLetter := events.Message{
+		Topic:   c.cfg.DeadLetterTopic,
+		Key:     string(message.Key),
+		Headers: headers,
+		Value:   message.Value,
+	}
+
+	fields := []zap.Field{
+		zap.NamedError("process_error", processErr),
+		zap.String("topic", message.Topic),
+		zap.Int("partition", message.Partition),
+		zap.Int64("offset", message.Offset),
+		zap.Int("attempts", attempts),
+	}
+	for failures := 1; ; failures++ {
+		err := c.deadLetter.Publish(ctx, deadLetter)
+		if err == nil {
+			consumerDeadLettered.Add(1)
+			logger.Error("Message dead-lettered", fields...)
+			return nil
+		}
+
+		logger.Error("Failed to dead-letter message", append(fields, zap.Error(err), zap.Int("failures", failures))...)
+		if failures >= c.cfg.MaxAttempts {
+			return fmt.Errorf("error dead-lettering message at offset %d of partition %d of %s: %w",
+				message.Offset, message.Partition, message.Topic, err)
+		}
+		if !c.sleep(ctx, failures) {
+			return ctx.Err()
+		}
+	}
+}
+
+// sleep waits for the backoff of the given attempt, returning false if ctx is
+// cancelled first
+func (c *Consumer) sleep(ctx context.Context, attempts int) bool {
+	timer := time.NewTimer(utils.Backoff(c.cfg.InitialBackoff, c.cfg.MaxBackoff, attempts-1))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,341 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/stream"
+	"xm-exercise/pkg/models"
+)
+
+// fakeReader serves queued messages and records the committed ones
+type fakeReader struct {
+	mu        sync.Mutex
+	messages  chan kafka.Message
+	committed []kafka.Message
+}
+
+func newFakeReader(messages ...kafka.Message) *fakeReader {
+	reader := &fakeReader{messages: make(chan kafka.Message, len(messages))}
+	for _, message := range messages {
+		reader.messages <- message
+	}
+	return reader
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case message := <-r.messages:
+		return message, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, messages ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.committed = append(r.committed, messages...)
+	return nil
+}
+
+func (r *fakeReader) Close() error {
+	return nil
+}
+
+func (r *fakeReader) committedOffsets() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offsets := make([]int64, len(r.committed))
+	for i, message := range r.committed {
+		offsets[i] = message.Offset
+	}
+	return offsets
+}
+
+// recordingPublisher records published messages, failing while failures > 0
+type recordingPublisher struct {
+	mu        sync.Mutex
+	failures  int
+	published []events.Message
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, message events.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, message)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func (p *recordingPublisher) messages() []events.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]events.Message(nil), p.published...)
+}
+
+// newTestProcessor creates a processor on a new database holding the organization
+func newTestProcessor(t *testing.T, organizationID string) (*Processor, *db.Database) {
+	t.Helper()
+	database := dbtest.NewSQLite(t)
+	require.NoError(t, db.NewOrganizationRepository(database).Create(context.Background(),
+		&models.Organization{ID: organizationID, Name: "Acme Holdings"}))
+
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	return NewProcessor(database, encoder, nil), database
+}
+
+func testConsumerConfig() config.ConsumerConfig {
+	return config.ConsumerConfig{
+		Topic:           "crm.company.changes",
+		GroupID:         "test",
+		DeadLetterTopic: "crm.company.changes.dead-letter",
+		MaxAttempts:     3,
+		InitialBackoff:  time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+	}
+}
+
+// encodeEvent builds the value of an upstream event
+func encodeEvent(t *testing.T, eventType, organizationID, companyID string, data any) []byte {
+	t.Helper()
+	event := map[string]any{
+		"id":              uuid.New().String(),
+		"type":            eventType,
+		"organization_id": organizationID,
+		"company_id":      companyID,
+	}
+	if data != nil {
+		event["data"] = data
+	}
+	value, err := json.Marshal(event)
+	require.NoError(t, err)
+	return value
+}
+
+func createRequest(name string) models.CompanyCreateRequest {
+	registered := true
+	return models.CompanyCreateRequest{
+		Name:          name,
+		EmployeeCount: 10,
+		Registered:    &registered,
+		Type:          models.TypeCorporation,
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	ctx := context.Background()
+	organizationID := uuid.New().String()
+
+	t.Run("applies creates, updates and deletes", func(t *testing.T) {
+		processor, database := newTestProcessor(t, organizationID)
+		companyID := uuid.New().String()
+		companyRepo := db.NewCompanyRepository(database).ForOrganization(organizationID)
+
+		result, err := processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyCreated, organizationID, companyID, createRequest("Acme")))
+		require.NoError(t, err)
+		assert.Equal(t, ResultApplied, result)
+		company, err := companyRepo.GetByID(context.Background(), companyID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme", company.Name)
+
+		result, err = processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyUpdated, organizationID, companyID,
+			map[string]any{"employee_count": 20}))
+		require.NoError(t, err)
+		assert.Equal(t, ResultApplied, result)
+		company, err = companyRepo.GetByID(context.Background(), companyID)
+		require.NoError(t, err)
+		assert.Equal(t, 20, company.EmployeeCount)
+
+		result, err = processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyUpdated, organizationID, companyID,
+			map[string]any{"employee_count": 20}))
+		require.NoError(t, err)
+		assert.Equal(t, ResultUnchanged, result)
+
+		result, err = processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyDeleted, organizationID, companyID, nil))
+		require.NoError(t, err)
+		assert.Equal(t, ResultApplied, result)
+		_, err = companyRepo.GetByID(context.Background(), companyID)
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+
+		result, err = processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyDeleted, organizationID, companyID, nil))
+		require.NoError(t, err)
+		assert.Equal(t, ResultUnchanged, result)
+
+		stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stats.Pending)
+	})
+
+	t.Run("skips redelivered events", func(t *testing.T) {
+		processor, database := newTestProcessor(t, organizationID)
+		value := encodeEvent(t, events.EventCompanyCreated, organizationID, uuid.New().String(), createRequest("Acme"))
+
+		result, err := processor.Process(ctx, "crm", value)
+		require.NoError(t, err)
+		assert.Equal(t, ResultApplied, result)
+
+		result, err = processor.Process(ctx, "crm", value)
+		require.NoError(t, err)
+		assert.Equal(t, ResultDuplicate, result)
+
+		stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), stats.Pending)
+	})
+
+	t.Run("rolls back failed events so they can be retried", func(t *testing.T) {
+		processor, database := newTestProcessor(t, organizationID)
+		existingID := uuid.New().String()
+		_, err := processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyCreated, organizationID, existingID, createRequest("Acme")))
+		require.NoError(t, err)
+
+		value := encodeEvent(t, events.EventCompanyCreated, organizationID, uuid.New().String(), createRequest("Acme"))
+		_, err = processor.Process(ctx, "crm", value)
+		assert.ErrorContains(t, err, "company name already exists")
+
+		var processed int64
+		require.NoError(t, database.Model(&models.ProcessedEvent{}).Count(&processed).Error)
+		assert.Equal(t, int64(1), processed)
+	})
+
+	t.Run("publishes committed changes to the stream", func(t *testing.T) {
+		processor, _ := newTestProcessor(t, organizationID)
+		var changes stream.Batch
+		processor.publisher = &changes
+		companyID := uuid.New().String()
+
+		value := encodeEvent(t, events.EventCompanyCreated, organizationID, companyID, createRequest("Acme"))
+		_, err := processor.Process(ctx, "crm", value)
+		require.NoError(t, err)
+		_, err = processor.Process(ctx, "crm", value)
+		require.NoError(t, err)
+		_, err = processor.Process(ctx, "crm", encodeEvent(t, events.EventCompanyCreated, organizationID, uuid.New().String(), createRequest("Acme")))
+		require.Error(t, err)
+
+		require.Len(t, changes, 1, "duplicates and failed events publish nothing")
+		assert.Equal(t, events.EventCompanyCreated, changes[0].Type)
+		assert.Equal(t, companyID, changes[0].CompanyID)
+		assert.Equal(t, organizationID, changes[0].OrganizationID)
+	})
+
+	for name, value := range map[string][]byte{
+		"malformed JSON":       []byte(`{"id":`),
+		"missing event ID":     []byte(`{"type":"company.deleted","organization_id":"` + organizationID + `","company_id":"` + uuid.New().String() + `"}`),
+		"unsupported type":     encodeEvent(t, "company.merged", organizationID, uuid.New().String(), nil),
+		"invalid company ID":   encodeEvent(t, events.EventCompanyDeleted, organizationID, "acme", nil),
+		"failing validation":   encodeEvent(t, events.EventCompanyCreated, organizationID, uuid.New().String(), createRequest("")),
+		"unknown data fields":  encodeEvent(t, events.EventCompanyUpdated, organizationID, uuid.New().String(), map[string]any{"colour": "red"}),
+		"update of no company": encodeEvent(t, events.EventCompanyUpdated, organizationID, uuid.New().String(), map[string]any{"employee_count": 5}),
+		"unknown organization": encodeEvent(t, events.EventCompanyCreated, uuid.New().String(), uuid.New().String(), createRequest("Acme")),
+	} {
+		t.Run("fails permanently on "+name, func(t *testing.T) {
+			processor, _ := newTestProcessor(t, organizationID)
+			_, err := processor.Process(ctx, "crm", value)
+			require.Error(t, err)
+			assert.True(t, isPermanent(err), err.Error())
+		})
+	}
+}
+
+func TestConsumer(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	organizationID := uuid.New().String()
+
+	t.Run("commits applied messages and dead-letters poison ones", func(t *testing.T) {
+		processor, database := newTestProcessor(t, organizationID)
+		companyID := uuid.New().String()
+		reader := newFakeReader(
+			kafka.Message{Topic: "crm", Offset: 1, Key: []byte(companyID),
+				Value: encodeEvent(t, events.EventCompanyCreated, organizationID, companyID, createRequest("Acme"))},
+			kafka.Message{Topic: "crm", Offset: 2, Key: []byte("poison"), Value: []byte("not json"),
+				Headers: []kafka.Header{{Key: "source", Value: []byte("crm")}}},
+		)
+		deadLetter := &recordingPublisher{failures: 1}
+		consumer := NewConsumer(reader, processor, deadLetter, testConsumerConfig())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.NoError(t, consumer.Run(ctx))
+		}()
+		require.Eventually(t, func() bool { return len(reader.committedOffsets()) == 2 }, time.Second, time.Millisecond)
+		cancel()
+		<-done
+
+		assert.Equal(t, []int64{1, 2}, reader.committedOffsets())
+		_, err := db.NewCompanyRepository(database).ForOrganization(organizationID).GetByID(context.Background(), companyID)
+		assert.NoError(t, err)
+
+		dead := deadLetter.messages()
+		require.Len(t, dead, 1)
+		assert.Equal(t, "crm.company.changes.dead-letter", dead[0].Topic)
+		assert.Equal(t, "poison", dead[0].Key)
+		assert.Equal(t, "not json", string(dead[0].Value))
+		assert.Equal(t, "crm", dead[0].Headers["source"])
+		assert.Equal(t, "crm", dead[0].Headers[events.DeadLetterTopicHeader])
+		assert.Equal(t, "1", dead[0].Headers[events.DeadLetterAttemptsHeader])
+		assert.Contains(t, dead[0].Headers[events.DeadLetterErrorHeader], "invalid event")
+	})
+
+	t.Run("leaves the message uncommitted when stopped", func(t *testing.T) {
+		processor, _ := newTestProcessor(t, organizationID)
+		reader := newFakeReader(kafka.Message{Topic: "crm", Offset: 1, Value: []byte("not json")})
+		deadLetter := &recordingPublisher{failures: 1 << 30}
+		cfg := testConsumerConfig()
+		cfg.MaxAttempts = 1 << 30
+		consumer := NewConsumer(reader, processor, deadLetter, cfg)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		assert.NoError(t, consumer.Run(ctx))
+
+		assert.Empty(t, reader.committedOffsets())
+		assert.Empty(t, deadLetter.messages())
+	})
+
+	t.Run("stops when a message cannot be dead-lettered", func(t *testing.T) {
+		processor, _ := newTestProcessor(t, organizationID)
+		reader := newFakeReader(
+			kafka.Message{Topic: "crm", Offset: 1, Value: []byte("not json")},
+			kafka.Message{Topic: "crm", Offset: 2, Value: []byte("not json")},
+		)
+		deadLetter := &recordingPublisher{failures: 1 << 30}
+		consumer := NewConsumer(reader, processor, deadLetter, testConsumerConfig())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := consumer.Run(ctx)
+
+		assert.ErrorContains(t, err, "error dead-lettering message at offset 1")
+		assert.NoError(t, ctx.Err(), "the consumer stopped by itself")
+		assert.Empty(t, reader.committedOffsets())
+		deadLetter.mu.Lock()
+		defer deadLetter.mu.Unlock()
+		assert.Equal(t, 1<<30-testConsumerConfig().MaxAttempts, deadLetter.failures, "publishing was tried MaxAttempts times")
+	})
+}
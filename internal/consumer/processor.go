@@ -0,0 +1,242 @@
+// Package consumer applies company changes published by upstream systems to
+// an inbound Kafka topic, through the same service as the HTTP API.
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/outbox"
+	"xm-exercise/internal/service"
+	"xm-exercise/internal/stream"
+	"xm-exercise/pkg/models"
+)
+
+// Event is an upstream company change. Data holds a company create request
+// for company.created, a company update request for company.updated and
+// nothing for company.deleted.
+type Event struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	OrganizationID string          `json:"organization_id"`
+	CompanyID      string          `json:"company_id"`
+	Data           json.RawMessage `json:"data"`
+}
+
+// Result describes what processing an event did
+type Result string
+
+const (
+	// ResultApplied means the change was written
+	ResultApplied Result = "applied"
+	// ResultUnchanged means the company already was in the requested state
+	ResultUnchanged Result = "unchanged"
+	// ResultDuplicate means the event had been processed before
+	ResultDuplicate Result = "duplicate"
+)
+
+// permanentError marks a failure that would repeat however often the event is processed
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent marks err as permanent
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether err would repeat on every attempt
+func isPermanent(err error) bool {
+	var pe *permanentError
+	return errors.As(err, &pe)
+}
+
+// Processor applies upstream events. Each event is applied, its outbox events
+// recorded and its ID marked as processed in one transaction, so redelivered
+// events are skipped.
+type Processor struct {
+	transactions *db.TransactionManager
+	encoder      *events.Encoder
+	// publisher, if set, receives the changes of committed events
+	publisher stream.Publisher
+}
+
+// NewProcessor creates a new processor writing to database and handing the
+// changes it commits to publisher, which may be nil
+func NewProcessor(database *db.Database, encoder *events.Encoder, publisher stream.Publisher) *Processor {
+	return &Processor{transactions: db.NewTransactionManager(database), encoder: encoder, publisher: publisher}
+}
+
+// Process decodes an event read from topic and applies it. Errors that would
+// repeat on every attempt, like malformed or invalid events, are permanent.
+func (p *Processor) Process(ctx context.Context, topic string, value []byte) (Result, error) {
+	event, err := decodeEvent(value)
+	if err != nil {
+		return "", permanent(err)
+	}
+
+	var result Result
+	var changes stream.Batch
+	err = p.transactions.Do(ctx, func(ctx context.Context, repos *db.Repositories) error {
+		changes = nil
+		processed := repos.ProcessedEvents
+		seen, err := processed.Exists(ctx, event.ID)
+		if err != nil {
+			return fmt.Errorf("error checking processed events: %w", err)
+		}
+		if seen {
+			result = ResultDuplicate
+			return nil
+		}
+
+		result, err = p.apply(ctx, repos, event, &changes)
+		if err != nil {
+			return err
+		}
+
+		if err := processed.Add(ctx, &models.ProcessedEvent{
+			ID:          event.ID,
+			Topic:       topic,
+			EventType:   event.Type,
+			ProcessedAt: time.Now().UTC(),
+		}); err != nil {
+			return fmt.Errorf("error recording processed event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if p.publisher != nil && len(changes) > 0 {
+		p.publisher.Publish(changes...)
+	}
+	return result, nil
+}
+
+// apply applies event with the repositories of a transaction, adding the changes made to changes
+func (p *Processor) apply(
+	ctx context.Context,
+	repos *db.Repositories,
+	event Event,
+	changes *stream.Batch,
+) (Result, error) {
+	var transactor service.Transactor = outbox.NewTransactor(repos.Tx, p.encoder)
+	if p.publisher != nil {
+		transactor = stream.NewTransactor(transactor, changes)
+	}
+	companies := service.NewCompanyService(transactor)
+	companyRepo := repos.Companies.ForOrganization(event.OrganizationID)
+
+	// The organization is not taken on trust, so a mistyped or forged ID can
+	// neither create companies without an owner nor touch another tenant's
+	if _, err := repos.Organizations.GetByID(ctx, event.OrganizationID); err != nil {
+		if errors.Is(err, db.ErrOrganizationNotFound) {
+			return "", permanent(fmt.Errorf("organization %s not found", event.OrganizationID))
+		}
+		return "", fmt.Errorf("error loading organization: %w", err)
+	}
+
+	switch event.Type {
+	case events.EventCompanyCreated:
+		var req models.CompanyCreateRequest
+		if err := decodeData(event.Data, &req); err != nil {
+			return "", err
+		}
+		_, err := companyRepo.GetByID(ctx, event.CompanyID)
+		if err == nil {
+			return "", permanent(fmt.Errorf("company %s already exists", event.CompanyID))
+		}
+		if !errors.Is(err, db.ErrCompanyNotFound) {
+			return "", fmt.Errorf("error loading company: %w", err)
+		}
+		if _, err := companies.Create(ctx, event.OrganizationID, event.CompanyID, req); err != nil {
+			return "", serviceError(err)
+		}
+		return ResultApplied, nil
+
+	case events.EventCompanyUpdated:
+		var updates models.CompanyUpdateRequest
+		if err := decodeData(event.Data, &updates); err != nil {
+			return "", err
+		}
+		_, changed, err := companies.Update(ctx, event.OrganizationID, event.CompanyID, updates)
+		if errors.Is(err, db.ErrCompanyNotFound) {
+			return "", permanent(fmt.Errorf("company %s not found", event.CompanyID))
+		}
+		if err != nil {
+			return "", serviceError(err)
+		}
+		if !changed {
+			return ResultUnchanged, nil
+		}
+		return ResultApplied, nil
+
+	case events.EventCompanyDeleted:
+		_, err := companies.Delete(ctx, event.OrganizationID, event.CompanyID)
+		if errors.Is(err, db.ErrCompanyNotFound) {
+			return ResultUnchanged, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return ResultApplied, nil
+
+	default:
+		return "", permanent(fmt.Errorf("unsupported event type %q", event.Type))
+	}
+}
+
+// decodeEvent decodes and checks the envelope of an upstream event
+func decodeEvent(value []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(value, &event); err != nil {
+		return Event{}, fmt.Errorf("invalid event: %w", err)
+	}
+
+	if event.ID == "" {
+		return Event{}, errors.New("event id is required")
+	}
+	if _, err := uuid.Parse(event.OrganizationID); err != nil {
+		return Event{}, errors.New("event organization_id must be a UUID")
+	}
+	if _, err := uuid.Parse(event.CompanyID); err != nil {
+		return Event{}, errors.New("event company_id must be a UUID")
+	}
+	return event, nil
+}
+
+// decodeData decodes the event data into target, rejecting unknown fields
+func decodeData(data json.RawMessage, target any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		return permanent(fmt.Errorf("invalid event data: %w", err))
+	}
+	return nil
+}
+
+// serviceError marks the service errors caused by the event itself, failing
+// validation or clashing with an existing company, as permanent
+func serviceError(err error) error {
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) || errors.Is(err, db.ErrConflict) {
+		return permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"xm-exercise/pkg/models"
+)
+
+// ReplayFilter selects the companies or logged events of a replay. Empty
+// fields match everything.
+type ReplayFilter struct {
+	OrganizationID string
+	CompanyIDs     []string
+	// EventTypes, Since and Until only apply to logged events
+	EventTypes []string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+// CompanyEventRepository handles database operations for the company event log
+// and the reads of replays, which unlike CompanyRepository span organizations
+type CompanyEventRepository struct {
+	db *Database
+}
+
+// NewCompanyEventRepository creates a new company event repository
+func NewCompanyEventRepository(db *Database) *CompanyEventRepository {
+	return &CompanyEventRepository{db: db}
+}
+
+// Add appends an event to the log
+func (r *CompanyEventRepository) Add(ctx context.Context, event *models.CompanyEvent) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Create(event).Error
+}
+
+// LastSequence returns the sequence number of the latest logged event, or zero
+func (r *CompanyEventRepository) LastSequence(ctx context.Context) (uint64, error) {
+	var sequence uint64
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	err := query.Model(&models.CompanyEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&sequence).Error
+	return sequence, err
+}
+
+// Events returns up to limit logged events matching filter with a sequence
+// number after afterSequence and up to untilSequence, in log order
+func (r *CompanyEventRepository) Events(
+	ctx context.Context,
+	filter ReplayFilter,
+	afterSequence, untilSequence uint64,
+	limit int,
+) ([]models.CompanyEvent, error) {
+	var events []models.CompanyEvent
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	err := r.events(query, filter).
+		Where("sequence > ? AND sequence <= ?", afterSequence, untilSequence).
+		Order("sequence").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// CountEvents returns the number of logged events matching filter up to untilSequence
+func (r *CompanyEventRepository) CountEvents(
+	ctx context.Context,
+	filter ReplayFilter,
+	untilSequence uint64,
+) (int64, error) {
+	var count int64
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	err := r.events(query, filter).Where("sequence <= ?", untilSequence).Count(&count).Error
+	return count, err
+}
+
+// Companies returns up to limit current companies matching filter with an ID
+// after afterID, ordered by ID
+func (r *CompanyEventRepository) Companies(
+	ctx context.Context,
+	filter ReplayFilter,
+	afterID string,
+	limit int,
+) ([]models.Company, error) {
+	var companies []models.Company
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := r.companies(query, filter).
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&companies).Error
+	return companies, err
+}
+
+// CountCompanies returns the number of current companies matching filter
+func (r *CompanyEventRepository) CountCompanies(ctx context.Context, filter ReplayFilter) (int64, error) {
+	var count int64
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := r.companies(query, filter).Count(&count).Error
+	return count, err
+}
+
+// events narrows session to the logged events matching filter
+func (r *CompanyEventRepository) events(session *gorm.DB, filter ReplayFilter) *gorm.DB {
+	query := session.Model(&models.CompanyEvent{})
+	if filter.OrganizationID != "" {
+		query = query.Where("organization_id = ?", filter.OrganizationID)
+	}
+	if len(filter.CompanyIDs) > 0 {
+		query = query.Where("company_id IN ?", filter.CompanyIDs)
+	}
+	if len(filter.EventTypes) > 0 {
+		query = query.Where("event_type IN ?", filter.EventTypes)
+	}
+	if filter.Since != nil {
+		query = query.Where("occurred_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("occurred_at < ?", *filter.Until)
+	}
+	return query
+}
+
+// companies narrows session to the current companies matching filter
+func (r *CompanyEventRepository) companies(session *gorm.DB, filter ReplayFilter) *gorm.DB {
+	query := session.Model(&models.Company{})
+	if filter.OrganizationID != "" {
+		query = query.Where("organization_id = ?", filter.OrganizationID)
+	}
+	if len(filter.CompanyIDs) > 0 {
+		query = query.Where("id IN ?", filter.CompanyIDs)
+	}
+	return query
+}
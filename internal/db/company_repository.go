@@ -1,25 +1,41 @@
 package db
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"xm-exercise/pkg/models"
 )
 
+var (
+	// ErrCompanyNotFound is returned when no company of the organization has the ID
+	ErrCompanyNotFound = newError(ErrNotFound, "company not found")
+	// ErrCompanyNameExists is returned when another company of the organization has the name
+	ErrCompanyNameExists = newError(ErrConflict, "company name already exists")
+	// ErrCompanyExists is returned when a company with the ID already exists
+	ErrCompanyExists = newError(ErrConflict, "company already exists")
+)
+
 // CompanyRepositoryInterface defines the interface for company database operations
 type CompanyRepositoryInterface interface {
-	Create(company *models.Company) error
-	GetByID(id string) (*models.Company, error)
-	Update(company *models.Company) error
-	Delete(id string) error
-	ExistsByName(name string) (bool, error)
+	ForOrganization(organizationID string) CompanyRepositoryInterface
+	Create(ctx context.Context, company *models.Company) error
+	GetByID(ctx context.Context, id string) (*models.Company, error)
+	GetForUpdate(ctx context.Context, id string) (*models.Company, error)
+	Update(ctx context.Context, company *models.Company) error
+	Delete(ctx context.Context, id string) error
 }
 
-// CompanyRepository handles database operations for companies
+// CompanyRepository handles database operations for companies.
+// Every query is scoped to a single organization (tenant); a repository
+// that has not been bound with ForOrganization matches no rows.
 type CompanyRepository struct {
-	db *Database
+	db             *Database
+	organizationID string
 }
 
 // NewCompanyRepository creates a new company repository
@@ -27,66 +43,108 @@ func NewCompanyRepository(db *Database) *CompanyRepository {
 	return &CompanyRepository{db: db}
 }
 
-// Create inserts a new company into the database
-func (r *CompanyRepository) Create(company *models.Company) error {
-	result := r.db.Create(company)
+// ForOrganization returns a copy of the repository scoped to the given organization
+func (r *CompanyRepository) ForOrganization(organizationID string) CompanyRepositoryInterface {
+	return &CompanyRepository{db: r.db, organizationID: organizationID}
+}
+
+// scoped returns a query bound to ctx and restricted to the repository's organization
+func (r *CompanyRepository) scoped(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	query, cancel := r.db.query(ctx)
+	return query.Where("organization_id = ?", r.organizationID), cancel
+}
+
+// Create inserts a new company into the database, owned by the repository's
+// organization. A name already taken in the organization fails with ErrCompanyNameExists.
+func (r *CompanyRepository) Create(ctx context.Context, company *models.Company) error {
+	company.OrganizationID = r.organizationID
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	result := query.Create(company)
 	if result.Error != nil {
-		return result.Error
+		return companyWriteError(result.Error)
 	}
 	return nil
 }
 
 // GetByID retrieves a company by its ID
-func (r *CompanyRepository) GetByID(id string) (*models.Company, error) {
+func (r *CompanyRepository) GetByID(ctx context.Context, id string) (*models.Company, error) {
 	var company models.Company
-	result := r.db.First(&company, "id = ?", id)
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	result := query.Where("organization_id = ?", r.organizationID).First(&company, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("company not found")
+			return nil, ErrCompanyNotFound
 		}
 		return nil, result.Error
 	}
 	return &company, nil
 }
 
-// Update updates an existing company
-func (r *CompanyRepository) Update(company *models.Company) error {
-	result := r.db.Model(&company).Updates(company)
+// GetForUpdate retrieves a company by its ID from the primary, locking its row
+// until the end of the transaction so that concurrent changes to the company
+// wait for each other. SQLite has no row locks; its transactions take the
+// database-wide write lock.
+func (r *CompanyRepository) GetForUpdate(ctx context.Context, id string) (*models.Company, error) {
+	var company models.Company
+	query, cancel := r.scoped(ctx)
+	defer cancel()
+	if r.db.Dialector.Name() != "sqlite" {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	result := query.First(&company, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCompanyNotFound
+		}
+		return nil, result.Error
+	}
+	return &company, nil
+}
+
+// Update writes the non-zero fields of company to the stored company
+func (r *CompanyRepository) Update(ctx context.Context, company *models.Company) error {
+	company.OrganizationID = r.organizationID
+	query, cancel := r.scoped(ctx)
+	defer cancel()
+	result := query.Model(company).Updates(company)
 
 	if result.Error != nil {
-		return result.Error
+		return companyWriteError(result.Error)
 	}
 
 	if result.RowsAffected == 0 {
-		return errors.New("company not found")
+		return ErrCompanyNotFound
 	}
 
 	return nil
 }
 
 // Delete removes a company by its ID
-func (r *CompanyRepository) Delete(id string) error {
-	result := r.db.Delete(&models.Company{}, "id = ?", id)
+func (r *CompanyRepository) Delete(ctx context.Context, id string) error {
+	query, cancel := r.scoped(ctx)
+	defer cancel()
+	result := query.Delete(&models.Company{}, "id = ?", id)
 	if result.Error != nil {
 		return result.Error
 	}
 
 	if result.RowsAffected == 0 {
-		return errors.New("company not found")
+		return ErrCompanyNotFound
 	}
 
 	return nil
 }
 
-// ExistsByName checks if a company with the given name exists
-func (r *CompanyRepository) ExistsByName(name string) (bool, error) {
-	var count int64
-	query := r.db.Model(&models.Company{}).Where("name = ?", name)
-
-	err := query.Count(&count).Error
-	if err != nil {
-		return false, err
+// companyWriteError maps unique index violations of a company write to the company errors
+func companyWriteError(err error) error {
+	var violation *UniqueViolationError
+	if !errors.As(err, &violation) {
+		return err
 	}
-
-	return count > 0, nil
+	if violation.On("idx_companies_organization_name", "organization_id", "name") {
+		return fmt.Errorf("%w: %w", ErrCompanyNameExists, err)
+	}
+	return fmt.Errorf("%w: %w", ErrCompanyExists, err)
 }
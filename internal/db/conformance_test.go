@@ -0,0 +1,73 @@
+package db_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/pkg/models"
+)
+
+// newOrganizations creates the given number of organizations in database
+func newOrganizations(t *testing.T, database *db.Database, organizations int) []string {
+	t.Helper()
+	ids := make([]string, organizations)
+	for i := range ids {
+		organization := models.Organization{ID: uuid.New().String(), Name: uuid.New().String()}
+		require.NoError(t, db.NewOrganizationRepository(database).Create(context.Background(), &organization))
+		ids[i] = organization.ID
+	}
+	return ids
+}
+
+// newSQLiteDatabase returns a migrated in-memory sqlite database holding the
+// given number of organizations
+func newSQLiteDatabase(t *testing.T, organizations int) (*db.Database, []string) {
+	t.Helper()
+	database := dbtest.NewSQLite(t)
+	return database, newOrganizations(t, database, organizations)
+}
+
+func TestCompanyRepositoryConformance(t *testing.T) {
+	dbtest.TestCompanyRepository(t, func(t *testing.T) (db.CompanyRepositoryInterface, [2]string) {
+		database, organizations := newSQLiteDatabase(t, 2)
+		return db.NewCompanyRepository(database), [2]string(organizations)
+	})
+}
+
+// TestPgxCompanyRepositoryConformance runs only when POSTGRES_TEST_URL points
+// at a PostgreSQL database, which it migrates and leaves its companies in
+func TestPgxCompanyRepositoryConformance(t *testing.T) {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL not set")
+	}
+	ctx := context.Background()
+	database, err := db.NewDatabase("postgres", url)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+	migrator, err := db.NewMigrator(database, time.Minute)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	pool, err := db.NewPgxPool(ctx, url, db.DefaultPoolConfig)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	dbtest.TestCompanyRepository(t, func(t *testing.T) (db.CompanyRepositoryInterface, [2]string) {
+		return db.NewPgxCompanyRepository(pool, time.Second), [2]string(newOrganizations(t, database, 2))
+	})
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	dbtest.TestUserRepository(t, func(t *testing.T) (db.UserRepositoryInterface, string) {
+		database, organizations := newSQLiteDatabase(t, 1)
+		return db.NewUserRepository(database), organizations[0]
+	})
+}
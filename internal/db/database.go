@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,26 +17,55 @@ import (
 // Database wraps a gorm.DB connection
 type Database struct {
 	*gorm.DB
+	// QueryTimeout bounds each repository query; zero leaves queries bounded
+	// by their context alone
+	QueryTimeout time.Duration
+	pool         PoolConfig
+	replicas     *replicaSet
 }
 
-// NewDatabase creates a new database connection based on dialect
+// NewDatabase creates a new database connection based on dialect, with the
+// DefaultPoolConfig. The schema is managed separately by a Migrator.
 func NewDatabase(dialect, connectionString string) (*Database, error) {
-	var db *gorm.DB
-	var err error
+	return Open(dialect, connectionString, DefaultPoolConfig)
+}
+
+// Open creates a new database connection based on dialect, with the given pool
+// configuration. Replicas added by UseReplicas share the configuration.
+func Open(dialect, connectionString string, pool PoolConfig) (*Database, error) {
+	db, err := openGorm(dialect, connectionString, pool, true)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{DB: db, pool: pool}, nil
+}
+
+// openGorm opens a connection pool to the database with the given dialect.
+// Unless ping is set, an unreachable database is only noticed by the first query.
+func openGorm(dialect, connectionString string, pool PoolConfig, ping bool) (*gorm.DB, error) {
+	connectionString, err := withStatementTimeout(dialect, connectionString, pool.StatementTimeout)
+	if err != nil {
+		return nil, err
+	}
 
+	var dialector gorm.Dialector
 	switch dialect {
 	case "postgres":
-		db, err = gorm.Open(postgres.Open(connectionString), &gorm.Config{})
+		dialector = postgres.Open(connectionString)
 	case "mysql":
-		db, err = gorm.Open(mysql.Open(connectionString), &gorm.Config{})
+		dialector = mysql.Open(connectionString)
 	case "sqlite":
-		db, err = gorm.Open(sqlite.Open(connectionString), &gorm.Config{})
+		dialector = sqlite.Open(connectionString)
 	default:
 		return nil, fmt.Errorf("unsupported database dialect: %s", dialect)
 	}
 
+	db, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: !ping})
 	if err != nil {
-		return nil, fmt.Errorf("could not connect to database: %w", err)
+		return nil, fmt.Errorf("could not connect to database: %w", translateError(err))
+	}
+	if err := registerErrorTranslation(db); err != nil {
+		return nil, err
 	}
 
 	// Configure connection pool
@@ -43,23 +74,88 @@ func NewDatabase(dialect, connectionString string) (*Database, error) {
 		return nil, fmt.Errorf("could not get sql.DB: %w", err)
 	}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
-	// Initialize models
-	if err := db.AutoMigrate(&models.User{}, &models.Company{}); err != nil {
-		return nil, fmt.Errorf("could not migrate database: %w", err)
-	}
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
 
-	return &Database{DB: db}, nil
+	return db, nil
 }
 
-// Close closes the database connection
+// Close closes the database connection and those of its replicas
 func (d *Database) Close() error {
+	var replicasErr error
+	if d.replicas != nil {
+		replicasErr = d.replicas.close()
+	}
 	sqlDB, err := d.DB.DB()
 	if err != nil {
 		return fmt.Errorf("could not get sql.DB: %w", err)
 	}
-	return sqlDB.Close()
+	return errors.Join(sqlDB.Close(), replicasErr)
+}
+
+// Ping checks that the database answers
+func (d *Database) Ping(ctx context.Context) error {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return fmt.Errorf("could not get sql.DB: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// WithTransaction runs fn inside a database transaction begun with ctx. The
+// transaction is committed if fn returns nil and rolled back otherwise.
+func (d *Database) WithTransaction(ctx context.Context, fn func(tx *Database) error) error {
+	err := d.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&Database{DB: tx, QueryTimeout: d.QueryTimeout})
+	})
+	// Begin and commit errors bypass the statement callbacks
+	return translateError(err)
+}
+
+// Wipe deletes the rows of every application table in one transaction,
+// leaving the schema and its migration history alone
+func (d *Database) Wipe(ctx context.Context) error {
+	return d.WithTransaction(ctx, func(tx *Database) error {
+		for _, model := range []any{
+			&models.WebhookDelivery{},
+			&models.WebhookSubscription{},
+			&models.CompanyEvent{},
+			&models.ProcessedEvent{},
+			&models.OutboxMessage{},
+			&models.Company{},
+			&models.User{},
+			&models.Organization{},
+		} {
+			query, cancel := tx.query(ctx)
+			err := query.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// inTransaction reports whether d is bound to a transaction
+func (d *Database) inTransaction() bool {
+	committer, ok := d.DB.Statement.ConnPool.(gorm.TxCommitter)
+	return ok && committer != nil
+}
+
+// query returns a session running its statements with ctx, limited to
+// QueryTimeout. The returned cancel function must be called once the query is done.
+func (d *Database) query(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	return d.session(ctx, d.DB)
+}
+
+// session returns a session of db running its statements with ctx, limited to QueryTimeout
+func (d *Database) session(ctx context.Context, db *gorm.DB) (*gorm.DB, context.CancelFunc) {
+	if d.QueryTimeout <= 0 {
+		return db.WithContext(ctx), func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, d.QueryTimeout)
+	return db.WithContext(ctx), cancel
 }
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryContext(t *testing.T) {
+	migrator, database := newTestMigrator(t, memoryDatabase())
+	_, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	companyRepo := NewCompanyRepository(database).ForOrganization(uuid.New().String())
+
+	_, err = companyRepo.GetByID(context.Background(), uuid.New().String())
+	assert.ErrorIs(t, err, ErrCompanyNotFound)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = companyRepo.GetByID(ctx, uuid.New().String())
+	assert.ErrorIs(t, err, context.Canceled, "a cancelled request cancels its queries")
+
+	database.QueryTimeout = time.Nanosecond
+	_, err = companyRepo.GetByID(context.Background(), uuid.New().String())
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "queries are bounded by the query timeout")
+}
@@ -0,0 +1,281 @@
+// Package dbtest holds the conformance tests every implementation of the
+// repository interfaces of package db must pass, so that the SQL and
+// in-memory repositories cannot drift apart, and the databases other
+// packages' tests run against.
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/pkg/models"
+)
+
+// CompanyStore returns an empty company repository for a test, and the IDs of
+// two organizations it may hold companies of
+type CompanyStore func(t *testing.T) (db.CompanyRepositoryInterface, [2]string)
+
+// UserStore returns an empty user repository for a test, and the ID of an
+// organization it may hold users of
+type UserStore func(t *testing.T) (db.UserRepositoryInterface, string)
+
+// NewCompany returns a valid company with a new ID
+func NewCompany(name string) *models.Company {
+	description := "A company for testing"
+	registered := true
+	return &models.Company{
+		ID:            uuid.New().String(),
+		Name:          name,
+		Description:   &description,
+		EmployeeCount: 10,
+		Registered:    &registered,
+		Type:          models.TypeCorporation,
+	}
+}
+
+// NewUser returns a valid user of the organization with a new ID
+func NewUser(organizationID, name string) models.User {
+	return models.User{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		Name:           name,
+		Email:          name + "@example.com",
+		PasswordHash:   "hash",
+	}
+}
+
+// TestCompanyRepository runs the company repository conformance tests against
+// the repositories of newStore
+func TestCompanyRepository(t *testing.T, newStore CompanyStore) {
+	ctx := context.Background()
+
+	t.Run("creates and reads companies", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+
+		company := NewCompany("Acme")
+		require.NoError(t, companies.Create(ctx, company))
+		assert.Equal(t, organizations[0], company.OrganizationID, "the company belongs to the repository's organization")
+		assert.False(t, company.CreatedAt.IsZero())
+
+		stored, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assertSameCompany(t, company, stored)
+
+		locked, err := companies.GetForUpdate(ctx, company.ID)
+		require.NoError(t, err)
+		assertSameCompany(t, company, locked)
+	})
+
+	t.Run("reports missing companies", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+
+		_, err := companies.GetByID(ctx, uuid.New().String())
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		_, err = companies.GetForUpdate(ctx, uuid.New().String())
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+		assert.ErrorIs(t, companies.Update(ctx, NewCompany("Acme")), db.ErrCompanyNotFound)
+		assert.ErrorIs(t, companies.Delete(ctx, uuid.New().String()), db.ErrCompanyNotFound)
+	})
+
+	t.Run("scopes companies to their organization", func(t *testing.T) {
+		store, organizations := newStore(t)
+		company := NewCompany("Acme")
+		require.NoError(t, store.ForOrganization(organizations[0]).Create(ctx, company))
+
+		for name, other := range map[string]db.CompanyRepositoryInterface{
+			"another organization": store.ForOrganization(organizations[1]),
+			"no organization":      store,
+		} {
+			_, err := other.GetByID(ctx, company.ID)
+			assert.ErrorIs(t, err, db.ErrCompanyNotFound, name)
+			_, err = other.GetForUpdate(ctx, company.ID)
+			assert.ErrorIs(t, err, db.ErrCompanyNotFound, name)
+			update := *company
+			update.Name = "Changed"
+			assert.ErrorIs(t, other.Update(ctx, &update), db.ErrCompanyNotFound, name)
+			assert.ErrorIs(t, other.Delete(ctx, company.ID), db.ErrCompanyNotFound, name)
+		}
+
+		stored, err := store.ForOrganization(organizations[0]).GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme", stored.Name, "other organizations changed nothing")
+	})
+
+	t.Run("keeps names unique per organization", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+		require.NoError(t, companies.Create(ctx, NewCompany("Acme")))
+
+		err := companies.Create(ctx, NewCompany("Acme"))
+		assert.ErrorIs(t, err, db.ErrCompanyNameExists)
+		assert.ErrorIs(t, err, db.ErrConflict)
+		assert.NoError(t, store.ForOrganization(organizations[1]).Create(ctx, NewCompany("Acme")))
+	})
+
+	t.Run("keeps IDs unique", func(t *testing.T) {
+		store, organizations := newStore(t)
+		company := NewCompany("Acme")
+		require.NoError(t, store.ForOrganization(organizations[0]).Create(ctx, company))
+
+		duplicate := NewCompany("Globex")
+		duplicate.ID = company.ID
+		err := store.ForOrganization(organizations[1]).Create(ctx, duplicate)
+		assert.ErrorIs(t, err, db.ErrCompanyExists)
+		assert.NotErrorIs(t, err, db.ErrCompanyNameExists)
+	})
+
+	t.Run("updates the non-zero fields", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+		company := NewCompany("Acme")
+		require.NoError(t, companies.Create(ctx, company))
+
+		update := models.Company{ID: company.ID, Name: "Globex", EmployeeCount: 20}
+		require.NoError(t, companies.Update(ctx, &update))
+		assert.False(t, update.UpdatedAt.IsZero(), "the update is stamped")
+
+		stored, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		company.Name, company.EmployeeCount = "Globex", 20
+		assertSameCompany(t, company, stored)
+		assert.WithinDuration(t, update.UpdatedAt, stored.UpdatedAt, time.Second)
+	})
+
+	t.Run("rejects renaming to a taken name", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+		require.NoError(t, companies.Create(ctx, NewCompany("Acme")))
+		company := NewCompany("Globex")
+		require.NoError(t, companies.Create(ctx, company))
+
+		update := *company
+		update.Name = "Acme"
+		assert.ErrorIs(t, companies.Update(ctx, &update), db.ErrCompanyNameExists)
+		stored, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Globex", stored.Name)
+
+		update.Name = "Initech"
+		require.NoError(t, companies.Update(ctx, &update))
+		assert.NoError(t, companies.Create(ctx, NewCompany("Globex")), "renaming frees the old name")
+	})
+
+	t.Run("deletes companies", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+		company := NewCompany("Acme")
+		require.NoError(t, companies.Create(ctx, company))
+
+		require.NoError(t, companies.Delete(ctx, company.ID))
+		_, err := companies.GetByID(ctx, company.ID)
+		assert.ErrorIs(t, err, db.ErrCompanyNotFound)
+		assert.ErrorIs(t, companies.Delete(ctx, company.ID), db.ErrCompanyNotFound)
+		assert.NoError(t, companies.Create(ctx, NewCompany("Acme")), "deleting frees the name")
+	})
+
+	t.Run("returns copies", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+		company := NewCompany("Acme")
+		require.NoError(t, companies.Create(ctx, company))
+		*company.Description = "Changed"
+
+		stored, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "A company for testing", *stored.Description)
+		stored.Name = "Changed"
+		*stored.Registered = false
+
+		again, err := companies.GetByID(ctx, company.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme", again.Name)
+		assert.True(t, *again.Registered)
+	})
+
+	t.Run("stops on a cancelled context", func(t *testing.T) {
+		store, organizations := newStore(t)
+		companies := store.ForOrganization(organizations[0])
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		assert.ErrorIs(t, companies.Create(cancelled, NewCompany("Acme")), context.Canceled)
+		_, err := companies.GetByID(cancelled, uuid.New().String())
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+// TestUserRepository runs the user repository conformance tests against the
+// repositories of newStore
+func TestUserRepository(t *testing.T, newStore UserStore) {
+	ctx := context.Background()
+
+	t.Run("creates and reads users", func(t *testing.T) {
+		users, organizationID := newStore(t)
+		user := NewUser(organizationID, "alice")
+		require.NoError(t, users.Create(ctx, user))
+
+		byID, err := users.GetByID(ctx, uuid.MustParse(user.ID))
+		require.NoError(t, err)
+		byEmail, err := users.GetByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		for _, stored := range []*models.User{byID, byEmail} {
+			assert.Equal(t, user.ID, stored.ID)
+			assert.Equal(t, user.OrganizationID, stored.OrganizationID)
+			assert.Equal(t, user.Name, stored.Name)
+			assert.Equal(t, user.Email, stored.Email)
+			assert.Equal(t, user.PasswordHash, stored.PasswordHash)
+			assert.False(t, stored.CreatedAt.IsZero())
+		}
+	})
+
+	t.Run("reports missing users", func(t *testing.T) {
+		users, _ := newStore(t)
+		_, err := users.GetByID(ctx, uuid.New())
+		assert.ErrorIs(t, err, db.ErrUserNotFound)
+		assert.ErrorIs(t, err, db.ErrNotFound)
+		_, err = users.GetByEmail(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, db.ErrUserNotFound)
+	})
+
+	t.Run("keeps emails, names and IDs unique", func(t *testing.T) {
+		users, organizationID := newStore(t)
+		user := NewUser(organizationID, "alice")
+		require.NoError(t, users.Create(ctx, user))
+
+		sameEmail := NewUser(organizationID, "bob")
+		sameEmail.Email = user.Email
+		assert.ErrorIs(t, users.Create(ctx, sameEmail), db.ErrEmailRegistered)
+
+		sameName := NewUser(organizationID, "carol")
+		sameName.Name = user.Name
+		assert.ErrorIs(t, users.Create(ctx, sameName), db.ErrUserNameTaken)
+
+		sameID := NewUser(organizationID, "dave")
+		sameID.ID = user.ID
+		err := users.Create(ctx, sameID)
+		assert.ErrorIs(t, err, db.ErrUserExists)
+		assert.ErrorIs(t, err, db.ErrConflict)
+	})
+}
+
+// assertSameCompany asserts that stored holds the fields of company
+func assertSameCompany(t *testing.T, company, stored *models.Company) {
+	t.Helper()
+	assert.Equal(t, company.ID, stored.ID)
+	assert.Equal(t, company.OrganizationID, stored.OrganizationID)
+	assert.Equal(t, company.Name, stored.Name)
+	assert.Equal(t, company.Description, stored.Description)
+	assert.Equal(t, company.EmployeeCount, stored.EmployeeCount)
+	assert.Equal(t, company.Registered, stored.Registered)
+	assert.Equal(t, company.Type, stored.Type)
+	assert.WithinDuration(t, company.CreatedAt, stored.CreatedAt, time.Second)
+}
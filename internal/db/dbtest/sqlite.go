@@ -0,0 +1,26 @@
+package dbtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/db"
+)
+
+// NewSQLite returns a migrated in-memory sqlite database of its own, closed
+// when the test ends
+func NewSQLite(t *testing.T) *db.Database {
+	t.Helper()
+	database, err := db.NewDatabase("sqlite", "file:"+uuid.New().String()+"?mode=memory&cache=shared")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+	migrator, err := db.NewMigrator(database, time.Second)
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return database
+}
@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+// Kinds of repository errors, matched with errors.Is
+var (
+	// ErrNotFound is matched by errors reporting a missing row
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is matched by errors reporting a row clashing with an existing one
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable wraps errors of a database that cannot be reached or is overloaded
+	ErrUnavailable = errors.New("database unavailable")
+	// ErrSerialization wraps errors of a transaction aborted in favour of a
+	// concurrent one, which may succeed when run again
+	ErrSerialization = errors.New("transaction serialization failure")
+)
+
+// Error is a repository error of one of the kinds above, with a message fit
+// to show to clients
+type Error struct {
+	kind    error
+	message string
+}
+
+func newError(kind error, message string) *Error {
+	return &Error{kind: kind, message: message}
+}
+
+func (e *Error) Error() string {
+	return e.message
+}
+
+// Is reports whether target is the kind of the error
+func (e *Error) Is(target error) bool {
+	return target == e.kind
+}
+
+// UniqueViolationError reports a write violating a unique index or primary key
+type UniqueViolationError struct {
+	// Index is the name of the violated index, when the driver reports it
+	Index string
+	// Columns are the indexed columns, when the driver reports them
+	Columns []string
+	Err     error
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("unique constraint violated: %v", e.Err)
+}
+
+func (e *UniqueViolationError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrConflict
+func (e *UniqueViolationError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// On reports whether the violated index is the named one, or, for drivers
+// only reporting columns, an index on exactly the given columns
+func (e *UniqueViolationError) On(index string, columns ...string) bool {
+	if e.Index != "" {
+		return e.Index == index
+	}
+	if len(e.Columns) != len(columns) {
+		return false
+	}
+	for i, column := range columns {
+		if e.Columns[i] != column {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// postgresKeyPattern matches the columns in the detail of a postgres unique violation
+	postgresKeyPattern = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+	// mysqlKeyPattern matches the index in the message of a MySQL duplicate entry error
+	mysqlKeyPattern = regexp.MustCompile(`for key '(?:[^'.]+\.)?([^']+)'$`)
+)
+
+// translateError translates the driver errors of every dialect into the
+// repository errors above. Other errors are returned unchanged.
+func translateError(err error) error {
+	if err == nil ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrConflict) || errors.Is(err, ErrUnavailable) || errors.Is(err, ErrSerialization) ||
+		errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	var mysqlErr *mysql.MySQLError
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.As(err, &pgErr):
+		switch {
+		case pgErr.Code == "23505":
+			violation := &UniqueViolationError{Index: pgErr.ConstraintName, Err: err}
+			if match := postgresKeyPattern.FindStringSubmatch(pgErr.Detail); match != nil {
+				violation.Columns = strings.Split(match[1], ", ")
+			}
+			return violation
+		// Serialization failures and deadlocks
+		case pgErr.Code == "40001", pgErr.Code == "40P01":
+			return fmt.Errorf("%w: %w", ErrSerialization, err)
+		// Connection exceptions, too many connections and the server shutting down
+		case strings.HasPrefix(pgErr.Code, "08"), pgErr.Code == "53300", strings.HasPrefix(pgErr.Code, "57P"):
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case 1062:
+			violation := &UniqueViolationError{Err: err}
+			if match := mysqlKeyPattern.FindStringSubmatch(mysqlErr.Message); match != nil {
+				violation.Index = match[1]
+			}
+			return violation
+		// Deadlocks
+		case 1213:
+			return fmt.Errorf("%w: %w", ErrSerialization, err)
+		// Too many connections and the server shutting down
+		case 1040, 1053:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	case errors.As(err, &sqliteErr):
+		switch {
+		case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique,
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+			return &UniqueViolationError{Columns: sqliteColumns(sqliteErr.Error()), Err: err}
+		case sqliteErr.Code == sqlite3.ErrBusy, sqliteErr.Code == sqlite3.ErrLocked, sqliteErr.Code == sqlite3.ErrCantOpen:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	return err
+}
+
+// sqliteColumns returns the columns named by a sqlite constraint error, like
+// "UNIQUE constraint failed: companies.organization_id, companies.name"
+func sqliteColumns(message string) []string {
+	_, list, ok := strings.Cut(message, "constraint failed: ")
+	if !ok {
+		return nil
+	}
+	columns := strings.Split(list, ", ")
+	for i, column := range columns {
+		if _, name, ok := strings.Cut(column, "."); ok {
+			columns[i] = name
+		}
+	}
+	return columns
+}
+
+// registerErrorTranslation translates the error of every statement run through db
+func registerErrorTranslation(db *gorm.DB) error {
+	translate := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			tx.Error = translateError(tx.Error)
+		}
+	}
+
+	callbacks := db.Callback()
+	for name, register := range map[string]func(string, func(*gorm.DB)) error{
+		"create": callbacks.Create().Register,
+		"query":  callbacks.Query().Register,
+		"update": callbacks.Update().Register,
+		"delete": callbacks.Delete().Register,
+		"row":    callbacks.Row().Register,
+		"raw":    callbacks.Raw().Register,
+	} {
+		if err := register("app:translate_error", translate); err != nil {
+			return fmt.Errorf("could not register %s error translation: %w", name, err)
+		}
+	}
+	return nil
+}
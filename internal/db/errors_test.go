@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/pkg/models"
+)
+
+func TestRepositoryErrors(t *testing.T) {
+	ctx := context.Background()
+	migrator, database := newTestMigrator(t, memoryDatabase())
+	_, err := migrator.Up(ctx)
+	require.NoError(t, err)
+
+	organizations := NewOrganizationRepository(database)
+	organization := models.Organization{ID: uuid.New().String(), Name: "Acme Holdings"}
+	require.NoError(t, organizations.Create(ctx, &organization))
+
+	newCompany := func(name string) *models.Company {
+		return &models.Company{
+			ID:            uuid.New().String(),
+			Name:          name,
+			EmployeeCount: 10,
+			Registered:    new(bool),
+			Type:          models.TypeCorporation,
+			CreatedAt:     time.Now().UTC(),
+			UpdatedAt:     time.Now().UTC(),
+		}
+	}
+
+	t.Run("company name taken on create and update", func(t *testing.T) {
+		companies := NewCompanyRepository(database).ForOrganization(organization.ID)
+		require.NoError(t, companies.Create(ctx, newCompany("Acme")))
+
+		err := companies.Create(ctx, newCompany("Acme"))
+		assert.ErrorIs(t, err, ErrCompanyNameExists)
+		assert.ErrorIs(t, err, ErrConflict)
+		var violation *UniqueViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, []string{"organization_id", "name"}, violation.Columns)
+
+		other := newCompany("Globex")
+		require.NoError(t, companies.Create(ctx, other))
+		other.Name = "Acme"
+		assert.ErrorIs(t, companies.Update(ctx, other), ErrCompanyNameExists)
+
+		duplicate := newCompany("Initech")
+		duplicate.ID = other.ID
+		err = companies.Create(ctx, duplicate)
+		assert.ErrorIs(t, err, ErrCompanyExists)
+		assert.NotErrorIs(t, err, ErrCompanyNameExists)
+	})
+
+	t.Run("company names are unique per organization", func(t *testing.T) {
+		other := models.Organization{ID: uuid.New().String(), Name: "Other Holdings"}
+		require.NoError(t, organizations.Create(ctx, &other))
+		companies := NewCompanyRepository(database).ForOrganization(other.ID)
+		assert.NoError(t, companies.Create(ctx, newCompany("Acme")))
+	})
+
+	t.Run("missing rows", func(t *testing.T) {
+		_, err := NewCompanyRepository(database).ForOrganization(organization.ID).GetByID(ctx, uuid.New().String())
+		assert.ErrorIs(t, err, ErrCompanyNotFound)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		_, err = NewUserRepository(database).GetByEmail(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, ErrUserNotFound)
+		_, err = organizations.GetByID(ctx, uuid.New().String())
+		assert.ErrorIs(t, err, ErrOrganizationNotFound)
+	})
+
+	t.Run("organization and user conflicts", func(t *testing.T) {
+		err := organizations.Create(ctx, &models.Organization{ID: organization.ID, Name: "Other"})
+		assert.ErrorIs(t, err, ErrOrganizationExists)
+		require.NoError(t, organizations.Create(ctx, &models.Organization{ID: uuid.New().String(), Name: organization.Name}),
+			"organization names may repeat")
+
+		users := NewUserRepository(database)
+		user := models.User{
+			ID:             uuid.New().String(),
+			OrganizationID: organization.ID,
+			Name:           "alice",
+			Email:          "alice@example.com",
+			PasswordHash:   "hash",
+		}
+		require.NoError(t, users.Create(ctx, user))
+
+		sameEmail := user
+		sameEmail.ID, sameEmail.Name = uuid.New().String(), "alice2"
+		assert.ErrorIs(t, users.Create(ctx, sameEmail), ErrEmailRegistered)
+
+		sameName := user
+		sameName.ID, sameName.Email = uuid.New().String(), "alice2@example.com"
+		assert.ErrorIs(t, users.Create(ctx, sameName), ErrUserNameTaken)
+	})
+}
+
+func TestTranslateError(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		err := translateError(fmt.Errorf("insert: %w", &pgconn.PgError{
+			Code:           "23505",
+			ConstraintName: "idx_companies_organization_name",
+			Detail:         "Key (organization_id, name)=(1, Acme) already exists.",
+		}))
+		var violation *UniqueViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.True(t, violation.On("idx_companies_organization_name", "organization_id", "name"))
+		assert.False(t, violation.On("idx_users_name", "name"))
+		assert.Equal(t, []string{"organization_id", "name"}, violation.Columns)
+
+		assert.ErrorIs(t, translateError(&pgconn.PgError{Code: "40001"}), ErrSerialization)
+		assert.ErrorIs(t, translateError(&pgconn.PgError{Code: "40P01"}), ErrSerialization)
+		assert.ErrorIs(t, translateError(&pgconn.PgError{Code: "57P01"}), ErrUnavailable)
+		assert.ErrorIs(t, translateError(&pgconn.PgError{Code: "08006"}), ErrUnavailable)
+		assert.NotErrorIs(t, translateError(&pgconn.PgError{Code: "42P01"}), ErrUnavailable)
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		err := translateError(&mysql.MySQLError{
+			Number:  1062,
+			Message: "Duplicate entry '1-Acme' for key 'companies.idx_companies_organization_name'",
+		})
+		var violation *UniqueViolationError
+		require.ErrorAs(t, err, &violation)
+		assert.Equal(t, "idx_companies_organization_name", violation.Index)
+
+		assert.ErrorIs(t, translateError(&mysql.MySQLError{Number: 1040}), ErrUnavailable)
+		assert.ErrorIs(t, translateError(mysql.ErrInvalidConn), ErrUnavailable)
+	})
+
+	t.Run("passes other errors through", func(t *testing.T) {
+		assert.NoError(t, translateError(nil))
+		assert.Equal(t, context.Canceled, translateError(context.Canceled))
+		other := errors.New("syntax error")
+		assert.Equal(t, other, translateError(other))
+
+		unavailable := translateError(mysql.ErrInvalidConn)
+		assert.Equal(t, unavailable, translateError(unavailable), "translating twice changes nothing")
+	})
+}
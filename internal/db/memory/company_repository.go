@@ -0,0 +1,181 @@
+// Package memory holds thread-safe, in-memory implementations of the
+// repository interfaces of package db, for tests and demos. They report the
+// same not-found and uniqueness errors as the SQL repositories.
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/pkg/models"
+)
+
+// companyName identifies a company name within an organization, which the
+// SQL schema keeps unique
+type companyName struct {
+	organizationID string
+	name           string
+}
+
+// companyStore holds the companies of every organization
+type companyStore struct {
+	mu        sync.RWMutex
+	companies map[string]models.Company
+	names     map[companyName]string
+}
+
+// CompanyRepository is an in-memory db.CompanyRepositoryInterface. Like the
+// SQL repository, it is scoped to a single organization and a repository
+// that has not been bound with ForOrganization matches no companies.
+type CompanyRepository struct {
+	store          *companyStore
+	organizationID string
+}
+
+// NewCompanyRepository creates an empty company repository
+func NewCompanyRepository() *CompanyRepository {
+	return &CompanyRepository{store: &companyStore{
+		companies: make(map[string]models.Company),
+		names:     make(map[companyName]string),
+	}}
+}
+
+// ForOrganization returns a view of the same companies scoped to the given organization
+func (r *CompanyRepository) ForOrganization(organizationID string) db.CompanyRepositoryInterface {
+	return &CompanyRepository{store: r.store, organizationID: organizationID}
+}
+
+// Create stores a new company, owned by the repository's organization. A
+// name already taken in the organization fails with db.ErrCompanyNameExists,
+// and an ID already taken with db.ErrCompanyExists.
+func (r *CompanyRepository) Create(ctx context.Context, company *models.Company) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	company.OrganizationID = r.organizationID
+	now := time.Now()
+	if company.CreatedAt.IsZero() {
+		company.CreatedAt = now
+	}
+	if company.UpdatedAt.IsZero() {
+		company.UpdatedAt = now
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if _, ok := r.store.companies[company.ID]; ok {
+		return db.ErrCompanyExists
+	}
+	key := companyName{organizationID: company.OrganizationID, name: company.Name}
+	if _, ok := r.store.names[key]; ok {
+		return db.ErrCompanyNameExists
+	}
+	r.store.companies[company.ID] = cloneCompany(company)
+	r.store.names[key] = company.ID
+	return nil
+}
+
+// GetByID retrieves a company of the organization by its ID
+func (r *CompanyRepository) GetByID(ctx context.Context, id string) (*models.Company, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	company, ok := r.store.companies[id]
+	if !ok || company.OrganizationID != r.organizationID {
+		return nil, db.ErrCompanyNotFound
+	}
+	stored := cloneCompany(&company)
+	return &stored, nil
+}
+
+// GetForUpdate retrieves a company of the organization by its ID. Writes are
+// serialized by the store's lock, so there is no row to lock.
+func (r *CompanyRepository) GetForUpdate(ctx context.Context, id string) (*models.Company, error) {
+	return r.GetByID(ctx, id)
+}
+
+// Update writes the non-zero fields of company to the stored company of the
+// organization with its ID, as a GORM struct update does, and stamps
+// UpdatedAt. A name taken by another company fails with db.ErrCompanyNameExists.
+func (r *CompanyRepository) Update(ctx context.Context, company *models.Company) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	company.OrganizationID = r.organizationID
+	company.UpdatedAt = time.Now()
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	stored, ok := r.store.companies[company.ID]
+	if !ok || stored.OrganizationID != r.organizationID {
+		return db.ErrCompanyNotFound
+	}
+
+	previous := companyName{organizationID: stored.OrganizationID, name: stored.Name}
+	if company.Name != "" && company.Name != stored.Name {
+		key := companyName{organizationID: stored.OrganizationID, name: company.Name}
+		if _, ok := r.store.names[key]; ok {
+			return db.ErrCompanyNameExists
+		}
+		delete(r.store.names, previous)
+		r.store.names[key] = stored.ID
+		stored.Name = company.Name
+	}
+	if company.Description != nil {
+		stored.Description = clonePointer(company.Description)
+	}
+	if company.EmployeeCount != 0 {
+		stored.EmployeeCount = company.EmployeeCount
+	}
+	if company.Registered != nil {
+		stored.Registered = clonePointer(company.Registered)
+	}
+	if company.Type != "" {
+		stored.Type = company.Type
+	}
+	if !company.CreatedAt.IsZero() {
+		stored.CreatedAt = company.CreatedAt
+	}
+	stored.UpdatedAt = company.UpdatedAt
+	r.store.companies[stored.ID] = stored
+	return nil
+}
+
+// Delete removes a company of the organization by its ID
+func (r *CompanyRepository) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	company, ok := r.store.companies[id]
+	if !ok || company.OrganizationID != r.organizationID {
+		return db.ErrCompanyNotFound
+	}
+	delete(r.store.companies, id)
+	delete(r.store.names, companyName{organizationID: company.OrganizationID, name: company.Name})
+	return nil
+}
+
+// cloneCompany returns a copy of company sharing no memory with it
+func cloneCompany(company *models.Company) models.Company {
+	clone := *company
+	clone.Description = clonePointer(company.Description)
+	clone.Registered = clonePointer(company.Registered)
+	return clone
+}
+
+// clonePointer returns a pointer to a copy of the value p points to
+func clonePointer[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	clone := *p
+	return &clone
+}
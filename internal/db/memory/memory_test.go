@@ -0,0 +1,51 @@
+package memory_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/db/memory"
+)
+
+func TestCompanyRepositoryConformance(t *testing.T) {
+	dbtest.TestCompanyRepository(t, func(*testing.T) (db.CompanyRepositoryInterface, [2]string) {
+		return memory.NewCompanyRepository(), [2]string{uuid.New().String(), uuid.New().String()}
+	})
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	dbtest.TestUserRepository(t, func(*testing.T) (db.UserRepositoryInterface, string) {
+		return memory.NewUserRepository(), uuid.New().String()
+	})
+}
+
+func TestConcurrentCreates(t *testing.T) {
+	companies := memory.NewCompanyRepository().ForOrganization(uuid.New().String())
+
+	var wg sync.WaitGroup
+	errs := make([]error, 20)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = companies.Create(context.Background(), dbtest.NewCompany("Acme"))
+		}()
+	}
+	wg.Wait()
+
+	var created int
+	for _, err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.ErrorIs(t, err, db.ErrCompanyNameExists)
+		}
+	}
+	assert.Equal(t, 1, created, "only one company takes the name")
+}
@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/pkg/models"
+)
+
+// UserRepository is an in-memory db.UserRepositoryInterface
+type UserRepository struct {
+	mu     sync.RWMutex
+	users  map[string]models.User
+	emails map[string]string
+	names  map[string]string
+}
+
+// NewUserRepository creates an empty user repository
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		users:  make(map[string]models.User),
+		emails: make(map[string]string),
+		names:  make(map[string]string),
+	}
+}
+
+// Create stores a new user. An email or name already taken fails with
+// db.ErrEmailRegistered or db.ErrUserNameTaken, and an ID already taken with
+// db.ErrUserExists.
+func (r *UserRepository) Create(ctx context.Context, user models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = now
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[user.ID]; ok {
+		return db.ErrUserExists
+	}
+	if _, ok := r.emails[user.Email]; ok {
+		return db.ErrEmailRegistered
+	}
+	if _, ok := r.names[user.Name]; ok {
+		return db.ErrUserNameTaken
+	}
+	r.users[user.ID] = user
+	r.emails[user.Email] = user.ID
+	r.names[user.Name] = user.ID
+	return nil
+}
+
+// GetByID retrieves a user by ID
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[id.String()]
+	if !ok {
+		return nil, db.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// GetByEmail retrieves a user by email
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	id, ok := r.emails[email]
+	if !ok {
+		return nil, db.ErrUserNotFound
+	}
+	user := r.users[id]
+	return &user, nil
+}
@@ -0,0 +1,465 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+const (
+	// migrationsTable records the applied migrations
+	migrationsTable = "schema_migrations"
+	// migrationLockName identifies the migration lock on PostgreSQL and MySQL
+	migrationLockName = "xm-exercise:" + migrationsTable
+	// migrationLockID is the PostgreSQL advisory lock key of migrationLockName
+	migrationLockID = 7261944310
+	// lockRetryInterval is the pause between attempts to take a held migration lock
+	lockRetryInterval = 250 * time.Millisecond
+)
+
+var (
+	// ErrSchemaBehind is returned when the database has migrations pending
+	ErrSchemaBehind = errors.New("database schema is behind")
+	// ErrMigrationLocked is returned when another process kept the migration
+	// lock for longer than the lock timeout
+	ErrMigrationLocked = errors.New("migration lock is held by another process")
+)
+
+// migrationFileName matches migration files, e.g. 0002_add_index.up.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change with the SQL reverting it
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// AppliedMigration is a migration recorded in the schema version table
+type AppliedMigration struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// MigrationStatus describes the schema version of a database
+type MigrationStatus struct {
+	// Current is the highest applied version, or zero
+	Current int
+	// Latest is the highest version known to this build
+	Latest  int
+	Applied []AppliedMigration
+	Pending []Migration
+}
+
+// Migrator applies the embedded migrations of the database's dialect. Every
+// run holds a lock so that processes starting at once migrate one at a time.
+type Migrator struct {
+	db          *Database
+	dialect     string
+	migrations  []Migration
+	lockTimeout time.Duration
+}
+
+// NewMigrator creates a migrator for database, waiting up to lockTimeout for
+// migrations run by other processes
+func NewMigrator(database *Database, lockTimeout time.Duration) (*Migrator, error) {
+	dialect := database.Dialector.Name()
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: database, dialect: dialect, migrations: migrations, lockTimeout: lockTimeout}, nil
+}
+
+// loadMigrations reads the embedded migrations of dialect, ordered by version
+func loadMigrations(dialect string) ([]Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database dialect %s", dialect)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Latest returns the highest migration version known to this build
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status reports the applied and pending migrations
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	if !m.db.WithContext(ctx).Migrator().HasTable(migrationsTable) {
+		return m.status(nil), nil
+	}
+
+	sqlDB, err := m.db.DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("could not get sql.DB: %w", err)
+	}
+	applied, err := readApplied(ctx, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+	return m.status(applied), nil
+}
+
+// status compares the applied migrations with the known ones
+func (m *Migrator) status(applied []AppliedMigration) *MigrationStatus {
+	status := &MigrationStatus{Latest: m.Latest(), Applied: applied}
+	versions := map[int]bool{}
+	for _, migration := range applied {
+		versions[migration.Version] = true
+		status.Current = max(status.Current, migration.Version)
+	}
+	for _, migration := range m.migrations {
+		if !versions[migration.Version] {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+	return status
+}
+
+// Check returns ErrSchemaBehind when migrations are pending. A schema ahead of
+// this build, as during a rolling deployment, passes.
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if len(status.Pending) > 0 {
+		return fmt.Errorf("%w: version %d, %d migrations pending up to %d",
+			ErrSchemaBehind, status.Current, len(status.Pending), status.Latest)
+	}
+	return nil
+}
+
+// Up applies every pending migration and returns the ones applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the latest steps applied migrations and returns the ones reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		return nil, errors.New("steps must be positive")
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target := 0
+	if steps < len(status.Applied) {
+		target = status.Applied[len(status.Applied)-steps-1].Version
+	}
+	return m.To(ctx, target)
+}
+
+// To applies the pending migrations up to version and reverts the applied ones
+// above it, returning the migrations applied or reverted in order
+func (m *Migrator) To(ctx context.Context, version int) ([]Migration, error) {
+	if version < 0 {
+		return nil, errors.New("version must not be negative")
+	}
+	if version != 0 && !m.known(version) {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	sqlDB, err := m.db.DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("could not get sql.DB: %w", err)
+	}
+	// The lock belongs to a session, so the whole run uses one connection
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not get a database connection: %w", err)
+	}
+	//nolint:errcheck // Returns the connection to the pool.
+	defer conn.Close()
+
+	if err := m.lock(ctx, conn); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	err = func() error {
+		if _, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+migrationsTable+
+			" (version BIGINT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, applied_at TIMESTAMP NOT NULL)"); err != nil {
+			return fmt.Errorf("could not create the %s table: %w", migrationsTable, err)
+		}
+
+		// The versions are read under the lock, as another process may have
+		// migrated while this one waited
+		recorded, err := readApplied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		applied := map[int]bool{}
+		for _, migration := range recorded {
+			applied[migration.Version] = true
+			if migration.Version > version && !m.known(migration.Version) {
+				return fmt.Errorf("cannot revert migration %d, which is unknown to this build", migration.Version)
+			}
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if migration := m.migrations[i]; migration.Version > version && applied[migration.Version] {
+				if err := m.apply(ctx, conn, migration, false); err != nil {
+					return err
+				}
+				done = append(done, migration)
+			}
+		}
+		for _, migration := range m.migrations {
+			if migration.Version <= version && !applied[migration.Version] {
+				if err := m.apply(ctx, conn, migration, true); err != nil {
+					return err
+				}
+				done = append(done, migration)
+			}
+		}
+		return nil
+	}()
+
+	if unlockErr := m.unlock(context.WithoutCancel(ctx), conn, err == nil); err == nil && unlockErr != nil {
+		return nil, fmt.Errorf("could not release the migration lock: %w", unlockErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// known reports whether this build has a migration with the given version
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// readApplied returns the migrations recorded in the schema version table, ordered by version
+func readApplied(ctx context.Context, db interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) ([]AppliedMigration, error) {
+	rows, err := db.QueryContext(ctx, "SELECT version, name, applied_at FROM "+migrationsTable+" ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("could not read the %s table: %w", migrationsTable, err)
+	}
+	//nolint:errcheck // Read-only; errors surface through rows.Err.
+	defer rows.Close()
+
+	var applied []AppliedMigration
+	for rows.Next() {
+		var migration AppliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.AppliedAt); err != nil {
+			return nil, fmt.Errorf("could not read the %s table: %w", migrationsTable, err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, rows.Err()
+}
+
+// apply runs the up or down SQL of migration and records the new version. On
+// PostgreSQL each migration runs in a transaction of its own; SQLite runs the
+// whole migration in the lock's transaction and MySQL commits DDL implicitly.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	script, record := migration.down, m.bind("DELETE FROM "+migrationsTable+" WHERE version = ?")
+	args := []any{migration.Version}
+	if up {
+		script = migration.up
+		record = m.bind("INSERT INTO " + migrationsTable + " (version, name, applied_at) VALUES (?, ?, ?)")
+		args = append(args, migration.Name, time.Now().UTC())
+	}
+
+	var exec interface {
+		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	} = conn
+	var tx *sql.Tx
+	if m.dialect == "postgres" {
+		var err error
+		if tx, err = conn.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+		//nolint:errcheck // A no-op once committed.
+		defer tx.Rollback()
+		exec = tx
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := exec.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	if _, err := exec.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("could not record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// lock takes the migration lock on conn, waiting up to the lock timeout. On
+// SQLite the lock is a write transaction held until unlock.
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) error {
+	deadline := time.Now().Add(m.lockTimeout)
+	for {
+		locked, err := m.tryLock(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("could not take the migration lock: %w", err)
+		}
+		if locked {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrMigrationLocked
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// tryLock attempts to take the migration lock, reporting false when another
+// process holds it
+func (m *Migrator) tryLock(ctx context.Context, conn *sql.Conn) (bool, error) {
+	switch m.dialect {
+	case "postgres":
+		var locked bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationLockID).Scan(&locked)
+		return locked, err
+	case "mysql":
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", migrationLockName).Scan(&locked)
+		return locked.Int64 == 1, err
+	default:
+		_, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+// unlock releases the migration lock. On SQLite it commits the migrations
+// when they succeeded and rolls them back otherwise.
+func (m *Migrator) unlock(ctx context.Context, conn *sql.Conn, succeeded bool) error {
+	var err error
+	switch m.dialect {
+	case "postgres":
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+	case "mysql":
+		_, err = conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", migrationLockName)
+	default:
+		if succeeded {
+			_, err = conn.ExecContext(ctx, "COMMIT")
+		} else {
+			_, err = conn.ExecContext(ctx, "ROLLBACK")
+		}
+	}
+	return err
+}
+
+// bind rewrites the ? placeholders of query for the dialect
+func (m *Migrator) bind(query string) string {
+	if m.dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitStatements splits a migration script into statements ending with a
+// semicolon at the end of a line, dropping comment lines
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
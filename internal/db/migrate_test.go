@@ -0,0 +1,234 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"xm-exercise/pkg/models"
+)
+
+// schemaModels are the models stored by the migrated schema
+var schemaModels = []interface{}{
+	&models.Organization{}, &models.User{}, &models.Company{}, &models.OutboxMessage{},
+	&models.ProcessedEvent{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}, &models.CompanyEvent{},
+}
+
+// legacyUser and legacyCompany are the models of the release before
+// organizations, whose schema GORM AutoMigrate created
+type legacyUser struct {
+	ID           string `gorm:"type:uuid;primaryKey"`
+	Name         string `gorm:"size:50;uniqueIndex;not null"`
+	Email        string `gorm:"size:255;uniqueIndex;not null"`
+	PasswordHash string `gorm:"size:255;not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (legacyUser) TableName() string { return "users" }
+
+type legacyCompany struct {
+	ID            string  `gorm:"type:uuid;primaryKey"`
+	Name          string  `gorm:"size:15;uniqueIndex;not null"`
+	Description   *string `gorm:"size:3000"`
+	EmployeeCount int     `gorm:"not null"`
+	Registered    bool    `gorm:"not null"`
+	Type          string  `gorm:"not null"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (legacyCompany) TableName() string { return "companies" }
+
+func newTestMigrator(t *testing.T, connectionString string) (*Migrator, *Database) {
+	t.Helper()
+	database, err := NewDatabase("sqlite", connectionString)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+	migrator, err := NewMigrator(database, 5*time.Second)
+	require.NoError(t, err)
+	return migrator, database
+}
+
+func memoryDatabase() string {
+	return "file:" + uuid.New().String() + "?mode=memory&cache=shared"
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("migrates up and down", func(t *testing.T) {
+		migrator, database := newTestMigrator(t, memoryDatabase())
+		assert.ErrorIs(t, migrator.Check(ctx), ErrSchemaBehind)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		require.Len(t, applied, migrator.Latest())
+		assert.Equal(t, "initial_schema", applied[0].Name)
+		require.NoError(t, migrator.Check(ctx))
+		assert.True(t, database.Migrator().HasTable(&models.Company{}))
+
+		applied, err = migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, applied, "nothing is pending")
+
+		status, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, migrator.Latest(), status.Current)
+		assert.Empty(t, status.Pending)
+		require.Len(t, status.Applied, migrator.Latest())
+		assert.WithinDuration(t, time.Now(), status.Applied[0].AppliedAt, time.Minute)
+
+		reverted, err := migrator.Down(ctx, migrator.Latest())
+		require.NoError(t, err)
+		assert.Len(t, reverted, migrator.Latest())
+		assert.False(t, database.Migrator().HasTable(&models.Company{}))
+		assert.ErrorIs(t, migrator.Check(ctx), ErrSchemaBehind)
+
+		applied, err = migrator.To(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, applied[0].Version)
+
+		_, err = migrator.To(ctx, 9999)
+		assert.ErrorContains(t, err, "unknown migration version")
+	})
+
+	t.Run("schema matches the models", func(t *testing.T) {
+		migrator, database := newTestMigrator(t, memoryDatabase())
+		_, err := migrator.Up(ctx)
+		require.NoError(t, err)
+
+		for _, model := range schemaModels {
+			stmt := &gorm.Statement{DB: database.DB}
+			require.NoError(t, stmt.Parse(model))
+			for _, field := range stmt.Schema.Fields {
+				if field.DBName != "" {
+					assert.True(t, database.Migrator().HasColumn(model, field.DBName), "%s.%s", stmt.Schema.Table, field.DBName)
+				}
+			}
+			for name := range stmt.Schema.ParseIndexes() {
+				assert.True(t, database.Migrator().HasIndex(model, name), "%s %s", stmt.Schema.Table, name)
+			}
+		}
+	})
+
+	t.Run("upgrades a schema created by AutoMigrate before organizations", func(t *testing.T) {
+		migrator, database := newTestMigrator(t, memoryDatabase())
+		require.NoError(t, database.AutoMigrate(&legacyUser{}, &legacyCompany{}))
+		userID, companyID := uuid.New().String(), uuid.New().String()
+		require.NoError(t, database.Create(&legacyUser{ID: userID, Name: "demo", Email: "demo@example.com"}).Error)
+		require.NoError(t, database.Create(&legacyCompany{ID: companyID, Name: "Acme Corp", EmployeeCount: 10}).Error)
+
+		applied, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		assert.Len(t, applied, migrator.Latest())
+
+		organization, err := NewOrganizationRepository(database).GetByID(ctx, "00000000-0000-0000-0000-000000000001")
+		require.NoError(t, err)
+		user, err := NewUserRepository(database).GetByEmail(ctx, "demo@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, organization.ID, user.OrganizationID, "existing users move to the default organization")
+		company, err := NewCompanyRepository(database).ForOrganization(organization.ID).GetByID(ctx, companyID)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme Corp", company.Name, "existing companies move to the default organization")
+
+		assert.False(t, database.Migrator().HasIndex(&models.Company{}, "idx_companies_name"))
+		other := models.Organization{ID: uuid.New().String(), Name: "Other"}
+		require.NoError(t, NewOrganizationRepository(database).Create(ctx, &other))
+		registered := true
+		require.NoError(t, NewCompanyRepository(database).ForOrganization(other.ID).Create(ctx, &models.Company{
+			ID: uuid.New().String(), Name: "Acme Corp", EmployeeCount: 1, Registered: &registered, Type: models.TypeCorporation,
+		}), "company names are unique per organization only")
+	})
+
+	t.Run("numbers existing outbox messages by creation time", func(t *testing.T) {
+		migrator, database := newTestMigrator(t, memoryDatabase())
+		_, err := migrator.To(ctx, 4)
+		require.NoError(t, err)
+		createdAt := time.Now().UTC()
+		ids := []string{uuid.New().String(), uuid.New().String()}
+		for i, id := range []string{ids[1], ids[0]} {
+			require.NoError(t, database.Exec("INSERT INTO outbox_messages "+
+				"(id, topic, message_key, event_type, payload, created_at, next_attempt_at) VALUES (?, 't', 'k', 'e', ?, ?, ?)",
+				id, []byte("{}"), createdAt.Add(-time.Duration(i)*time.Second), createdAt).Error)
+		}
+
+		_, err = migrator.Up(ctx)
+		require.NoError(t, err)
+		var messages []models.OutboxMessage
+		require.NoError(t, database.Order("sequence_number").Find(&messages).Error)
+		require.Len(t, messages, 2)
+		assert.Equal(t, ids, []string{messages[0].ID, messages[1].ID})
+
+		message := models.OutboxMessage{ID: uuid.New().String(), Topic: "t", Key: "k", EventType: "e", Payload: []byte("{}")}
+		require.NoError(t, NewOutboxRepository(database).Add(ctx, &message))
+		require.NoError(t, database.First(&message, "id = ?", message.ID).Error)
+		assert.Equal(t, int64(3), message.Sequence, "new messages are numbered after the existing ones")
+	})
+
+	t.Run("processes starting at once migrate one at a time", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.db")
+
+		var wg sync.WaitGroup
+		applied := make([][]Migration, 3)
+		errs := make([]error, 3)
+		for i := range applied {
+			migrator, _ := newTestMigrator(t, path)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				applied[i], errs[i] = migrator.Up(ctx)
+			}()
+		}
+		wg.Wait()
+
+		var total int
+		for i := range applied {
+			require.NoError(t, errs[i])
+			total += len(applied[i])
+		}
+		migrator, _ := newTestMigrator(t, path)
+		assert.Equal(t, migrator.Latest(), total, "every migration ran once")
+	})
+}
+
+func TestLoadMigrations(t *testing.T) {
+	sqlite, err := loadMigrations("sqlite")
+	require.NoError(t, err)
+	require.NotEmpty(t, sqlite)
+
+	for _, dialect := range []string{"postgres", "mysql"} {
+		migrations, err := loadMigrations(dialect)
+		require.NoError(t, err)
+		require.Len(t, migrations, len(sqlite), "%s has every migration", dialect)
+		for i, migration := range migrations {
+			assert.Equal(t, sqlite[i].Version, migration.Version, dialect)
+			assert.Equal(t, sqlite[i].Name, migration.Name, dialect)
+		}
+	}
+
+	_, err = loadMigrations("oracle")
+	assert.Error(t, err)
+}
+
+func TestSplitStatements(t *testing.T) {
+	statements := splitStatements(`-- Comment
+CREATE TABLE a (
+    id integer
+);
+
+CREATE INDEX idx_a_id ON a (id);
+DROP TABLE b`)
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n    id integer\n);",
+		"CREATE INDEX idx_a_id ON a (id);",
+		"DROP TABLE b",
+	}, statements)
+}
@@ -0,0 +1,27 @@
+-- Initial schema, before organizations were added. UUIDs are stored as
+-- CHAR(36) since MySQL has no UUID type.
+
+CREATE TABLE IF NOT EXISTS users (
+    id CHAR(36) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_users_name (name),
+    UNIQUE INDEX idx_users_email (email)
+);
+
+CREATE TABLE IF NOT EXISTS companies (
+    id CHAR(36) NOT NULL,
+    name VARCHAR(15) NOT NULL,
+    description VARCHAR(3000),
+    employee_count BIGINT NOT NULL,
+    registered BOOLEAN NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_companies_name (name)
+);
@@ -0,0 +1,12 @@
+-- Fails when two organizations have a company of the same name
+
+ALTER TABLE companies
+    DROP INDEX idx_companies_organization_name,
+    ADD UNIQUE INDEX idx_companies_name (name),
+    DROP COLUMN organization_id;
+
+ALTER TABLE users
+    DROP INDEX idx_users_organization_id,
+    DROP COLUMN organization_id;
+
+DROP TABLE IF EXISTS organizations;
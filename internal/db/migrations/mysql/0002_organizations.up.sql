@@ -0,0 +1,30 @@
+-- Scopes users and companies to organizations. Rows created before
+-- organizations existed move to a "Default" organization, and company names
+-- become unique per organization instead of globally.
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id CHAR(36) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    PRIMARY KEY (id),
+    UNIQUE INDEX idx_organizations_name (name)
+);
+
+INSERT INTO organizations (id, name, created_at, updated_at)
+SELECT '00000000-0000-0000-0000-000000000001', 'Default', NOW(3), NOW(3)
+FROM DUAL
+WHERE EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM companies);
+
+ALTER TABLE users ADD COLUMN organization_id CHAR(36) AFTER id;
+UPDATE users SET organization_id = '00000000-0000-0000-0000-000000000001';
+ALTER TABLE users
+    MODIFY organization_id CHAR(36) NOT NULL,
+    ADD INDEX idx_users_organization_id (organization_id);
+
+ALTER TABLE companies ADD COLUMN organization_id CHAR(36) AFTER id;
+UPDATE companies SET organization_id = '00000000-0000-0000-0000-000000000001';
+ALTER TABLE companies
+    MODIFY organization_id CHAR(36) NOT NULL,
+    DROP INDEX idx_companies_name,
+    ADD UNIQUE INDEX idx_companies_organization_name (organization_id, name);
@@ -0,0 +1,79 @@
+-- Tables added after organizations. UUIDs are stored as CHAR(36) since MySQL has
+-- no UUID type.
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id CHAR(36) NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    message_key VARCHAR(255),
+    event_type VARCHAR(100) NOT NULL,
+    headers TEXT,
+    payload LONGBLOB NOT NULL,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    last_error VARCHAR(1000),
+    created_at DATETIME(3),
+    next_attempt_at DATETIME(3) NOT NULL,
+    sent_at DATETIME(3),
+    PRIMARY KEY (id),
+    INDEX idx_outbox_messages_created_at (created_at),
+    INDEX idx_outbox_messages_next_attempt_at (next_attempt_at),
+    INDEX idx_outbox_messages_sent_at (sent_at)
+);
+
+CREATE TABLE IF NOT EXISTS processed_events (
+    id VARCHAR(255) NOT NULL,
+    topic VARCHAR(255) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    processed_at DATETIME(3) NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_processed_events_processed_at (processed_at)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id CHAR(36) NOT NULL,
+    organization_id CHAR(36) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    event_types TEXT,
+    secret VARCHAR(255) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    consecutive_failures BIGINT NOT NULL DEFAULT 0,
+    disabled_at DATETIME(3),
+    created_at DATETIME(3),
+    updated_at DATETIME(3),
+    PRIMARY KEY (id),
+    INDEX idx_webhook_subscriptions_organization_id (organization_id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id CHAR(36) NOT NULL,
+    subscription_id CHAR(36) NOT NULL,
+    event_id CHAR(36) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    payload LONGBLOB NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts BIGINT NOT NULL DEFAULT 0,
+    last_status_code BIGINT,
+    last_error VARCHAR(1000),
+    created_at DATETIME(3),
+    next_attempt_at DATETIME(3) NOT NULL,
+    last_attempt_at DATETIME(3),
+    delivered_at DATETIME(3),
+    PRIMARY KEY (id),
+    INDEX idx_webhook_deliveries_subscription_id (subscription_id),
+    INDEX idx_webhook_deliveries_status (status),
+    INDEX idx_webhook_deliveries_created_at (created_at),
+    INDEX idx_webhook_deliveries_next_attempt_at (next_attempt_at)
+);
+
+CREATE TABLE IF NOT EXISTS company_events (
+    sequence BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    event_type VARCHAR(100) NOT NULL,
+    organization_id CHAR(36) NOT NULL,
+    company_id CHAR(36) NOT NULL,
+    company TEXT NOT NULL,
+    previous TEXT,
+    occurred_at DATETIME(3) NOT NULL,
+    PRIMARY KEY (sequence),
+    INDEX idx_company_events_organization_id (organization_id),
+    INDEX idx_company_events_company_id (company_id),
+    INDEX idx_company_events_occurred_at (occurred_at)
+);
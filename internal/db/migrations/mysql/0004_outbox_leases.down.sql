@@ -0,0 +1,4 @@
+ALTER TABLE outbox_messages
+    DROP INDEX idx_outbox_messages_message_key,
+    DROP COLUMN dead_lettered_at,
+    DROP COLUMN locked_until;
@@ -0,0 +1,7 @@
+-- Relays lease the messages they claim instead of holding row locks while
+-- publishing, and messages exhausting their attempts are dead-lettered
+
+ALTER TABLE outbox_messages
+    ADD COLUMN locked_until DATETIME(3) NULL,
+    ADD COLUMN dead_lettered_at DATETIME(3) NULL,
+    ADD INDEX idx_outbox_messages_message_key (message_key);
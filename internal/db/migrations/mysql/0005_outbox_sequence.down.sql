@@ -0,0 +1,3 @@
+ALTER TABLE outbox_messages
+    DROP INDEX idx_outbox_messages_sequence_number,
+    DROP COLUMN sequence_number;
@@ -0,0 +1,12 @@
+-- Outbox messages are numbered in insertion order by the database, so that a
+-- key's messages keep their order whatever the clocks of the writers say.
+-- Existing messages are numbered by creation time.
+
+ALTER TABLE outbox_messages ADD COLUMN sequence_number BIGINT NULL;
+UPDATE outbox_messages
+JOIN (SELECT id, ROW_NUMBER() OVER (ORDER BY created_at, id) AS n FROM outbox_messages) ordered
+    ON outbox_messages.id = ordered.id
+SET outbox_messages.sequence_number = ordered.n;
+ALTER TABLE outbox_messages
+    MODIFY sequence_number BIGINT NOT NULL AUTO_INCREMENT,
+    ADD UNIQUE INDEX idx_outbox_messages_sequence_number (sequence_number);
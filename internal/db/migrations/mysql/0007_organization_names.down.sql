@@ -0,0 +1 @@
+CREATE UNIQUE INDEX idx_organizations_name ON organizations (name);
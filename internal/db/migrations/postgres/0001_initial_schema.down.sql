@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS companies;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,27 @@
+-- Schema as created by GORM AutoMigrate before organizations were added. IF
+-- NOT EXISTS lets databases created that way adopt the migration.
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid,
+    name varchar(50) NOT NULL,
+    email varchar(255) NOT NULL,
+    password_hash varchar(255) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users (name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS companies (
+    id uuid,
+    name varchar(15) NOT NULL,
+    description varchar(3000),
+    employee_count bigint NOT NULL,
+    registered boolean NOT NULL,
+    type text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_companies_name ON companies (name);
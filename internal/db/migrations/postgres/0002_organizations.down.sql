@@ -0,0 +1,10 @@
+-- Fails when two organizations have a company of the same name
+
+DROP INDEX IF EXISTS idx_companies_organization_name;
+CREATE UNIQUE INDEX idx_companies_name ON companies (name);
+ALTER TABLE companies DROP COLUMN organization_id;
+
+DROP INDEX IF EXISTS idx_users_organization_id;
+ALTER TABLE users DROP COLUMN organization_id;
+
+DROP TABLE IF EXISTS organizations;
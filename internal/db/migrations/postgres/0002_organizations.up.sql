@@ -0,0 +1,27 @@
+-- Scopes users and companies to organizations. Rows created before
+-- organizations existed move to a "Default" organization, and company names
+-- become unique per organization instead of globally.
+
+CREATE TABLE IF NOT EXISTS organizations (
+    id uuid,
+    name varchar(100) NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_organizations_name ON organizations (name);
+
+INSERT INTO organizations (id, name, created_at, updated_at)
+SELECT '00000000-0000-0000-0000-000000000001', 'Default', now(), now()
+WHERE EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM companies);
+
+ALTER TABLE users ADD COLUMN organization_id uuid;
+UPDATE users SET organization_id = '00000000-0000-0000-0000-000000000001';
+ALTER TABLE users ALTER COLUMN organization_id SET NOT NULL;
+CREATE INDEX idx_users_organization_id ON users (organization_id);
+
+ALTER TABLE companies ADD COLUMN organization_id uuid;
+UPDATE companies SET organization_id = '00000000-0000-0000-0000-000000000001';
+ALTER TABLE companies ALTER COLUMN organization_id SET NOT NULL;
+DROP INDEX IF EXISTS idx_companies_name;
+CREATE UNIQUE INDEX idx_companies_organization_name ON companies (organization_id, name);
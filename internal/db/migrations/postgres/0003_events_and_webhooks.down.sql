@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS company_events;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS processed_events;
+DROP TABLE IF EXISTS outbox_messages;
@@ -0,0 +1,79 @@
+-- Tables added after organizations, as previously created by GORM AutoMigrate.
+-- IF NOT EXISTS lets databases created that way adopt the migration.
+
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id uuid,
+    topic varchar(255) NOT NULL,
+    message_key varchar(255),
+    event_type varchar(100) NOT NULL,
+    headers text,
+    payload bytea NOT NULL,
+    attempts bigint NOT NULL DEFAULT 0,
+    last_error varchar(1000),
+    created_at timestamptz,
+    next_attempt_at timestamptz NOT NULL,
+    sent_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_created_at ON outbox_messages (created_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_next_attempt_at ON outbox_messages (next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_outbox_messages_sent_at ON outbox_messages (sent_at);
+
+CREATE TABLE IF NOT EXISTS processed_events (
+    id varchar(255),
+    topic varchar(255) NOT NULL,
+    event_type varchar(100) NOT NULL,
+    processed_at timestamptz NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events (processed_at);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id uuid,
+    organization_id uuid NOT NULL,
+    url varchar(2048) NOT NULL,
+    event_types text,
+    secret varchar(255) NOT NULL,
+    enabled boolean NOT NULL DEFAULT true,
+    consecutive_failures bigint NOT NULL DEFAULT 0,
+    disabled_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_organization_id ON webhook_subscriptions (organization_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id uuid,
+    subscription_id uuid NOT NULL,
+    event_id uuid NOT NULL,
+    event_type varchar(100) NOT NULL,
+    payload bytea NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts bigint NOT NULL DEFAULT 0,
+    last_status_code bigint,
+    last_error varchar(1000),
+    created_at timestamptz,
+    next_attempt_at timestamptz NOT NULL,
+    last_attempt_at timestamptz,
+    delivered_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries (status);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries (next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS company_events (
+    sequence bigserial,
+    event_type varchar(100) NOT NULL,
+    organization_id uuid NOT NULL,
+    company_id uuid NOT NULL,
+    company text NOT NULL,
+    previous text,
+    occurred_at timestamptz NOT NULL,
+    PRIMARY KEY (sequence)
+);
+CREATE INDEX IF NOT EXISTS idx_company_events_organization_id ON company_events (organization_id);
+CREATE INDEX IF NOT EXISTS idx_company_events_company_id ON company_events (company_id);
+CREATE INDEX IF NOT EXISTS idx_company_events_occurred_at ON company_events (occurred_at);
@@ -0,0 +1,15 @@
+-- Outbox messages are numbered in insertion order by the database, so that a
+-- key's messages keep their order whatever the clocks of the writers say.
+-- Existing messages are numbered by creation time.
+
+CREATE SEQUENCE IF NOT EXISTS outbox_messages_sequence_number_seq;
+ALTER TABLE outbox_messages ADD COLUMN sequence_number bigint;
+UPDATE outbox_messages SET sequence_number = ordered.n
+FROM (SELECT id, row_number() OVER (ORDER BY created_at, id) AS n FROM outbox_messages) ordered
+WHERE outbox_messages.id = ordered.id;
+SELECT setval('outbox_messages_sequence_number_seq', COALESCE(MAX(sequence_number), 0) + 1, false) FROM outbox_messages;
+ALTER TABLE outbox_messages
+    ALTER COLUMN sequence_number SET DEFAULT nextval('outbox_messages_sequence_number_seq'),
+    ALTER COLUMN sequence_number SET NOT NULL;
+ALTER SEQUENCE outbox_messages_sequence_number_seq OWNED BY outbox_messages.sequence_number;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_messages_sequence_number ON outbox_messages (sequence_number);
@@ -0,0 +1,4 @@
+-- Webhook dispatchers lease the deliveries they claim instead of holding row
+-- locks while sending them
+
+ALTER TABLE webhook_deliveries ADD COLUMN locked_until timestamptz;
@@ -0,0 +1,4 @@
+-- Organization names are only labels and may repeat, so that signing up
+-- neither fails on nor reveals the name of another tenant
+
+DROP INDEX IF EXISTS idx_organizations_name;
@@ -0,0 +1,27 @@
+-- Schema as created by GORM AutoMigrate before organizations were added. IF
+-- NOT EXISTS lets databases created that way adopt the migration.
+
+CREATE TABLE IF NOT EXISTS `users` (
+    `id` uuid,
+    `name` text NOT NULL,
+    `email` text NOT NULL,
+    `password_hash` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_name` ON `users` (`name`);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_users_email` ON `users` (`email`);
+
+CREATE TABLE IF NOT EXISTS `companies` (
+    `id` uuid,
+    `name` text NOT NULL,
+    `description` text,
+    `employee_count` integer NOT NULL,
+    `registered` numeric NOT NULL,
+    `type` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_companies_name` ON `companies` (`name`);
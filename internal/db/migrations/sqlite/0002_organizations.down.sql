@@ -0,0 +1,39 @@
+-- Fails when two organizations have a company of the same name
+
+CREATE TABLE `companies_global` (
+    `id` uuid,
+    `name` text NOT NULL,
+    `description` text,
+    `employee_count` integer NOT NULL,
+    `registered` numeric NOT NULL,
+    `type` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+INSERT INTO `companies_global`
+    (`id`, `name`, `description`, `employee_count`, `registered`, `type`, `created_at`, `updated_at`)
+SELECT `id`, `name`, `description`, `employee_count`, `registered`, `type`, `created_at`, `updated_at`
+FROM `companies`;
+DROP TABLE `companies`;
+ALTER TABLE `companies_global` RENAME TO `companies`;
+CREATE UNIQUE INDEX `idx_companies_name` ON `companies` (`name`);
+
+CREATE TABLE `users_global` (
+    `id` uuid,
+    `name` text NOT NULL,
+    `email` text NOT NULL,
+    `password_hash` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+INSERT INTO `users_global` (`id`, `name`, `email`, `password_hash`, `created_at`, `updated_at`)
+SELECT `id`, `name`, `email`, `password_hash`, `created_at`, `updated_at`
+FROM `users`;
+DROP TABLE `users`;
+ALTER TABLE `users_global` RENAME TO `users`;
+CREATE UNIQUE INDEX `idx_users_name` ON `users` (`name`);
+CREATE UNIQUE INDEX `idx_users_email` ON `users` (`email`);
+
+DROP TABLE IF EXISTS `organizations`;
@@ -0,0 +1,57 @@
+-- Scopes users and companies to organizations. Rows created before
+-- organizations existed move to a "Default" organization, and company names
+-- become unique per organization instead of globally. SQLite cannot add a NOT
+-- NULL column without a default, so both tables are rebuilt.
+
+CREATE TABLE IF NOT EXISTS `organizations` (
+    `id` uuid,
+    `name` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_organizations_name` ON `organizations` (`name`);
+
+INSERT INTO `organizations` (`id`, `name`, `created_at`, `updated_at`)
+SELECT '00000000-0000-0000-0000-000000000001', 'Default', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+WHERE EXISTS (SELECT 1 FROM `users`) OR EXISTS (SELECT 1 FROM `companies`);
+
+CREATE TABLE `users_organizations` (
+    `id` uuid,
+    `organization_id` uuid NOT NULL,
+    `name` text NOT NULL,
+    `email` text NOT NULL,
+    `password_hash` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+INSERT INTO `users_organizations` (`id`, `organization_id`, `name`, `email`, `password_hash`, `created_at`, `updated_at`)
+SELECT `id`, '00000000-0000-0000-0000-000000000001', `name`, `email`, `password_hash`, `created_at`, `updated_at`
+FROM `users`;
+DROP TABLE `users`;
+ALTER TABLE `users_organizations` RENAME TO `users`;
+CREATE UNIQUE INDEX `idx_users_name` ON `users` (`name`);
+CREATE UNIQUE INDEX `idx_users_email` ON `users` (`email`);
+CREATE INDEX `idx_users_organization_id` ON `users` (`organization_id`);
+
+CREATE TABLE `companies_organizations` (
+    `id` uuid,
+    `organization_id` uuid NOT NULL,
+    `name` text NOT NULL,
+    `description` text,
+    `employee_count` integer NOT NULL,
+    `registered` numeric NOT NULL,
+    `type` text NOT NULL,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+INSERT INTO `companies_organizations`
+    (`id`, `organization_id`, `name`, `description`, `employee_count`, `registered`, `type`, `created_at`, `updated_at`)
+SELECT `id`, '00000000-0000-0000-0000-000000000001', `name`, `description`, `employee_count`, `registered`, `type`,
+    `created_at`, `updated_at`
+FROM `companies`;
+DROP TABLE `companies`;
+ALTER TABLE `companies_organizations` RENAME TO `companies`;
+CREATE UNIQUE INDEX `idx_companies_organization_name` ON `companies` (`organization_id`, `name`);
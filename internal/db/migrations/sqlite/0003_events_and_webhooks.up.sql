@@ -0,0 +1,78 @@
+-- Tables added after organizations, as previously created by GORM AutoMigrate.
+-- IF NOT EXISTS lets databases created that way adopt the migration.
+
+CREATE TABLE IF NOT EXISTS `outbox_messages` (
+    `id` uuid,
+    `topic` text NOT NULL,
+    `message_key` text,
+    `event_type` text NOT NULL,
+    `headers` text,
+    `payload` blob NOT NULL,
+    `attempts` integer NOT NULL DEFAULT 0,
+    `last_error` text,
+    `created_at` datetime,
+    `next_attempt_at` datetime NOT NULL,
+    `sent_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_outbox_messages_created_at` ON `outbox_messages` (`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_outbox_messages_next_attempt_at` ON `outbox_messages` (`next_attempt_at`);
+CREATE INDEX IF NOT EXISTS `idx_outbox_messages_sent_at` ON `outbox_messages` (`sent_at`);
+
+CREATE TABLE IF NOT EXISTS `processed_events` (
+    `id` text,
+    `topic` text NOT NULL,
+    `event_type` text NOT NULL,
+    `processed_at` datetime NOT NULL,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_processed_events_processed_at` ON `processed_events` (`processed_at`);
+
+CREATE TABLE IF NOT EXISTS `webhook_subscriptions` (
+    `id` uuid,
+    `organization_id` uuid NOT NULL,
+    `url` text NOT NULL,
+    `event_types` text,
+    `secret` text NOT NULL,
+    `enabled` numeric NOT NULL DEFAULT true,
+    `consecutive_failures` integer NOT NULL DEFAULT 0,
+    `disabled_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_webhook_subscriptions_organization_id` ON `webhook_subscriptions` (`organization_id`);
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+    `id` uuid,
+    `subscription_id` uuid NOT NULL,
+    `event_id` uuid NOT NULL,
+    `event_type` text NOT NULL,
+    `payload` blob NOT NULL,
+    `status` text NOT NULL,
+    `attempts` integer NOT NULL DEFAULT 0,
+    `last_status_code` integer,
+    `last_error` text,
+    `created_at` datetime,
+    `next_attempt_at` datetime NOT NULL,
+    `last_attempt_at` datetime,
+    `delivered_at` datetime,
+    PRIMARY KEY (`id`)
+);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_subscription_id` ON `webhook_deliveries` (`subscription_id`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_status` ON `webhook_deliveries` (`status`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_created_at` ON `webhook_deliveries` (`created_at`);
+CREATE INDEX IF NOT EXISTS `idx_webhook_deliveries_next_attempt_at` ON `webhook_deliveries` (`next_attempt_at`);
+
+CREATE TABLE IF NOT EXISTS `company_events` (
+    `sequence` integer PRIMARY KEY AUTOINCREMENT,
+    `event_type` text NOT NULL,
+    `organization_id` uuid NOT NULL,
+    `company_id` uuid NOT NULL,
+    `company` text NOT NULL,
+    `previous` text,
+    `occurred_at` datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS `idx_company_events_organization_id` ON `company_events` (`organization_id`);
+CREATE INDEX IF NOT EXISTS `idx_company_events_company_id` ON `company_events` (`company_id`);
+CREATE INDEX IF NOT EXISTS `idx_company_events_occurred_at` ON `company_events` (`occurred_at`);
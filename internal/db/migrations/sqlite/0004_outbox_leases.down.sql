@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS `idx_outbox_messages_message_key`;
+ALTER TABLE `outbox_messages` DROP COLUMN `dead_lettered_at`;
+ALTER TABLE `outbox_messages` DROP COLUMN `locked_until`;
@@ -0,0 +1,6 @@
+-- Relays lease the messages they claim instead of holding row locks while
+-- publishing, and messages exhausting their attempts are dead-lettered
+
+ALTER TABLE `outbox_messages` ADD COLUMN `locked_until` datetime;
+ALTER TABLE `outbox_messages` ADD COLUMN `dead_lettered_at` datetime;
+CREATE INDEX IF NOT EXISTS `idx_outbox_messages_message_key` ON `outbox_messages` (`message_key`);
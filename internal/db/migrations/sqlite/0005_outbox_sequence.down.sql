@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS `outbox_messages_sequence_number`;
+DROP INDEX IF EXISTS `idx_outbox_messages_sequence_number`;
+ALTER TABLE `outbox_messages` DROP COLUMN `sequence_number`;
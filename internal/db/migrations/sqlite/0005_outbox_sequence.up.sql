@@ -0,0 +1,16 @@
+-- Outbox messages are numbered in insertion order by the database, so that a
+-- key's messages keep their order whatever the clocks of the writers say.
+-- Existing messages are numbered by creation time. SQLite has no sequences, so
+-- a trigger numbers each new message after the highest number in use; its
+-- writes are serialized, so no two messages get the same number.
+
+ALTER TABLE `outbox_messages` ADD COLUMN `sequence_number` integer;
+UPDATE `outbox_messages` SET `sequence_number` = (
+    SELECT COUNT(*) FROM `outbox_messages` earlier
+    WHERE earlier.`created_at` < `outbox_messages`.`created_at`
+    OR (earlier.`created_at` = `outbox_messages`.`created_at` AND earlier.`id` <= `outbox_messages`.`id`)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_outbox_messages_sequence_number` ON `outbox_messages` (`sequence_number`);
+CREATE TRIGGER IF NOT EXISTS `outbox_messages_sequence_number` AFTER INSERT ON `outbox_messages`
+WHEN NEW.`sequence_number` IS NULL
+BEGIN UPDATE `outbox_messages` SET `sequence_number` = (SELECT COALESCE(MAX(`sequence_number`), 0) + 1 FROM `outbox_messages`) WHERE `id` = NEW.`id`; END;
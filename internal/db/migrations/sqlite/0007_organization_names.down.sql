@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS `idx_organizations_name` ON `organizations` (`name`);
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"xm-exercise/pkg/models"
+)
+
+var (
+	// ErrOrganizationNotFound is returned when no organization has the ID
+	ErrOrganizationNotFound = newError(ErrNotFound, "organization not found")
+	// ErrOrganizationExists is returned when another organization has the ID
+	ErrOrganizationExists = newError(ErrConflict, "organization already exists")
+)
+
+// OrganizationRepository handles database operations for organizations
+type OrganizationRepository struct {
+	db *Database
+}
+
+// NewOrganizationRepository creates a new organization repository
+func NewOrganizationRepository(db *Database) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// Create inserts a new organization into the database. An ID already taken
+// fails with ErrOrganizationExists; names may repeat.
+func (r *OrganizationRepository) Create(ctx context.Context, organization *models.Organization) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	if err := query.Create(organization).Error; err != nil {
+		if errors.Is(err, ErrConflict) {
+			return fmt.Errorf("%w: %w", ErrOrganizationExists, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// GetByID retrieves an organization by its ID
+func (r *OrganizationRepository) GetByID(ctx context.Context, id string) (*models.Organization, error) {
+	var organization models.Organization
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	result := query.First(&organization, "id = ?", id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, result.Error
+	}
+	return &organization, nil
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"xm-exercise/pkg/models"
+)
+
+// pendingMessage matches the outbox messages neither sent nor dead-lettered
+const pendingMessage = "sent_at IS NULL AND dead_lettered_at IS NULL"
+
+// OutboxRepository handles database operations for outbox messages
+type OutboxRepository struct {
+	db *Database
+}
+
+// NewOutboxRepository creates a new outbox repository
+func NewOutboxRepository(db *Database) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// Add inserts a new pending message into the outbox
+func (r *OutboxRepository) Add(ctx context.Context, message *models.OutboxMessage) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Create(message).Error
+}
+
+// ClaimPending leases up to limit unsent messages that are due for delivery
+// until now+lease, in insertion order, and commits before returning them, so that
+// no locks are held while they are published. Whole keys are claimed, so that
+// one relay gets all of a key's messages in order: a key is claimed through
+// its oldest pending message, which must be due and not leased, and the
+// messages following it are leased with it.
+func (r *OutboxRepository) ClaimPending(
+	ctx context.Context,
+	limit int,
+	now time.Time,
+	lease time.Duration,
+) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	err := r.db.WithTransaction(ctx, func(tx *Database) error {
+		session, cancel := tx.query(ctx)
+		defer cancel()
+		locking := tx.Dialector.Name() != "sqlite"
+
+		var heads []models.OutboxMessage
+		query := session.Where(pendingMessage+" AND next_attempt_at <= ?", now).
+			Where("(locked_until IS NULL OR locked_until <= ?)", now).
+			Where(`NOT EXISTS (SELECT 1 FROM outbox_messages earlier
+				WHERE earlier.message_key = outbox_messages.message_key
+				AND earlier.sent_at IS NULL AND earlier.dead_lettered_at IS NULL
+				AND earlier.sequence_number < outbox_messages.sequence_number)`).
+			Order("sequence_number").
+			Limit(limit)
+		if locking {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&heads).Error; err != nil {
+			return err
+		}
+		messages = heads
+		if len(heads) == 0 {
+			return nil
+		}
+
+		keys := make([]string, 0, len(heads))
+		ids := make([]string, 0, len(heads))
+		for _, head := range heads {
+			keys = append(keys, head.Key)
+			ids = append(ids, head.ID)
+		}
+		if len(heads) < limit {
+			var following []models.OutboxMessage
+			query = session.Where(pendingMessage+" AND message_key IN ? AND id NOT IN ?", keys, ids).
+				Order("sequence_number").
+				Limit(limit - len(heads))
+			if locking {
+				query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+			}
+			if err := query.Find(&following).Error; err != nil {
+				return err
+			}
+			messages = append(messages, following...)
+			for _, message := range following {
+				ids = append(ids, message.ID)
+			}
+		}
+
+		lockedUntil := now.Add(lease)
+		for i := range messages {
+			messages[i].LockedUntil = &lockedUntil
+		}
+		return session.Model(&models.OutboxMessage{}).
+			Where("id IN ?", ids).
+			Update("locked_until", lockedUntil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Sequence < messages[j].Sequence
+	})
+	return messages, nil
+}
+
+// MarkSent records a successful delivery and ends the message's lease
+func (r *OutboxRepository) MarkSent(ctx context.Context, id string, sentAt time.Time) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"sent_at":      sentAt,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_until": nil,
+		}).Error
+}
+
+// MarkFailed records a failed delivery, schedules the next attempt and ends
+// the message's lease
+func (r *OutboxRepository) MarkFailed(
+	ctx context.Context,
+	id string,
+	deliveryErr error,
+	nextAttemptAt time.Time,
+) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      truncateError(deliveryErr),
+			"next_attempt_at": nextAttemptAt,
+			"locked_until":    nil,
+		}).Error
+}
+
+// MarkDeadLettered records a failed delivery after which the message was
+// dead-lettered; it is not attempted again
+func (r *OutboxRepository) MarkDeadLettered(
+	ctx context.Context,
+	id string,
+	deliveryErr error,
+	deadLetteredAt time.Time,
+) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.OutboxMessage{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"attempts":         gorm.Expr("attempts + 1"),
+			"last_error":       truncateError(deliveryErr),
+			"dead_lettered_at": deadLetteredAt,
+			"locked_until":     nil,
+		}).Error
+}
+
+// Release ends the leases of messages that were claimed but not attempted
+func (r *OutboxRepository) Release(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.OutboxMessage{}).
+		Where("id IN ?", ids).
+		Update("locked_until", nil).Error
+}
+
+// truncateError returns the message of err cut to the size of last_error
+func truncateError(err error) string {
+	message := err.Error()
+	if len(message) > 1000 {
+		message = message[:1000]
+	}
+	return message
+}
+
+// Stats reports the number of pending messages and how far behind the relay is
+func (r *OutboxRepository) Stats(ctx context.Context, now time.Time) (*models.OutboxStats, error) {
+	var stats models.OutboxStats
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+
+	pending := query.Model(&models.OutboxMessage{}).Where(pendingMessage)
+	if err := pending.Count(&stats.Pending).Error; err != nil {
+		return nil, err
+	}
+
+	retrying := query.Model(&models.OutboxMessage{}).Where(pendingMessage + " AND attempts > 0")
+	if err := retrying.Count(&stats.Retrying).Error; err != nil {
+		return nil, err
+	}
+
+	deadLettered := query.Model(&models.OutboxMessage{}).Where("dead_lettered_at IS NOT NULL")
+	if err := deadLettered.Count(&stats.DeadLettered).Error; err != nil {
+		return nil, err
+	}
+
+	if stats.Pending > 0 {
+		var oldest models.OutboxMessage
+		err := query.Where(pendingMessage).Order("created_at").First(&oldest).Error
+		if err != nil {
+			return nil, err
+		}
+		stats.OldestPendingAt = &oldest.CreatedAt
+		stats.LagSeconds = now.Sub(oldest.CreatedAt).Seconds()
+	}
+
+	var lastSent models.OutboxMessage
+	err := query.Where("sent_at IS NOT NULL").Order("sent_at DESC").Limit(1).Find(&lastSent).Error
+	if err != nil {
+		return nil, err
+	}
+	if lastSent.SentAt != nil {
+		stats.LastSentAt = lastSent.SentAt
+	}
+
+	return &stats, nil
+}
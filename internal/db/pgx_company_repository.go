@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"xm-exercise/pkg/models"
+)
+
+// companyColumns are the columns of a company, in the order scanCompany reads them
+const companyColumns = `id, organization_id, name, description, employee_count, registered, type, created_at, ` +
+	`updated_at`
+
+// companyStatements are the statements of PgxCompanyRepository, prepared on
+// every connection of the pool under their names
+var companyStatements = map[string]string{
+	"company_create": `INSERT INTO companies (` + companyColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at, updated_at`,
+	"company_get": `SELECT ` + companyColumns + ` FROM companies
+		WHERE organization_id = $1 AND id = $2`,
+	// Like GORM's struct updates, only the non-zero fields are written
+	"company_update": `UPDATE companies SET
+			name = COALESCE(NULLIF($3::text, ''), name),
+			description = COALESCE($4::text, description),
+			employee_count = COALESCE(NULLIF($5::bigint, 0), employee_count),
+			registered = COALESCE($6::boolean, registered),
+			type = COALESCE(NULLIF($7::text, ''), type),
+			created_at = COALESCE($8::timestamptz, created_at),
+			updated_at = $9
+		WHERE organization_id = $1 AND id = $2
+		RETURNING ` + companyColumns,
+	"company_delete": `DELETE FROM companies WHERE organization_id = $1 AND id = $2 RETURNING id`,
+}
+
+// NewPgxPool connects a pgx pool, sized by pool, to the PostgreSQL database at
+// connString and prepares the statements of PgxCompanyRepository on each of its connections
+func NewPgxPool(ctx context.Context, connString string, pool PoolConfig) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid postgres connection string: %w", err)
+	}
+	if pool.MaxOpenConns > 0 {
+		config.MaxConns = int32(min(pool.MaxOpenConns, math.MaxInt32))
+	}
+	if pool.ConnMaxLifetime > 0 {
+		config.MaxConnLifetime = pool.ConnMaxLifetime
+	}
+	if pool.ConnMaxIdleTime > 0 {
+		config.MaxConnIdleTime = pool.ConnMaxIdleTime
+	}
+	if pool.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(pool.StatementTimeout.Milliseconds(), 10)
+	}
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		for name, sql := range companyStatements {
+			if _, err := conn.Prepare(ctx, name, sql); err != nil {
+				return fmt.Errorf("could not prepare %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	connections, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to database: %w", translateError(err))
+	}
+	if err := connections.Ping(ctx); err != nil {
+		connections.Close()
+		return nil, fmt.Errorf("could not connect to database: %w", translateError(err))
+	}
+	return connections, nil
+}
+
+// ConnectPgxPool connects a pool like NewPgxPool, trying again with
+// exponential backoff while the database is unavailable until ctx is done.
+// retry, when not nil, is called with the error and the delay before each new
+// attempt.
+func ConnectPgxPool(
+	ctx context.Context,
+	connString string,
+	pool PoolConfig,
+	retry func(err error, delay time.Duration),
+) (*pgxpool.Pool, error) {
+	return retryUnavailable(ctx, func() (*pgxpool.Pool, error) {
+		return NewPgxPool(ctx, connString, pool)
+	}, retry)
+}
+
+// PgxPoolStats returns the statistics of a pgx pool. Acquiring a connection
+// from an empty pool counts as a wait, and the wait duration is the time spent
+// acquiring connections at all.
+func PgxPoolStats(pool *pgxpool.Pool) models.PoolStats {
+	stats := pool.Stat()
+	return models.PoolStats{
+		MaxOpen:           int(stats.MaxConns()),
+		Open:              int(stats.TotalConns()),
+		InUse:             int(stats.AcquiredConns()),
+		Idle:              int(stats.IdleConns()),
+		WaitCount:         stats.EmptyAcquireCount(),
+		WaitDurationMs:    stats.AcquireDuration().Milliseconds(),
+		MaxIdleTimeClosed: stats.MaxIdleDestroyCount(),
+		MaxLifetimeClosed: stats.MaxLifetimeDestroyCount(),
+	}
+}
+
+// PgxCompanyRepository handles database operations for companies on
+// PostgreSQL through pgx, without GORM. Like CompanyRepository, every query is
+// scoped to a single organization; a repository that has not been bound with
+// ForOrganization matches no rows.
+type PgxCompanyRepository struct {
+	pool           *pgxpool.Pool
+	organizationID string
+	// QueryTimeout bounds each query; zero leaves queries bounded by their context alone
+	QueryTimeout time.Duration
+}
+
+// NewPgxCompanyRepository creates a new company repository on a pool created by NewPgxPool
+func NewPgxCompanyRepository(pool *pgxpool.Pool, queryTimeout time.Duration) *PgxCompanyRepository {
+	return &PgxCompanyRepository{pool: pool, QueryTimeout: queryTimeout}
+}
+
+// ForOrganization returns a copy of the repository scoped to the given organization
+func (r *PgxCompanyRepository) ForOrganization(organizationID string) CompanyRepositoryInterface {
+	return &PgxCompanyRepository{pool: r.pool, organizationID: organizationID, QueryTimeout: r.QueryTimeout}
+}
+
+// query returns ctx limited to QueryTimeout. The returned cancel function must
+// be called once the query is done.
+func (r *PgxCompanyRepository) query(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.QueryTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.QueryTimeout)
+}
+
+// scope returns the organization and company IDs as native UUIDs. An ID that
+// is no UUID matches no company.
+func (r *PgxCompanyRepository) scope(id string) (organizationID, companyID pgtype.UUID, ok bool) {
+	organization, err := uuid.Parse(r.organizationID)
+	if err != nil {
+		return organizationID, companyID, false
+	}
+	company, err := uuid.Parse(id)
+	if err != nil {
+		return organizationID, companyID, false
+	}
+	return pgtype.UUID{Bytes: organization, Valid: true}, pgtype.UUID{Bytes: company, Valid: true}, true
+}
+
+// Create inserts a new company into the database, owned by the repository's
+// organization. A name already taken in the organization fails with ErrCompanyNameExists.
+func (r *PgxCompanyRepository) Create(ctx context.Context, company *models.Company) error {
+	company.OrganizationID = r.organizationID
+	organizationID, companyID, ok := r.scope(company.ID)
+	if !ok {
+		return fmt.Errorf("invalid company or organization ID %q, %q", company.ID, company.OrganizationID)
+	}
+	now := time.Now()
+	createdAt, updatedAt := company.CreatedAt, company.UpdatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	if updatedAt.IsZero() {
+		updatedAt = now
+	}
+
+	ctx, cancel := r.query(ctx)
+	defer cancel()
+	err := r.pool.QueryRow(ctx, "company_create",
+		companyID, organizationID, company.Name, company.Description, company.EmployeeCount,
+		company.Registered, string(company.Type), createdAt, updatedAt,
+	).Scan(&company.CreatedAt, &company.UpdatedAt)
+	if err != nil {
+		return companyWriteError(translateError(err))
+	}
+	return nil
+}
+
+// GetByID retrieves a company by its ID
+func (r *PgxCompanyRepository) GetByID(ctx context.Context, id string) (*models.Company, error) {
+	organizationID, companyID, ok := r.scope(id)
+	if !ok {
+		return nil, ErrCompanyNotFound
+	}
+
+	ctx, cancel := r.query(ctx)
+	defer cancel()
+	var company models.Company
+	err := scanCompany(r.pool.QueryRow(ctx, "company_get", organizationID, companyID), &company)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCompanyNotFound
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &company, nil
+}
+
+// GetForUpdate retrieves a company by its ID. Every statement on the pool
+// commits on its own, so there is no transaction to hold a row lock for; the
+// service changes companies through the GORM repositories of a transaction.
+func (r *PgxCompanyRepository) GetForUpdate(ctx context.Context, id string) (*models.Company, error) {
+	return r.GetByID(ctx, id)
+}
+
+// Update writes the non-zero fields of company to the stored company and
+// fills company with the stored values
+func (r *PgxCompanyRepository) Update(ctx context.Context, company *models.Company) error {
+	organizationID, companyID, ok := r.scope(company.ID)
+	if !ok {
+		return ErrCompanyNotFound
+	}
+	var createdAt *time.Time
+	if !company.CreatedAt.IsZero() {
+		createdAt = &company.CreatedAt
+	}
+
+	ctx, cancel := r.query(ctx)
+	defer cancel()
+	var updated models.Company
+	err := scanCompany(r.pool.QueryRow(ctx, "company_update",
+		organizationID, companyID, company.Name, company.Description, company.EmployeeCount,
+		company.Registered, string(company.Type), createdAt, time.Now(),
+	), &updated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCompanyNotFound
+	}
+	if err != nil {
+		return companyWriteError(translateError(err))
+	}
+	*company = updated
+	return nil
+}
+
+// Delete removes a company by its ID
+func (r *PgxCompanyRepository) Delete(ctx context.Context, id string) error {
+	organizationID, companyID, ok := r.scope(id)
+	if !ok {
+		return ErrCompanyNotFound
+	}
+
+	ctx, cancel := r.query(ctx)
+	defer cancel()
+	var deleted pgtype.UUID
+	err := r.pool.QueryRow(ctx, "company_delete", organizationID, companyID).Scan(&deleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCompanyNotFound
+	}
+	return translateError(err)
+}
+
+// scanCompany reads the companyColumns of row into company
+func scanCompany(row pgx.Row, company *models.Company) error {
+	var id, organizationID pgtype.UUID
+	var companyType string
+	err := row.Scan(&id, &organizationID, &company.Name, &company.Description, &company.EmployeeCount,
+		&company.Registered, &companyType, &company.CreatedAt, &company.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	company.ID = uuid.UUID(id.Bytes).String()
+	company.OrganizationID = uuid.UUID(organizationID.Bytes).String()
+	company.Type = models.CompanyType(companyType)
+	return nil
+}
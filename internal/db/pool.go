@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"xm-exercise/pkg/models"
+)
+
+// PoolConfig configures the connections of a Database and of its replicas
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime closes connections left idle for longer; zero keeps them
+	ConnMaxIdleTime time.Duration
+	// StatementTimeout has the server abort statements running for longer;
+	// zero leaves them unbounded. Postgres applies it to every statement,
+	// MySQL to SELECTs only and sqlite not at all.
+	StatementTimeout time.Duration
+}
+
+// DefaultPoolConfig is the pool configuration of NewDatabase
+var DefaultPoolConfig = PoolConfig{MaxOpenConns: 100, MaxIdleConns: 10, ConnMaxLifetime: time.Hour}
+
+// Connection retry backoff of Connect
+const (
+	connectInitialBackoff = 500 * time.Millisecond
+	connectMaxBackoff     = 10 * time.Second
+)
+
+// Connect opens the database like Open, trying again with exponential backoff
+// while it is unavailable until ctx is done. retry, when not nil, is called
+// with the error and the delay before each new attempt.
+func Connect(
+	ctx context.Context,
+	dialect, connectionString string,
+	pool PoolConfig,
+	retry func(err error, delay time.Duration),
+) (*Database, error) {
+	return retryUnavailable(ctx, func() (*Database, error) {
+		return Open(dialect, connectionString, pool)
+	}, retry)
+}
+
+// retryUnavailable calls open until it succeeds or fails with an error other
+// than ErrUnavailable, waiting with exponential backoff in between until ctx
+// is done. retry, when not nil, is called with the error and the delay before
+// each new attempt.
+func retryUnavailable[T any](
+	ctx context.Context,
+	open func() (T, error),
+	retry func(err error, delay time.Duration),
+) (T, error) {
+	var zero T
+	delay := connectInitialBackoff
+	for {
+		opened, err := open()
+		if err == nil || !errors.Is(err, ErrUnavailable) {
+			return opened, err
+		}
+		if ctx.Err() != nil {
+			return zero, fmt.Errorf("%w (gave up: %w)", err, ctx.Err())
+		}
+		if retry != nil {
+			retry(err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, fmt.Errorf("%w (gave up: %w)", err, ctx.Err())
+		case <-timer.C:
+		}
+		delay = min(2*delay, connectMaxBackoff)
+	}
+}
+
+// PoolStats returns the statistics of the primary's connection pool
+func (d *Database) PoolStats() (models.PoolStats, error) {
+	sqlDB, err := d.DB.DB()
+	if err != nil {
+		return models.PoolStats{}, fmt.Errorf("could not get sql.DB: %w", err)
+	}
+	stats := sqlDB.Stats()
+	return models.PoolStats{
+		MaxOpen:           stats.MaxOpenConnections,
+		Open:              stats.OpenConnections,
+		InUse:             stats.InUse,
+		Idle:              stats.Idle,
+		WaitCount:         stats.WaitCount,
+		WaitDurationMs:    stats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:     stats.MaxIdleClosed,
+		MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed: stats.MaxLifetimeClosed,
+	}, nil
+}
+
+// withStatementTimeout returns connectionString with the session setting that
+// bounds statements by timeout on dialect
+func withStatementTimeout(dialect, connectionString string, timeout time.Duration) (string, error) {
+	if timeout <= 0 {
+		return connectionString, nil
+	}
+	milliseconds := strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	switch dialect {
+	case "postgres":
+		if !strings.HasPrefix(connectionString, "postgres://") && !strings.HasPrefix(connectionString, "postgresql://") {
+			return connectionString + " statement_timeout=" + milliseconds, nil
+		}
+		u, err := url.Parse(connectionString)
+		if err != nil {
+			return "", fmt.Errorf("invalid postgres connection string: %w", err)
+		}
+		query := u.Query()
+		query.Set("statement_timeout", milliseconds)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	case "mysql":
+		config, err := mysql.ParseDSN(connectionString)
+		if err != nil {
+			return "", fmt.Errorf("invalid mysql connection string: %w", err)
+		}
+		if config.Params == nil {
+			config.Params = make(map[string]string)
+		}
+		config.Params["max_execution_time"] = milliseconds
+		return config.FormatDSN(), nil
+	default:
+		return connectionString, nil
+	}
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+
+	"xm-exercise/pkg/models"
+)
+
+// ProcessedEventRepository handles database operations for processed upstream events
+type ProcessedEventRepository struct {
+	db *Database
+}
+
+// NewProcessedEventRepository creates a new processed event repository
+func NewProcessedEventRepository(db *Database) *ProcessedEventRepository {
+	return &ProcessedEventRepository{db: db}
+}
+
+// Exists reports whether the upstream event with the given ID was processed
+func (r *ProcessedEventRepository) Exists(ctx context.Context, id string) (bool, error) {
+	var count int64
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	if err := query.Model(&models.ProcessedEvent{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Add records an upstream event as processed
+func (r *ProcessedEventRepository) Add(ctx context.Context, event *models.ProcessedEvent) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Create(event).Error
+}
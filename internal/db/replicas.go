@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// primaryKey marks contexts whose reads must go to the primary
+type primaryKey struct{}
+
+// ReadPrimary returns a copy of ctx whose reads go to the primary rather than
+// a replica, so that they see the writes made just before them
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// ReadsPrimary reports whether ReadPrimary marked ctx
+func ReadsPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// replica is a read replica connection and whether it answered its last health check
+type replica struct {
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+// replicaSet holds the read replicas of a Database and checks their health
+// in the background
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint64
+	stop     chan struct{}
+	done     sync.WaitGroup
+}
+
+// UseReplicas connects the read replicas at connectionStrings, with the
+// dialect and pool configuration of d; replicas that are down are not waited
+// for. Reads that can tolerate replication lag then go to the healthy replicas
+// in turn, and to the primary while none is healthy. Each replica is pinged
+// every healthInterval, and a replica failing a query with ErrUnavailable is
+// taken out of rotation until it answers a ping again.
+func (d *Database) UseReplicas(connectionStrings []string, healthInterval time.Duration) error {
+	if d.replicas != nil {
+		return errors.New("replicas are already in use")
+	}
+	if healthInterval <= 0 {
+		return errors.New("replica health interval must be positive")
+	}
+
+	set := &replicaSet{stop: make(chan struct{})}
+	for i, connectionString := range connectionStrings {
+		db, err := openGorm(d.Dialector.Name(), connectionString, d.pool, false)
+		if err == nil {
+			r := &replica{db: db}
+			err = r.registerHealthTracking()
+			set.replicas = append(set.replicas, r)
+		}
+		if err != nil {
+			//nolint:errcheck // The replicas are being abandoned either way.
+			set.close()
+			return fmt.Errorf("replica %d: %w", i+1, err)
+		}
+	}
+
+	set.check(healthInterval)
+	set.done.Add(1)
+	go set.run(healthInterval)
+	d.replicas = set
+	return nil
+}
+
+// HealthyReplicas returns the number of replicas in rotation and the number of
+// replicas in use
+func (d *Database) HealthyReplicas() (healthy, total int) {
+	if d.replicas == nil {
+		return 0, 0
+	}
+	for _, r := range d.replicas.replicas {
+		if r.healthy.Load() {
+			healthy++
+		}
+	}
+	return healthy, len(d.replicas.replicas)
+}
+
+// read returns a session for a query that may be served by a replica, bound
+// to ctx like query. Transactions and contexts marked by ReadPrimary read from
+// the primary.
+func (d *Database) read(ctx context.Context) (*gorm.DB, context.CancelFunc) {
+	if d.replicas == nil || ReadsPrimary(ctx) || d.inTransaction() {
+		return d.query(ctx)
+	}
+	r := d.replicas.pick()
+	if r == nil {
+		return d.query(ctx)
+	}
+	return d.session(ctx, r.db)
+}
+
+// pick returns the next healthy replica in turn, or nil when none is healthy
+func (s *replicaSet) pick() *replica {
+	start := s.next.Add(1)
+	for i := range s.replicas {
+		r := s.replicas[(start+uint64(i))%uint64(len(s.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// run checks the replicas every interval until the set is closed
+func (s *replicaSet) run(interval time.Duration) {
+	defer s.done.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.check(interval)
+		}
+	}
+}
+
+// check pings every replica, waiting up to timeout for each
+func (s *replicaSet) check(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			sqlDB, err := r.db.DB()
+			if err == nil {
+				err = sqlDB.PingContext(ctx)
+			}
+			r.healthy.Store(err == nil)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// close stops the health checks and closes the replica connections
+func (s *replicaSet) close() error {
+	close(s.stop)
+	s.done.Wait()
+	var errs []error
+	for _, r := range s.replicas {
+		sqlDB, err := r.db.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// registerHealthTracking takes the replica out of rotation when one of its
+// queries fails with ErrUnavailable
+func (r *replica) registerHealthTracking() error {
+	track := func(tx *gorm.DB) {
+		if errors.Is(tx.Error, ErrUnavailable) {
+			r.healthy.Store(false)
+		}
+	}
+
+	callbacks := r.db.Callback()
+	if err := callbacks.Query().After("app:translate_error").Register("app:replica_health", track); err != nil {
+		return fmt.Errorf("could not register query health tracking: %w", err)
+	}
+	if err := callbacks.Row().After("app:translate_error").Register("app:replica_health", track); err != nil {
+		return fmt.Errorf("could not register row health tracking: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/pkg/models"
+)
+
+func TestReplicas(t *testing.T) {
+	ctx := context.Background()
+	newDatabase := func(connectionString string) *Database {
+		migrator, database := newTestMigrator(t, connectionString)
+		_, err := migrator.Up(ctx)
+		require.NoError(t, err)
+		return database
+	}
+	primary := newDatabase(memoryDatabase())
+	replicaURL := memoryDatabase()
+	// Holds the replica's schema; the shared memory database lives while a connection is open
+	replicated := newDatabase(replicaURL)
+	require.NoError(t, primary.UseReplicas([]string{replicaURL}, time.Hour))
+	healthy, total := primary.HealthyReplicas()
+	assert.Equal(t, 1, healthy)
+	assert.Equal(t, 1, total)
+
+	organizationID := uuid.New().String()
+	newCompany := func(name string) *models.Company {
+		return &models.Company{ID: uuid.New().String(), Name: name, Registered: new(bool), Type: models.TypeCorporation}
+	}
+	onPrimary, onReplica := newCompany("Primary"), newCompany("Replica")
+	require.NoError(t, NewCompanyRepository(primary).ForOrganization(organizationID).Create(ctx, onPrimary))
+	require.NoError(t, NewCompanyRepository(replicated).ForOrganization(organizationID).Create(ctx, onReplica))
+	companies := NewCompanyRepository(primary).ForOrganization(organizationID)
+
+	t.Run("reads from the replicas", func(t *testing.T) {
+		_, err := companies.GetByID(ctx, onReplica.ID)
+		assert.NoError(t, err)
+		_, err = companies.GetByID(ctx, onPrimary.ID)
+		assert.ErrorIs(t, err, ErrCompanyNotFound, "the write has not reached the replica")
+	})
+
+	t.Run("reads marked contexts from the primary", func(t *testing.T) {
+		_, err := companies.GetByID(ReadPrimary(ctx), onPrimary.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("reads transactions from the primary", func(t *testing.T) {
+		err := primary.WithTransaction(ctx, func(tx *Database) error {
+			_, err := NewCompanyRepository(tx).ForOrganization(organizationID).GetByID(ctx, onPrimary.ID)
+			return err
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("falls back to the primary without healthy replicas", func(t *testing.T) {
+		sqlDB, err := primary.replicas.replicas[0].db.DB()
+		require.NoError(t, err)
+		require.NoError(t, sqlDB.Close())
+		primary.replicas.check(time.Second)
+
+		healthy, _ := primary.HealthyReplicas()
+		assert.Zero(t, healthy)
+		_, err = companies.GetByID(ctx, onPrimary.ID)
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"xm-exercise/internal/utils"
+)
+
+// Repositories are the repositories bound to one transaction
+type Repositories struct {
+	// Tx is the transaction itself, for building repositories of other packages
+	Tx              *Database
+	Users           *UserRepository
+	Organizations   *OrganizationRepository
+	Companies       *CompanyRepository
+	CompanyEvents   *CompanyEventRepository
+	Outbox          *OutboxRepository
+	ProcessedEvents *ProcessedEventRepository
+	Webhooks        *WebhookRepository
+}
+
+// newRepositories returns the repositories of the transaction tx
+func newRepositories(tx *Database) *Repositories {
+	return &Repositories{
+		Tx:              tx,
+		Users:           NewUserRepository(tx),
+		Organizations:   NewOrganizationRepository(tx),
+		Companies:       NewCompanyRepository(tx),
+		CompanyEvents:   NewCompanyEventRepository(tx),
+		Outbox:          NewOutboxRepository(tx),
+		ProcessedEvents: NewProcessedEventRepository(tx),
+		Webhooks:        NewWebhookRepository(tx),
+	}
+}
+
+// transactionKey is the context key of the transaction a context runs in
+type transactionKey struct{}
+
+// TransactionManager runs units of work spanning several repositories in one
+// transaction. Units of work started within another run in a savepoint of the
+// enclosing transaction, and top-level transactions failing to serialize with
+// a concurrent one are run again.
+type TransactionManager struct {
+	database *Database
+	// MaxAttempts bounds the runs of a transaction failing to serialize
+	MaxAttempts int
+	// RetryBackoff is the delay before running a transaction again, doubled
+	// for every further attempt
+	RetryBackoff time.Duration
+}
+
+// NewTransactionManager creates a transaction manager on the given database
+func NewTransactionManager(database *Database) *TransactionManager {
+	return &TransactionManager{
+		database:     database,
+		MaxAttempts:  3,
+		RetryBackoff: 20 * time.Millisecond,
+	}
+}
+
+// Do calls fn with the repositories of a transaction, committed if fn returns
+// nil and rolled back otherwise. The context passed to fn carries the
+// transaction: Do called with it runs in a savepoint, so a failing inner unit
+// of work is rolled back alone and the enclosing one decides whether to go on.
+//
+// A top-level transaction failing with ErrSerialization is run again up to
+// MaxAttempts times, so fn must not have effects outside the transaction.
+func (m *TransactionManager) Do(ctx context.Context, fn func(ctx context.Context, repos *Repositories) error) error {
+	tx, nested := ctx.Value(transactionKey{}).(*Database)
+	if !nested && m.database.inTransaction() {
+		tx, nested = m.database, true
+	}
+	if nested {
+		// gorm runs a transaction begun within another in a savepoint
+		return tx.WithTransaction(ctx, func(savepoint *Database) error {
+			return fn(context.WithValue(ctx, transactionKey{}, savepoint), newRepositories(savepoint))
+		})
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := m.database.WithTransaction(ctx, func(tx *Database) error {
+			return fn(context.WithValue(ctx, transactionKey{}, tx), newRepositories(tx))
+		})
+		if !errors.Is(err, ErrSerialization) || attempt >= m.MaxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(utils.Backoff(m.RetryBackoff, 0, attempt-1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
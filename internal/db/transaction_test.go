@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/pkg/models"
+)
+
+func TestTransactionManager(t *testing.T) {
+	ctx := context.Background()
+	migrator, database := newTestMigrator(t, memoryDatabase())
+	_, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	transactions := NewTransactionManager(database)
+	transactions.RetryBackoff = 0
+	failure := errors.New("failure")
+
+	newOrganization := func(name string) *models.Organization {
+		return &models.Organization{ID: uuid.New().String(), Name: name}
+	}
+	newUser := func(organizationID, name string) models.User {
+		return models.User{
+			ID:             uuid.New().String(),
+			OrganizationID: organizationID,
+			Name:           name,
+			Email:          name + "@example.com",
+			PasswordHash:   "hash",
+		}
+	}
+	exists := func(organization *models.Organization) bool {
+		_, err := NewOrganizationRepository(database).GetByID(ctx, organization.ID)
+		if errors.Is(err, ErrOrganizationNotFound) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+	userExists := func(user models.User) bool {
+		_, err := NewUserRepository(database).GetByEmail(ctx, user.Email)
+		if errors.Is(err, ErrUserNotFound) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+
+	t.Run("commits the writes of every repository", func(t *testing.T) {
+		organization := newOrganization("Commit")
+		user := newUser(organization.ID, "commit")
+		err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+			require.NoError(t, repos.Organizations.Create(ctx, organization))
+			return repos.Users.Create(ctx, user)
+		})
+		require.NoError(t, err)
+		assert.True(t, exists(organization))
+		assert.True(t, userExists(user))
+	})
+
+	t.Run("rolls back every write when the unit of work fails", func(t *testing.T) {
+		organization := newOrganization("Rollback")
+		user := newUser(organization.ID, "rollback")
+		err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+			require.NoError(t, repos.Organizations.Create(ctx, organization))
+			require.NoError(t, repos.Users.Create(ctx, user))
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+		assert.False(t, exists(organization))
+		assert.False(t, userExists(user))
+	})
+
+	t.Run("rolls back the unit of work when a unique index rejects a write", func(t *testing.T) {
+		created := newOrganization("Unique")
+		err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+			require.NoError(t, repos.Organizations.Create(ctx, created))
+			return repos.Users.Create(ctx, newUser(created.ID, "commit"))
+		})
+		assert.ErrorIs(t, err, ErrConflict)
+		assert.False(t, exists(created))
+	})
+
+	t.Run("rolls back a nested unit of work to its savepoint", func(t *testing.T) {
+		organization := newOrganization("Savepoint")
+		inner := newUser(organization.ID, "savepoint")
+		err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+			require.NoError(t, repos.Organizations.Create(ctx, organization))
+			err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+				require.NoError(t, repos.Users.Create(ctx, inner))
+				return failure
+			})
+			assert.ErrorIs(t, err, failure)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, exists(organization), "the enclosing transaction commits")
+		assert.False(t, userExists(inner), "the nested unit of work is rolled back")
+	})
+
+	t.Run("rolls back a committed nested unit of work with the enclosing one", func(t *testing.T) {
+		organization := newOrganization("Enclosing")
+		inner := newUser(organization.ID, "enclosing")
+		err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+			require.NoError(t, repos.Organizations.Create(ctx, organization))
+			require.NoError(t, transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+				return repos.Users.Create(ctx, inner)
+			}))
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+		assert.False(t, exists(organization))
+		assert.False(t, userExists(inner))
+	})
+
+	t.Run("runs a transaction failing to serialize again", func(t *testing.T) {
+		var attempts int
+		var created []*models.Organization
+		err := transactions.Do(ctx, func(ctx context.Context, repos *Repositories) error {
+			attempts++
+			organization := newOrganization(fmt.Sprintf("Retry %d", attempts))
+			created = append(created, organization)
+			require.NoError(t, repos.Organizations.Create(ctx, organization))
+			if attempts == 1 {
+				return fmt.Errorf("%w: could not serialize access", ErrSerialization)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.False(t, exists(created[0]), "the failed attempt is rolled back")
+		assert.True(t, exists(created[1]))
+	})
+
+	t.Run("gives up after MaxAttempts", func(t *testing.T) {
+		var attempts int
+		err := transactions.Do(ctx, func(context.Context, *Repositories) error {
+			attempts++
+			return ErrSerialization
+		})
+		assert.ErrorIs(t, err, ErrSerialization)
+		assert.Equal(t, transactions.MaxAttempts, attempts)
+	})
+
+	t.Run("does not retry other failures or nested units of work", func(t *testing.T) {
+		var attempts int
+		err := transactions.Do(ctx, func(context.Context, *Repositories) error {
+			attempts++
+			return failure
+		})
+		assert.ErrorIs(t, err, failure)
+		assert.Equal(t, 1, attempts)
+
+		attempts = 0
+		err = transactions.Do(ctx, func(ctx context.Context, _ *Repositories) error {
+			return transactions.Do(ctx, func(context.Context, *Repositories) error {
+				attempts++
+				return ErrSerialization
+			})
+		})
+		assert.ErrorIs(t, err, ErrSerialization)
+		assert.Equal(t, transactions.MaxAttempts, attempts, "only the enclosing transaction runs again")
+	})
+
+	t.Run("nests within a transaction it was created on", func(t *testing.T) {
+		organization := newOrganization("Bound")
+		err := database.WithTransaction(ctx, func(tx *Database) error {
+			require.NoError(t, NewOrganizationRepository(tx).Create(ctx, organization))
+			err := NewTransactionManager(tx).Do(ctx, func(context.Context, *Repositories) error {
+				return ErrSerialization
+			})
+			assert.ErrorIs(t, err, ErrSerialization)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.True(t, exists(organization))
+	})
+}
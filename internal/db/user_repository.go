@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -10,6 +11,24 @@ import (
 	"xm-exercise/pkg/models"
 )
 
+var (
+	// ErrUserNotFound is returned when no user has the ID or email
+	ErrUserNotFound = newError(ErrNotFound, "user not found")
+	// ErrEmailRegistered is returned when another user has the email
+	ErrEmailRegistered = newError(ErrConflict, "email already registered")
+	// ErrUserNameTaken is returned when another user has the name
+	ErrUserNameTaken = newError(ErrConflict, "name already taken")
+	// ErrUserExists is returned when a user with the ID already exists
+	ErrUserExists = newError(ErrConflict, "user already exists")
+)
+
+// UserRepositoryInterface defines the interface for user database operations
+type UserRepositoryInterface interface {
+	Create(ctx context.Context, user models.User) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+}
+
 // UserRepository handles database operations for users
 type UserRepository struct {
 	db *Database
@@ -20,19 +39,33 @@ func NewUserRepository(db *Database) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// Create inserts a new user into the database
-func (r *UserRepository) Create(user models.User) error {
-	result := r.db.Create(&user)
-	return result.Error
+// Create inserts a new user into the database. An email or name already taken
+// fails with ErrEmailRegistered or ErrUserNameTaken.
+func (r *UserRepository) Create(ctx context.Context, user models.User) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	result := query.Create(&user)
+	var violation *UniqueViolationError
+	switch {
+	case !errors.As(result.Error, &violation):
+		return result.Error
+	case violation.On("idx_users_email", "email"):
+		return fmt.Errorf("%w: %w", ErrEmailRegistered, result.Error)
+	case violation.On("idx_users_name", "name"):
+		return fmt.Errorf("%w: %w", ErrUserNameTaken, result.Error)
+	}
+	return fmt.Errorf("%w: %w", ErrUserExists, result.Error)
 }
 
 // GetByID retrieves a user by ID
-func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
-	result := r.db.First(&user, "id = ?", id)
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	result := query.First(&user, "id = ?", id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, result.Error
 	}
@@ -40,24 +73,16 @@ func (r *UserRepository) GetByID(id uuid.UUID) (*models.User, error) {
 }
 
 // GetByEmail retrieves a user by username
-func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	result := r.db.First(&user, "email = ?", email)
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	result := query.First(&user, "email = ?", email)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("get user by email: %w", result.Error)
 	}
 	return &user, nil
 }
-
-// ExistsByEmail checks if a user with the given email exists
-func (r *UserRepository) ExistsByEmail(email string) (bool, error) {
-	var count int64
-	err := r.db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
-	if err != nil {
-		return false, err
-	}
-	return count > 0, nil
-}
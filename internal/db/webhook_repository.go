@@ -0,0 +1,345 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"xm-exercise/pkg/models"
+)
+
+var (
+	// ErrWebhookNotFound is returned when no subscription of the organization has the ID
+	ErrWebhookNotFound = newError(ErrNotFound, "webhook subscription not found")
+	// ErrDeliveryNotFound is returned when no delivery of the subscription has the ID
+	ErrDeliveryNotFound = newError(ErrNotFound, "webhook delivery not found")
+)
+
+// WebhookRepository handles database operations for webhook subscriptions and deliveries
+type WebhookRepository struct {
+	db *Database
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *Database) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+// CreateSubscription inserts a new subscription
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Create(subscription).Error
+}
+
+// GetSubscription retrieves a subscription of the organization by its ID
+func (r *WebhookRepository) GetSubscription(
+	ctx context.Context,
+	organizationID, id string,
+) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := query.Where("organization_id = ?", organizationID).First(&subscription, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// ListSubscriptions returns the subscriptions of the organization, oldest first
+func (r *WebhookRepository) ListSubscriptions(
+	ctx context.Context,
+	organizationID string,
+) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := query.Where("organization_id = ?", organizationID).Order("created_at").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// SubscriptionsVersion returns a summary of the subscriptions of the
+// organization that changes whenever one is added, changed or removed
+func (r *WebhookRepository) SubscriptionsVersion(ctx context.Context, organizationID string) (string, error) {
+	var version struct {
+		Count  int64
+		Latest sql.NullString
+	}
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := query.Model(&models.WebhookSubscription{}).
+		Select("COUNT(*) AS count, MAX(updated_at) AS latest").
+		Where("organization_id = ?", organizationID).
+		Scan(&version).Error
+	return fmt.Sprintf("%d/%s", version.Count, version.Latest.String), err
+}
+
+// EnabledSubscriptions returns the enabled subscriptions of the organization
+func (r *WebhookRepository) EnabledSubscriptions(
+	ctx context.Context,
+	organizationID string,
+) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	err := query.Where("organization_id = ? AND enabled = ?", organizationID, true).Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// SubscriptionsByID returns the subscriptions with the given IDs, keyed by ID
+func (r *WebhookRepository) SubscriptionsByID(
+	ctx context.Context,
+	ids []string,
+) (map[string]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	if err := query.Where("id IN ?", ids).Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.WebhookSubscription, len(subscriptions))
+	for _, subscription := range subscriptions {
+		byID[subscription.ID] = subscription
+	}
+	return byID, nil
+}
+
+// UpdateSubscription saves every field of the subscription
+func (r *WebhookRepository) UpdateSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Save(subscription).Error
+}
+
+// DeleteSubscription removes a subscription of the organization and its deliveries
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, organizationID, id string) error {
+	return r.db.WithTransaction(ctx, func(tx *Database) error {
+		query, cancel := tx.query(ctx)
+		defer cancel()
+		result := query.Where("organization_id = ?", organizationID).Delete(&models.WebhookSubscription{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		return query.Where("subscription_id = ?", id).Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+// RecordSuccess resets the consecutive failures of a subscription
+func (r *WebhookRepository) RecordSuccess(ctx context.Context, id string) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.WebhookSubscription{}).
+		Where("id = ?", id).
+		Update("consecutive_failures", 0).Error
+}
+
+// RecordFailure counts a failed attempt against a subscription and disables
+// it once it reaches disableAfter consecutive failures. It reports whether
+// the subscription was disabled by this failure.
+func (r *WebhookRepository) RecordFailure(
+	ctx context.Context,
+	id string,
+	disableAfter int,
+	now time.Time,
+) (bool, error) {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	err := query.Model(&models.WebhookSubscription{}).
+		Where("id = ?", id).
+		Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error
+	if err != nil {
+		return false, err
+	}
+
+	result := query.Model(&models.WebhookSubscription{}).
+		Where("id = ? AND enabled = ? AND consecutive_failures >= ?", id, true, disableAfter).
+		Updates(map[string]interface{}{
+			"enabled":     false,
+			"disabled_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// AddDelivery inserts a new pending delivery
+func (r *WebhookRepository) AddDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Create(delivery).Error
+}
+
+// GetDelivery retrieves a delivery of the subscription by its ID
+func (r *WebhookRepository) GetDelivery(
+	ctx context.Context,
+	subscriptionID, id string,
+) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := query.Where("subscription_id = ?", subscriptionID).First(&delivery, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ListDeliveries returns up to limit deliveries of the subscription, newest first
+func (r *WebhookRepository) ListDeliveries(
+	ctx context.Context,
+	subscriptionID string,
+	limit int,
+) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := query.Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// DeliveriesVersion returns a summary of the deliveries of the subscription
+// that changes whenever one is added or attempted
+func (r *WebhookRepository) DeliveriesVersion(ctx context.Context, subscriptionID string) (string, error) {
+	var version struct {
+		Count     int64
+		Attempts  int64
+		Created   sql.NullString
+		Attempted sql.NullString
+	}
+	query, cancel := r.db.read(ctx)
+	defer cancel()
+	err := query.Model(&models.WebhookDelivery{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(attempts), 0) AS attempts, "+
+			"MAX(created_at) AS created, MAX(last_attempt_at) AS attempted").
+		Where("subscription_id = ?", subscriptionID).
+		Scan(&version).Error
+	return fmt.Sprintf("%d/%d/%s/%s",
+		version.Count, version.Attempts, version.Created.String, version.Attempted.String), err
+}
+
+// ClaimPendingDeliveries leases up to limit due pending deliveries of enabled
+// subscriptions until now+lease, oldest first, and commits before returning
+// them, so that no locks are held while they are sent. Leased deliveries are
+// not claimed again until the lease ends.
+func (r *WebhookRepository) ClaimPendingDeliveries(
+	ctx context.Context,
+	limit int,
+	now time.Time,
+	lease time.Duration,
+) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.db.WithTransaction(ctx, func(tx *Database) error {
+		session, cancel := tx.query(ctx)
+		defer cancel()
+		enabled := session.Model(&models.WebhookSubscription{}).Select("id").Where("enabled = ?", true)
+		query := session.
+			Where("status = ? AND next_attempt_at <= ? AND subscription_id IN (?)", models.DeliveryPending, now, enabled).
+			Where("(locked_until IS NULL OR locked_until <= ?)", now).
+			Order("created_at").
+			Limit(limit)
+		if tx.Dialector.Name() != "sqlite" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]string, 0, len(deliveries))
+		lockedUntil := now.Add(lease)
+		for i := range deliveries {
+			ids = append(ids, deliveries[i].ID)
+			deliveries[i].LockedUntil = &lockedUntil
+		}
+		return session.Model(&models.WebhookDelivery{}).
+			Where("id IN ?", ids).
+			Update("locked_until", lockedUntil).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ReleaseDeliveries ends the lease of deliveries that were claimed but not
+// attempted, so that they can be claimed again at once
+func (r *WebhookRepository) ReleaseDeliveries(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.WebhookDelivery{}).
+		Where("id IN ?", ids).
+		Update("locked_until", nil).Error
+}
+
+// MarkDelivered records a successful attempt and ends the delivery's lease
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, id string, statusCode int, now time.Time) error {
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"status":           models.DeliverySucceeded,
+			"attempts":         gorm.Expr("attempts + 1"),
+			"last_status_code": statusCode,
+			"last_error":       nil,
+			"last_attempt_at":  now,
+			"delivered_at":     now,
+			"locked_until":     nil,
+		}).Error
+}
+
+// MarkAttemptFailed records a failed attempt and ends the delivery's lease.
+// The delivery is retried at nextAttemptAt, or given up on when nextAttemptAt
+// is nil. statusCode is nil when no response was received.
+func (r *WebhookRepository) MarkAttemptFailed(
+	ctx context.Context,
+	id string,
+	statusCode *int,
+	deliveryErr error,
+	now time.Time,
+	nextAttemptAt *time.Time,
+) error {
+	lastError := deliveryErr.Error()
+	if len(lastError) > 1000 {
+		lastError = lastError[:1000]
+	}
+
+	updates := map[string]interface{}{
+		"attempts":         gorm.Expr("attempts + 1"),
+		"last_status_code": statusCode,
+		"last_error":       lastError,
+		"last_attempt_at":  now,
+		"locked_until":     nil,
+	}
+	if nextAttemptAt != nil {
+		updates["next_attempt_at"] = *nextAttemptAt
+	} else {
+		updates["status"] = models.DeliveryFailed
+	}
+
+	query, cancel := r.db.query(ctx)
+	defer cancel()
+	return query.Model(&models.WebhookDelivery{}).Where("id = ?", id).Updates(updates).Error
+}
@@ -23,6 +23,319 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/health": {
+            "get": {
+                "description": "Run the readiness checks and report each one's error and connection pool statistics",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get dependency health",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Admin API key",
+                        "name": "X-Admin-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Every check passed",
+                        "schema": {
+                            "$ref": "#/definitions/models.Readiness"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin API key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API is disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "A check failed",
+                        "schema": {
+                            "$ref": "#/definitions/models.Readiness"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/outbox": {
+            "get": {
+                "description": "Get the number of events waiting in the outbox and how far behind the relay is",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get outbox lag",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Admin API key",
+                        "name": "X-Admin-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Outbox lag",
+                        "schema": {
+                            "$ref": "#/definitions/models.OutboxStats"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin API key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API is disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/replay": {
+            "get": {
+                "description": "List the running and recent event replays, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "List event replays",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Admin API key",
+                        "name": "X-Admin-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Replays",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ReplayJob"
+                            }
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin API key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API is disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Publish company events again, either a company.created snapshot of the current\ncompanies or the events of the company event log, optionally filtered. The replay\nruns in the background at the given rate; its progress is read from the returned\njob. Replayed events carry a replay-id header. Only one replay publishes at a time.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Start an event replay",
+                "parameters": [
+                    {
+                        "description": "Replay mode and filters",
+                        "name": "replay",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.ReplayRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin API key",
+                        "name": "X-Admin-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Replay started",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReplayJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin API key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API is disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "A replay is already running",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/replay/{id}": {
+            "get": {
+                "description": "Get the status and progress of an event replay",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get an event replay",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replay ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin API key",
+                        "name": "X-Admin-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Replay",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReplayJob"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin API key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API is disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Replay not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stop a running event replay. The events published so far are not retracted.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Cancel an event replay",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Replay ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Admin API key",
+                        "name": "X-Admin-Key",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Cancellation requested",
+                        "schema": {
+                            "$ref": "#/definitions/models.ReplayJob"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin API key",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "403": {
+                        "description": "Admin API is disabled",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Replay not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/auth/login": {
             "post": {
                 "description": "Login with username and password and return a JWT token",
@@ -71,13 +384,19 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
         "/auth/register": {
             "post": {
-                "description": "Register a new user and return a JWT token",
+                "description": "Register a new user and return a JWT token. The user gets a new organization named by\norganization (defaults to the user's name).",
                 "consumes": [
                     "application/json"
                 ],
@@ -123,6 +442,12 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
@@ -193,43 +518,218 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         },
-        "/companies/{id}": {
+        "/companies/stream": {
             "get": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Get detailed information about a company by its ID",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Server-Sent Events feed of the organization's company changes. Every event has an\n` + "`" + `id` + "`" + `, its type as ` + "`" + `event` + "`" + ` and the change as JSON ` + "`" + `data` + "`" + `. Clients resume with the\nLast-Event-ID header or the last_event_id parameter; a ` + "`" + `stream.reset` + "`" + ` event means\nchanges were missed and the client should reload. EventSource clients may pass the\ntoken as access_token.",
                 "produces": [
-                    "application/json"
+                    "text/event-stream"
                 ],
                 "tags": [
                     "companies"
                 ],
-                "summary": "Get a company by ID",
+                "summary": "Stream company changes",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Bearer token",
-                        "name": "Authorization",
-                        "in": "header",
-                        "required": true
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Only changes of these companies",
+                        "name": "company_id",
+                        "in": "query"
                     },
                     {
-                        "type": "string",
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Only these event types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resume after this event",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resume after this event",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter or event ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Server shutting down",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/companies/stream/ws": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "WebSocket equivalent of /companies/stream. Every message is a JSON event with its\n` + "`" + `id` + "`" + ` and ` + "`" + `type` + "`" + `; the filters, resumption and access_token work the same way.",
+                "tags": [
+                    "companies"
+                ],
+                "summary": "Stream company changes over a WebSocket",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Only changes of these companies",
+                        "name": "company_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "string"
+                        },
+                        "collectionFormat": "multi",
+                        "description": "Only these event types",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resume after this event",
+                        "name": "last_event_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid filter, event ID or handshake",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Server shutting down",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/companies/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Get detailed information about a company by its ID. Responses carry a strong\nETag and a Last-Modified date, and conditional requests are answered with 304.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "companies"
+                ],
+                "summary": "Get a company by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
                         "format": "uuid",
                         "description": "Company ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity tag of the copy the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified date of the copy the client has",
+                        "name": "If-Modified-Since",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -239,17 +739,38 @@ const docTemplate = `{
                             "$ref": "#/definitions/models.CompanyResponse"
                         }
                     },
+                    "304": {
+                        "description": "Company not modified"
+                    },
                     "400": {
                         "description": "Invalid company ID",
                         "schema": {
                             "type": "string"
                         }
                     },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "404": {
                         "description": "Company not found",
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             },
@@ -259,36 +780,548 @@ const docTemplate = `{
                         "Bearer": []
                     }
                 ],
-                "description": "Delete a company by its ID",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Delete a company by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "companies"
+                ],
+                "summary": "Delete a company",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Company ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Company deleted successfully",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid company ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Company not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Update specific fields of a company",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "companies"
+                ],
+                "summary": "Update a company",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Company ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to update",
+                        "name": "company",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Company updated successfully",
+                        "schema": {
+                            "$ref": "#/definitions/models.CompanyUpdateRequest"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Company not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Company name already exists",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "List the webhook subscriptions of the organization. Responses carry an ETag,\nand requests with a matching If-None-Match are answered with 304.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook subscriptions",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity tag of the listing the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscriptions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookResponse"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Subscriptions not modified"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Subscribe an HTTP endpoint to company events. Requests are signed with the\nsubscription secret, which is generated when not given and only returned here.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create a webhook subscription",
+                "parameters": [
+                    {
+                        "description": "Subscription details",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookCreateRequest"
+                        }
+                    },
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Subscription created",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Get a webhook subscription by its ID. Responses carry a strong ETag and a\nLast-Modified date, and conditional requests are answered with 304.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get a webhook subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity tag of the copy the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last-Modified date of the copy the client has",
+                        "name": "If-Modified-Since",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription found",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookResponse"
+                        }
+                    },
+                    "304": {
+                        "description": "Subscription not modified"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook subscription not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Delete a webhook subscription and its delivery log",
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "Subscription deleted"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook subscription not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "Change the URL, event filter or secret of a subscription, or enable or disable\nit. Enabling a subscription resets its failure count.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Update a webhook subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to update",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookUpdateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription updated",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body or validation error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Webhook subscription not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "security": [
+                    {
+                        "Bearer": []
+                    }
+                ],
+                "description": "List the deliveries of a subscription with the outcome of their latest attempt,\nnewest first. Responses carry an ETag, and requests with a matching\nIf-None-Match are answered with 304.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "companies"
+                    "webhooks"
                 ],
-                "summary": "Delete a company",
+                "summary": "List webhook deliveries",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
                     {
                         "type": "string",
                         "format": "uuid",
-                        "description": "Company ID",
+                        "description": "Subscription ID",
                         "name": "id",
                         "in": "path",
                         "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of deliveries (default 50, at most 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Entity tag of the listing the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "Company deleted successfully",
+                    "200": {
+                        "description": "Deliveries",
                         "schema": {
-                            "type": "string"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookDeliveryResponse"
+                            }
                         }
                     },
+                    "304": {
+                        "description": "Deliveries not modified"
+                    },
                     "400": {
-                        "description": "Invalid company ID",
+                        "description": "Invalid limit",
                         "schema": {
                             "type": "string"
                         }
@@ -300,7 +1333,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Company not found",
+                        "description": "Webhook subscription not found",
                         "schema": {
                             "type": "string"
                         }
@@ -310,56 +1343,61 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
-            },
-            "patch": {
+            }
+        },
+        "/webhooks/{id}/deliveries/{deliveryID}/redeliver": {
+            "post": {
                 "security": [
                     {
                         "Bearer": []
                     }
                 ],
-                "description": "Update specific fields of a company",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Queue a new delivery of the same event to the subscription, whatever the\noutcome of the original one. The event ID is kept so receivers can deduplicate.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "companies"
+                    "webhooks"
                 ],
-                "summary": "Update a company",
+                "summary": "Redeliver a webhook",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Bearer token",
+                        "name": "Authorization",
+                        "in": "header",
+                        "required": true
+                    },
                     {
                         "type": "string",
                         "format": "uuid",
-                        "description": "Company ID",
+                        "description": "Subscription ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Fields to update",
-                        "name": "company",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "type": "object"
-                        }
+                        "type": "string",
+                        "format": "uuid",
+                        "description": "Delivery ID",
+                        "name": "deliveryID",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Company updated successfully",
-                        "schema": {
-                            "$ref": "#/definitions/models.CompanyUpdateRequest"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid request body or validation error",
+                    "202": {
+                        "description": "Delivery queued",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/models.WebhookDeliveryResponse"
                         }
                     },
                     "401": {
@@ -369,13 +1407,13 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Company not found",
+                        "description": "Webhook subscription or delivery not found",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "409": {
-                        "description": "Company name already exists",
+                        "description": "Webhook subscription is disabled",
                         "schema": {
                             "type": "string"
                         }
@@ -385,12 +1423,35 @@ const docTemplate = `{
                         "schema": {
                             "type": "string"
                         }
+                    },
+                    "503": {
+                        "description": "Database unavailable",
+                        "schema": {
+                            "type": "string"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
+        "models.CheckResult": {
+            "description": "Dependency check result",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "kafka brokers unreachable"
+                },
+                "pool": {
+                    "$ref": "#/definitions/models.PoolStats"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "up"
+                }
+            }
+        },
         "models.CompanyCreateRequest": {
             "description": "Contains details to successfully create a Company",
             "type": "object",
@@ -507,6 +1568,198 @@ const docTemplate = `{
                 }
             }
         },
+        "models.OutboxStats": {
+            "description": "Outbox relay lag",
+            "type": "object",
+            "properties": {
+                "dead_lettered": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "lag_seconds": {
+                    "type": "number",
+                    "example": 1.5
+                },
+                "last_sent_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "oldest_pending_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "pending": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "retrying": {
+                    "type": "integer",
+                    "example": 1
+                }
+            }
+        },
+        "models.PoolStats": {
+            "description": "Database connection pool statistics",
+            "type": "object",
+            "properties": {
+                "idle": {
+                    "type": "integer",
+                    "example": 8
+                },
+                "in_use": {
+                    "type": "integer",
+                    "example": 4
+                },
+                "max_idle_closed": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "max_idle_time_closed": {
+                    "type": "integer",
+                    "example": 5
+                },
+                "max_lifetime_closed": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "max_open": {
+                    "type": "integer",
+                    "example": 100
+                },
+                "open": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "wait_count": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "wait_duration_ms": {
+                    "type": "integer",
+                    "example": 42
+                }
+            }
+        },
+        "models.Readiness": {
+            "description": "Readiness of the service and its dependencies",
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/models.CheckResult"
+                    }
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ready"
+                }
+            }
+        },
+        "models.ReplayJob": {
+            "description": "Status and progress of an event replay",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string",
+                    "example": "kafka: broker not available"
+                },
+                "finished_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:12Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "8d4e-01fa2.....c-3b9d0"
+                },
+                "published": {
+                    "description": "Events published so far, or counted in a dry run",
+                    "type": "integer",
+                    "example": 300
+                },
+                "request": {
+                    "$ref": "#/definitions/models.ReplayRequest"
+                },
+                "started_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "status": {
+                    "type": "string",
+                    "enum": [
+                        "running",
+                        "completed",
+                        "failed",
+                        "cancelled"
+                    ],
+                    "example": "running"
+                },
+                "total": {
+                    "description": "Number of matching events when the replay started",
+                    "type": "integer",
+                    "example": 1200
+                }
+            }
+        },
+        "models.ReplayRequest": {
+            "description": "Mode, filters and pace of an event replay",
+            "type": "object",
+            "properties": {
+                "company_ids": {
+                    "description": "Only events of these companies",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "5b7e-12cd4.....a-77f01"
+                    ]
+                },
+                "dry_run": {
+                    "description": "Counts the matching events without publishing them",
+                    "type": "boolean",
+                    "example": false
+                },
+                "event_types": {
+                    "description": "Only these event types; history mode only",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "company.updated"
+                    ]
+                },
+                "mode": {
+                    "type": "string",
+                    "enum": [
+                        "snapshot",
+                        "history"
+                    ],
+                    "example": "snapshot"
+                },
+                "organization_id": {
+                    "description": "Only events of this organization; all organizations when empty",
+                    "type": "string",
+                    "example": "3f1c-55ab2.....b-90e1d"
+                },
+                "rate": {
+                    "description": "Events published per second; REPLAY_RATE when zero",
+                    "type": "integer",
+                    "example": 100
+                },
+                "since": {
+                    "description": "Only events that occurred at or after this time; history mode only",
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "until": {
+                    "description": "Only events that occurred before this time; history mode only",
+                    "type": "string",
+                    "example": "2024-02-01T00:00:00Z"
+                }
+            }
+        },
         "models.TokenResponse": {
             "type": "object",
             "properties": {
@@ -543,11 +1796,171 @@ const docTemplate = `{
                     "type": "string",
                     "example": "John Doe"
                 },
+                "organization": {
+                    "description": "Name of a new organization to create for the user. Defaults to the user's name.",
+                    "type": "string",
+                    "example": "Acme Holdings"
+                },
                 "password": {
                     "type": "string",
                     "example": "securepassword123"
                 }
             }
+        },
+        "models.WebhookCreateRequest": {
+            "description": "Endpoint, event filter and signing secret of a webhook subscription",
+            "type": "object",
+            "properties": {
+                "event_types": {
+                    "description": "Event types to send; all events when empty",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "company.created",
+                        "company.deleted"
+                    ]
+                },
+                "secret": {
+                    "description": "Secret signing the payloads; generated when empty",
+                    "type": "string",
+                    "example": "whsec_3f9a..."
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://partner.example.com/hooks/companies"
+                }
+            }
+        },
+        "models.WebhookDeliveryResponse": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "delivered_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "event_id": {
+                    "type": "string",
+                    "example": "9a1b-22cd3.....e-4f5a6"
+                },
+                "event_type": {
+                    "type": "string",
+                    "example": "company.created"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0c2f-88ab1.....d-1e2f3"
+                },
+                "last_attempt_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "unexpected status 503"
+                },
+                "last_status_code": {
+                    "type": "integer",
+                    "example": 200
+                },
+                "next_attempt_at": {
+                    "description": "Only set while the delivery is pending",
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "succeeded"
+                }
+            }
+        },
+        "models.WebhookResponse": {
+            "type": "object",
+            "properties": {
+                "consecutive_failures": {
+                    "type": "integer",
+                    "example": 0
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "disabled_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "enabled": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "company.created"
+                    ]
+                },
+                "id": {
+                    "type": "string",
+                    "example": "5b7e-12cd4.....a-77f01"
+                },
+                "secret": {
+                    "description": "Only returned when the secret is set or generated",
+                    "type": "string",
+                    "example": "whsec_3f9a..."
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2024-01-01T00:00:00Z"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://partner.example.com/hooks/companies"
+                }
+            }
+        },
+        "models.WebhookUpdateRequest": {
+            "description": "Fields of a webhook subscription to change",
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "description": "Re-enables a disabled subscription, or disables it",
+                    "type": "boolean",
+                    "example": true
+                },
+                "event_types": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "company.updated"
+                    ]
+                },
+                "secret": {
+                    "description": "New signing secret; returned in the response",
+                    "type": "string",
+                    "example": "whsec_3f9a..."
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://partner.example.com/hooks/companies"
+                }
+            }
         }
     },
     "securityDefinitions": {
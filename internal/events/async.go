@@ -0,0 +1,298 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/logger"
+)
+
+var (
+	publishQueueDepth     = expvar.NewInt("event_publish_queue_depth")
+	publishBatchesTotal   = expvar.NewInt("event_publish_batches_total")
+	publishPublishedTotal = expvar.NewInt("event_publish_published_total")
+	publishFailuresTotal  = expvar.NewInt("event_publish_failures_total")
+)
+
+// BatchPublisher is implemented by backends that deliver several messages in one call
+type BatchPublisher interface {
+	PublishBatch(ctx context.Context, messages []Message) error
+}
+
+// queuedMessage is a message waiting in the AsyncPublisher queue
+type queuedMessage struct {
+	message Message
+	result  chan error
+}
+
+// AsyncPublisher queues messages in a bounded in-memory queue and delivers
+// them in batches from a single worker, preserving their order. Failures are
+// not retried but reported to the callers, which own retrying, so a message
+// is never retried by two layers. Once a message fails, the later messages
+// with its key fail with ErrKeyBlocked without being sent until the queue has
+// drained, so no key is delivered out of order.
+type AsyncPublisher struct {
+	publisher Publisher
+	cfg       config.AsyncPublishConfig
+	// failedKeys holds the keys of the messages that failed since the queue
+	// last drained; only the worker uses it
+	failedKeys map[string]bool
+
+	queue   chan queuedMessage
+	closing chan struct{}
+	done    chan struct{}
+	// stop aborts deliveries when shutdown runs out of time
+	stop      context.Context
+	forceStop context.CancelFunc
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewAsyncPublisher starts a publisher delivering to publisher
+func NewAsyncPublisher(publisher Publisher, cfg config.AsyncPublishConfig) *AsyncPublisher {
+	stop, forceStop := context.WithCancel(context.Background())
+	p := &AsyncPublisher{
+		publisher:  publisher,
+		cfg:        cfg,
+		failedKeys: make(map[string]bool),
+		queue:      make(chan queuedMessage, cfg.QueueSize),
+		closing:    make(chan struct{}),
+		done:       make(chan struct{}),
+		stop:       stop,
+		forceStop:  forceStop,
+	}
+	go p.run()
+	return p
+}
+
+// PublishAsync queues message and returns a channel receiving the delivery
+// result. Queuing blocks while the queue is full, until ctx is done.
+func (p *AsyncPublisher) PublishAsync(ctx context.Context, message Message) <-chan error {
+	result := make(chan error, 1)
+
+	select {
+	case <-p.closing:
+		result <- ErrPublisherClosed
+		return result
+	default:
+	}
+
+	select {
+	case p.queue <- queuedMessage{message: message, result: result}:
+		publishQueueDepth.Add(1)
+	case <-ctx.Done():
+		result <- fmt.Errorf("event publish queue is full: %w", ctx.Err())
+	case <-p.closing:
+		result <- ErrPublisherClosed
+	}
+	return result
+}
+
+// Publish queues message and waits until it is delivered or ctx is done
+func (p *AsyncPublisher) Publish(ctx context.Context, message Message) error {
+	select {
+	case err := <-p.PublishAsync(ctx, message):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Ping checks the connection of the underlying publisher, when it supports it
+func (p *AsyncPublisher) Ping(ctx context.Context) error {
+	if checker, ok := p.publisher.(HealthChecker); ok {
+		return checker.Ping(ctx)
+	}
+	return nil
+}
+
+// Shutdown stops accepting messages and delivers the queued ones. When ctx is
+// done first, pending deliveries are aborted and their callers get an error.
+// The underlying publisher is closed afterwards.
+func (p *AsyncPublisher) Shutdown(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		close(p.closing)
+
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			p.forceStop()
+			<-p.done
+			p.closeErr = fmt.Errorf("event publish queue not flushed before the deadline: %w", ctx.Err())
+		}
+		p.forceStop()
+
+		p.closeErr = errors.Join(p.closeErr, p.publisher.Close())
+	})
+	return p.closeErr
+}
+
+// Close flushes the queue without a deadline and closes the underlying publisher
+func (p *AsyncPublisher) Close() error {
+	return p.Shutdown(context.Background())
+}
+
+// run delivers queued messages in batches until the publisher is shut down
+// and the queue is drained
+func (p *AsyncPublisher) run() {
+	defer close(p.done)
+
+	for {
+		var first queuedMessage
+		select {
+		case first = <-p.queue:
+		case <-p.closing:
+			// Nothing can be queued once closing is closed, so draining what
+			// is left empties the queue for good
+			for {
+				select {
+				case first = <-p.queue:
+					p.deliver(p.collect(first, false))
+				default:
+					return
+				}
+			}
+		}
+		p.deliver(p.collect(first, true))
+		if len(p.queue) == 0 {
+			clear(p.failedKeys)
+		}
+	}
+}
+
+// collect gathers up to BatchSize queued messages, waiting up to Linger for
+// more to arrive when linger is set
+func (p *AsyncPublisher) collect(first queuedMessage, linger bool) []queuedMessage {
+	batch := []queuedMessage{first}
+	publishQueueDepth.Add(-1)
+
+	var timeout <-chan time.Time
+	if linger && p.cfg.Linger > 0 {
+		timer := time.NewTimer(p.cfg.Linger)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for len(batch) < p.cfg.BatchSize {
+		select {
+		case item := <-p.queue:
+			batch = append(batch, item)
+			publishQueueDepth.Add(-1)
+			continue
+		default:
+		}
+		if timeout == nil {
+			break
+		}
+		select {
+		case item := <-p.queue:
+			batch = append(batch, item)
+			publishQueueDepth.Add(-1)
+		case <-timeout:
+			timeout = nil
+		case <-p.closing:
+			timeout = nil
+		}
+	}
+	return batch
+}
+
+// deliver publishes a batch. When the batch fails, each message gets an
+// attempt on its own, so that one bad message fails alone.
+func (p *AsyncPublisher) deliver(batch []queuedMessage) {
+	batch = p.skipFailedKeys(batch)
+	if len(batch) == 0 {
+		return
+	}
+
+	messages := make([]Message, len(batch))
+	for i, item := range batch {
+		messages[i] = item.message
+	}
+	publishBatchesTotal.Add(1)
+
+	err := p.publishBatch(messages)
+	if err == nil {
+		publishPublishedTotal.Add(int64(len(batch)))
+		for _, item := range batch {
+			item.result <- nil
+		}
+		return
+	}
+	publishFailuresTotal.Add(1)
+
+	for _, item := range batch {
+		if p.failedKeys[item.message.Key] {
+			item.result <- ErrKeyBlocked
+			continue
+		}
+		itemErr := err
+		if len(batch) > 1 && p.stop.Err() == nil {
+			if itemErr = p.publisher.Publish(p.stop, item.message); itemErr == nil {
+				publishPublishedTotal.Add(1)
+				item.result <- nil
+				continue
+			}
+		}
+		if item.message.Key != "" {
+			p.failedKeys[item.message.Key] = true
+		}
+		logger.Warn("Failed to publish event",
+			zap.Error(itemErr),
+			zap.String("topic", item.message.Topic),
+			zap.String("key", item.message.Key),
+		)
+		item.result <- fmt.Errorf("error publishing event: %w", itemErr)
+	}
+}
+
+// skipFailedKeys fails the messages of batch whose key failed before and
+// returns the others
+func (p *AsyncPublisher) skipFailedKeys(batch []queuedMessage) []queuedMessage {
+	sendable := make([]queuedMessage, 0, len(batch))
+	for _, item := range batch {
+		if p.failedKeys[item.message.Key] {
+			item.result <- ErrKeyBlocked
+			continue
+		}
+		sendable = append(sendable, item)
+	}
+	return sendable
+}
+
+// publishBatch delivers messages in one call when the backend supports it
+func (p *AsyncPublisher) publishBatch(messages []Message) error {
+	if batcher, ok := p.publisher.(BatchPublisher); ok {
+		return batcher.PublishBatch(p.stop, messages)
+	}
+	for _, message := range messages {
+		if err := p.publisher.Publish(p.stop, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topicDeadLetter publishes dead-lettered messages to a topic of the event bus
+type topicDeadLetter struct {
+	publisher Publisher
+	topic     string
+}
+
+// Publish sends message to the dead-letter topic
+func (d *topicDeadLetter) Publish(ctx context.Context, message Message) error {
+	message.Topic = d.topic
+	return d.publisher.Publish(ctx, message)
+}
+
+// Close does nothing: the event bus publisher is closed by its owner
+func (d *topicDeadLetter) Close() error {
+	return nil
+}
@@ -0,0 +1,233 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/logger"
+)
+
+// recordingPublisher records delivered batches, failing batches rejected by fail
+type recordingPublisher struct {
+	mu      sync.Mutex
+	batches [][]Message
+	calls   int
+	// fail decides whether a batch fails, given the number of calls so far
+	fail func(calls int, messages []Message) error
+	// block, when set, holds every delivery until it is closed
+	block chan struct{}
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, message Message) error {
+	return p.PublishBatch(ctx, []Message{message})
+}
+
+func (p *recordingPublisher) PublishBatch(ctx context.Context, messages []Message) error {
+	if p.block != nil {
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.fail != nil {
+		if err := p.fail(p.calls, messages); err != nil {
+			return err
+		}
+	}
+	p.batches = append(p.batches, messages)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+func (p *recordingPublisher) delivered() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var messages []Message
+	for _, batch := range p.batches {
+		messages = append(messages, batch...)
+	}
+	return messages
+}
+
+// orderedValues returns the message values in delivery order
+func orderedValues(messages []Message) []string {
+	values := make([]string, len(messages))
+	for i, message := range messages {
+		values[i] = string(message.Value)
+	}
+	return values
+}
+
+func testAsyncConfig() config.AsyncPublishConfig {
+	return config.AsyncPublishConfig{
+		QueueSize: 100,
+		BatchSize: 10,
+		Linger:    20 * time.Millisecond,
+	}
+}
+
+func TestAsyncPublisher(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	ctx := context.Background()
+
+	t.Run("delivers in order and in batches", func(t *testing.T) {
+		backend := &recordingPublisher{}
+		publisher := NewAsyncPublisher(backend, testAsyncConfig())
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		messages := conformanceMessages("company.created", "batched", 25)
+		results := make([]<-chan error, len(messages))
+		for i, message := range messages {
+			results[i] = publisher.PublishAsync(ctx, message)
+		}
+		for _, result := range results {
+			require.NoError(t, <-result)
+		}
+
+		assert.Equal(t, orderedValues(messages), orderedValues(backend.delivered()))
+		assert.Less(t, len(backend.batches), len(messages))
+		for _, batch := range backend.batches {
+			assert.LessOrEqual(t, len(batch), 10)
+		}
+	})
+
+	t.Run("reports failed batches without retrying them", func(t *testing.T) {
+		backend := &recordingPublisher{fail: func(int, []Message) error {
+			return errors.New("broker unavailable")
+		}}
+		publisher := NewAsyncPublisher(backend, testAsyncConfig())
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		err := publisher.Publish(ctx, Message{Topic: "company.created", Value: []byte("1")})
+		assert.ErrorContains(t, err, "broker unavailable")
+		assert.Equal(t, 1, backend.calls)
+	})
+
+	t.Run("fails only the messages failing on their own", func(t *testing.T) {
+		backend := &recordingPublisher{fail: func(_ int, messages []Message) error {
+			for _, message := range messages {
+				if string(message.Value) == "poison" {
+					return errors.New("message too large")
+				}
+			}
+			return nil
+		}}
+		cfg := testAsyncConfig()
+		cfg.Linger = time.Second
+		cfg.BatchSize = 3
+		publisher := NewAsyncPublisher(backend, cfg)
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		var results []<-chan error
+		for _, value := range []string{"first", "poison", "last"} {
+			results = append(results, publisher.PublishAsync(ctx, Message{Topic: "company.created", Value: []byte(value)}))
+		}
+		assert.NoError(t, <-results[0])
+		assert.ErrorContains(t, <-results[1], "message too large")
+		assert.NoError(t, <-results[2])
+
+		assert.Equal(t, []string{"first", "last"}, orderedValues(backend.delivered()))
+	})
+
+	t.Run("holds back the later messages of a failed key", func(t *testing.T) {
+		backend := &recordingPublisher{fail: func(_ int, messages []Message) error {
+			for _, message := range messages {
+				if string(message.Value) == "poison" {
+					return errors.New("message too large")
+				}
+			}
+			return nil
+		}}
+		cfg := testAsyncConfig()
+		cfg.Linger = time.Second
+		cfg.BatchSize = 3
+		publisher := NewAsyncPublisher(backend, cfg)
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		var results []<-chan error
+		for _, message := range []Message{
+			{Topic: "company.created", Key: "a", Value: []byte("poison")},
+			{Topic: "company.created", Key: "b", Value: []byte("other")},
+			{Topic: "company.updated", Key: "a", Value: []byte("later")},
+		} {
+			results = append(results, publisher.PublishAsync(ctx, message))
+		}
+		assert.ErrorContains(t, <-results[0], "message too large")
+		assert.NoError(t, <-results[1])
+		assert.ErrorIs(t, <-results[2], ErrKeyBlocked)
+		assert.Equal(t, []string{"other"}, orderedValues(backend.delivered()))
+
+		// The key is released once the queue has drained
+		require.NoError(t, publisher.Publish(ctx, Message{Topic: "company.updated", Key: "a", Value: []byte("retried")}))
+	})
+
+	t.Run("blocks while the queue is full", func(t *testing.T) {
+		backend := &recordingPublisher{block: make(chan struct{})}
+		cfg := testAsyncConfig()
+		cfg.QueueSize = 1
+		cfg.BatchSize = 1
+		publisher := NewAsyncPublisher(backend, cfg)
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		// The worker holds the first message, the queue the second
+		first := publisher.PublishAsync(ctx, Message{Topic: "company.created", Value: []byte("1")})
+		require.Eventually(t, func() bool { return len(publisher.queue) == 0 }, time.Second, time.Millisecond)
+		second := publisher.PublishAsync(ctx, Message{Topic: "company.created", Value: []byte("2")})
+
+		fullCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, <-publisher.PublishAsync(fullCtx, Message{Topic: "company.created"}), context.DeadlineExceeded)
+
+		close(backend.block)
+		assert.NoError(t, <-first)
+		assert.NoError(t, <-second)
+	})
+
+	t.Run("flushes the queue on shutdown", func(t *testing.T) {
+		backend := &recordingPublisher{}
+		cfg := testAsyncConfig()
+		cfg.Linger = time.Hour
+		publisher := NewAsyncPublisher(backend, cfg)
+
+		messages := conformanceMessages("company.created", "flushed", 5)
+		for _, message := range messages {
+			publisher.PublishAsync(ctx, message)
+		}
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		require.NoError(t, publisher.Shutdown(shutdownCtx))
+		assert.Equal(t, orderedValues(messages), orderedValues(backend.delivered()))
+
+		assert.ErrorIs(t, publisher.Publish(ctx, messages[0]), ErrPublisherClosed)
+	})
+
+	t.Run("gives up flushing at the shutdown deadline", func(t *testing.T) {
+		backend := &recordingPublisher{block: make(chan struct{})}
+		publisher := NewAsyncPublisher(backend, testAsyncConfig())
+
+		result := publisher.PublishAsync(ctx, Message{Topic: "company.created", Value: []byte("1")})
+
+		shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, publisher.Shutdown(shutdownCtx), context.DeadlineExceeded)
+		assert.Error(t, <-result)
+		assert.Empty(t, backend.delivered())
+	})
+}
@@ -0,0 +1,275 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/config"
+)
+
+// collectFunc returns the next n messages delivered by the backend under test,
+// or nil if the backend cannot be observed
+type collectFunc func(t *testing.T, n int) []Message
+
+// conformanceBackend opens a fresh publisher for the given topic
+type conformanceBackend struct {
+	name string
+	open func(t *testing.T, topic string) (Publisher, collectFunc)
+}
+
+// TestPublisherConformance runs the shared publisher contract against every
+// backend that can run locally. Kafka and NATS run only when KAFKA_TEST_BROKERS
+// or NATS_TEST_URL point at a broker.
+func TestPublisherConformance(t *testing.T) {
+	backends := []conformanceBackend{
+		{name: BackendMemory, open: openMemoryBackend},
+		{name: BackendFile, open: openFileBackend},
+		{name: BackendNoop, open: openNoopBackend},
+		{name: BackendKafka, open: openKafkaBackend},
+		{name: BackendNATS, open: openNATSBackend(false)},
+		{name: BackendNATS + "-jetstream", open: openNATSBackend(true)},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			runPublisherConformance(t, backend)
+		})
+	}
+}
+
+func runPublisherConformance(t *testing.T, backend conformanceBackend) {
+	t.Run("delivers messages in order", func(t *testing.T) {
+		topic := conformanceTopic()
+		publisher, collect := backend.open(t, topic)
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		sent := conformanceMessages(topic, "ordered", 20)
+		for _, message := range sent {
+			require.NoError(t, publisher.Publish(context.Background(), message))
+		}
+
+		if collect == nil {
+			return
+		}
+		assert.Equal(t, sent, collect(t, len(sent)))
+	})
+
+	t.Run("is safe for concurrent use", func(t *testing.T) {
+		topic := conformanceTopic()
+		publisher, collect := backend.open(t, topic)
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		var sent []Message
+		var wg sync.WaitGroup
+		errs := make(chan error, 80)
+		for worker := 0; worker < 8; worker++ {
+			messages := conformanceMessages(topic, fmt.Sprintf("worker-%d", worker), 10)
+			sent = append(sent, messages...)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, message := range messages {
+					errs <- publisher.Publish(context.Background(), message)
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		if collect == nil {
+			return
+		}
+		assert.ElementsMatch(t, messageValues(sent), messageValues(collect(t, len(sent))))
+	})
+
+	t.Run("fails on cancelled context", func(t *testing.T) {
+		topic := conformanceTopic()
+		publisher, _ := backend.open(t, topic)
+		defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Error(t, publisher.Publish(ctx, conformanceMessages(topic, "cancelled", 1)[0]))
+	})
+
+	t.Run("fails after close", func(t *testing.T) {
+		topic := conformanceTopic()
+		publisher, _ := backend.open(t, topic)
+
+		require.NoError(t, publisher.Close())
+		err := publisher.Publish(context.Background(), conformanceMessages(topic, "closed", 1)[0])
+		assert.True(t, errors.Is(err, ErrPublisherClosed), "expected ErrPublisherClosed, got %v", err)
+		assert.NoError(t, publisher.Close())
+	})
+}
+
+func conformanceTopic() string {
+	return "conformance." + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+func conformanceMessages(topic, prefix string, n int) []Message {
+	messages := make([]Message, n)
+	for i := range messages {
+		messages[i] = Message{
+			Topic:   topic,
+			Type:    "conformance.test",
+			Headers: map[string]string{ContentTypeHeader: "application/json", "ce_id": fmt.Sprintf("%s-%d", prefix, i)},
+			Value:   []byte(fmt.Sprintf(`{"id":"%s-%d"}`, prefix, i)),
+		}
+	}
+	return messages
+}
+
+func messageValues(messages []Message) []string {
+	values := make([]string, len(messages))
+	for i, message := range messages {
+		values[i] = string(message.Value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func openMemoryBackend(t *testing.T, _ string) (Publisher, collectFunc) {
+	bus := NewMemoryBus(128)
+	sub := bus.Subscribe()
+	return bus, func(t *testing.T, n int) []Message {
+		var received []Message
+		timeout := time.After(5 * time.Second)
+		for len(received) < n {
+			select {
+			case message := <-sub.C:
+				received = append(received, message)
+			case <-timeout:
+				t.Fatalf("received %d of %d messages", len(received), n)
+			}
+		}
+		return received
+	}
+}
+
+func openFileBackend(t *testing.T, _ string) (Publisher, collectFunc) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	sink, err := NewFileSink(path)
+	require.NoError(t, err)
+	return sink, func(t *testing.T, n int) []Message {
+		require.NoError(t, sink.Close())
+		messages, err := ReadFileSink(path)
+		require.NoError(t, err)
+		require.Len(t, messages, n)
+		return messages
+	}
+}
+
+func openNoopBackend(_ *testing.T, _ string) (Publisher, collectFunc) {
+	return NewNoopPublisher(), nil
+}
+
+func openKafkaBackend(t *testing.T, topic string) (Publisher, collectFunc) {
+	brokers := os.Getenv("KAFKA_TEST_BROKERS")
+	if brokers == "" {
+		t.Skip("KAFKA_TEST_BROKERS not set")
+	}
+
+	conn, err := kafka.Dial("tcp", strings.Split(brokers, ",")[0])
+	require.NoError(t, err)
+	defer conn.Close() //nolint:errcheck // Test cleanup.
+	require.NoError(t, conn.CreateTopics(kafka.TopicConfig{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}))
+
+	producer, err := NewKafkaProducer(config.KafkaConfig{
+		Brokers:      strings.Split(brokers, ","),
+		RequiredAcks: "all",
+		BatchTimeout: time.Millisecond,
+	})
+	require.NoError(t, err)
+	return producer, func(t *testing.T, n int) []Message {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: strings.Split(brokers, ","),
+			Topic:   topic,
+		})
+		defer reader.Close() //nolint:errcheck // Test cleanup.
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		received := make([]Message, 0, n)
+		for len(received) < n {
+			kafkaMessage, err := reader.ReadMessage(ctx)
+			require.NoError(t, err)
+			headers := make(map[string]string, len(kafkaMessage.Headers))
+			for _, header := range kafkaMessage.Headers {
+				headers[header.Key] = string(header.Value)
+			}
+			received = append(received, Message{
+				Topic:   kafkaMessage.Topic,
+				Type:    "conformance.test",
+				Headers: headers,
+				Value:   kafkaMessage.Value,
+			})
+		}
+		return received
+	}
+}
+
+func openNATSBackend(jetStream bool) func(t *testing.T, topic string) (Publisher, collectFunc) {
+	return func(t *testing.T, topic string) (Publisher, collectFunc) {
+		return openNATS(t, topic, jetStream)
+	}
+}
+
+func openNATS(t *testing.T, topic string, jetStream bool) (Publisher, collectFunc) {
+	url := os.Getenv("NATS_TEST_URL")
+	if url == "" {
+		t.Skip("NATS_TEST_URL not set")
+	}
+
+	conn, err := nats.Connect(url)
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+	sub, err := conn.SubscribeSync(topic)
+	require.NoError(t, err)
+
+	publisher, err := NewNATSPublisher(config.NATSConfig{
+		URL:            url,
+		ConnectTimeout: 5 * time.Second,
+		JetStream:      jetStream,
+		Stream:         "CONFORMANCE",
+		StreamSubjects: []string{"conformance.>"},
+	})
+	require.NoError(t, err)
+	return publisher, func(t *testing.T, n int) []Message {
+		received := make([]Message, 0, n)
+		for len(received) < n {
+			msg, err := sub.NextMsg(5 * time.Second)
+			require.NoError(t, err)
+			headers := make(map[string]string, len(msg.Header))
+			for key := range msg.Header {
+				if key != EventTypeHeader {
+					headers[key] = msg.Header.Get(key)
+				}
+			}
+			received = append(received, Message{
+				Topic:   msg.Subject,
+				Type:    msg.Header.Get(EventTypeHeader),
+				Headers: headers,
+				Value:   msg.Data,
+			})
+		}
+		return received
+	}
+}
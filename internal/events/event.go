@@ -0,0 +1,369 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events/schema"
+	"xm-exercise/internal/events/schemaregistry"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+// Event types. Each is published to a topic of its own, named after the
+// event type unless configured otherwise.
+const (
+	EventCompanyCreated = "company.created"
+	EventCompanyUpdated = "company.updated"
+	EventCompanyDeleted = "company.deleted"
+)
+
+// Event formats selectable through EVENT_FORMAT
+const (
+	FormatCloudEvents = "cloudevents"
+	FormatLegacy      = "legacy"
+)
+
+// CloudEvents content modes selectable through EVENT_CONTENT_MODE
+const (
+	ContentModeStructured = "structured"
+	ContentModeBinary     = "binary"
+)
+
+// Headers set on every message, whatever the event format
+const (
+	EventTypeHeader     = "event-type"
+	SchemaVersionHeader = "schema-version"
+	RequestIDHeader     = "request-id"
+	UserIDHeader        = "user-id"
+	TraceParentHeader   = "traceparent"
+	TraceStateHeader    = "tracestate"
+	// ReplayIDHeader marks events published again by a replay, naming the replay
+	ReplayIDHeader = "replay-id"
+)
+
+// replayIDKey is the context key for the ID of the replay publishing events
+type replayIDKey struct{}
+
+// WithReplay returns a copy of ctx marking the events encoded with it as
+// published again by the replay with the given ID
+func WithReplay(ctx context.Context, replayID string) context.Context {
+	return context.WithValue(ctx, replayIDKey{}, replayID)
+}
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	// ContentTypeHeader is the message header carrying the payload content type
+	ContentTypeHeader = "content-type"
+	// cloudEventsHeaderPrefix prefixes CloudEvents attributes in binary content mode
+	cloudEventsHeaderPrefix = "ce_"
+)
+
+// Event represents a legacy, pre-CloudEvents event envelope
+type Event struct {
+	Type      string      `json:"type"`
+	TenantID  string      `json:"tenant_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// CloudEvent is a CloudEvents 1.0 envelope in structured content mode. JSON
+// data is embedded as is, other data is carried base64 encoded.
+type CloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	DataSchema      string          `json:"dataschema,omitempty"`
+	TenantID        string          `json:"tenantid,omitempty"`
+	CorrelationID   string          `json:"correlationid,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// Message is an encoded event ready to be written to a topic
+type Message struct {
+	Topic string
+	// Key is the ID of the company the event is about. Backends that partition
+	// topics use it to keep each company's events in order.
+	Key     string
+	Type    string
+	Headers map[string]string
+	Value   []byte
+}
+
+// KafkaProducerInterface defines the interface for Kafka producer operations
+type KafkaProducerInterface interface {
+	PublishCompanyCreated(ctx context.Context, company models.Company) error
+	PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error
+	PublishCompanyDeleted(ctx context.Context, company *models.Company) error
+}
+
+// SchemaRegistry registers payload schemas and locates them by ID
+type SchemaRegistry interface {
+	Register(ctx context.Context, subject, schemaType, document string) (int, error)
+	SchemaURL(id int) string
+}
+
+// eventPayloads is the payload schema of each event type
+var eventPayloads = map[string]schema.Descriptor{
+	EventCompanyCreated: schema.CompanyV1,
+	EventCompanyUpdated: schema.CompanyUpdatedV1,
+	EventCompanyDeleted: schema.CompanyDeletedV2,
+}
+
+// Encoder turns domain changes into encoded messages in the configured event format
+type Encoder struct {
+	cfg   config.EventEncodingConfig
+	codec schema.Codec
+	// topics is the topic of each event type
+	topics map[string]string
+
+	registry   SchemaRegistry
+	schemaType string
+	schemaIDs  map[string]int
+}
+
+// NewEncoder creates a new encoder. Payloads are encoded as JSON unless
+// cfg selects another data encoding.
+func NewEncoder(cfg config.EventEncodingConfig) (*Encoder, error) {
+	encoding := cfg.DataEncoding
+	if encoding == "" {
+		encoding = schema.EncodingJSON
+	}
+
+	codec, err := schema.NewCodec(encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := map[string]string{
+		EventCompanyCreated: cfg.Topics.CompanyCreated,
+		EventCompanyUpdated: cfg.Topics.CompanyUpdated,
+		EventCompanyDeleted: cfg.Topics.CompanyDeleted,
+	}
+	for eventType, topic := range topics {
+		if topic == "" {
+			topics[eventType] = eventType
+		}
+	}
+
+	return &Encoder{cfg: cfg, codec: codec, topics: topics}, nil
+}
+
+// Topic returns the topic events of eventType are published to
+func (e *Encoder) Topic(eventType string) string {
+	return e.topics[eventType]
+}
+
+// Topics returns the topics of all event types, sorted
+func (e *Encoder) Topics() []string {
+	topics := make([]string, 0, len(e.topics))
+	for _, topic := range e.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// RegisterSchemas registers the payload schema of every topic with registry
+// under the "<topic>-<record name>" subject, so a new major payload version
+// gets a subject of its own. Payloads encoded afterwards are framed
+// with their schema ID in the registry wire format, and the dataschema
+// attribute points at the registered schema. It must be called before the
+// encoder is used.
+func (e *Encoder) RegisterSchemas(ctx context.Context, registry SchemaRegistry) error {
+	schemaIDs := make(map[string]int, len(eventPayloads))
+	var schemaType string
+	for eventType, descriptor := range eventPayloads {
+		definition, err := schema.Lookup(descriptor, e.codec.Encoding())
+		if err != nil {
+			return err
+		}
+
+		id, err := registry.Register(ctx, e.topics[eventType]+"-"+descriptor.Record, definition.Type, definition.Schema)
+		if err != nil {
+			return err
+		}
+		schemaIDs[eventType] = id
+		schemaType = definition.Type
+	}
+
+	e.registry = registry
+	e.schemaType = schemaType
+	e.schemaIDs = schemaIDs
+	return nil
+}
+
+// CompanyCreated encodes a company created event
+func (e *Encoder) CompanyCreated(ctx context.Context, company models.Company) (Message, error) {
+	return e.encode(ctx, EventCompanyCreated, company.OrganizationID, company.ID,
+		company, schema.NewCompany(&company))
+}
+
+// CompanyUpdated encodes a company updated event carrying the company's
+// state before and after the change and the fields that changed
+func (e *Encoder) CompanyUpdated(ctx context.Context, before, after *models.Company) (Message, error) {
+	return e.encode(ctx, EventCompanyUpdated, after.OrganizationID, after.ID,
+		after, schema.CompanyUpdated{
+			Before:        schema.NewCompany(before),
+			After:         schema.NewCompany(after),
+			ChangedFields: after.ChangedFields(before),
+		})
+}
+
+// CompanyDeleted encodes a company deleted event carrying the company's last known state
+func (e *Encoder) CompanyDeleted(ctx context.Context, company *models.Company) (Message, error) {
+	return e.encode(ctx, EventCompanyDeleted, company.OrganizationID, company.ID,
+		map[string]string{"id": company.ID}, schema.CompanyDeleted{Company: schema.NewCompany(company)})
+}
+
+// encode wraps the payload in the configured envelope. The legacy format
+// carries legacyData unchanged, as its consumers predate the payload schemas.
+func (e *Encoder) encode(
+	ctx context.Context,
+	eventType, tenantID, subject string,
+	legacyData interface{},
+	payload schema.Payload,
+) (Message, error) {
+	topic := e.topics[eventType]
+	headers := contextHeaders(ctx)
+	headers[EventTypeHeader] = eventType
+
+	if e.cfg.Format == FormatLegacy {
+		return encodeLegacy(topic, subject, eventType, tenantID, legacyData, headers)
+	}
+	headers[SchemaVersionHeader] = strconv.Itoa(payload.Schema().Version)
+
+	data, err := e.codec.Marshal(payload)
+	if err != nil {
+		return Message{}, fmt.Errorf("error encoding event data: %w", err)
+	}
+
+	dataSchema := e.dataSchema(eventType)
+	schemaID, registered := e.schemaIDs[eventType]
+	if registered {
+		data = schemaregistry.Frame(e.schemaType, schemaID, data)
+		dataSchema = e.registry.SchemaURL(schemaID)
+	}
+
+	event := CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              uuid.New().String(),
+		Source:          e.cfg.Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: e.codec.ContentType(),
+		DataSchema:      dataSchema,
+		TenantID:        tenantID,
+		CorrelationID:   requestID(ctx),
+	}
+
+	if e.cfg.ContentMode == ContentModeBinary {
+		return encodeBinary(topic, subject, event, data, headers), nil
+	}
+
+	if e.codec.Encoding() == schema.EncodingJSON && !registered {
+		event.Data = data
+	} else {
+		event.DataBase64 = data
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		return Message{}, fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	headers[ContentTypeHeader] = cloudEventsContentType
+	return Message{Topic: topic, Key: subject, Type: eventType, Headers: headers, Value: value}, nil
+}
+
+// dataSchema returns the URI of the schema describing the data of eventType
+func (e *Encoder) dataSchema(eventType string) string {
+	if e.cfg.DataSchemaBaseURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/v%d", e.cfg.DataSchemaBaseURL, eventType, eventPayloads[eventType].Version)
+}
+
+// encodeBinary puts the CloudEvents attributes in headers and only the data in the value
+func encodeBinary(topic, key string, event CloudEvent, data []byte, headers map[string]string) Message {
+	attributes := map[string]string{
+		ContentTypeHeader:                         event.DataContentType,
+		cloudEventsHeaderPrefix + "specversion":   event.SpecVersion,
+		cloudEventsHeaderPrefix + "id":            event.ID,
+		cloudEventsHeaderPrefix + "source":        event.Source,
+		cloudEventsHeaderPrefix + "type":          event.Type,
+		cloudEventsHeaderPrefix + "time":          event.Time.Format(time.RFC3339Nano),
+		cloudEventsHeaderPrefix + "subject":       event.Subject,
+		cloudEventsHeaderPrefix + "dataschema":    event.DataSchema,
+		cloudEventsHeaderPrefix + "tenantid":      event.TenantID,
+		cloudEventsHeaderPrefix + "correlationid": event.CorrelationID,
+	}
+	for name, value := range attributes {
+		if value != "" {
+			headers[name] = value
+		}
+	}
+
+	return Message{Topic: topic, Key: key, Type: event.Type, Headers: headers, Value: data}
+}
+
+// encodeLegacy wraps data in the legacy Event envelope
+func encodeLegacy(
+	topic, key, eventType, tenantID string,
+	data interface{},
+	headers map[string]string,
+) (Message, error) {
+	event := Event{
+		Type:      eventType,
+		TenantID:  tenantID,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	value, err := json.Marshal(event)
+	if err != nil {
+		return Message{}, fmt.Errorf("error marshaling event: %w", err)
+	}
+
+	return Message{Topic: topic, Key: key, Type: eventType, Headers: headers, Value: value}, nil
+}
+
+// contextHeaders returns the request ID, user ID, W3C trace context and replay
+// ID carried by ctx as message headers
+func contextHeaders(ctx context.Context) map[string]string {
+	headers := map[string]string{}
+	for header, key := range map[string]interface{}{
+		RequestIDHeader:   logger.RequestIDKey,
+		UserIDHeader:      logger.UserIDKey,
+		TraceParentHeader: logger.TraceParentKey,
+		TraceStateHeader:  logger.TraceStateKey,
+		ReplayIDHeader:    replayIDKey{},
+	} {
+		if value, ok := ctx.Value(key).(string); ok && value != "" {
+			headers[header] = value
+		}
+	}
+	return headers
+}
+
+// requestID returns the HTTP request ID carried by ctx, if any
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(logger.RequestIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
@@ -0,0 +1,245 @@
+package events
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events/schema"
+	"xm-exercise/internal/events/schemaregistry"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+func TestEncoder(t *testing.T) {
+	company := models.Company{ID: "company-1", OrganizationID: "org-1", Name: "Acme"}
+	ctx := context.WithValue(context.Background(), logger.RequestIDKey, "request-1")
+
+	t.Run("structured CloudEvents", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:            FormatCloudEvents,
+			ContentMode:       ContentModeStructured,
+			Source:            "/companies",
+			DataSchemaBaseURL: "https://schemas.example.com",
+		})
+
+		message, err := encoder.CompanyCreated(ctx, company)
+		require.NoError(t, err)
+		assert.Equal(t, EventCompanyCreated, message.Topic)
+		assert.Equal(t, cloudEventsContentType, message.Headers[ContentTypeHeader])
+
+		var event map[string]interface{}
+		require.NoError(t, json.Unmarshal(message.Value, &event))
+		assert.Equal(t, "1.0", event["specversion"])
+		assert.NotEmpty(t, event["id"])
+		assert.Equal(t, "/companies", event["source"])
+		assert.Equal(t, "company.created", event["type"])
+		assert.Equal(t, "company-1", event["subject"])
+		assert.Equal(t, "application/json", event["datacontenttype"])
+		assert.Equal(t, "https://schemas.example.com/company.created/v1", event["dataschema"])
+		assert.Equal(t, "org-1", event["tenantid"])
+		assert.Equal(t, "request-1", event["correlationid"])
+		data, ok := event["data"].(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "Acme", data["name"])
+		assert.Equal(t, "org-1", data["organization_id"])
+	})
+
+	t.Run("binary CloudEvents", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:      FormatCloudEvents,
+			ContentMode: ContentModeBinary,
+			Source:      "/companies",
+		})
+
+		message, err := encoder.CompanyDeleted(ctx, &company)
+		require.NoError(t, err)
+		assert.Equal(t, "application/json", message.Headers[ContentTypeHeader])
+		assert.Equal(t, "1.0", message.Headers["ce_specversion"])
+		assert.NotEmpty(t, message.Headers["ce_id"])
+		assert.Equal(t, "company.deleted", message.Headers["ce_type"])
+		assert.Equal(t, "company-1", message.Headers["ce_subject"])
+		assert.Equal(t, "request-1", message.Headers["ce_correlationid"])
+		assert.NotContains(t, message.Headers, "ce_dataschema")
+
+		var data schema.CompanyDeleted
+		require.NoError(t, json.Unmarshal(message.Value, &data))
+		assert.Equal(t, "company-1", data.Company.ID)
+		assert.Equal(t, "Acme", data.Company.Name)
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{Format: FormatLegacy})
+
+		message, err := encoder.CompanyUpdated(ctx, &company, &company)
+		require.NoError(t, err)
+		assert.NotContains(t, message.Headers, ContentTypeHeader)
+
+		var event Event
+		require.NoError(t, json.Unmarshal(message.Value, &event))
+		assert.Equal(t, "company.updated", event.Type)
+		assert.Equal(t, "org-1", event.TenantID)
+	})
+
+	t.Run("keys and context headers", func(t *testing.T) {
+		ctx := context.WithValue(ctx, logger.UserIDKey, "user-1")
+		ctx = context.WithValue(ctx, logger.TraceParentKey, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+		ctx = context.WithValue(ctx, logger.TraceStateKey, "vendor=value")
+		ctx = WithReplay(ctx, "replay-1")
+
+		for _, format := range []string{FormatCloudEvents, FormatLegacy} {
+			encoder := newTestEncoder(t, config.EventEncodingConfig{Format: format, ContentMode: ContentModeStructured})
+
+			message, err := encoder.CompanyUpdated(ctx, &company, &company)
+			require.NoError(t, err)
+			assert.Equal(t, "company-1", message.Key)
+			assert.Equal(t, "company.updated", message.Headers[EventTypeHeader])
+			assert.Equal(t, "request-1", message.Headers[RequestIDHeader])
+			assert.Equal(t, "user-1", message.Headers[UserIDHeader])
+			assert.Equal(t, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", message.Headers[TraceParentHeader])
+			assert.Equal(t, "vendor=value", message.Headers[TraceStateHeader])
+			assert.Equal(t, "replay-1", message.Headers[ReplayIDHeader])
+			if format == FormatLegacy {
+				assert.NotContains(t, message.Headers, SchemaVersionHeader)
+			} else {
+				assert.Equal(t, "1", message.Headers[SchemaVersionHeader])
+			}
+		}
+
+		message, err := newTestEncoder(t, config.EventEncodingConfig{Format: FormatCloudEvents}).
+			CompanyDeleted(ctx, &company)
+		require.NoError(t, err)
+		assert.Equal(t, "2", message.Headers[SchemaVersionHeader])
+	})
+
+	t.Run("unique IDs", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{Format: FormatCloudEvents, ContentMode: ContentModeBinary})
+
+		first, err := encoder.CompanyCreated(ctx, company)
+		require.NoError(t, err)
+		second, err := encoder.CompanyCreated(ctx, company)
+		require.NoError(t, err)
+		assert.NotEqual(t, first.Headers["ce_id"], second.Headers["ce_id"])
+	})
+}
+
+func TestEncoderDataEncodings(t *testing.T) {
+	company := models.Company{ID: "company-1", OrganizationID: "org-1", Name: "Acme"}
+	ctx := context.Background()
+
+	t.Run("Avro in structured mode is base64 encoded", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:       FormatCloudEvents,
+			ContentMode:  ContentModeStructured,
+			DataEncoding: schema.EncodingAvro,
+		})
+
+		message, err := encoder.CompanyCreated(ctx, company)
+		require.NoError(t, err)
+
+		var event CloudEvent
+		require.NoError(t, json.Unmarshal(message.Value, &event))
+		assert.Equal(t, "application/avro", event.DataContentType)
+		assert.Empty(t, event.Data)
+		assert.NotEmpty(t, event.DataBase64)
+	})
+
+	t.Run("Protobuf framed with registered schema IDs", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:       FormatCloudEvents,
+			ContentMode:  ContentModeBinary,
+			DataEncoding: schema.EncodingProtobuf,
+		})
+		registry := schemaregistry.NewClient(config.SchemaRegistryConfig{URL: schemaregistry.MemoryURL})
+		require.NoError(t, encoder.RegisterSchemas(ctx, registry))
+
+		message, err := encoder.CompanyDeleted(ctx, &company)
+		require.NoError(t, err)
+		assert.Equal(t, "application/x-protobuf", message.Headers[ContentTypeHeader])
+
+		require.Greater(t, len(message.Value), 6)
+		assert.Equal(t, byte(0), message.Value[0])
+		schemaID := int(binary.BigEndian.Uint32(message.Value[1:5]))
+		assert.Positive(t, schemaID)
+		assert.Equal(t, byte(0), message.Value[5])
+		assert.Equal(t, registry.SchemaURL(schemaID), message.Headers["ce_dataschema"])
+	})
+
+	t.Run("update carries both states and the changed fields", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:      FormatCloudEvents,
+			ContentMode: ContentModeBinary,
+		})
+		renamed := company
+		renamed.Name = "Acme Ltd"
+		renamed.EmployeeCount = 10
+
+		message, err := encoder.CompanyUpdated(ctx, &company, &renamed)
+		require.NoError(t, err)
+
+		var data schema.CompanyUpdated
+		require.NoError(t, json.Unmarshal(message.Value, &data))
+		assert.Equal(t, "Acme", data.Before.Name)
+		assert.Equal(t, "Acme Ltd", data.After.Name)
+		assert.Equal(t, []string{"name", "employee_count"}, data.ChangedFields)
+	})
+
+	t.Run("configured topics", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:      FormatCloudEvents,
+			ContentMode: ContentModeBinary,
+			Topics:      config.TopicsConfig{CompanyDeleted: "prod.companies.deleted"},
+		})
+		registry := &recordingRegistry{}
+		require.NoError(t, encoder.RegisterSchemas(ctx, registry))
+
+		message, err := encoder.CompanyDeleted(ctx, &company)
+		require.NoError(t, err)
+		assert.Equal(t, "prod.companies.deleted", message.Topic)
+		assert.Equal(t, "company.deleted", message.Headers[EventTypeHeader])
+		assert.Equal(t, EventCompanyCreated, encoder.Topic(EventCompanyCreated))
+		assert.Contains(t, registry.subjects, "prod.companies.deleted-"+schema.CompanyDeletedV2.Record)
+	})
+
+	t.Run("legacy ignores the data encoding", func(t *testing.T) {
+		encoder := newTestEncoder(t, config.EventEncodingConfig{
+			Format:       FormatLegacy,
+			DataEncoding: schema.EncodingAvro,
+		})
+
+		message, err := encoder.CompanyCreated(ctx, company)
+		require.NoError(t, err)
+
+		var event Event
+		require.NoError(t, json.Unmarshal(message.Value, &event))
+		assert.Equal(t, "company.created", event.Type)
+	})
+}
+
+// recordingRegistry is a SchemaRegistry recording the registered subjects
+type recordingRegistry struct {
+	subjects []string
+}
+
+func (r *recordingRegistry) Register(_ context.Context, subject, _, _ string) (int, error) {
+	r.subjects = append(r.subjects, subject)
+	return len(r.subjects), nil
+}
+
+func (r *recordingRegistry) SchemaURL(id int) string {
+	return fmt.Sprintf("memory://schemas/%d", id)
+}
+
+// newTestEncoder creates an encoder, failing the test on error
+func newTestEncoder(t *testing.T, cfg config.EventEncodingConfig) *Encoder {
+	t.Helper()
+	encoder, err := NewEncoder(cfg)
+	require.NoError(t, err)
+	return encoder
+}
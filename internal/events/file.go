@@ -0,0 +1,124 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileRecord is one line of the NDJSON file sink. JSON payloads are embedded
+// as-is; any other payload is stored base64 encoded.
+type fileRecord struct {
+	Topic       string            `json:"topic"`
+	Key         string            `json:"key,omitempty"`
+	Type        string            `json:"type"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	PublishedAt time.Time         `json:"published_at"`
+	Value       json.RawMessage   `json:"value,omitempty"`
+	ValueBase64 []byte            `json:"value_base64,omitempty"`
+}
+
+// FileSink appends every event as a line of JSON to a file
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileSink opens (or creates) the NDJSON file at path for appending
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open event file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+// Publish appends the message to the file
+func (s *FileSink) Publish(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record := fileRecord{
+		Topic:       message.Topic,
+		Key:         message.Key,
+		Type:        message.Type,
+		Headers:     message.Headers,
+		PublishedAt: time.Now().UTC(),
+	}
+	if json.Valid(message.Value) {
+		record.Value = message.Value
+	} else {
+		record.ValueBase64 = message.Value
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshaling event record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return ErrPublisherClosed
+	}
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("error writing event to file: %w", err)
+	}
+	return nil
+}
+
+// Close flushes and closes the file
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	file := s.file
+	s.file = nil
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadFileSink reads back every message written to the NDJSON file at path
+func ReadFileSink(path string) ([]Message, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open event file: %w", err)
+	}
+	defer file.Close() //nolint:errcheck // Read-only file.
+
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid event record: %w", err)
+		}
+
+		value := []byte(record.Value)
+		if record.ValueBase64 != nil {
+			value = record.ValueBase64
+		}
+		messages = append(messages, Message{
+			Topic:   record.Topic,
+			Key:     record.Key,
+			Type:    record.Type,
+			Headers: record.Headers,
+			Value:   value,
+		})
+	}
+	return messages, scanner.Err()
+}
@@ -2,92 +2,212 @@ package events
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"time"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
 
-	"xm-exercise/pkg/models"
+	"xm-exercise/internal/config"
 )
 
-const (
-	TopicCompanyCreated = "company.created"
-	TopicCompanyUpdated = "company.updated"
-	TopicCompanyDeleted = "company.deleted"
-)
-
-// Event represents a Kafka event
-type Event struct {
-	Type      string      `json:"type"`
-	Timestamp time.Time   `json:"timestamp"`
-	Data      interface{} `json:"data"`
+// KafkaProducer publishes events to Kafka
+type KafkaProducer struct {
+	writer *kafka.Writer
+	client *kafka.Client
 }
 
-// KafkaProducerInterface defines the interface for Kafka producer operations
-type KafkaProducerInterface interface {
-	PublishCompanyCreated(company models.Company) error
-	PublishCompanyUpdated(company *models.Company) error
-	PublishCompanyDeleted(companyID string) error
+// kafkaAcks maps KAFKA_REQUIRED_ACKS values to Kafka acknowledgement levels
+var kafkaAcks = map[string]kafka.RequiredAcks{
+	"none":   kafka.RequireNone,
+	"leader": kafka.RequireOne,
+	"all":    kafka.RequireAll,
 }
 
-// KafkaProducer handles publishing events to Kafka
-type KafkaProducer struct {
-	writer *kafka.Writer
+// kafkaCompression maps KAFKA_COMPRESSION values to Kafka compression codecs
+var kafkaCompression = map[string]compress.Compression{
+	"none":   0,
+	"gzip":   compress.Gzip,
+	"snappy": compress.Snappy,
+	"lz4":    compress.Lz4,
+	"zstd":   compress.Zstd,
 }
 
 // NewKafkaProducer creates a new Kafka producer
-func NewKafkaProducer(brokers []string) *KafkaProducer {
+func NewKafkaProducer(cfg config.KafkaConfig) (*KafkaProducer, error) {
+	transport, err := newKafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	writer := &kafka.Writer{
-		Addr:     kafka.TCP(brokers...),
-		Balancer: &kafka.LeastBytes{},
+		Addr:      kafka.TCP(cfg.Brokers...),
+		Transport: transport,
+		// Hashing the key keeps each company's events on one partition, in
+		// order, and matches the partitioning of the Java client
+		Balancer:     kafka.Murmur2Balancer{},
+		RequiredAcks: kafkaAcks[cfg.RequiredAcks],
+		Compression:  kafkaCompression[cfg.Compression],
+		BatchSize:    cfg.BatchSize,
+		// Messages arrive already batched by the AsyncPublisher, so the
+		// writer should not hold them back long waiting for more
+		BatchTimeout: cfg.BatchTimeout,
 	}
 
-	return &KafkaProducer{writer: writer}
+	client := &kafka.Client{Addr: writer.Addr, Transport: transport, Timeout: cfg.HealthTimeout}
+	return &KafkaProducer{writer: writer, client: client}, nil
 }
 
-// PublishCompanyCreated publishes a company created event
-func (p *KafkaProducer) PublishCompanyCreated(company models.Company) error {
-	return p.publishEvent(TopicCompanyCreated, "company.created", company)
+// Publish writes an encoded message to its Kafka topic
+func (p *KafkaProducer) Publish(ctx context.Context, message Message) error {
+	return p.PublishBatch(ctx, []Message{message})
 }
 
-// PublishCompanyUpdated publishes a company updated event
-func (p *KafkaProducer) PublishCompanyUpdated(company *models.Company) error {
-	return p.publishEvent(TopicCompanyUpdated, "company.updated", company)
+// PublishBatch writes encoded messages to their Kafka topics in one call
+func (p *KafkaProducer) PublishBatch(ctx context.Context, messages []Message) error {
+	records := make([]kafka.Message, len(messages))
+	for i, message := range messages {
+		records[i] = kafka.Message{
+			Topic:   message.Topic,
+			Key:     kafkaKey(message.Key),
+			Headers: kafkaHeaders(message.Headers),
+			Value:   message.Value,
+		}
+	}
+
+	if err := p.writer.WriteMessages(ctx, records...); err != nil {
+		if errors.Is(err, io.ErrClosedPipe) {
+			return ErrPublisherClosed
+		}
+		return fmt.Errorf("error publishing events to Kafka: %w", err)
+	}
+
+	return nil
 }
 
-// PublishCompanyDeleted publishes a company deleted event
-func (p *KafkaProducer) PublishCompanyDeleted(companyID string) error {
-	return p.publishEvent(TopicCompanyDeleted, "company.deleted", map[string]string{"id": companyID})
+// Ping checks that the brokers answer a metadata request
+func (p *KafkaProducer) Ping(ctx context.Context) error {
+	return pingKafka(ctx, p.client)
 }
 
-// publishEvent publishes an event to Kafka
-func (p *KafkaProducer) publishEvent(topic, eventType string, data interface{}) error {
-	event := Event{
-		Type:      eventType,
-		Timestamp: time.Now(),
-		Data:      data,
+// Close closes the Kafka writer
+func (p *KafkaProducer) Close() error {
+	return p.writer.Close()
+}
+
+// kafkaKey converts a message key to a Kafka record key; keyless messages are spread across partitions
+func kafkaKey(key string) []byte {
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// kafkaHeaders converts message headers to Kafka record headers in a stable order
+func kafkaHeaders(headers map[string]string) []kafka.Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kafkaHeaders := make([]kafka.Header, 0, len(keys))
+	for _, key := range keys {
+		kafkaHeaders = append(kafkaHeaders, kafka.Header{Key: key, Value: []byte(headers[key])})
 	}
+	return kafkaHeaders
+}
 
-	value, err := json.Marshal(event)
+// newKafkaTransport creates a transport with the client ID, TLS and SASL settings of cfg
+func newKafkaTransport(cfg config.KafkaConfig) (*kafka.Transport, error) {
+	tlsConfig, err := newKafkaTLSConfig(cfg.TLS)
 	if err != nil {
-		return fmt.Errorf("error marshaling event: %w", err)
+		return nil, err
 	}
 
-	err = p.writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Topic: topic,
-			Value: value,
-		},
-	)
+	mechanism, err := newKafkaSASLMechanism(cfg.SASL)
 	if err != nil {
-		return fmt.Errorf("error publishing event to Kafka: %w", err)
+		return nil, err
 	}
 
-	return nil
+	return &kafka.Transport{
+		ClientID: cfg.ClientID,
+		TLS:      tlsConfig,
+		SASL:     mechanism,
+	}, nil
 }
 
-// Close closes the Kafka writer
-func (p *KafkaProducer) Close() error {
-	return p.writer.Close()
+// newKafkaTLSConfig builds the TLS configuration, or nil when TLS is disabled
+func newKafkaTLSConfig(cfg config.KafkaTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		//nolint:gosec // Opt-in through KAFKA_TLS_INSECURE_SKIP_VERIFY, for local clusters.
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Kafka CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading Kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// newKafkaSASLMechanism builds the SASL mechanism, or nil when SASL is disabled
+func newKafkaSASLMechanism(cfg config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case "scram-sha-256":
+		return newScramMechanism(scram.SHA256, cfg)
+	case "scram-sha-512":
+		return newScramMechanism(scram.SHA512, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported Kafka SASL mechanism: %s", cfg.Mechanism)
+	}
+}
+
+// newScramMechanism builds a SCRAM mechanism with the given hash
+func newScramMechanism(algorithm scram.Algorithm, cfg config.KafkaSASLConfig) (sasl.Mechanism, error) {
+	mechanism, err := scram.Mechanism(algorithm, cfg.Username, cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring Kafka SASL %s: %w", cfg.Mechanism, err)
+	}
+	return mechanism, nil
 }
@@ -0,0 +1,91 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+
+	"xm-exercise/internal/config"
+)
+
+// KafkaAdmin checks broker connectivity and provisions topics
+type KafkaAdmin struct {
+	client *kafka.Client
+	cfg    config.KafkaProvisioningConfig
+}
+
+// NewKafkaAdmin creates an admin client for the brokers of cfg
+func NewKafkaAdmin(cfg config.KafkaConfig) (*KafkaAdmin, error) {
+	transport, err := newKafkaTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaAdmin{
+		client: &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Transport: transport, Timeout: cfg.HealthTimeout},
+		cfg:    cfg.Provisioning,
+	}, nil
+}
+
+// Ping checks that the brokers answer a metadata request
+func (a *KafkaAdmin) Ping(ctx context.Context) error {
+	return pingKafka(ctx, a.client)
+}
+
+// EnsureTopics creates the topics missing from the cluster with the
+// configured partitions, replication factor and retention, and returns the
+// names of the topics it created. Existing topics are left unchanged.
+func (a *KafkaAdmin) EnsureTopics(ctx context.Context, topics []string) ([]string, error) {
+	var entries []kafka.ConfigEntry
+	if a.cfg.Retention > 0 {
+		entries = append(entries, kafka.ConfigEntry{
+			ConfigName:  "retention.ms",
+			ConfigValue: strconv.FormatInt(a.cfg.Retention.Milliseconds(), 10),
+		})
+	}
+
+	request := &kafka.CreateTopicsRequest{}
+	for _, topic := range topics {
+		request.Topics = append(request.Topics, kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     a.cfg.Partitions,
+			ReplicationFactor: a.cfg.ReplicationFactor,
+			ConfigEntries:     entries,
+		})
+	}
+
+	response, err := a.client.CreateTopics(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kafka topics: %w", err)
+	}
+
+	var created []string
+	var errs []error
+	for topic, err := range response.Errors {
+		switch {
+		case err == nil:
+			created = append(created, topic)
+		case errors.Is(err, kafka.TopicAlreadyExists):
+		default:
+			errs = append(errs, fmt.Errorf("error creating Kafka topic %s: %w", topic, err))
+		}
+	}
+	sort.Strings(created)
+	return created, errors.Join(errs...)
+}
+
+// pingKafka requests the cluster metadata, failing when no broker answers
+func pingKafka(ctx context.Context, client *kafka.Client) error {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{}})
+	if err != nil {
+		return fmt.Errorf("kafka brokers unreachable: %w", err)
+	}
+	if len(metadata.Brokers) == 0 {
+		return errors.New("kafka cluster reported no brokers")
+	}
+	return nil
+}
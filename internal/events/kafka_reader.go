@@ -0,0 +1,39 @@
+package events
+
+import (
+	"github.com/segmentio/kafka-go"
+
+	"xm-exercise/internal/config"
+)
+
+// NewKafkaReader creates a reader of topic in the consumer group groupID,
+// connecting with the client ID, TLS and SASL settings of cfg. Offsets are only
+// committed through CommitMessages, so unprocessed messages are read again
+// after a restart or rebalance.
+func NewKafkaReader(cfg config.KafkaConfig, groupID, topic string) (*kafka.Reader, error) {
+	tlsConfig, err := newKafkaTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	mechanism, err := newKafkaSASLMechanism(cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &kafka.Dialer{
+		ClientID:      cfg.ClientID,
+		Timeout:       cfg.HealthTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}
+
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     cfg.Brokers,
+		GroupID:     groupID,
+		Topic:       topic,
+		Dialer:      dialer,
+		StartOffset: kafka.FirstOffset,
+	}), nil
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/config"
+)
+
+func TestKafkaTransport(t *testing.T) {
+	t.Run("plaintext by default", func(t *testing.T) {
+		transport, err := newKafkaTransport(config.KafkaConfig{ClientID: "companies"})
+		require.NoError(t, err)
+		assert.Equal(t, "companies", transport.ClientID)
+		assert.Nil(t, transport.TLS)
+		assert.Nil(t, transport.SASL)
+	})
+
+	t.Run("TLS with custom CA and client certificate", func(t *testing.T) {
+		certFile, keyFile := writeTestCertificate(t)
+
+		transport, err := newKafkaTransport(config.KafkaConfig{TLS: config.KafkaTLSConfig{
+			Enabled:  true,
+			CAFile:   certFile,
+			CertFile: certFile,
+			KeyFile:  keyFile,
+		}})
+		require.NoError(t, err)
+		require.NotNil(t, transport.TLS)
+		assert.NotNil(t, transport.TLS.RootCAs)
+		assert.Len(t, transport.TLS.Certificates, 1)
+		assert.False(t, transport.TLS.InsecureSkipVerify)
+	})
+
+	t.Run("TLS with an unreadable CA file", func(t *testing.T) {
+		_, err := newKafkaTransport(config.KafkaConfig{TLS: config.KafkaTLSConfig{
+			Enabled: true,
+			CAFile:  filepath.Join(t.TempDir(), "missing.pem"),
+		}})
+		assert.ErrorContains(t, err, "Kafka CA file")
+	})
+
+	for mechanism, name := range map[string]string{
+		"plain":         "PLAIN",
+		"scram-sha-256": "SCRAM-SHA-256",
+		"scram-sha-512": "SCRAM-SHA-512",
+	} {
+		t.Run("SASL "+mechanism, func(t *testing.T) {
+			transport, err := newKafkaTransport(config.KafkaConfig{SASL: config.KafkaSASLConfig{
+				Mechanism: mechanism,
+				Username:  "user",
+				Password:  "secret",
+			}})
+			require.NoError(t, err)
+			require.NotNil(t, transport.SASL)
+			assert.Equal(t, name, transport.SASL.Name())
+		})
+	}
+
+	t.Run("unsupported SASL mechanism", func(t *testing.T) {
+		_, err := newKafkaTransport(config.KafkaConfig{SASL: config.KafkaSASLConfig{Mechanism: "gssapi"}})
+		assert.Error(t, err)
+	})
+}
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM
+// files and returns their paths
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestKafkaAdmin(t *testing.T) {
+	t.Run("unreachable brokers", func(t *testing.T) {
+		admin, err := NewKafkaAdmin(config.KafkaConfig{
+			Brokers:       []string{"127.0.0.1:1"},
+			HealthTimeout: 500 * time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		assert.ErrorContains(t, admin.Ping(ctx), "kafka brokers unreachable")
+	})
+
+	t.Run("creates missing topics", func(t *testing.T) {
+		brokers := os.Getenv("KAFKA_TEST_BROKERS")
+		if brokers == "" {
+			t.Skip("KAFKA_TEST_BROKERS not set")
+		}
+
+		admin, err := NewKafkaAdmin(config.KafkaConfig{
+			Brokers:       strings.Split(brokers, ","),
+			HealthTimeout: 10 * time.Second,
+			Provisioning: config.KafkaProvisioningConfig{
+				Partitions:        2,
+				ReplicationFactor: 1,
+				Retention:         time.Hour,
+			},
+		})
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		require.NoError(t, admin.Ping(ctx))
+
+		topic := conformanceTopic()
+		created, err := admin.EnsureTopics(ctx, []string{topic})
+		require.NoError(t, err)
+		assert.Equal(t, []string{topic}, created)
+
+		created, err = admin.EnsureTopics(ctx, []string{topic})
+		require.NoError(t, err)
+		assert.Empty(t, created)
+	})
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBus is an in-process event bus that fans messages out to subscribers over channels
+type MemoryBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*Subscription
+	nextID      int
+	bufferSize  int
+	closed      bool
+}
+
+// Subscription receives the messages published on a MemoryBus
+type Subscription struct {
+	// C delivers published messages. It is never closed; select on Done as well.
+	C <-chan Message
+
+	ch   chan Message
+	done chan struct{}
+	once sync.Once
+	bus  *MemoryBus
+	id   int
+}
+
+// NewMemoryBus creates an in-process bus whose subscriptions buffer bufferSize messages
+func NewMemoryBus(bufferSize int) *MemoryBus {
+	return &MemoryBus{
+		subscribers: make(map[int]*Subscription),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Subscribe registers a new subscriber that receives every message published from now on
+func (b *MemoryBus) Subscribe() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Message, b.bufferSize)
+	sub := &Subscription{C: ch, ch: ch, done: make(chan struct{}), bus: b, id: b.nextID}
+	if b.closed {
+		sub.close()
+		return sub
+	}
+
+	b.subscribers[sub.id] = sub
+	b.nextID++
+	return sub
+}
+
+// Publish delivers the message to every subscriber, waiting for buffer space.
+// Subscribers that unsubscribe while the message is in flight are skipped.
+func (b *MemoryBus) Publish(ctx context.Context, message Message) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrPublisherClosed
+	}
+	subscribers := make([]*Subscription, 0, len(b.subscribers))
+	for _, sub := range b.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+	b.mu.RUnlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, sub := range subscribers {
+		select {
+		case sub.ch <- message:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Close ends every subscription; later publishes fail with ErrPublisherClosed
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for id, sub := range b.subscribers {
+		sub.close()
+		delete(b.subscribers, id)
+	}
+	return nil
+}
+
+// Done is closed when the subscription ends
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Unsubscribe stops delivery to the subscription
+func (s *Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	delete(s.bus.subscribers, s.id)
+	s.bus.mu.Unlock()
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.once.Do(func() { close(s.done) })
+}
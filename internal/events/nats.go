@@ -0,0 +1,115 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"xm-exercise/internal/config"
+)
+
+// NATSPublisher publishes events to NATS subjects named after the event topics,
+// optionally through JetStream for acknowledged, persisted delivery
+type NATSPublisher struct {
+	conn          *nats.Conn
+	js            jetstream.JetStream
+	subjectPrefix string
+	timeout       time.Duration
+}
+
+// NewNATSPublisher connects to NATS and, when configured, ensures the JetStream stream exists
+func NewNATSPublisher(cfg config.NATSConfig) (*NATSPublisher, error) {
+	conn, err := nats.Connect(cfg.URL,
+		nats.Name("xm-exercise"),
+		nats.Timeout(cfg.ConnectTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to NATS: %w", err)
+	}
+
+	publisher := &NATSPublisher{conn: conn, subjectPrefix: cfg.SubjectPrefix, timeout: cfg.ConnectTimeout}
+	if !cfg.JetStream {
+		return publisher, nil
+	}
+
+	publisher.js, err = jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not create JetStream context: %w", err)
+	}
+
+	if cfg.Stream != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+		defer cancel()
+		_, err = publisher.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: cfg.StreamSubjects,
+		})
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not create JetStream stream %s: %w", cfg.Stream, err)
+		}
+	}
+
+	return publisher, nil
+}
+
+// Publish sends the message to the subject named after its topic. Without a
+// deadline on ctx, the publish is bounded by the configured connect timeout.
+func (p *NATSPublisher) Publish(ctx context.Context, message Message) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	msg := &nats.Msg{
+		Subject: p.subjectPrefix + message.Topic,
+		Data:    message.Value,
+		Header:  nats.Header{},
+	}
+	for key, value := range message.Headers {
+		msg.Header.Set(key, value)
+	}
+	msg.Header.Set(EventTypeHeader, message.Type)
+
+	var err error
+	if p.js != nil {
+		_, err = p.js.PublishMsg(ctx, msg)
+	} else if err = p.conn.PublishMsg(msg); err == nil {
+		err = p.conn.FlushWithContext(ctx)
+	}
+
+	if err != nil {
+		if errors.Is(err, nats.ErrConnectionClosed) {
+			return ErrPublisherClosed
+		}
+		return fmt.Errorf("error publishing event to NATS: %w", err)
+	}
+	return nil
+}
+
+// Ping checks that the server answers a round trip on the connection
+func (p *NATSPublisher) Ping(ctx context.Context) error {
+	if status := p.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("NATS connection is %s", status)
+	}
+	if err := p.conn.FlushWithContext(ctx); err != nil {
+		return fmt.Errorf("NATS server unreachable: %w", err)
+	}
+	return nil
+}
+
+// Close flushes buffered messages and closes the connection
+func (p *NATSPublisher) Close() error {
+	if p.conn.IsClosed() {
+		return nil
+	}
+	err := p.conn.Flush()
+	p.conn.Close()
+	return err
+}
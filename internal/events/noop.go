@@ -0,0 +1,30 @@
+package events
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// NoopPublisher discards every event
+type NoopPublisher struct {
+	closed atomic.Bool
+}
+
+// NewNoopPublisher creates a publisher that discards every event
+func NewNoopPublisher() *NoopPublisher {
+	return &NoopPublisher{}
+}
+
+// Publish discards the message
+func (p *NoopPublisher) Publish(ctx context.Context, _ Message) error {
+	if p.closed.Load() {
+		return ErrPublisherClosed
+	}
+	return ctx.Err()
+}
+
+// Close marks the publisher closed
+func (p *NoopPublisher) Close() error {
+	p.closed.Store(true)
+	return nil
+}
@@ -0,0 +1,135 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/pkg/models"
+)
+
+// Event bus backends selectable through EVENT_BUS_BACKEND
+const (
+	BackendKafka  = "kafka"
+	BackendMemory = "memory"
+	BackendFile   = "file"
+	BackendNATS   = "nats"
+	BackendNoop   = "noop"
+)
+
+// ErrPublisherClosed is returned when publishing to a closed publisher
+var ErrPublisherClosed = errors.New("publisher is closed")
+
+// ErrKeyBlocked is returned for a message not sent because an earlier message
+// with the same key failed, since sending it would deliver the key out of order
+var ErrKeyBlocked = errors.New("an earlier message with the same key failed")
+
+// Publisher delivers encoded events to an event bus backend
+type Publisher interface {
+	Publish(ctx context.Context, message Message) error
+	Close() error
+}
+
+// HealthChecker is implemented by publishers that can check their connection to the broker
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// NewPublisher creates the publisher for the configured backend
+func NewPublisher(cfg config.EventBusConfig) (Publisher, error) {
+	switch cfg.Backend {
+	case BackendKafka:
+		return NewKafkaProducer(cfg.Kafka)
+	case BackendMemory:
+		return NewMemoryBus(cfg.Memory.BufferSize), nil
+	case BackendFile:
+		return NewFileSink(cfg.File.Path)
+	case BackendNATS:
+		return NewNATSPublisher(cfg.NATS)
+	case BackendNoop:
+		return NewNoopPublisher(), nil
+	default:
+		return nil, fmt.Errorf("unsupported event bus backend: %s", cfg.Backend)
+	}
+}
+
+// Dead-letter targets selectable through EVENT_DEAD_LETTER
+const (
+	DeadLetterTopic = "topic"
+	DeadLetterFile  = "file"
+	DeadLetterNone  = "none"
+)
+
+// Headers added to dead-lettered messages
+const (
+	DeadLetterTopicHeader    = "dead-letter-topic"
+	DeadLetterErrorHeader    = "dead-letter-error"
+	DeadLetterAttemptsHeader = "dead-letter-attempts"
+)
+
+// NewDeadLetter creates the publisher receiving messages that exhausted their
+// retries: the event bus itself under another topic, or a file. It returns nil
+// when dead-lettering is disabled.
+func NewDeadLetter(cfg config.DeadLetterConfig, publisher Publisher) (Publisher, error) {
+	switch cfg.Target {
+	case DeadLetterTopic:
+		return &topicDeadLetter{publisher: publisher, topic: cfg.Topic}, nil
+	case DeadLetterFile:
+		return NewFileSink(cfg.Path)
+	case DeadLetterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported dead-letter target: %s", cfg.Target)
+	}
+}
+
+// DeadLetterMessage returns message with the dead-letter headers recording
+// why and after how many attempts it was given up on
+func DeadLetterMessage(message Message, deliveryErr error, attempts int) Message {
+	headers := make(map[string]string, len(message.Headers)+3)
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+	headers[DeadLetterTopicHeader] = message.Topic
+	headers[DeadLetterErrorHeader] = deliveryErr.Error()
+	headers[DeadLetterAttemptsHeader] = fmt.Sprint(attempts)
+	message.Headers = headers
+	return message
+}
+
+// Producer implements KafkaProducerInterface on top of any Publisher backend
+type Producer struct {
+	publisher Publisher
+	encoder   *Encoder
+}
+
+// NewProducer creates a producer encoding with encoder and publishing through the given backend
+func NewProducer(publisher Publisher, encoder *Encoder) *Producer {
+	return &Producer{publisher: publisher, encoder: encoder}
+}
+
+// PublishCompanyCreated publishes a company created event
+func (p *Producer) PublishCompanyCreated(ctx context.Context, company models.Company) error {
+	return p.publishEvent(ctx)(p.encoder.CompanyCreated(ctx, company))
+}
+
+// PublishCompanyUpdated publishes a company updated event
+func (p *Producer) PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error {
+	return p.publishEvent(ctx)(p.encoder.CompanyUpdated(ctx, before, after))
+}
+
+// PublishCompanyDeleted publishes a company deleted event
+func (p *Producer) PublishCompanyDeleted(ctx context.Context, company *models.Company) error {
+	return p.publishEvent(ctx)(p.encoder.CompanyDeleted(ctx, company))
+}
+
+// publishEvent returns a function publishing an encoded event through the backend
+func (p *Producer) publishEvent(ctx context.Context) func(message Message, err error) error {
+	return func(message Message, err error) error {
+		if err != nil {
+			return err
+		}
+		return p.publisher.Publish(ctx, message)
+	}
+}
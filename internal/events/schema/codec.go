@@ -0,0 +1,144 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Codec encodes payloads in one encoding
+type Codec interface {
+	// Encoding is the encoding name, e.g. "avro"
+	Encoding() string
+	// ContentType is the media type of encoded payloads
+	ContentType() string
+	Marshal(payload Payload) ([]byte, error)
+}
+
+// NewCodec creates the codec for encoding
+func NewCodec(encoding string) (Codec, error) {
+	switch encoding {
+	case EncodingJSON:
+		return jsonCodec{}, nil
+	case EncodingAvro:
+		return newAvroCodec()
+	case EncodingProtobuf:
+		return protobufCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported data encoding: %s", encoding)
+	}
+}
+
+// jsonCodec encodes payloads as JSON
+type jsonCodec struct{}
+
+func (jsonCodec) Encoding() string    { return EncodingJSON }
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(payload Payload) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// avroCodec encodes payloads as Avro binary
+type avroCodec struct {
+	schemas map[Descriptor]avro.Schema
+}
+
+// newAvroCodec parses the Avro schemas of all payloads
+func newAvroCodec() (*avroCodec, error) {
+	codec := &avroCodec{schemas: map[Descriptor]avro.Schema{}}
+	for _, descriptor := range current {
+		definition, err := Lookup(descriptor, EncodingAvro)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := avro.Parse(definition.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Avro schema of %s: %w", descriptor.Record, err)
+		}
+		codec.schemas[descriptor] = parsed
+	}
+	return codec, nil
+}
+
+func (*avroCodec) Encoding() string    { return EncodingAvro }
+func (*avroCodec) ContentType() string { return "application/avro" }
+
+func (c *avroCodec) Marshal(payload Payload) ([]byte, error) {
+	parsed, ok := c.schemas[payload.Schema()]
+	if !ok {
+		return nil, fmt.Errorf("no Avro schema for payload %s", payload.Schema().Record)
+	}
+	return avro.Marshal(parsed, payload)
+}
+
+// protobufCodec encodes payloads as Protobuf following the field numbers of
+// the .proto schemas. Fields holding their zero value are omitted, as proto3
+// does, except optional fields which are written whenever they are set.
+type protobufCodec struct{}
+
+func (protobufCodec) Encoding() string    { return EncodingProtobuf }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) Marshal(payload Payload) ([]byte, error) {
+	switch p := payload.(type) {
+	case Company:
+		return marshalCompany(p), nil
+	case CompanyUpdated:
+		var b []byte
+		b = appendMessage(b, 1, marshalCompany(p.Before))
+		b = appendMessage(b, 2, marshalCompany(p.After))
+		for _, field := range p.ChangedFields {
+			b = protowire.AppendTag(b, 3, protowire.BytesType)
+			b = protowire.AppendString(b, field)
+		}
+		return b, nil
+	case CompanyDeleted:
+		return appendMessage(nil, 1, marshalCompany(p.Company)), nil
+	default:
+		return nil, fmt.Errorf("no Protobuf encoding for payload %s", payload.Schema().Record)
+	}
+}
+
+// marshalCompany appends the Company (or CompanyState) message fields
+func marshalCompany(c Company) []byte {
+	var b []byte
+	b = appendString(b, 1, c.ID)
+	b = appendString(b, 2, c.OrganizationID)
+	b = appendString(b, 3, c.Name)
+	if c.Description != nil {
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendString(b, *c.Description)
+	}
+	b = appendVarint(b, 5, uint64(int64(c.EmployeeCount)))
+	b = appendVarint(b, 6, protowire.EncodeBool(c.Registered))
+	b = appendString(b, 7, c.Type)
+	b = appendVarint(b, 8, uint64(c.CreatedAt.UnixMilli()))
+	return appendVarint(b, 9, uint64(c.UpdatedAt.UnixMilli()))
+}
+
+// appendMessage appends an embedded message field, which is always present
+func appendMessage(b []byte, number protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// appendString appends a length-delimited field unless value is empty
+func appendString(b []byte, number protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+// appendVarint appends a varint field unless value is zero
+func appendVarint(b []byte, number protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, number, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
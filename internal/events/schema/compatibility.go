@@ -0,0 +1,286 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hamba/avro/v2"
+)
+
+// CheckCompatibility returns an error describing why a schema cannot read data
+// written with the previous schema, following the registry BACKWARD rules:
+//   - Avro uses the Avro schema resolution rules
+//   - Protobuf messages must keep their fields' numbers, names and types, and
+//     removed field numbers must be reserved
+//   - JSON Schema must not require new properties, change property types or
+//     drop properties while disallowing additional ones
+func CheckCompatibility(schemaType, previous, next string) error {
+	switch schemaType {
+	case TypeAvro:
+		return checkAvro(previous, next)
+	case TypeProtobuf:
+		return checkProtobuf(previous, next)
+	case TypeJSON:
+		return checkJSONSchema(previous, next)
+	default:
+		return fmt.Errorf("unsupported schema type: %s", schemaType)
+	}
+}
+
+// checkAvro checks that next can read data written with previous
+func checkAvro(previous, next string) error {
+	writer, err := avro.Parse(previous)
+	if err != nil {
+		return fmt.Errorf("error parsing previous schema: %w", err)
+	}
+	reader, err := avro.Parse(next)
+	if err != nil {
+		return fmt.Errorf("error parsing new schema: %w", err)
+	}
+	return avro.NewSchemaCompatibility().Compatible(reader, writer)
+}
+
+// protoField is a field declared in a .proto message
+type protoField struct {
+	Name  string
+	Type  string
+	Label string
+}
+
+// protoMessage is the fields and reservations of a .proto message
+type protoMessage struct {
+	Name             string
+	Fields           map[int]protoField
+	ReservedNumbers  map[int]bool
+	ReservedNames    map[string]bool
+	DeclarationOrder []int
+}
+
+var (
+	protoCommentPattern  = regexp.MustCompile(`//[^\n]*`)
+	protoMessagePattern  = regexp.MustCompile(`message\s+(\w+)\s*\{([^}]*)\}`)
+	protoFieldPattern    = regexp.MustCompile(`^(optional\s+|repeated\s+)?([\w.]+)\s+(\w+)\s*=\s*(\d+)\s*;$`)
+	protoReservedPattern = regexp.MustCompile(`^reserved\s+(.+);$`)
+)
+
+// parseProto extracts the top-level messages of a .proto document in
+// declaration order. Nested messages, enums and oneofs are not used by the
+// event schemas and are not supported.
+func parseProto(document string) ([]protoMessage, error) {
+	document = protoCommentPattern.ReplaceAllString(document, "")
+
+	var messages []protoMessage
+	for _, match := range protoMessagePattern.FindAllStringSubmatch(document, -1) {
+		message := protoMessage{
+			Name:            match[1],
+			Fields:          map[int]protoField{},
+			ReservedNumbers: map[int]bool{},
+			ReservedNames:   map[string]bool{},
+		}
+
+		for _, statement := range strings.Split(match[2], ";") {
+			statement = strings.Join(strings.Fields(statement), " ")
+			if statement == "" {
+				continue
+			}
+			statement += ";"
+
+			if reserved := protoReservedPattern.FindStringSubmatch(statement); reserved != nil {
+				if err := parseProtoReserved(reserved[1], &message); err != nil {
+					return nil, fmt.Errorf("message %s: %w", match[1], err)
+				}
+				continue
+			}
+
+			field := protoFieldPattern.FindStringSubmatch(statement)
+			if field == nil {
+				return nil, fmt.Errorf("message %s: unsupported statement %q", match[1], statement)
+			}
+			number, err := strconv.Atoi(field[4])
+			if err != nil {
+				return nil, fmt.Errorf("message %s: invalid field number %q", match[1], field[4])
+			}
+			if _, exists := message.Fields[number]; exists {
+				return nil, fmt.Errorf("message %s: field number %d is used twice", match[1], number)
+			}
+			message.Fields[number] = protoField{
+				Label: strings.TrimSpace(field[1]),
+				Type:  field[2],
+				Name:  field[3],
+			}
+			message.DeclarationOrder = append(message.DeclarationOrder, number)
+		}
+
+		messages = append(messages, message)
+	}
+
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("no messages found")
+	}
+	return messages, nil
+}
+
+// parseProtoReserved records the numbers, ranges and names of a reserved statement
+func parseProtoReserved(list string, message *protoMessage) error {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, `"`) {
+			message.ReservedNames[strings.Trim(item, `"`)] = true
+			continue
+		}
+
+		bounds := strings.SplitN(item, " to ", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return fmt.Errorf("invalid reserved number %q", item)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return fmt.Errorf("invalid reserved range %q", item)
+			}
+		}
+		for number := from; number <= to; number++ {
+			message.ReservedNumbers[number] = true
+		}
+	}
+	return nil
+}
+
+// checkProtobuf checks that next keeps the messages and fields of previous
+func checkProtobuf(previous, next string) error {
+	previousMessages, err := parseProto(previous)
+	if err != nil {
+		return fmt.Errorf("error parsing previous schema: %w", err)
+	}
+	parsedNext, err := parseProto(next)
+	if err != nil {
+		return fmt.Errorf("error parsing new schema: %w", err)
+	}
+	nextMessages := make(map[string]protoMessage, len(parsedNext))
+	for _, message := range parsedNext {
+		nextMessages[message.Name] = message
+	}
+
+	var problems []string
+	if previousMessages[0].Name != parsedNext[0].Name {
+		problems = append(problems, fmt.Sprintf(
+			"first message changed from %s to %s", previousMessages[0].Name, parsedNext[0].Name))
+	}
+	for _, previousMessage := range previousMessages {
+		name := previousMessage.Name
+		nextMessage, ok := nextMessages[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("message %s was removed", name))
+			continue
+		}
+
+		for _, number := range previousMessage.DeclarationOrder {
+			previousField := previousMessage.Fields[number]
+			nextField, ok := nextMessage.Fields[number]
+			switch {
+			case !ok && !nextMessage.ReservedNumbers[number]:
+				problems = append(problems, fmt.Sprintf(
+					"%s.%s (field %d) was removed without reserving its number", name, previousField.Name, number))
+			case !ok:
+			case nextField.Type != previousField.Type:
+				problems = append(problems, fmt.Sprintf(
+					"%s.%s (field %d) changed type from %s to %s",
+					name, previousField.Name, number, previousField.Type, nextField.Type))
+			case nextField.Name != previousField.Name:
+				problems = append(problems, fmt.Sprintf(
+					"%s field %d was renamed from %s to %s", name, number, previousField.Name, nextField.Name))
+			case (nextField.Label == "repeated") != (previousField.Label == "repeated"):
+				problems = append(problems, fmt.Sprintf(
+					"%s.%s (field %d) changed cardinality", name, previousField.Name, number))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("incompatible Protobuf schema: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// jsonSchema is the subset of JSON Schema used by the event schemas
+type jsonSchema struct {
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties *bool                      `json:"additionalProperties"`
+}
+
+// propertyType returns the declared type of a property, normalized for comparison
+func (s jsonSchema) propertyType(name string) (string, error) {
+	var property struct {
+		Type interface{} `json:"type"`
+		Ref  string      `json:"$ref"`
+	}
+	if err := json.Unmarshal(s.Properties[name], &property); err != nil {
+		return "", fmt.Errorf("property %s: %w", name, err)
+	}
+	if property.Ref != "" {
+		return property.Ref, nil
+	}
+	normalized, err := json.Marshal(property.Type)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// checkJSONSchema checks that data valid against previous is valid against next
+func checkJSONSchema(previous, next string) error {
+	var previousSchema, nextSchema jsonSchema
+	if err := json.Unmarshal([]byte(previous), &previousSchema); err != nil {
+		return fmt.Errorf("error parsing previous schema: %w", err)
+	}
+	if err := json.Unmarshal([]byte(next), &nextSchema); err != nil {
+		return fmt.Errorf("error parsing new schema: %w", err)
+	}
+
+	var problems []string
+
+	previouslyRequired := map[string]bool{}
+	for _, name := range previousSchema.Required {
+		previouslyRequired[name] = true
+	}
+	for _, name := range nextSchema.Required {
+		if !previouslyRequired[name] {
+			problems = append(problems, fmt.Sprintf("property %s became required", name))
+		}
+	}
+
+	closed := nextSchema.AdditionalProperties != nil && !*nextSchema.AdditionalProperties
+	for name := range previousSchema.Properties {
+		if _, ok := nextSchema.Properties[name]; !ok {
+			if closed {
+				problems = append(problems, fmt.Sprintf("property %s was removed while additional properties are not allowed", name))
+			}
+			continue
+		}
+
+		previousType, err := previousSchema.propertyType(name)
+		if err != nil {
+			return fmt.Errorf("error parsing previous schema: %w", err)
+		}
+		nextType, err := nextSchema.propertyType(name)
+		if err != nil {
+			return fmt.Errorf("error parsing new schema: %w", err)
+		}
+		if previousType != nextType {
+			problems = append(problems, fmt.Sprintf("property %s changed type from %s to %s", name, previousType, nextType))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("incompatible JSON schema: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package schema defines the versioned payloads carried by company events,
+// the Avro, Protobuf and JSON Schema documents describing them, and the
+// codecs encoding payloads in each of those formats.
+//
+// Payloads are decoupled from the GORM models: changing a model does not
+// change what consumers receive until a payload and its schemas are changed
+// too, and TestReleasedSchemasAreCompatible fails on breaking changes to
+// released schemas.
+package schema
+
+import (
+	"embed"
+	"fmt"
+	"time"
+
+	"xm-exercise/pkg/models"
+)
+
+// Encodings selectable through EVENT_DATA_ENCODING
+const (
+	EncodingJSON     = "json"
+	EncodingAvro     = "avro"
+	EncodingProtobuf = "protobuf"
+)
+
+// Schema types as named by Confluent-compatible schema registries
+const (
+	TypeAvro     = "AVRO"
+	TypeProtobuf = "PROTOBUF"
+	TypeJSON     = "JSON"
+)
+
+//go:embed *.avsc *.proto *.schema.json
+var files embed.FS
+
+// Descriptor identifies one version of a payload schema. Breaking changes
+// get a new version, whose record lives in a new versioned namespace.
+type Descriptor struct {
+	// Name is the schema file name stem, e.g. "company_deleted"
+	Name    string
+	Version int
+	// Record is the fully qualified record name
+	Record string
+}
+
+// Payload schemas
+var (
+	CompanyV1        = Descriptor{Name: "company", Version: 1, Record: "com.xm.company.v1.Company"}
+	CompanyUpdatedV1 = Descriptor{Name: "company_updated", Version: 1, Record: "com.xm.company.v1.CompanyUpdated"}
+	// CompanyDeletedV1 carried only the company's identifiers; it is kept for
+	// consumers decoding events emitted before CompanyDeletedV2
+	CompanyDeletedV1 = Descriptor{Name: "company_deleted", Version: 1, Record: "com.xm.company.v1.CompanyDeleted"}
+	CompanyDeletedV2 = Descriptor{Name: "company_deleted", Version: 2, Record: "com.xm.company.v2.CompanyDeleted"}
+)
+
+// current lists the payload schemas of the events emitted today
+var current = []Descriptor{CompanyV1, CompanyUpdatedV1, CompanyDeletedV2}
+
+// Payload is a versioned event payload
+type Payload interface {
+	// Schema identifies the schema describing the payload
+	Schema() Descriptor
+}
+
+// Company is the payload of company.created events, and the company state
+// within other payloads
+type Company struct {
+	ID             string    `json:"id" avro:"id"`
+	OrganizationID string    `json:"organization_id" avro:"organization_id"`
+	Name           string    `json:"name" avro:"name"`
+	Description    *string   `json:"description,omitempty" avro:"description"`
+	EmployeeCount  int       `json:"employee_count" avro:"employee_count"`
+	Registered     bool      `json:"registered" avro:"registered"`
+	Type           string    `json:"type" avro:"type"`
+	CreatedAt      time.Time `json:"created_at" avro:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" avro:"updated_at"`
+}
+
+// Schema implements Payload
+func (Company) Schema() Descriptor {
+	return CompanyV1
+}
+
+// CompanyUpdated is the payload of company.updated events
+type CompanyUpdated struct {
+	Before Company `json:"before" avro:"before"`
+	After  Company `json:"after" avro:"after"`
+	// ChangedFields names the fields that differ between Before and After
+	ChangedFields []string `json:"changed_fields" avro:"changed_fields"`
+}
+
+// Schema implements Payload
+func (CompanyUpdated) Schema() Descriptor {
+	return CompanyUpdatedV1
+}
+
+// CompanyDeleted is the payload of company.deleted events
+type CompanyDeleted struct {
+	// Company is the last known state of the deleted company
+	Company Company `json:"company" avro:"company"`
+}
+
+// Schema implements Payload
+func (CompanyDeleted) Schema() Descriptor {
+	return CompanyDeletedV2
+}
+
+// NewCompany builds the event payload for a company
+func NewCompany(company *models.Company) Company {
+	return Company{
+		ID:             company.ID,
+		OrganizationID: company.OrganizationID,
+		Name:           company.Name,
+		Description:    company.Description,
+		EmployeeCount:  company.EmployeeCount,
+		Registered:     company.Registered != nil && *company.Registered,
+		Type:           string(company.Type),
+		CreatedAt:      company.CreatedAt.UTC(),
+		UpdatedAt:      company.UpdatedAt.UTC(),
+	}
+}
+
+// Definition is the schema document of one payload schema in one encoding
+type Definition struct {
+	Descriptor
+	// Type is the schema type as named by schema registries
+	Type   string
+	Schema string
+}
+
+// Lookup returns the schema document of a payload schema in encoding
+func Lookup(descriptor Descriptor, encoding string) (Definition, error) {
+	schemaType, extension, err := encodingFile(encoding)
+	if err != nil {
+		return Definition{}, err
+	}
+
+	content, err := files.ReadFile(fmt.Sprintf("%s.v%d.%s", descriptor.Name, descriptor.Version, extension))
+	if err != nil {
+		return Definition{}, fmt.Errorf("no %s schema for payload %s v%d: %w",
+			encoding, descriptor.Name, descriptor.Version, err)
+	}
+
+	return Definition{Descriptor: descriptor, Type: schemaType, Schema: string(content)}, nil
+}
+
+// encodingFile returns the schema type and file extension of an encoding
+func encodingFile(encoding string) (string, string, error) {
+	switch encoding {
+	case EncodingJSON:
+		return TypeJSON, "schema.json", nil
+	case EncodingAvro:
+		return TypeAvro, "avsc", nil
+	case EncodingProtobuf:
+		return TypeProtobuf, "proto", nil
+	default:
+		return "", "", fmt.Errorf("unsupported data encoding: %s", encoding)
+	}
+}
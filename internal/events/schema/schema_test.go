@@ -0,0 +1,323 @@
+package schema
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"xm-exercise/pkg/models"
+)
+
+// TestReleasedSchemasAreCompatible fails when a schema change would break
+// consumers of a released schema. testdata/baseline holds the schemas as
+// released; copy a schema there once its change has shipped.
+func TestReleasedSchemasAreCompatible(t *testing.T) {
+	baseline, err := filepath.Glob(filepath.Join("testdata", "baseline", "*"))
+	require.NoError(t, err)
+	require.NotEmpty(t, baseline)
+
+	for _, path := range baseline {
+		name := filepath.Base(path)
+		t.Run(name, func(t *testing.T) {
+			released, err := os.ReadFile(path)
+			require.NoError(t, err)
+
+			current, err := files.ReadFile(name)
+			require.NoError(t, err, "released schema %s was removed", name)
+
+			assert.NoError(t, CheckCompatibility(schemaTypeOf(name), string(released), string(current)))
+		})
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	tests := []struct {
+		name       string
+		schemaType string
+		previous   string
+		next       string
+		wantErr    string
+	}{
+		{
+			name:       "Avro optional field added",
+			schemaType: TypeAvro,
+			previous:   `{"type":"record","name":"R","fields":[{"name":"a","type":"string"}]}`,
+			next: `{"type":"record","name":"R","fields":[{"name":"a","type":"string"},` +
+				`{"name":"b","type":["null","string"],"default":null}]}`,
+		},
+		{
+			name:       "Avro required field added",
+			schemaType: TypeAvro,
+			previous:   `{"type":"record","name":"R","fields":[{"name":"a","type":"string"}]}`,
+			next:       `{"type":"record","name":"R","fields":[{"name":"a","type":"string"},{"name":"b","type":"string"}]}`,
+			wantErr:    "b",
+		},
+		{
+			name:       "Avro field type changed",
+			schemaType: TypeAvro,
+			previous:   `{"type":"record","name":"R","fields":[{"name":"a","type":"string"}]}`,
+			next:       `{"type":"record","name":"R","fields":[{"name":"a","type":"int"}]}`,
+			wantErr:    "a",
+		},
+		{
+			name:       "Protobuf field added",
+			schemaType: TypeProtobuf,
+			previous:   `message M { string a = 1; }`,
+			next:       `message M { string a = 1; int64 b = 2; }`,
+		},
+		{
+			name:       "Protobuf field removed and reserved",
+			schemaType: TypeProtobuf,
+			previous:   `message M { string a = 1; string b = 2; }`,
+			next:       `message M { string a = 1; reserved 2; reserved "b"; }`,
+		},
+		{
+			name:       "Protobuf field removed",
+			schemaType: TypeProtobuf,
+			previous:   `message M { string a = 1; string b = 2; }`,
+			next:       `message M { string a = 1; }`,
+			wantErr:    "M.b (field 2) was removed without reserving its number",
+		},
+		{
+			name:       "Protobuf field type changed",
+			schemaType: TypeProtobuf,
+			previous:   `message M { string a = 1; }`,
+			next:       `message M { int32 a = 1; }`,
+			wantErr:    "M.a (field 1) changed type from string to int32",
+		},
+		{
+			name:       "Protobuf message removed",
+			schemaType: TypeProtobuf,
+			previous:   `message M { string a = 1; }`,
+			next:       `message N { string a = 1; }`,
+			wantErr:    "message M was removed",
+		},
+		{
+			name:       "JSON optional property added",
+			schemaType: TypeJSON,
+			previous:   `{"properties":{"a":{"type":"string"}},"required":["a"]}`,
+			next:       `{"properties":{"a":{"type":"string"},"b":{"type":"string"}},"required":["a"]}`,
+		},
+		{
+			name:       "JSON property became required",
+			schemaType: TypeJSON,
+			previous:   `{"properties":{"a":{"type":"string"},"b":{"type":"string"}},"required":["a"]}`,
+			next:       `{"properties":{"a":{"type":"string"},"b":{"type":"string"}},"required":["a","b"]}`,
+			wantErr:    "property b became required",
+		},
+		{
+			name:       "JSON property type changed",
+			schemaType: TypeJSON,
+			previous:   `{"properties":{"a":{"type":"string"}}}`,
+			next:       `{"properties":{"a":{"type":"integer"}}}`,
+			wantErr:    `property a changed type from "string" to "integer"`,
+		},
+		{
+			name:       "JSON property removed from closed schema",
+			schemaType: TypeJSON,
+			previous:   `{"properties":{"a":{"type":"string"},"b":{"type":"string"}},"additionalProperties":false}`,
+			next:       `{"properties":{"a":{"type":"string"}},"additionalProperties":false}`,
+			wantErr:    "property b was removed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCompatibility(tt.schemaType, tt.previous, tt.next)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	description := "Widgets"
+	registered := true
+	company := NewCompany(&models.Company{
+		ID:             "company-1",
+		OrganizationID: "org-1",
+		Name:           "Acme",
+		Description:    &description,
+		EmployeeCount:  42,
+		Registered:     &registered,
+		Type:           models.TypeCorporation,
+		CreatedAt:      time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		UpdatedAt:      time.Date(2024, 2, 3, 4, 5, 6, 7000000, time.UTC),
+	})
+	renamed := company
+	renamed.Name = "Acme Ltd"
+	payloads := []Payload{
+		company,
+		CompanyUpdated{Before: company, After: renamed, ChangedFields: []string{"name"}},
+		CompanyDeleted{Company: company},
+	}
+
+	t.Run("JSON matches the JSON schema", func(t *testing.T) {
+		codec, err := NewCodec(EncodingJSON)
+		require.NoError(t, err)
+
+		for _, payload := range payloads {
+			value, err := codec.Marshal(payload)
+			require.NoError(t, err)
+
+			var fields map[string]interface{}
+			require.NoError(t, json.Unmarshal(value, &fields))
+
+			definition, err := Lookup(payload.Schema(), EncodingJSON)
+			require.NoError(t, err)
+			var document jsonSchema
+			require.NoError(t, json.Unmarshal([]byte(definition.Schema), &document))
+
+			for _, name := range document.Required {
+				assert.Contains(t, fields, name)
+			}
+			for name := range fields {
+				assert.Contains(t, document.Properties, name)
+			}
+		}
+	})
+
+	t.Run("Avro round trip", func(t *testing.T) {
+		codec, err := NewCodec(EncodingAvro)
+		require.NoError(t, err)
+
+		value, err := codec.Marshal(payloads[1])
+		require.NoError(t, err)
+
+		definition, err := Lookup(CompanyUpdatedV1, EncodingAvro)
+		require.NoError(t, err)
+		var decoded CompanyUpdated
+		require.NoError(t, avro.Unmarshal(avro.MustParse(definition.Schema), value, &decoded))
+		assert.Equal(t, "Acme", decoded.Before.Name)
+		assert.Equal(t, "Acme Ltd", decoded.After.Name)
+		assert.Equal(t, description, *decoded.After.Description)
+		assert.Equal(t, []string{"name"}, decoded.ChangedFields)
+		assert.True(t, decoded.After.CreatedAt.Equal(company.CreatedAt.Truncate(time.Millisecond)))
+	})
+
+	t.Run("Protobuf follows the .proto field numbers", func(t *testing.T) {
+		codec, err := NewCodec(EncodingProtobuf)
+		require.NoError(t, err)
+
+		for _, payload := range payloads {
+			value, err := codec.Marshal(payload)
+			require.NoError(t, err)
+
+			definition, err := Lookup(payload.Schema(), EncodingProtobuf)
+			require.NoError(t, err)
+			messages, err := parseProto(definition.Schema)
+			require.NoError(t, err)
+
+			byName := map[string]protoMessage{}
+			for _, message := range messages {
+				byName[message.Name] = message
+			}
+			assertProtoWire(t, byName, messages[0], value)
+		}
+	})
+
+	t.Run("Protobuf encodes timestamps as epoch milliseconds", func(t *testing.T) {
+		codec, err := NewCodec(EncodingProtobuf)
+		require.NoError(t, err)
+
+		value, err := codec.Marshal(company)
+		require.NoError(t, err)
+
+		for len(value) > 0 {
+			number, wireType, n := protowire.ConsumeTag(value)
+			value = value[n:]
+			if number == 8 {
+				millis, _ := protowire.ConsumeVarint(value)
+				assert.Equal(t, company.CreatedAt.UnixMilli(), int64(millis))
+				return
+			}
+			value = value[protowire.ConsumeFieldValue(number, wireType, value):]
+		}
+		t.Fatal("created_at was not encoded")
+	})
+}
+
+func TestLookup(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingAvro, EncodingProtobuf} {
+		for _, descriptor := range append(current, CompanyDeletedV1) {
+			definition, err := Lookup(descriptor, encoding)
+			require.NoError(t, err)
+			assert.Equal(t, descriptor, definition.Descriptor)
+			assert.NotEmpty(t, definition.Schema)
+		}
+	}
+
+	_, err := Lookup(CompanyV1, "xml")
+	assert.Error(t, err)
+}
+
+// assertProtoWire checks that every field of an encoded message is declared
+// in the .proto message with a matching wire type, recursing into embedded
+// messages, and that every declared scalar field was written
+func assertProtoWire(t *testing.T, messages map[string]protoMessage, message protoMessage, value []byte) {
+	t.Helper()
+
+	seen := map[int]bool{}
+	for len(value) > 0 {
+		number, wireType, n := protowire.ConsumeTag(value)
+		require.GreaterOrEqual(t, n, 0)
+		value = value[n:]
+
+		field, ok := message.Fields[int(number)]
+		require.True(t, ok, "%s field %d is not declared", message.Name, number)
+		seen[int(number)] = true
+
+		if embedded, ok := messages[field.Type]; ok {
+			require.Equal(t, protowire.BytesType, wireType, "%s.%s", message.Name, field.Name)
+			content, n := protowire.ConsumeBytes(value)
+			require.GreaterOrEqual(t, n, 0)
+			assertProtoWire(t, messages, embedded, content)
+			value = value[n:]
+			continue
+		}
+
+		assert.Equal(t, protoWireType(field.Type), wireType, "%s.%s", message.Name, field.Name)
+		n = protowire.ConsumeFieldValue(number, wireType, value)
+		require.GreaterOrEqual(t, n, 0)
+		value = value[n:]
+	}
+	assert.Len(t, seen, len(message.Fields), "%s fields written", message.Name)
+}
+
+// schemaTypeOf returns the schema type of a schema file
+func schemaTypeOf(fileName string) string {
+	switch {
+	case strings.HasSuffix(fileName, ".avsc"):
+		return TypeAvro
+	case strings.HasSuffix(fileName, ".proto"):
+		return TypeProtobuf
+	default:
+		return TypeJSON
+	}
+}
+
+// protoWireType returns the wire type of a scalar .proto type
+func protoWireType(protoType string) protowire.Type {
+	switch protoType {
+	case "string", "bytes":
+		return protowire.BytesType
+	case "double", "fixed64", "sfixed64":
+		return protowire.Fixed64Type
+	case "float", "fixed32", "sfixed32":
+		return protowire.Fixed32Type
+	default:
+		return protowire.VarintType
+	}
+}
@@ -0,0 +1,180 @@
+// Package schemaregistry is a client for Confluent-compatible schema
+// registries, plus an in-memory stub registry for local development and tests.
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events/schema"
+)
+
+// MemoryURL selects the in-process stub registry instead of a remote one
+const MemoryURL = "memory"
+
+// contentType is the media type of registry API requests
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// wireFormatMagicByte starts every message framed with a schema ID
+const wireFormatMagicByte = 0
+
+// Error is an error response from the registry
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry error %d: %s", e.Code, e.Message)
+}
+
+// schemaRequest registers or tests a schema
+type schemaRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// Client talks to a Confluent-compatible schema registry
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the configured registry. The MemoryURL
+// address serves requests from a new in-process Stub.
+func NewClient(cfg config.SchemaRegistryConfig) *Client {
+	client := &Client{
+		baseURL:    strings.TrimSuffix(cfg.URL, "/"),
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if cfg.URL == MemoryURL {
+		client.baseURL = "http://" + MemoryURL
+		client.httpClient = &http.Client{Transport: handlerTransport{handler: NewStub()}}
+	}
+	return client
+}
+
+// Register registers a schema under subject, returning its global ID. The
+// registry returns the existing ID when the schema is already registered and
+// rejects schemas incompatible with the subject's previous versions.
+func (c *Client) Register(ctx context.Context, subject, schemaType, document string) (int, error) {
+	var response struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := c.post(ctx, path, schemaType, document, &response); err != nil {
+		return 0, fmt.Errorf("error registering schema for %s: %w", subject, err)
+	}
+	return response.ID, nil
+}
+
+// TestCompatibility reports whether a schema is compatible with the latest
+// version registered under subject. Subjects without versions accept any schema.
+func (c *Client) TestCompatibility(ctx context.Context, subject, schemaType, document string) (bool, error) {
+	var response struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest"
+	err := c.post(ctx, path, schemaType, document, &response)
+	var registryErr *Error
+	if errors.As(err, &registryErr) && registryErr.StatusCode == http.StatusNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error testing schema compatibility for %s: %w", subject, err)
+	}
+	return response.IsCompatible, nil
+}
+
+// SchemaURL returns the registry URL of the schema with the given ID
+func (c *Client) SchemaURL(id int) string {
+	return fmt.Sprintf("%s/schemas/ids/%d", c.baseURL, id)
+}
+
+// post sends a schema to the registry and decodes the response into out
+func (c *Client) post(ctx context.Context, path, schemaType, document string, out interface{}) error {
+	request := schemaRequest{Schema: document}
+	// AVRO is the registry default and older registries reject the field
+	if schemaType != schema.TypeAvro {
+		request.SchemaType = schemaType
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", contentType)
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck // Close errors on a read body are not actionable.
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		registryErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(registryErr); err != nil || registryErr.Message == "" {
+			registryErr.Code = resp.StatusCode
+			registryErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return registryErr
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// handlerTransport serves requests from an http.Handler in process
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorder := httptest.NewRecorder()
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	t.handler.ServeHTTP(recorder, req)
+	return recorder.Result(), nil
+}
+
+// Frame prefixes an encoded payload with the registry wire format header: a
+// magic byte and the big-endian schema ID, followed for Protobuf by the index
+// of the message within the schema, which is always the first one here.
+func Frame(schemaType string, schemaID int, payload []byte) []byte {
+	framed := make([]byte, 0, len(payload)+6)
+	framed = append(framed, wireFormatMagicByte)
+	framed = binary.BigEndian.AppendUint32(framed, uint32(schemaID))
+	if schemaType == schema.TypeProtobuf {
+		// A single zero stands for the message index path [0]
+		framed = append(framed, 0)
+	}
+	return append(framed, payload...)
+}
@@ -0,0 +1,74 @@
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/events/schema"
+)
+
+func TestClientWithStub(t *testing.T) {
+	server := httptest.NewServer(NewStub())
+	defer server.Close()
+
+	client := NewClient(config.SchemaRegistryConfig{URL: server.URL})
+	ctx := context.Background()
+
+	v1 := `{"type":"record","name":"R","fields":[{"name":"a","type":"string"}]}`
+	v2 := `{"type":"record","name":"R","fields":[{"name":"a","type":"string"},` +
+		`{"name":"b","type":["null","string"],"default":null}]}`
+	breaking := `{"type":"record","name":"R","fields":[{"name":"a","type":"int"}]}`
+
+	compatible, err := client.TestCompatibility(ctx, "topic-value", schema.TypeAvro, v1)
+	require.NoError(t, err)
+	assert.True(t, compatible)
+
+	id, err := client.Register(ctx, "topic-value", schema.TypeAvro, v1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	again, err := client.Register(ctx, "topic-value", schema.TypeAvro, v1)
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	compatible, err = client.TestCompatibility(ctx, "topic-value", schema.TypeAvro, breaking)
+	require.NoError(t, err)
+	assert.False(t, compatible)
+
+	_, err = client.Register(ctx, "topic-value", schema.TypeAvro, breaking)
+	var registryErr *Error
+	require.True(t, errors.As(err, &registryErr))
+	assert.Equal(t, http.StatusConflict, registryErr.StatusCode)
+
+	id, err = client.Register(ctx, "topic-value", schema.TypeAvro, v2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, id)
+
+	resp, err := http.Get(client.SchemaURL(id))
+	require.NoError(t, err)
+	defer resp.Body.Close() //nolint:errcheck // Test cleanup.
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMemoryClient(t *testing.T) {
+	client := NewClient(config.SchemaRegistryConfig{URL: MemoryURL})
+
+	definition, err := schema.Lookup(schema.CompanyV1, schema.EncodingProtobuf)
+	require.NoError(t, err)
+
+	id, err := client.Register(context.Background(), "company.created-"+schema.CompanyV1.Record, definition.Type, definition.Schema)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+}
+
+func TestFrame(t *testing.T) {
+	assert.Equal(t, []byte{0, 0, 0, 1, 2, 'x'}, Frame(schema.TypeAvro, 258, []byte("x")))
+	assert.Equal(t, []byte{0, 0, 0, 0, 7, 0, 'x'}, Frame(schema.TypeProtobuf, 7, []byte("x")))
+}
@@ -0,0 +1,218 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"xm-exercise/internal/events/schema"
+)
+
+// Registry error codes returned by the stub
+const (
+	codeSubjectNotFound     = 40401
+	codeSchemaNotFound      = 40403
+	codeIncompatibleSchema  = 409
+	codeInvalidSchema       = 42201
+	codeUnprocessableEntity = 422
+)
+
+// registeredSchema is a schema known to the stub
+type registeredSchema struct {
+	ID         int
+	SchemaType string
+	Schema     string
+}
+
+// Stub is an in-memory, Confluent-compatible schema registry. It supports
+// registering schemas, looking them up and testing compatibility, enforcing
+// BACKWARD compatibility with the latest version of each subject.
+type Stub struct {
+	mu       sync.Mutex
+	schemas  []registeredSchema
+	subjects map[string][]int
+	router   chi.Router
+}
+
+// NewStub creates an empty stub registry
+func NewStub() *Stub {
+	s := &Stub{subjects: map[string][]int{}}
+
+	r := chi.NewRouter()
+	r.Get("/subjects", s.listSubjects)
+	r.Post("/subjects/{subject}/versions", s.register)
+	r.Get("/subjects/{subject}/versions/latest", s.latest)
+	r.Post("/compatibility/subjects/{subject}/versions/latest", s.testCompatibility)
+	r.Get("/schemas/ids/{id}", s.schemaByID)
+	s.router = r
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *Stub) listSubjects(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	subjects := make([]string, 0, len(s.subjects))
+	for subject := range s.subjects {
+		subjects = append(subjects, subject)
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, subjects)
+}
+
+func (s *Stub) register(w http.ResponseWriter, r *http.Request) {
+	subject := chi.URLParam(r, "subject")
+	request, ok := decodeSchemaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.subjects[subject]
+	for _, id := range versions {
+		existing := s.schemas[id-1]
+		if existing.SchemaType == request.SchemaType && existing.Schema == request.Schema {
+			writeJSON(w, http.StatusOK, map[string]int{"id": id})
+			return
+		}
+	}
+
+	if len(versions) > 0 {
+		latest := s.schemas[versions[len(versions)-1]-1]
+		if err := compatible(latest, request); err != nil {
+			writeError(w, http.StatusConflict, codeIncompatibleSchema,
+				fmt.Sprintf("Schema being registered is incompatible with an earlier schema: %v", err))
+			return
+		}
+	}
+
+	id := len(s.schemas) + 1
+	s.schemas = append(s.schemas, registeredSchema{ID: id, SchemaType: request.SchemaType, Schema: request.Schema})
+	s.subjects[subject] = append(versions, id)
+
+	writeJSON(w, http.StatusOK, map[string]int{"id": id})
+}
+
+func (s *Stub) latest(w http.ResponseWriter, r *http.Request) {
+	subject := chi.URLParam(r, "subject")
+
+	s.mu.Lock()
+	versions := s.subjects[subject]
+	var latest registeredSchema
+	if len(versions) > 0 {
+		latest = s.schemas[versions[len(versions)-1]-1]
+	}
+	s.mu.Unlock()
+
+	if len(versions) == 0 {
+		writeError(w, http.StatusNotFound, codeSubjectNotFound, "Subject not found.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"subject":    subject,
+		"version":    len(versions),
+		"id":         latest.ID,
+		"schemaType": latest.SchemaType,
+		"schema":     latest.Schema,
+	})
+}
+
+func (s *Stub) testCompatibility(w http.ResponseWriter, r *http.Request) {
+	subject := chi.URLParam(r, "subject")
+	request, ok := decodeSchemaRequest(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	versions := s.subjects[subject]
+	var latest registeredSchema
+	if len(versions) > 0 {
+		latest = s.schemas[versions[len(versions)-1]-1]
+	}
+	s.mu.Unlock()
+
+	if len(versions) == 0 {
+		writeError(w, http.StatusNotFound, codeSubjectNotFound, "Subject not found.")
+		return
+	}
+
+	err := compatible(latest, request)
+	response := map[string]interface{}{"is_compatible": err == nil}
+	if err != nil {
+		response["messages"] = []string{err.Error()}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Stub) schemaByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+
+	s.mu.Lock()
+	found := err == nil && id > 0 && id <= len(s.schemas)
+	var registered registeredSchema
+	if found {
+		registered = s.schemas[id-1]
+	}
+	s.mu.Unlock()
+
+	if !found {
+		writeError(w, http.StatusNotFound, codeSchemaNotFound, "Schema not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"schemaType": registered.SchemaType,
+		"schema":     registered.Schema,
+	})
+}
+
+// compatible checks a requested schema against a registered one
+func compatible(registered registeredSchema, request schemaRequest) error {
+	if registered.SchemaType != request.SchemaType {
+		return fmt.Errorf("schema type changed from %s to %s", registered.SchemaType, request.SchemaType)
+	}
+	return schema.CheckCompatibility(request.SchemaType, registered.Schema, request.Schema)
+}
+
+// decodeSchemaRequest reads a schema request, writing an error response when it is invalid
+func decodeSchemaRequest(w http.ResponseWriter, r *http.Request) (schemaRequest, bool) {
+	var request schemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeUnprocessableEntity, "Invalid request body")
+		return request, false
+	}
+	if request.SchemaType == "" {
+		request.SchemaType = schema.TypeAvro
+	}
+	if request.Schema == "" {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidSchema, "Empty schema")
+		return request, false
+	}
+	return request, true
+}
+
+// writeJSON writes a registry response
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	//nolint:errcheck // A failed write means the client went away.
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a registry error response
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	writeJSON(w, status, Error{Code: code, Message: message})
+}
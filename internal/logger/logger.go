@@ -18,6 +18,12 @@ const (
 	RequestIDKey contextKey = "request_id"
 	// UserIDKey is the context key for the user ID
 	UserIDKey contextKey = "user_id"
+	// OrganizationIDKey is the context key for the organization (tenant) ID
+	OrganizationIDKey contextKey = "organization_id"
+	// TraceParentKey is the context key for the W3C traceparent of the request
+	TraceParentKey contextKey = "traceparent"
+	// TraceStateKey is the context key for the W3C tracestate of the request
+	TraceStateKey contextKey = "tracestate"
 )
 
 // Field creates a field for structured logging
@@ -79,6 +85,9 @@ func WithContext(ctx context.Context) *zap.Logger {
 	if userID, ok := ctx.Value(UserIDKey).(uuid.UUID); ok && userID != uuid.Nil {
 		logger = logger.With(zap.String("user_id", userID.String()))
 	}
+	if organizationID, ok := ctx.Value(OrganizationIDKey).(string); ok && organizationID != "" {
+		logger = logger.With(zap.String("organization_id", organizationID))
+	}
 	return logger
 }
 
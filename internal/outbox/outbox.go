@@ -0,0 +1,130 @@
+// Package outbox implements the transactional outbox pattern: events are stored
+// in the database together with the change they describe and relayed to the
+// message broker by a background worker.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/replay"
+	"xm-exercise/internal/webhook"
+	"xm-exercise/pkg/models"
+)
+
+// Producer implements events.KafkaProducerInterface by writing events to the outbox table
+type Producer struct {
+	repo    *db.OutboxRepository
+	encoder *events.Encoder
+}
+
+// NewProducer creates an outbox producer encoding with encoder and writing through the given repository
+func NewProducer(repo *db.OutboxRepository, encoder *events.Encoder) *Producer {
+	return &Producer{repo: repo, encoder: encoder}
+}
+
+// PublishCompanyCreated stores a company created event in the outbox
+func (p *Producer) PublishCompanyCreated(ctx context.Context, company models.Company) error {
+	message, err := p.encoder.CompanyCreated(ctx, company)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(ctx, message)
+}
+
+// PublishCompanyUpdated stores a company updated event in the outbox
+func (p *Producer) PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error {
+	message, err := p.encoder.CompanyUpdated(ctx, before, after)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(ctx, message)
+}
+
+// PublishCompanyDeleted stores a company deleted event in the outbox
+func (p *Producer) PublishCompanyDeleted(ctx context.Context, company *models.Company) error {
+	message, err := p.encoder.CompanyDeleted(ctx, company)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(ctx, message)
+}
+
+// enqueue stores an encoded event as a pending outbox message
+func (p *Producer) enqueue(ctx context.Context, message events.Message) error {
+	now := time.Now().UTC()
+	return p.repo.Add(ctx, &models.OutboxMessage{
+		ID:            uuid.New().String(),
+		Topic:         message.Topic,
+		Key:           message.Key,
+		EventType:     message.Type,
+		Headers:       message.Headers,
+		Payload:       message.Value,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	})
+}
+
+// Transactor runs company changes and their events in a single database transaction
+type Transactor struct {
+	transactions *db.TransactionManager
+	encoder      *events.Encoder
+}
+
+// NewTransactor creates a new transactor on the given database
+func NewTransactor(database *db.Database, encoder *events.Encoder) *Transactor {
+	return &Transactor{transactions: db.NewTransactionManager(database), encoder: encoder}
+}
+
+// WithinTransaction calls fn with a company repository and a producer bound
+// to the same transaction. The producer writes each event to the outbox and
+// the company event log and records its webhook deliveries. Nothing is persisted if fn returns an error.
+func (t *Transactor) WithinTransaction(
+	ctx context.Context,
+	fn func(companyRepo db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error,
+) error {
+	return t.transactions.Do(ctx, func(_ context.Context, repos *db.Repositories) error {
+		return fn(repos.Companies, fanOutProducer{
+			NewProducer(repos.Outbox, t.encoder),
+			replay.NewRecorder(repos.CompanyEvents),
+			webhook.NewRecorder(repos.Webhooks),
+		})
+	})
+}
+
+// fanOutProducer hands every event to each of its producers in turn
+type fanOutProducer []events.KafkaProducerInterface
+
+// PublishCompanyCreated records a company created event with every producer
+func (f fanOutProducer) PublishCompanyCreated(ctx context.Context, company models.Company) error {
+	for _, producer := range f {
+		if err := producer.PublishCompanyCreated(ctx, company); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishCompanyUpdated records a company updated event with every producer
+func (f fanOutProducer) PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error {
+	for _, producer := range f {
+		if err := producer.PublishCompanyUpdated(ctx, before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PublishCompanyDeleted records a company deleted event with every producer
+func (f fanOutProducer) PublishCompanyDeleted(ctx context.Context, company *models.Company) error {
+	for _, producer := range f {
+		if err := producer.PublishCompanyDeleted(ctx, company); err != nil {
+			return err
+		}
+	}
+	return nil
+}
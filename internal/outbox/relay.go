@@ -0,0 +1,262 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/utils"
+	"xm-exercise/pkg/models"
+)
+
+var (
+	publishedTotal = expvar.NewInt("outbox_published_total")
+	failedTotal    = expvar.NewInt("outbox_failed_total")
+	deadLettered   = expvar.NewInt("outbox_dead_lettered_total")
+	pendingGauge   = expvar.NewInt("outbox_pending")
+	lagGauge       = expvar.NewFloat("outbox_lag_seconds")
+)
+
+// Publisher delivers encoded events to the message broker
+type Publisher interface {
+	Publish(ctx context.Context, message events.Message) error
+}
+
+// AsyncPublisher is implemented by publishers that queue messages and report
+// each delivery later, letting the relay hand over a whole batch at once
+type AsyncPublisher interface {
+	PublishAsync(ctx context.Context, message events.Message) <-chan error
+}
+
+// RelayConfig controls how often and how aggressively the relay delivers messages
+type RelayConfig struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	PublishTimeout time.Duration
+	// MaxAttempts is the number of failed attempts after which a message is dead-lettered
+	MaxAttempts int
+	// Lease keeps claimed messages from other relays; it must exceed the time
+	// a batch takes to publish
+	Lease time.Duration
+}
+
+// Relay publishes pending outbox messages and marks them sent. It is the only
+// layer retrying failed messages, with exponential backoff, and dead-letters
+// the messages failing MaxAttempts times.
+type Relay struct {
+	database   *db.Database
+	publisher  Publisher
+	deadLetter Publisher
+	cfg        RelayConfig
+}
+
+// NewRelay creates a new outbox relay. deadLetter may be nil, in which case
+// failed messages are retried until they are published.
+func NewRelay(database *db.Database, publisher, deadLetter Publisher, cfg RelayConfig) *Relay {
+	return &Relay{
+		database:   database,
+		publisher:  publisher,
+		deadLetter: deadLetter,
+		cfg:        cfg,
+	}
+}
+
+// Run relays messages until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	logger.Info("Outbox relay started",
+		zap.Duration("poll_interval", r.cfg.PollInterval),
+		zap.Int("batch_size", r.cfg.BatchSize),
+	)
+
+	for {
+		for {
+			relayed, err := r.relayBatch(ctx)
+			if err != nil {
+				logger.Error("Failed to relay outbox batch", zap.Error(err))
+				break
+			}
+			if relayed < r.cfg.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+		r.updateGauges(ctx)
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Outbox relay stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayBatch publishes one batch of due messages and returns how many were claimed.
+// The messages are leased and the claim committed before publishing, so no
+// locks are held while the broker is slow.
+func (r *Relay) relayBatch(ctx context.Context) (int, error) {
+	// Shutting down stops publishing, but the outcome of the messages already
+	// published must still be stored
+	dbCtx := context.WithoutCancel(ctx)
+	repo := db.NewOutboxRepository(r.database)
+	messages, err := repo.ClaimPending(dbCtx, r.cfg.BatchSize, time.Now().UTC(), r.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	// A key stops at its first failure: its later messages stay pending
+	// behind the failed one, which keeps them from overtaking it
+	failedKeys := make(map[string]bool)
+	results := r.publish(ctx, messages)
+	var released []string
+	for i, message := range messages {
+		if i >= len(results) {
+			released = append(released, message.ID)
+			continue
+		}
+
+		if err := results[i]; err != nil {
+			// A message held back behind an earlier failure of its key, in
+			// this batch or still in the publisher's queue, was never sent
+			// and so is not an attempt
+			if failedKeys[message.Key] || errors.Is(err, events.ErrKeyBlocked) || ctx.Err() != nil {
+				failedKeys[message.Key] = true
+				released = append(released, message.ID)
+				continue
+			}
+			failedKeys[message.Key] = true
+			if err := r.recordFailure(ctx, repo, message, err); err != nil {
+				return len(messages), err
+			}
+			continue
+		}
+
+		publishedTotal.Add(1)
+		if err := repo.MarkSent(dbCtx, message.ID, time.Now().UTC()); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), repo.Release(dbCtx, released)
+}
+
+// recordFailure schedules the next attempt of a message that failed, or
+// dead-letters it once it has failed MaxAttempts times. A message that
+// cannot be dead-lettered is retried like any other.
+func (r *Relay) recordFailure(
+	ctx context.Context,
+	repo *db.OutboxRepository,
+	message models.OutboxMessage,
+	deliveryErr error,
+) error {
+	failedTotal.Add(1)
+	dbCtx := context.WithoutCancel(ctx)
+	attempts := message.Attempts + 1
+	fields := []zap.Field{
+		zap.Error(deliveryErr),
+		zap.String("outbox_id", message.ID),
+		zap.String("topic", message.Topic),
+		zap.String("key", message.Key),
+		zap.Int("attempts", attempts),
+	}
+
+	if r.deadLetter != nil && attempts >= r.cfg.MaxAttempts {
+		publishCtx, cancel := context.WithTimeout(ctx, r.cfg.PublishTimeout)
+		err := r.deadLetter.Publish(publishCtx, events.DeadLetterMessage(eventMessage(message), deliveryErr, attempts))
+		cancel()
+		if err == nil {
+			deadLettered.Add(1)
+			logger.Error("Outbox message dead-lettered", fields...)
+			return repo.MarkDeadLettered(dbCtx, message.ID, deliveryErr, time.Now().UTC())
+		}
+		fields = append(fields, zap.NamedError("dead_letter_error", err))
+	}
+
+	next := time.Now().UTC().Add(utils.Backoff(r.cfg.InitialBackoff, r.cfg.MaxBackoff, message.Attempts))
+	logger.Warn("Failed to publish outbox message", append(fields, zap.Time("next_attempt_at", next))...)
+	return repo.MarkFailed(dbCtx, message.ID, deliveryErr, next)
+}
+
+// publish delivers messages in order and returns the delivery results of the
+// leading messages attempted before ctx was cancelled. Asynchronous publishers
+// get the whole batch queued up front and share one PublishTimeout, and keep
+// a key's later messages from being sent once one of them fails; otherwise
+// they are not sent and fail with events.ErrKeyBlocked here.
+func (r *Relay) publish(ctx context.Context, messages []models.OutboxMessage) []error {
+	results := make([]error, 0, len(messages))
+
+	if async, ok := r.publisher.(AsyncPublisher); ok {
+		publishCtx, cancel := context.WithTimeout(ctx, r.cfg.PublishTimeout)
+		defer cancel()
+
+		pending := make([]<-chan error, 0, len(messages))
+		for _, message := range messages {
+			if ctx.Err() != nil {
+				break
+			}
+			pending = append(pending, async.PublishAsync(publishCtx, eventMessage(message)))
+		}
+		for _, result := range pending {
+			select {
+			case err := <-result:
+				results = append(results, err)
+			case <-publishCtx.Done():
+				results = append(results, publishCtx.Err())
+			}
+		}
+		return results
+	}
+
+	blocked := make(map[string]bool)
+	for _, message := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		if blocked[message.Key] {
+			results = append(results, events.ErrKeyBlocked)
+			continue
+		}
+		publishCtx, cancel := context.WithTimeout(ctx, r.cfg.PublishTimeout)
+		err := r.publisher.Publish(publishCtx, eventMessage(message))
+		cancel()
+		if err != nil {
+			blocked[message.Key] = true
+		}
+		results = append(results, err)
+	}
+	return results
+}
+
+// eventMessage converts an outbox message to the message published on the event bus
+func eventMessage(message models.OutboxMessage) events.Message {
+	return events.Message{
+		Topic:   message.Topic,
+		Key:     message.Key,
+		Type:    message.EventType,
+		Headers: message.Headers,
+		Value:   message.Payload,
+	}
+}
+
+// updateGauges refreshes the pending and lag metrics
+func (r *Relay) updateGauges(ctx context.Context) {
+	stats, err := db.NewOutboxRepository(r.database).Stats(ctx, time.Now().UTC())
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error("Failed to read outbox stats", zap.Error(err))
+		return
+	}
+	pendingGauge.Set(stats.Pending)
+	lagGauge.Set(stats.LagSeconds)
+}
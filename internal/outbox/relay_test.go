@@ -0,0 +1,349 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+// fakePublisher records published messages and fails while failures > 0
+type fakePublisher struct {
+	failures  int
+	published []events.Message
+}
+
+func (p *fakePublisher) Publish(_ context.Context, message events.Message) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, message)
+	return nil
+}
+
+// blockingPublisher is an asynchronous publisher holding back every message
+// behind an earlier failure of its key
+type blockingPublisher struct{}
+
+func (blockingPublisher) Publish(context.Context, events.Message) error {
+	return events.ErrKeyBlocked
+}
+
+func (blockingPublisher) PublishAsync(context.Context, events.Message) <-chan error {
+	result := make(chan error, 1)
+	result <- events.ErrKeyBlocked
+	return result
+}
+
+func TestTransactor_RollsBackEventsWithChange(t *testing.T) {
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	transactor := NewTransactor(database, encoder)
+	organizationID := uuid.New().String()
+
+	err = transactor.WithinTransaction(context.Background(), func(
+		companyRepo db.CompanyRepositoryInterface,
+		producer events.KafkaProducerInterface,
+	) error {
+		company := models.Company{ID: uuid.New().String(), Name: "Acme", EmployeeCount: 1, Type: models.TypeCorporation}
+		registered := true
+		company.Registered = &registered
+		require.NoError(t, companyRepo.ForOrganization(organizationID).Create(context.Background(), &company))
+		require.NoError(t, producer.PublishCompanyCreated(context.Background(), company))
+		return errors.New("abort")
+	})
+	assert.EqualError(t, err, "abort")
+
+	stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Zero(t, stats.Pending)
+}
+
+func TestRelay_RetriesUntilPublished(t *testing.T) {
+	require.NoError(t, logger.Init(zap.WarnLevel.String(), false))
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{
+		Format:      events.FormatCloudEvents,
+		ContentMode: events.ContentModeBinary,
+		Source:      "/test",
+	})
+	require.NoError(t, err)
+	producer := NewProducer(db.NewOutboxRepository(database), encoder)
+	company := &models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme"}
+	require.NoError(t, producer.PublishCompanyDeleted(context.Background(), company))
+
+	publisher := &fakePublisher{failures: 1}
+	relay := NewRelay(database, publisher, nil, RelayConfig{
+		PollInterval:   time.Millisecond,
+		BatchSize:      10,
+		InitialBackoff: time.Nanosecond,
+		MaxBackoff:     time.Nanosecond,
+		PublishTimeout: time.Second,
+		Lease:          time.Minute,
+	})
+
+	claimed, err := relay.relayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	assert.Empty(t, publisher.published)
+
+	stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Pending)
+	assert.Equal(t, int64(1), stats.Retrying)
+
+	time.Sleep(time.Millisecond)
+	claimed, err = relay.relayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, claimed)
+	require.Len(t, publisher.published, 1)
+	assert.Equal(t, events.EventCompanyDeleted, publisher.published[0].Topic)
+	assert.Equal(t, company.ID, publisher.published[0].Key)
+	assert.Equal(t, "company.deleted", publisher.published[0].Headers["ce_type"])
+
+	stats, err = db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Zero(t, stats.Pending)
+	assert.NotNil(t, stats.LastSentAt)
+}
+
+func TestRelay_KeepsKeysInOrder(t *testing.T) {
+	require.NoError(t, logger.Init(zap.WarnLevel.String(), false))
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	producer := NewProducer(db.NewOutboxRepository(database), encoder)
+
+	failing := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme"}
+	other := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Other"}
+	require.NoError(t, producer.PublishCompanyCreated(context.Background(), failing))
+	require.NoError(t, producer.PublishCompanyCreated(context.Background(), other))
+	require.NoError(t, producer.PublishCompanyDeleted(context.Background(), &failing))
+
+	publisher := &fakePublisher{failures: 1}
+	relay := NewRelay(database, publisher, nil, RelayConfig{
+		PollInterval:   time.Millisecond,
+		BatchSize:      10,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+		PublishTimeout: time.Second,
+		Lease:          time.Minute,
+	})
+
+	claimed, err := relay.relayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, claimed)
+	require.Len(t, publisher.published, 1, "the failed key's later message is held back")
+	assert.Equal(t, other.ID, publisher.published[0].Key)
+
+	claimed, err = relay.relayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, claimed, "a key is not claimed while its oldest message waits for a retry")
+
+	stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Pending)
+	assert.Equal(t, int64(1), stats.Retrying)
+}
+
+func TestRelay_ReleasesBlockedMessagesWithoutAttempts(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	producer := NewProducer(db.NewOutboxRepository(database), encoder)
+	company := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme"}
+	require.NoError(t, producer.PublishCompanyCreated(context.Background(), company))
+
+	relay := NewRelay(database, blockingPublisher{}, &fakePublisher{}, RelayConfig{
+		PollInterval:   time.Millisecond,
+		BatchSize:      10,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+		PublishTimeout: time.Second,
+		MaxAttempts:    1,
+		Lease:          time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		claimed, err := relay.relayBatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed, "a blocked message is released, not backed off")
+	}
+
+	var message models.OutboxMessage
+	require.NoError(t, database.First(&message).Error)
+	assert.Zero(t, message.Attempts)
+	assert.Nil(t, message.DeadLetteredAt)
+	assert.Nil(t, message.LockedUntil)
+}
+
+func TestRelay_DeadLettersAfterMaxAttempts(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	producer := NewProducer(db.NewOutboxRepository(database), encoder)
+	company := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme"}
+	require.NoError(t, producer.PublishCompanyCreated(context.Background(), company))
+
+	publisher := &fakePublisher{failures: 2}
+	deadLetter := &fakePublisher{}
+	relay := NewRelay(database, publisher, deadLetter, RelayConfig{
+		PollInterval:   time.Millisecond,
+		BatchSize:      10,
+		InitialBackoff: time.Nanosecond,
+		MaxBackoff:     time.Nanosecond,
+		PublishTimeout: time.Second,
+		MaxAttempts:    2,
+		Lease:          time.Minute,
+	})
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		time.Sleep(time.Millisecond)
+		claimed, err := relay.relayBatch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed, "attempt %d", attempt)
+	}
+	assert.Empty(t, publisher.published)
+	require.Len(t, deadLetter.published, 1)
+	assert.Equal(t, events.EventCompanyCreated, deadLetter.published[0].Headers[events.DeadLetterTopicHeader])
+	assert.Equal(t, "broker unavailable", deadLetter.published[0].Headers[events.DeadLetterErrorHeader])
+	assert.Equal(t, "2", deadLetter.published[0].Headers[events.DeadLetterAttemptsHeader])
+
+	stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Zero(t, stats.Pending, "a dead-lettered message is no longer pending")
+	assert.Equal(t, int64(1), stats.DeadLettered)
+	assert.Nil(t, stats.LastSentAt, "a dead-lettered message is not sent")
+
+	time.Sleep(time.Millisecond)
+	claimed, err := relay.relayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, claimed)
+}
+
+func TestOutboxRepository_LeasesClaimedMessages(t *testing.T) {
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	repo := db.NewOutboxRepository(database)
+	producer := NewProducer(repo, encoder)
+	company := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme"}
+	require.NoError(t, producer.PublishCompanyCreated(context.Background(), company))
+	require.NoError(t, producer.PublishCompanyDeleted(context.Background(), &company))
+
+	now := time.Now().UTC().Add(time.Second)
+	claimed, err := repo.ClaimPending(context.Background(), 10, now, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2, "the key's later message is claimed with its oldest")
+	require.NotNil(t, claimed[0].LockedUntil)
+
+	claimed, err = repo.ClaimPending(context.Background(), 10, now, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "leased messages are not claimed again")
+
+	claimed, err = repo.ClaimPending(context.Background(), 10, now.Add(time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 2, "messages are claimed again once their lease ended")
+
+	require.NoError(t, repo.Release(context.Background(), []string{claimed[0].ID, claimed[1].ID}))
+	claimed, err = repo.ClaimPending(context.Background(), 10, now.Add(time.Minute), time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 2, "released messages are claimed again")
+}
+
+func TestOutboxRepository_ClaimsKeysInInsertionOrder(t *testing.T) {
+	database := dbtest.NewSQLite(t)
+	repo := db.NewOutboxRepository(database)
+	createdAt := time.Now().UTC().Add(-time.Minute)
+	// The second writer's clock is behind, and the third matches the first
+	var ids []string
+	for _, skew := range []time.Duration{0, -time.Second, 0} {
+		message := models.OutboxMessage{
+			ID:            uuid.New().String(),
+			Topic:         events.EventCompanyUpdated,
+			Key:           "acme",
+			EventType:     events.EventCompanyUpdated,
+			Payload:       []byte("{}"),
+			CreatedAt:     createdAt.Add(skew),
+			NextAttemptAt: createdAt,
+		}
+		require.NoError(t, repo.Add(context.Background(), &message))
+		ids = append(ids, message.ID)
+	}
+
+	claimed, err := repo.ClaimPending(context.Background(), 1, time.Now().UTC(), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, ids[0], claimed[0].ID, "the key is claimed through the message inserted first")
+
+	require.NoError(t, repo.Release(context.Background(), []string{claimed[0].ID}))
+	claimed, err = repo.ClaimPending(context.Background(), 10, time.Now().UTC(), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+	for i, message := range claimed {
+		assert.Equal(t, ids[i], message.ID)
+		assert.Equal(t, int64(i+1), message.Sequence)
+	}
+}
+
+func TestRelay_QueuesBatchesOnAsyncPublishers(t *testing.T) {
+	require.NoError(t, logger.Init(zap.WarnLevel.String(), false))
+	database := dbtest.NewSQLite(t)
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	producer := NewProducer(db.NewOutboxRepository(database), encoder)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		company := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme"}
+		require.NoError(t, producer.PublishCompanyCreated(context.Background(), company))
+		ids = append(ids, company.ID)
+	}
+
+	backend := events.NewMemoryBus(10)
+	subscription := backend.Subscribe()
+	publisher := events.NewAsyncPublisher(backend, config.AsyncPublishConfig{
+		QueueSize: 10,
+		BatchSize: 10,
+		Linger:    10 * time.Millisecond,
+	})
+	defer publisher.Close() //nolint:errcheck // Test cleanup.
+
+	relay := NewRelay(database, publisher, nil, RelayConfig{
+		PollInterval:   time.Millisecond,
+		BatchSize:      10,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		PublishTimeout: time.Second,
+		Lease:          time.Minute,
+	})
+
+	claimed, err := relay.relayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, claimed)
+
+	for _, id := range ids {
+		message := <-subscription.C
+		assert.Equal(t, id, message.Key)
+	}
+
+	stats, err := db.NewOutboxRepository(database).Stats(context.Background(), time.Now().UTC())
+	require.NoError(t, err)
+	assert.Zero(t, stats.Pending)
+}
@@ -0,0 +1,183 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+// keptJobs is the number of replay jobs remembered, running ones included
+const keptJobs = 20
+
+var (
+	// ErrReplayRunning is returned when starting a replay while another one publishes
+	ErrReplayRunning = errors.New("a replay is already running")
+	// ErrJobNotFound is returned when no remembered replay job has the ID
+	ErrJobNotFound = errors.New("replay job not found")
+)
+
+// job is a replay running in the background
+type job struct {
+	state  models.ReplayJob
+	cancel context.CancelFunc
+}
+
+// Manager runs replays in the background and keeps track of their progress.
+// Only one replay publishes at a time; dry runs may run alongside it.
+type Manager struct {
+	replayer *Replayer
+	ctx      context.Context
+	stop     context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu sync.Mutex
+	// jobs holds the most recent jobs, oldest first
+	jobs []*job
+}
+
+// NewManager creates a manager running replays with replayer
+func NewManager(replayer *Replayer) *Manager {
+	ctx, stop := context.WithCancel(context.Background())
+	return &Manager{replayer: replayer, ctx: ctx, stop: stop}
+}
+
+// Start validates request and starts replaying it in the background
+func (m *Manager) Start(request models.ReplayRequest) (models.ReplayJob, error) {
+	if err := request.Validate(); err != nil {
+		return models.ReplayJob{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !request.DryRun {
+		for _, j := range m.jobs {
+			if j.state.Status == models.ReplayRunning && !j.state.Request.DryRun {
+				return models.ReplayJob{}, ErrReplayRunning
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		state: models.ReplayJob{
+			ID:        uuid.New().String(),
+			Request:   request,
+			Status:    models.ReplayRunning,
+			StartedAt: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+	m.jobs = append(m.jobs, j)
+	m.forget()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		m.run(ctx, j)
+	}()
+	return j.state, nil
+}
+
+// Get returns the replay job with the given ID
+func (m *Manager) Get(id string) (models.ReplayJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.state.ID == id {
+			return j.state, nil
+		}
+	}
+	return models.ReplayJob{}, ErrJobNotFound
+}
+
+// List returns the remembered replay jobs, newest first
+func (m *Manager) List() []models.ReplayJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := make([]models.ReplayJob, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, m.jobs[i].state)
+	}
+	return jobs
+}
+
+// Cancel stops the replay job with the given ID. The job reports the
+// cancellation once the event being published is done.
+func (m *Manager) Cancel(id string) (models.ReplayJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.state.ID == id {
+			j.cancel()
+			return j.state, nil
+		}
+	}
+	return models.ReplayJob{}, ErrJobNotFound
+}
+
+// Shutdown cancels the running replays and waits until they stop or ctx is done
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.wg.Wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run replays the request of j, recording its progress and outcome
+func (m *Manager) run(ctx context.Context, j *job) {
+	log := logger.WithContext(ctx).With(zap.String("replay_id", j.state.ID))
+
+	published, err := m.replayer.Run(ctx, j.state.ID, j.state.Request, func(published, total int64) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		j.state.Published = published
+		j.state.Total = total
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	finishedAt := time.Now().UTC()
+	j.state.Published = published
+	j.state.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		j.state.Status = models.ReplayCompleted
+		log.Info("Replay completed", zap.Int64("published", published))
+	case errors.Is(err, context.Canceled):
+		j.state.Status = models.ReplayCancelled
+		log.Warn("Replay cancelled", zap.Int64("published", published))
+	default:
+		j.state.Status = models.ReplayFailed
+		j.state.Error = err.Error()
+		log.Error("Replay failed", zap.Int64("published", published), zap.Error(err))
+	}
+}
+
+// forget drops the oldest finished jobs beyond keptJobs. It must be called
+// with the lock held.
+func (m *Manager) forget() {
+	for i := 0; len(m.jobs) > keptJobs && i < len(m.jobs); {
+		if m.jobs[i].state.Status == models.ReplayRunning {
+			i++
+			continue
+		}
+		m.jobs = append(m.jobs[:i], m.jobs[i+1:]...)
+	}
+}
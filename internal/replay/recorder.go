@@ -0,0 +1,61 @@
+// Package replay publishes company events again for downstream consumers that
+// lost them, either as snapshots of the current companies or from the company
+// event log.
+package replay
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/pkg/models"
+)
+
+// Recorder implements events.KafkaProducerInterface by appending every event
+// to the company event log
+type Recorder struct {
+	repo *db.CompanyEventRepository
+}
+
+// NewRecorder creates a recorder writing through the given repository
+func NewRecorder(repo *db.CompanyEventRepository) *Recorder {
+	return &Recorder{repo: repo}
+}
+
+// PublishCompanyCreated logs a company created event
+func (r *Recorder) PublishCompanyCreated(ctx context.Context, company models.Company) error {
+	return r.record(ctx, events.EventCompanyCreated, company, nil)
+}
+
+// PublishCompanyUpdated logs a company updated event with the state before the change
+func (r *Recorder) PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error {
+	previous := *before
+	return r.record(ctx, events.EventCompanyUpdated, *after, &previous)
+}
+
+// PublishCompanyDeleted logs a company deleted event
+func (r *Recorder) PublishCompanyDeleted(ctx context.Context, company *models.Company) error {
+	return r.record(ctx, events.EventCompanyDeleted, *company, nil)
+}
+
+// record appends an event about company to the log
+func (r *Recorder) record(
+	ctx context.Context,
+	eventType string,
+	company models.Company,
+	previous *models.Company,
+) error {
+	if err := r.repo.Add(ctx, &models.CompanyEvent{
+		EventType:      eventType,
+		OrganizationID: company.OrganizationID,
+		CompanyID:      company.ID,
+		Company:        company,
+		Previous:       previous,
+		OccurredAt:     time.Now().UTC(),
+	}); err != nil {
+		return fmt.Errorf("error logging company event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package replay
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+// fakePublisher records published messages
+type fakePublisher struct {
+	mu        sync.Mutex
+	published []events.Message
+}
+
+func (p *fakePublisher) Publish(_ context.Context, message events.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, message)
+	return nil
+}
+
+func (p *fakePublisher) Close() error {
+	return nil
+}
+
+func (p *fakePublisher) messages() []events.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]events.Message(nil), p.published...)
+}
+
+// messageTypes returns the event type and key of each message
+func messageTypes(messages []events.Message) [][2]string {
+	types := make([][2]string, len(messages))
+	for i, message := range messages {
+		types[i] = [2]string{message.Type, message.Key}
+	}
+	return types
+}
+
+// newTestReplayer returns a replayer publishing to the returned publisher
+func newTestReplayer(t *testing.T, database *db.Database, cfg config.ReplayConfig) (*Replayer, *fakePublisher) {
+	t.Helper()
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	publisher := &fakePublisher{}
+	return NewReplayer(database, events.NewProducer(publisher, encoder), cfg), publisher
+}
+
+// newCompany creates a company of the organization and logs its creation
+func newCompany(t *testing.T, database *db.Database, recorder *Recorder, organizationID, name string) *models.Company {
+	t.Helper()
+	registered := true
+	company := &models.Company{
+		ID:            uuid.New().String(),
+		Name:          name,
+		EmployeeCount: 10,
+		Registered:    &registered,
+		Type:          models.TypeCorporation,
+	}
+	companyRepo := db.NewCompanyRepository(database).ForOrganization(organizationID)
+	require.NoError(t, companyRepo.Create(context.Background(), company))
+	require.NoError(t, recorder.PublishCompanyCreated(context.Background(), *company))
+	return company
+}
+
+func TestReplayer(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	ctx := context.Background()
+	database := dbtest.NewSQLite(t)
+	recorder := NewRecorder(db.NewCompanyEventRepository(database))
+	organizationID := uuid.New().String()
+
+	acme := newCompany(t, database, recorder, organizationID, "Acme")
+	updated := *acme
+	updated.EmployeeCount = 20
+	require.NoError(t, db.NewCompanyRepository(database).ForOrganization(organizationID).Update(ctx, &updated))
+	require.NoError(t, recorder.PublishCompanyUpdated(ctx, acme, &updated))
+
+	globex := newCompany(t, database, recorder, organizationID, "Globex")
+	require.NoError(t, db.NewCompanyRepository(database).ForOrganization(organizationID).Delete(ctx, globex.ID))
+	require.NoError(t, recorder.PublishCompanyDeleted(ctx, globex))
+
+	other := newCompany(t, database, recorder, uuid.New().String(), "Initech")
+
+	t.Run("snapshot publishes the current companies", func(t *testing.T) {
+		replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1000, BatchSize: 1})
+
+		var progress [][2]int64
+		published, err := replayer.Run(ctx, "replay-1", models.ReplayRequest{Mode: models.ReplayModeSnapshot},
+			func(published, total int64) { progress = append(progress, [2]int64{published, total}) })
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), published)
+		assert.Equal(t, [][2]int64{{0, 2}, {1, 2}, {2, 2}, {2, 2}}, progress)
+
+		messages := publisher.messages()
+		assert.ElementsMatch(t, [][2]string{
+			{events.EventCompanyCreated, acme.ID},
+			{events.EventCompanyCreated, other.ID},
+		}, messageTypes(messages))
+		assert.Equal(t, "replay-1", messages[0].Headers[events.ReplayIDHeader])
+	})
+
+	t.Run("history publishes the logged events in order", func(t *testing.T) {
+		replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1000, BatchSize: 2})
+
+		published, err := replayer.Run(ctx, "replay-2", models.ReplayRequest{
+			Mode:           models.ReplayModeHistory,
+			OrganizationID: organizationID,
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), published)
+		assert.Equal(t, [][2]string{
+			{events.EventCompanyCreated, acme.ID},
+			{events.EventCompanyUpdated, acme.ID},
+			{events.EventCompanyCreated, globex.ID},
+			{events.EventCompanyDeleted, globex.ID},
+		}, messageTypes(publisher.messages()))
+	})
+
+	t.Run("history filters", func(t *testing.T) {
+		replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1000, BatchSize: 10})
+		future := time.Now().Add(time.Hour)
+
+		_, err := replayer.Run(ctx, "replay-3", models.ReplayRequest{
+			Mode:       models.ReplayModeHistory,
+			CompanyIDs: []string{acme.ID, other.ID},
+			EventTypes: []string{events.EventCompanyCreated},
+		}, nil)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, [][2]string{
+			{events.EventCompanyCreated, acme.ID},
+			{events.EventCompanyCreated, other.ID},
+		}, messageTypes(publisher.messages()))
+
+		published, err := replayer.Run(ctx, "replay-4", models.ReplayRequest{
+			Mode:  models.ReplayModeHistory,
+			Since: &future,
+		}, nil)
+		require.NoError(t, err)
+		assert.Zero(t, published)
+	})
+
+	t.Run("dry run publishes nothing", func(t *testing.T) {
+		replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1, BatchSize: 10})
+
+		published, err := replayer.Run(ctx, "replay-5", models.ReplayRequest{
+			Mode:   models.ReplayModeHistory,
+			DryRun: true,
+		}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), published)
+		assert.Empty(t, publisher.messages())
+	})
+
+	t.Run("paces events to the rate", func(t *testing.T) {
+		replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1000, BatchSize: 10})
+
+		start := time.Now()
+		_, err := replayer.Run(ctx, "replay-6", models.ReplayRequest{Mode: models.ReplayModeSnapshot, Rate: 20}, nil)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+		assert.Len(t, publisher.messages(), 2)
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1, BatchSize: 10})
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		published, err := replayer.Run(ctx, "replay-7", models.ReplayRequest{Mode: models.ReplayModeHistory}, nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Zero(t, published)
+		assert.Empty(t, publisher.messages())
+	})
+}
+
+func TestManager(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	database := dbtest.NewSQLite(t)
+	recorder := NewRecorder(db.NewCompanyEventRepository(database))
+	organizationID := uuid.New().String()
+	newCompany(t, database, recorder, organizationID, "Acme")
+	newCompany(t, database, recorder, organizationID, "Globex")
+
+	replayer, publisher := newTestReplayer(t, database, config.ReplayConfig{Rate: 1, BatchSize: 10})
+	manager := NewManager(replayer)
+	t.Cleanup(func() { _ = manager.Shutdown(context.Background()) })
+
+	_, err := manager.Start(models.ReplayRequest{Mode: "everything"})
+	assert.Error(t, err)
+
+	running, err := manager.Start(models.ReplayRequest{Mode: models.ReplayModeSnapshot})
+	require.NoError(t, err)
+	assert.Equal(t, models.ReplayRunning, running.Status)
+
+	_, err = manager.Start(models.ReplayRequest{Mode: models.ReplayModeHistory})
+	assert.ErrorIs(t, err, ErrReplayRunning)
+
+	dryRun, err := manager.Start(models.ReplayRequest{Mode: models.ReplayModeHistory, DryRun: true})
+	require.NoError(t, err, "dry runs run alongside")
+	require.Eventually(t, func() bool {
+		job, err := manager.Get(dryRun.ID)
+		return err == nil && job.Status == models.ReplayCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+	job, err := manager.Get(dryRun.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), job.Total)
+	assert.Equal(t, int64(2), job.Published)
+	assert.NotNil(t, job.FinishedAt)
+
+	_, err = manager.Cancel(running.ID)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		job, err := manager.Get(running.ID)
+		return err == nil && job.Status == models.ReplayCancelled
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Less(t, len(publisher.messages()), 2)
+
+	jobs := manager.List()
+	require.Len(t, jobs, 2)
+	assert.Equal(t, dryRun.ID, jobs[0].ID, "newest first")
+
+	_, err = manager.Get(uuid.New().String())
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
@@ -0,0 +1,190 @@
+package replay
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+var publishedTotal = expvar.NewInt("replay_published_total")
+
+// ProgressFunc receives the number of events published so far, or counted in
+// a dry run, and the number of matching events
+type ProgressFunc func(published, total int64)
+
+// Replayer publishes the events selected by replay requests
+type Replayer struct {
+	repo     *db.CompanyEventRepository
+	producer events.KafkaProducerInterface
+	cfg      config.ReplayConfig
+}
+
+// NewReplayer creates a replayer reading from database and publishing through producer
+func NewReplayer(database *db.Database, producer events.KafkaProducerInterface, cfg config.ReplayConfig) *Replayer {
+	return &Replayer{repo: db.NewCompanyEventRepository(database), producer: producer, cfg: cfg}
+}
+
+// Run publishes the events selected by request, paced to the request's rate,
+// and returns the number published. Every event carries the replay ID header
+// with id. progress, which may be nil, is called once the matching events are
+// counted and after every batch. Dry runs go through the same events without
+// publishing or pacing them.
+func (r *Replayer) Run(ctx context.Context, id string, request models.ReplayRequest, progress ProgressFunc) (int64, error) {
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+
+	rate := request.Rate
+	if rate == 0 {
+		rate = r.cfg.Rate
+	}
+	p := &pacer{dryRun: request.DryRun}
+	if interval := time.Second / time.Duration(rate); !request.DryRun && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		p.ticks = ticker.C
+	}
+
+	filter := db.ReplayFilter{
+		OrganizationID: request.OrganizationID,
+		CompanyIDs:     request.CompanyIDs,
+		EventTypes:     request.EventTypes,
+		Since:          request.Since,
+		Until:          request.Until,
+	}
+	ctx = events.WithReplay(ctx, id)
+	logger.WithContext(ctx).Info("Replay started",
+		zap.String("replay_id", id),
+		zap.String("mode", request.Mode),
+		zap.Int("rate", rate),
+		zap.Bool("dry_run", request.DryRun),
+	)
+
+	if request.Mode == models.ReplayModeHistory {
+		return r.history(ctx, filter, p, progress)
+	}
+	return r.snapshot(ctx, filter, p, progress)
+}
+
+// snapshot publishes a company created event per current company
+func (r *Replayer) snapshot(ctx context.Context, filter db.ReplayFilter, p *pacer, progress ProgressFunc) (int64, error) {
+	total, err := r.repo.CountCompanies(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error counting companies: %w", err)
+	}
+	progress(0, total)
+
+	var afterID string
+	for {
+		companies, err := r.repo.Companies(ctx, filter, afterID, r.cfg.BatchSize)
+		if err != nil {
+			return p.published, fmt.Errorf("error loading companies: %w", err)
+		}
+
+		for _, company := range companies {
+			if err := p.publish(ctx, func() error {
+				return r.producer.PublishCompanyCreated(ctx, company)
+			}); err != nil {
+				return p.published, fmt.Errorf("error publishing company %s: %w", company.ID, err)
+			}
+		}
+		progress(p.published, total)
+
+		if len(companies) < r.cfg.BatchSize {
+			return p.published, nil
+		}
+		afterID = companies[len(companies)-1].ID
+	}
+}
+
+// history publishes the logged events, up to the latest one when the replay started
+func (r *Replayer) history(ctx context.Context, filter db.ReplayFilter, p *pacer, progress ProgressFunc) (int64, error) {
+	untilSequence, err := r.repo.LastSequence(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the event log: %w", err)
+	}
+	total, err := r.repo.CountEvents(ctx, filter, untilSequence)
+	if err != nil {
+		return 0, fmt.Errorf("error counting logged events: %w", err)
+	}
+	progress(0, total)
+
+	var afterSequence uint64
+	for {
+		logged, err := r.repo.Events(ctx, filter, afterSequence, untilSequence, r.cfg.BatchSize)
+		if err != nil {
+			return p.published, fmt.Errorf("error loading logged events: %w", err)
+		}
+
+		for _, event := range logged {
+			if err := p.publish(ctx, func() error {
+				return r.publishLogged(ctx, event)
+			}); err != nil {
+				return p.published, fmt.Errorf("error publishing logged event %d: %w", event.Sequence, err)
+			}
+		}
+		progress(p.published, total)
+
+		if len(logged) < r.cfg.BatchSize {
+			return p.published, nil
+		}
+		afterSequence = logged[len(logged)-1].Sequence
+	}
+}
+
+// publishLogged publishes a logged event as it was originally published
+func (r *Replayer) publishLogged(ctx context.Context, event models.CompanyEvent) error {
+	switch event.EventType {
+	case events.EventCompanyCreated:
+		return r.producer.PublishCompanyCreated(ctx, event.Company)
+	case events.EventCompanyUpdated:
+		previous := event.Previous
+		if previous == nil {
+			previous = &event.Company
+		}
+		return r.producer.PublishCompanyUpdated(ctx, previous, &event.Company)
+	case events.EventCompanyDeleted:
+		return r.producer.PublishCompanyDeleted(ctx, &event.Company)
+	default:
+		return fmt.Errorf("unknown event type %q", event.EventType)
+	}
+}
+
+// pacer publishes events no faster than its ticks and counts them
+type pacer struct {
+	// ticks paces the events; unpaced when nil
+	ticks     <-chan time.Time
+	dryRun    bool
+	published int64
+}
+
+// publish waits for the next tick and calls fn, unless this is a dry run
+func (p *pacer) publish(ctx context.Context, fn func() error) error {
+	if p.ticks != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.ticks:
+		}
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !p.dryRun {
+		if err := fn(); err != nil {
+			return err
+		}
+		publishedTotal.Add(1)
+	}
+	p.published++
+	return nil
+}
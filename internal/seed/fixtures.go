@@ -0,0 +1,79 @@
+package seed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"xm-exercise/pkg/models"
+)
+
+// Fixtures are the users and companies to seed. Organizations are referred to
+// by name and created when missing.
+type Fixtures struct {
+	Users     []UserFixture    `json:"users"     yaml:"users"`
+	Companies []CompanyFixture `json:"companies" yaml:"companies"`
+}
+
+// UserFixture is a user to seed
+type UserFixture struct {
+	Name     string `json:"name"     yaml:"name"`
+	Email    string `json:"email"    yaml:"email"`
+	Password string `json:"password" yaml:"password"`
+	// Organization defaults to the user's name, as on registration
+	Organization string `json:"organization" yaml:"organization"`
+}
+
+// CompanyFixture is a company to seed
+type CompanyFixture struct {
+	// ID defaults to one derived from the organization and the name
+	ID            string             `json:"id"             yaml:"id"`
+	Organization  string             `json:"organization"   yaml:"organization"`
+	Name          string             `json:"name"           yaml:"name"`
+	Description   *string            `json:"description"    yaml:"description"`
+	EmployeeCount int                `json:"employee_count" yaml:"employee_count"`
+	Registered    *bool              `json:"registered"     yaml:"registered"`
+	Type          models.CompanyType `json:"type"           yaml:"type"`
+}
+
+// request returns the company as a creation request
+func (c CompanyFixture) request() models.CompanyCreateRequest {
+	return models.CompanyCreateRequest{
+		Name:          c.Name,
+		Description:   c.Description,
+		EmployeeCount: c.EmployeeCount,
+		Registered:    c.Registered,
+		Type:          c.Type,
+	}
+}
+
+// LoadFile reads fixtures from a .json, .yaml or .yml file, rejecting unknown fields
+func LoadFile(path string) (Fixtures, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, err
+	}
+
+	var fixtures Fixtures
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fixtures)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&fixtures)
+	default:
+		return Fixtures{}, fmt.Errorf("%s: unsupported fixture format, expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,94 @@
+package seed
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+
+	"xm-exercise/pkg/models"
+)
+
+// MaxGenerated bounds the companies generated at once, so that the generated
+// names fit the 15 characters companies are allowed
+const MaxGenerated = 100000
+
+var (
+	namePrefixes = []string{
+		"Acme", "Apex", "Atlas", "Blue", "Bright", "Cedar", "Civic", "Delta", "Echo", "Green",
+		"Iron", "North", "Nova", "Prime", "Silver", "Solar", "Swift", "Terra", "Urban", "Vista",
+	}
+	nameSuffixes = []string{
+		"Bakery", "Bank", "Capital", "Dynamics", "Energy", "Farms", "Foods", "Freight", "Health", "Labs",
+		"Logic", "Media", "Mills", "Motors", "Studio", "Systems", "Tools", "Trust", "Ventures", "Works",
+	}
+	sectors = []string{
+		"logistics", "renewable energy", "healthcare", "financial services", "agriculture",
+		"software", "retail", "manufacturing", "education", "hospitality",
+	}
+	cities = []string{
+		"London", "Limassol", "Berlin", "Madrid", "Athens", "Warsaw", "Lisbon", "Dublin", "Vienna", "Prague",
+	}
+	companyTypes = []models.CompanyType{
+		models.TypeCorporation, models.TypeNonProfit, models.TypeCooperative, models.TypeSoleProprietor,
+	}
+)
+
+// Generate returns count fake companies of the organization. The same seed
+// always gives the same companies, and the types take turns so that every
+// company type is represented.
+func Generate(organization string, count int, seed uint64) []CompanyFixture {
+	random := rand.New(rand.NewPCG(seed, seed))
+	taken := make(map[string]bool, count)
+
+	companies := make([]CompanyFixture, count)
+	for i := range companies {
+		companyType := companyTypes[i%len(companyTypes)]
+		suffix := nameSuffixes[random.IntN(len(nameSuffixes))]
+		name := namePrefixes[random.IntN(len(namePrefixes))] + " " + suffix
+		if taken[name] {
+			name = fmt.Sprintf("%s %d", suffix, i+1)
+		}
+		taken[name] = true
+
+		var description *string
+		if random.IntN(5) > 0 {
+			text := fmt.Sprintf("%s company based in %s, founded in %d.",
+				sectors[random.IntN(len(sectors))], cities[random.IntN(len(cities))], 1950+random.IntN(75))
+			text = strings.ToUpper(text[:1]) + text[1:]
+			description = &text
+		}
+
+		// Sole proprietors are rarely registered, corporations always are
+		registered := companyType == models.TypeCorporation || random.IntN(10) < 8
+		if companyType == models.TypeSoleProprietor {
+			registered = random.IntN(10) < 3
+		}
+
+		companies[i] = CompanyFixture{
+			Organization:  organization,
+			Name:          name,
+			Description:   description,
+			EmployeeCount: employees(random, companyType),
+			Registered:    &registered,
+			Type:          companyType,
+		}
+	}
+	return companies
+}
+
+// employees returns a head count typical of the company type, most companies
+// being small
+func employees(random *rand.Rand, companyType models.CompanyType) int {
+	low, high := 1.0, 10.0
+	switch companyType {
+	case models.TypeCorporation:
+		low, high = 50, 20000
+	case models.TypeNonProfit:
+		low, high = 3, 500
+	case models.TypeCooperative:
+		low, high = 5, 1000
+	}
+	// Uniform over the logarithm of the range
+	return int(math.Round(math.Exp(math.Log(low) + random.Float64()*(math.Log(high)-math.Log(low)))))
+}
@@ -0,0 +1,171 @@
+// Package seed fills a development database with users and companies, loaded
+// from fixture files or generated.
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/service"
+	"xm-exercise/pkg/models"
+)
+
+// namespace derives the IDs of seeded rows from their natural keys, so that
+// seeding again finds the rows it created before
+var namespace = uuid.MustParse("5b0b3c1e-6f0c-4d0a-9a57-3e8f2f7a2c41")
+
+// Result counts the rows a seeding created and those that already existed
+type Result struct {
+	Organizations     int
+	Users             int
+	ExistingUsers     int
+	Companies         int
+	ExistingCompanies int
+}
+
+// Seeder creates the users and companies of fixtures. Companies are created
+// through the company service, so they are announced like any other.
+type Seeder struct {
+	organizations *db.OrganizationRepository
+	users         *db.UserRepository
+	companies     *service.CompanyService
+	// organizationIDs caches the IDs of the organizations by name
+	organizationIDs map[string]string
+}
+
+// NewSeeder creates a seeder writing to database, and company changes and
+// their events through transactor
+func NewSeeder(database *db.Database, transactor service.Transactor) *Seeder {
+	return &Seeder{
+		organizations:   db.NewOrganizationRepository(database),
+		users:           db.NewUserRepository(database),
+		companies:       service.NewCompanyService(transactor),
+		organizationIDs: make(map[string]string),
+	}
+}
+
+// Seed creates the users and companies of fixtures and their organizations.
+// Users whose name or email and companies whose ID or name are taken are
+// left as they are, so seeding the same fixtures again changes nothing.
+func (s *Seeder) Seed(ctx context.Context, fixtures Fixtures) (Result, error) {
+	var result Result
+	for _, user := range fixtures.Users {
+		created, err := s.user(ctx, user, &result)
+		if err != nil {
+			return result, fmt.Errorf("user %q: %w", user.Email, err)
+		}
+		if created {
+			result.Users++
+		} else {
+			result.ExistingUsers++
+		}
+	}
+
+	for _, company := range fixtures.Companies {
+		created, err := s.company(ctx, company, &result)
+		if err != nil {
+			return result, fmt.Errorf("company %q: %w", company.Name, err)
+		}
+		if created {
+			result.Companies++
+		} else {
+			result.ExistingCompanies++
+		}
+	}
+	return result, nil
+}
+
+// user creates a user and its organization, reporting whether the user was new
+func (s *Seeder) user(ctx context.Context, fixture UserFixture, result *Result) (bool, error) {
+	if fixture.Organization == "" {
+		fixture.Organization = fixture.Name
+	}
+	registration := models.UserRegistration{
+		Name:         fixture.Name,
+		Email:        fixture.Email,
+		Password:     fixture.Password,
+		Organization: fixture.Organization,
+	}
+	if err := registration.Validate(); err != nil {
+		return false, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(fixture.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+
+	organizationID, err := s.organization(ctx, fixture.Organization, result)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC()
+	err = s.users.Create(ctx, models.User{
+		ID:             uuid.NewSHA1(namespace, []byte("user/"+fixture.Email)).String(),
+		OrganizationID: organizationID,
+		Name:           fixture.Name,
+		Email:          fixture.Email,
+		PasswordHash:   string(hashedPassword),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	})
+	if errors.Is(err, db.ErrConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// company creates a company and its organization, reporting whether the company was new
+func (s *Seeder) company(ctx context.Context, fixture CompanyFixture, result *Result) (bool, error) {
+	if fixture.Organization == "" {
+		return false, errors.New("organization is required")
+	}
+	organizationID, err := s.organization(ctx, fixture.Organization, result)
+	if err != nil {
+		return false, err
+	}
+
+	id := fixture.ID
+	if id == "" {
+		id = uuid.NewSHA1(namespace, []byte("company/"+organizationID+"/"+fixture.Name)).String()
+	}
+	_, err = s.companies.Create(ctx, organizationID, id, fixture.request())
+	if errors.Is(err, db.ErrConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// organization returns the ID of the named organization of the fixtures,
+// creating it when missing. Names are not unique, so the organization is found
+// by the ID derived from its name, never joining another of the same name.
+func (s *Seeder) organization(ctx context.Context, name string, result *Result) (string, error) {
+	if id, ok := s.organizationIDs[name]; ok {
+		return id, nil
+	}
+
+	id := uuid.NewSHA1(namespace, []byte("organization/"+name)).String()
+	organization, err := s.organizations.GetByID(ctx, id)
+	if errors.Is(err, db.ErrOrganizationNotFound) {
+		now := time.Now().UTC()
+		organization = &models.Organization{
+			ID:        id,
+			Name:      name,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err = s.organizations.Create(ctx, organization); err == nil {
+			result.Organizations++
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("organization %q: %w", name, err)
+	}
+	s.organizationIDs[name] = organization.ID
+	return organization.ID, nil
+}
@@ -0,0 +1,147 @@
+package seed_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/outbox"
+	"xm-exercise/internal/seed"
+	"xm-exercise/pkg/models"
+)
+
+// newTestSeeder returns a seeder writing to a fresh database
+func newTestSeeder(t *testing.T) (*seed.Seeder, *db.Database) {
+	t.Helper()
+	logger.Init(zap.FatalLevel.String(), false)
+	database := dbtest.NewSQLite(t)
+
+	encoder, err := events.NewEncoder(config.EventEncodingConfig{Format: events.FormatLegacy})
+	require.NoError(t, err)
+	return seed.NewSeeder(database, outbox.NewTransactor(database, encoder)), database
+}
+
+func count(t *testing.T, database *db.Database, model any) int64 {
+	t.Helper()
+	var n int64
+	require.NoError(t, database.Model(model).Count(&n).Error)
+	return n
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	yamlFixtures, err := seed.LoadFile(write("dev.yaml", `
+users:
+  - name: demo
+    email: demo@example.com
+    password: password123
+companies:
+  - organization: demo
+    name: Acme Corp
+    employee_count: 10
+    registered: true
+    type: Corporations
+`))
+	require.NoError(t, err)
+	require.Len(t, yamlFixtures.Users, 1)
+	require.Len(t, yamlFixtures.Companies, 1)
+	assert.Equal(t, "demo@example.com", yamlFixtures.Users[0].Email)
+	assert.Equal(t, models.TypeCorporation, yamlFixtures.Companies[0].Type)
+	assert.True(t, *yamlFixtures.Companies[0].Registered)
+
+	jsonFixtures, err := seed.LoadFile(write("dev.json",
+		`{"companies": [{"organization": "demo", "name": "Acme Corp", "employee_count": 10, "type": "NonProfit"}]}`))
+	require.NoError(t, err)
+	require.Len(t, jsonFixtures.Companies, 1)
+	assert.Equal(t, 10, jsonFixtures.Companies[0].EmployeeCount)
+
+	_, err = seed.LoadFile(write("typo.yaml", "companies:\n  - nmae: Acme Corp\n"))
+	assert.Error(t, err, "unknown YAML fields are rejected")
+	_, err = seed.LoadFile(write("typo.json", `{"company": []}`))
+	assert.Error(t, err, "unknown JSON fields are rejected")
+	_, err = seed.LoadFile(write("dev.toml", ""))
+	assert.ErrorContains(t, err, "unsupported fixture format")
+}
+
+func TestGenerate(t *testing.T) {
+	companies := seed.Generate("Demo", 500, 42)
+	require.Len(t, companies, 500)
+	assert.Equal(t, companies, seed.Generate("Demo", 500, 42), "the same seed generates the same companies")
+	assert.NotEqual(t, companies, seed.Generate("Demo", 500, 43))
+
+	names := make(map[string]bool)
+	types := make(map[models.CompanyType]int)
+	for _, company := range companies {
+		assert.False(t, names[company.Name], "duplicate name %q", company.Name)
+		names[company.Name] = true
+		types[company.Type]++
+		request := models.CompanyCreateRequest{
+			Name:          company.Name,
+			Description:   company.Description,
+			EmployeeCount: company.EmployeeCount,
+			Registered:    company.Registered,
+			Type:          company.Type,
+		}
+		assert.NoError(t, request.Validate(), "company %q", company.Name)
+	}
+	assert.Len(t, types, 4, "every company type is generated")
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	seeder, database := newTestSeeder(t)
+	description := "Leading provider of widgets."
+	registered := true
+	fixtures := seed.Fixtures{
+		Users: []seed.UserFixture{
+			{Name: "demo", Email: "demo@example.com", Password: "password123", Organization: "Demo"},
+			{Name: "other", Email: "other@example.com", Password: "password123"},
+		},
+		Companies: append([]seed.CompanyFixture{{
+			Organization:  "Demo",
+			Name:          "Acme Corp",
+			Description:   &description,
+			EmployeeCount: 120,
+			Registered:    &registered,
+			Type:          models.TypeCorporation,
+		}}, seed.Generate("Demo", 20, 1)...),
+	}
+
+	result, err := seeder.Seed(ctx, fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{Organizations: 2, Users: 2, Companies: 21}, result)
+	assert.EqualValues(t, 21, count(t, database, &models.Company{}))
+	assert.EqualValues(t, 21, count(t, database, &models.OutboxMessage{}), "seeded companies are announced")
+
+	result, err = seed.NewSeeder(database, nil).Seed(ctx, seed.Fixtures{Users: fixtures.Users})
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{ExistingUsers: 2}, result)
+	result, err = seeder.Seed(ctx, fixtures)
+	require.NoError(t, err)
+	assert.Equal(t, seed.Result{ExistingUsers: 2, ExistingCompanies: 21}, result, "seeding again changes nothing")
+	assert.EqualValues(t, 21, count(t, database, &models.Company{}))
+
+	_, err = seeder.Seed(ctx, seed.Fixtures{Companies: []seed.CompanyFixture{{Name: "Orphan"}}})
+	assert.ErrorContains(t, err, "organization is required")
+
+	require.NoError(t, database.Wipe(ctx))
+	for _, model := range []any{&models.Organization{}, &models.User{}, &models.Company{}, &models.OutboxMessage{}} {
+		assert.Zero(t, count(t, database, model), "%T is wiped", model)
+	}
+}
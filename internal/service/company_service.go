@@ -0,0 +1,220 @@
+// Package service holds the company changes shared by the HTTP API and the
+// inbound Kafka consumer, so both apply the same validation and record the
+// same events.
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/pkg/models"
+)
+
+// ErrNameExists is returned when another company of the organization has the
+// name. The unique index decides, so concurrent changes cannot both take a name.
+var ErrNameExists = db.ErrCompanyNameExists
+
+// ValidationError reports a request failing validation
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Transactor runs a company change and the events describing it atomically
+type Transactor interface {
+	WithinTransaction(
+		ctx context.Context,
+		fn func(companyRepo db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error,
+	) error
+}
+
+// CompanyService creates, updates and deletes companies, recording an event
+// for every change in the same transaction
+type CompanyService struct {
+	transactor Transactor
+}
+
+// NewCompanyService creates a new company service
+func NewCompanyService(transactor Transactor) *CompanyService {
+	return &CompanyService{transactor: transactor}
+}
+
+// Create validates req and creates the company in the organization. An empty
+// id generates a new one.
+func (s *CompanyService) Create(
+	ctx context.Context,
+	organizationID, id string,
+	req models.CompanyCreateRequest,
+) (*models.Company, error) {
+	if err := req.Validate(); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+
+	if id == "" {
+		id = uuid.New().String()
+	}
+	now := time.Now().UTC()
+	company := models.Company{
+		ID:             id,
+		OrganizationID: organizationID,
+		Name:           req.Name,
+		Description:    req.Description,
+		EmployeeCount:  req.EmployeeCount,
+		Registered:     req.Registered,
+		Type:           req.Type,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	err := s.transactor.WithinTransaction(ctx, func(
+		companyRepo db.CompanyRepositoryInterface,
+		producer events.KafkaProducerInterface,
+	) error {
+		companyRepo = companyRepo.ForOrganization(organizationID)
+
+		if err := companyRepo.Create(ctx, &company); err != nil {
+			return fmt.Errorf("error creating company: %w", err)
+		}
+
+		if err := producer.PublishCompanyCreated(ctx, company); err != nil {
+			return fmt.Errorf("error recording company created event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &company, nil
+}
+
+// Update validates updates and applies them to the company of the
+// organization with the ID, returning the company as updated. It reports
+// whether anything changed; unchanged companies are neither written nor
+// announced. The company is read and locked inside the transaction and only
+// the changed fields are written, so concurrent updates do not undo each other.
+func (s *CompanyService) Update(
+	ctx context.Context,
+	organizationID, id string,
+	updates models.CompanyUpdateRequest,
+) (*models.Company, bool, error) {
+	if err := updates.Validate(); err != nil {
+		return nil, false, &ValidationError{Err: err}
+	}
+
+	var company *models.Company
+	changed := false
+	err := s.transactor.WithinTransaction(ctx, func(
+		companyRepo db.CompanyRepositoryInterface,
+		producer events.KafkaProducerInterface,
+	) error {
+		companyRepo = companyRepo.ForOrganization(organizationID)
+
+		var err error
+		company, err = companyRepo.GetForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		previous := *company
+		if updates.Name != nil {
+			company.Name = *updates.Name
+		}
+		if updates.Description != nil {
+			company.Description = updates.Description
+		}
+		if updates.EmployeeCount != nil {
+			company.EmployeeCount = *updates.EmployeeCount
+		}
+		if updates.Registered != nil {
+			company.Registered = updates.Registered
+		}
+		if updates.Type != "" {
+			company.Type = updates.Type
+		}
+
+		fields := company.ChangedFields(&previous)
+		if len(fields) == 0 {
+			return nil
+		}
+		company.UpdatedAt = time.Now().UTC()
+
+		if err := companyRepo.Update(ctx, changes(company, fields)); err != nil {
+			return fmt.Errorf("error updating company: %w", err)
+		}
+
+		if err := producer.PublishCompanyUpdated(ctx, &previous, company); err != nil {
+			return fmt.Errorf("error recording company updated event: %w", err)
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return company, changed, nil
+}
+
+// Delete deletes the company of the organization with the ID, returning it
+// as it was when deleted
+func (s *CompanyService) Delete(ctx context.Context, organizationID, id string) (*models.Company, error) {
+	var company *models.Company
+	err := s.transactor.WithinTransaction(ctx, func(
+		companyRepo db.CompanyRepositoryInterface,
+		producer events.KafkaProducerInterface,
+	) error {
+		companyRepo = companyRepo.ForOrganization(organizationID)
+
+		var err error
+		company, err = companyRepo.GetForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := companyRepo.Delete(ctx, id); err != nil {
+			return fmt.Errorf("error deleting company: %w", err)
+		}
+
+		if err := producer.PublishCompanyDeleted(ctx, company); err != nil {
+			return fmt.Errorf("error recording company deleted event: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return company, nil
+}
+
+// changes returns a company holding only the given fields of company, named
+// as by models.Company.ChangedFields, and its ID and UpdatedAt. Repositories
+// write the non-zero fields of an update, so the other fields are left alone.
+func changes(company *models.Company, fields []string) *models.Company {
+	update := &models.Company{ID: company.ID, UpdatedAt: company.UpdatedAt}
+	for _, field := range fields {
+		switch field {
+		case "name":
+			update.Name = company.Name
+		case "description":
+			update.Description = company.Description
+		case "employee_count":
+			update.EmployeeCount = company.EmployeeCount
+		case "registered":
+			update.Registered = company.Registered
+		case "type":
+			update.Type = company.Type
+		}
+	}
+	return update
+}
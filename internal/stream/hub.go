@@ -0,0 +1,203 @@
+// Package stream fans committed company changes out to live subscribers, such
+// as Server-Sent Events and WebSocket clients, keeping a bounded buffer of
+// recent events so reconnecting clients can resume where they left off.
+package stream
+
+import (
+	"errors"
+	"expvar"
+	"slices"
+	"sync"
+	"time"
+
+	"xm-exercise/internal/webhook"
+)
+
+var (
+	eventsTotal      = expvar.NewInt("stream_events_total")
+	subscribersGauge = expvar.NewInt("stream_subscribers")
+	laggedTotal      = expvar.NewInt("stream_lagged_total")
+)
+
+// ResetEventType tells a resuming subscriber that events were missed, either
+// because they left the buffer or because the server restarted, and that it
+// should reload the state it shows
+const ResetEventType = "stream.reset"
+
+// ErrClosed is returned when subscribing to a closed hub
+var ErrClosed = errors.New("stream closed")
+
+// Event is a committed company change. ID is assigned by the hub and
+// increases by one per event.
+type Event struct {
+	ID             uint64               `json:"id,string,omitempty"`
+	Type           string               `json:"type"`
+	OrganizationID string               `json:"organization_id,omitempty"`
+	CompanyID      string               `json:"company_id,omitempty"`
+	OccurredAt     time.Time            `json:"occurred_at"`
+	Data           *webhook.PayloadData `json:"data,omitempty"`
+}
+
+// Filter selects the events of a subscription. Empty CompanyIDs or Types
+// match every company or type.
+type Filter struct {
+	OrganizationID string
+	CompanyIDs     []string
+	Types          []string
+}
+
+// Matches reports whether event passes the filter
+func (f Filter) Matches(event Event) bool {
+	if event.OrganizationID != f.OrganizationID {
+		return false
+	}
+	if len(f.CompanyIDs) > 0 && !slices.Contains(f.CompanyIDs, event.CompanyID) {
+		return false
+	}
+	return len(f.Types) == 0 || slices.Contains(f.Types, event.Type)
+}
+
+// Subscription receives the events matching its filter
+type Subscription struct {
+	hub    *Hub
+	filter Filter
+	events chan Event
+}
+
+// Events returns the live events. The channel is closed when the hub closes
+// or when the subscriber falls too far behind; either way the client should
+// reconnect with the ID of the last event it received.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub assigns IDs to published events, keeps the most recent ones and
+// delivers them to subscribers
+type Hub struct {
+	mu sync.Mutex
+	// buffer is a ring of the latest events, the oldest at start
+	buffer           []Event
+	start            int
+	size             int
+	nextID           uint64
+	subscriberBuffer int
+	subscribers      map[*Subscription]struct{}
+	closed           bool
+}
+
+// NewHub creates a hub keeping bufferSize events and queueing up to
+// subscriberBuffer events per subscriber. IDs start at the current time in
+// microseconds, so IDs issued before a restart are older than any issued
+// after it.
+func NewHub(bufferSize, subscriberBuffer int) *Hub {
+	return &Hub{
+		buffer:           make([]Event, bufferSize),
+		nextID:           uint64(time.Now().UnixMicro()),
+		subscriberBuffer: subscriberBuffer,
+		subscribers:      make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns IDs to events, buffers them and sends them to matching
+// subscribers. Subscribers whose queue is full are disconnected rather than
+// holding up the others.
+func (h *Hub) Publish(events ...Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+
+	for _, event := range events {
+		event.ID = h.nextID
+		h.nextID++
+		h.buffer[(h.start+h.size)%len(h.buffer)] = event
+		if h.size < len(h.buffer) {
+			h.size++
+		} else {
+			h.start = (h.start + 1) % len(h.buffer)
+		}
+		eventsTotal.Add(1)
+
+		for subscription := range h.subscribers {
+			if !subscription.filter.Matches(event) {
+				continue
+			}
+			select {
+			case subscription.events <- event:
+			default:
+				laggedTotal.Add(1)
+				h.remove(subscription)
+			}
+		}
+	}
+}
+
+// Subscribe starts a subscription. When lastEventID is not zero it also
+// returns the buffered events after it that match filter, preceded by a
+// reset event when events after lastEventID are no longer buffered.
+func (h *Hub) Subscribe(filter Filter, lastEventID uint64) ([]Event, *Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, nil, ErrClosed
+	}
+
+	var replay []Event
+	if lastEventID != 0 {
+		oldestID := h.nextID - uint64(h.size)
+		first := 0
+		switch {
+		case lastEventID >= h.nextID:
+			// An ID this hub never issued
+			first = h.size
+			replay = append(replay, Event{Type: ResetEventType, OccurredAt: time.Now().UTC()})
+		case lastEventID+1 < oldestID:
+			replay = append(replay, Event{Type: ResetEventType, OccurredAt: time.Now().UTC()})
+		default:
+			first = int(lastEventID + 1 - oldestID)
+		}
+		for i := first; i < h.size; i++ {
+			event := h.buffer[(h.start+i)%len(h.buffer)]
+			if filter.Matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	subscription := &Subscription{
+		hub:    h,
+		filter: filter,
+		events: make(chan Event, h.subscriberBuffer),
+	}
+	h.subscribers[subscription] = struct{}{}
+	subscribersGauge.Add(1)
+	return replay, subscription, nil
+}
+
+// Close ends every subscription and rejects new ones
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for subscription := range h.subscribers {
+		h.remove(subscription)
+	}
+}
+
+// remove ends a subscription. The caller must hold mu.
+func (h *Hub) remove(subscription *Subscription) {
+	if _, ok := h.subscribers[subscription]; !ok {
+		return
+	}
+	delete(h.subscribers, subscription)
+	close(subscription.events)
+	subscribersGauge.Add(-1)
+}
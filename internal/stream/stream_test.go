@@ -0,0 +1,200 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/pkg/models"
+)
+
+func companyEvent(organizationID, companyID, eventType string) Event {
+	return Event{Type: eventType, OrganizationID: organizationID, CompanyID: companyID}
+}
+
+func eventIDs(events []Event) []uint64 {
+	ids := make([]uint64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestHub(t *testing.T) {
+	organizationID := uuid.New().String()
+	companyID := uuid.New().String()
+	filter := Filter{OrganizationID: organizationID}
+
+	t.Run("delivers matching events to subscribers", func(t *testing.T) {
+		hub := NewHub(10, 10)
+		_, all, err := hub.Subscribe(filter, 0)
+		require.NoError(t, err)
+		_, deletes, err := hub.Subscribe(Filter{
+			OrganizationID: organizationID,
+			CompanyIDs:     []string{companyID},
+			Types:          []string{events.EventCompanyDeleted},
+		}, 0)
+		require.NoError(t, err)
+
+		hub.Publish(
+			companyEvent(organizationID, companyID, events.EventCompanyCreated),
+			companyEvent(uuid.New().String(), companyID, events.EventCompanyDeleted),
+			companyEvent(organizationID, uuid.New().String(), events.EventCompanyDeleted),
+			companyEvent(organizationID, companyID, events.EventCompanyDeleted),
+		)
+
+		require.Len(t, all.Events(), 3)
+		first := <-all.Events()
+		assert.Equal(t, events.EventCompanyCreated, first.Type)
+		assert.NotZero(t, first.ID)
+		require.Len(t, deletes.Events(), 1)
+		deleted := <-deletes.Events()
+		assert.Equal(t, first.ID+3, deleted.ID, "IDs are consecutive across organizations")
+	})
+
+	t.Run("replays events after the last event ID", func(t *testing.T) {
+		hub := NewHub(10, 10)
+		for i := 0; i < 4; i++ {
+			hub.Publish(companyEvent(organizationID, companyID, events.EventCompanyUpdated))
+		}
+		replay, _, err := hub.Subscribe(filter, 1)
+		require.NoError(t, err)
+		require.Len(t, replay, 5, "an unknown old ID resets and replays the buffer")
+		assert.Equal(t, ResetEventType, replay[0].Type)
+		first := replay[1].ID
+
+		replay, _, err = hub.Subscribe(filter, first+1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{first + 2, first + 3}, eventIDs(replay))
+
+		replay, _, err = hub.Subscribe(filter, first+3)
+		require.NoError(t, err)
+		assert.Empty(t, replay)
+
+		replay, _, err = hub.Subscribe(filter, first+10)
+		require.NoError(t, err)
+		require.Len(t, replay, 1, "an ID from the future resets without replaying")
+		assert.Equal(t, ResetEventType, replay[0].Type)
+	})
+
+	t.Run("resets when events left the buffer", func(t *testing.T) {
+		hub := NewHub(3, 10)
+		_, subscription, err := hub.Subscribe(filter, 0)
+		require.NoError(t, err)
+		for i := 0; i < 5; i++ {
+			hub.Publish(companyEvent(organizationID, companyID, events.EventCompanyUpdated))
+		}
+		first := (<-subscription.Events()).ID
+
+		replay, _, err := hub.Subscribe(filter, first)
+		require.NoError(t, err)
+		assert.Equal(t, ResetEventType, replay[0].Type)
+		assert.Equal(t, []uint64{first + 2, first + 3, first + 4}, eventIDs(replay[1:]))
+
+		replay, _, err = hub.Subscribe(filter, first+1)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{first + 2, first + 3, first + 4}, eventIDs(replay))
+	})
+
+	t.Run("disconnects subscribers that fall behind", func(t *testing.T) {
+		hub := NewHub(10, 2)
+		_, slow, err := hub.Subscribe(filter, 0)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			hub.Publish(companyEvent(organizationID, companyID, events.EventCompanyUpdated))
+		}
+
+		var received int
+		for range slow.Events() {
+			received++
+		}
+		assert.Equal(t, 2, received)
+	})
+
+	t.Run("close ends subscriptions", func(t *testing.T) {
+		hub := NewHub(10, 10)
+		_, subscription, err := hub.Subscribe(filter, 0)
+		require.NoError(t, err)
+		hub.Close()
+
+		_, ok := <-subscription.Events()
+		assert.False(t, ok)
+		subscription.Close()
+		_, _, err = hub.Subscribe(filter, 0)
+		assert.ErrorIs(t, err, ErrClosed)
+	})
+}
+
+// nopProducer accepts every event
+type nopProducer struct{}
+
+func (nopProducer) PublishCompanyCreated(context.Context, models.Company) error {
+	return nil
+}
+
+func (nopProducer) PublishCompanyUpdated(context.Context, *models.Company, *models.Company) error {
+	return nil
+}
+
+func (nopProducer) PublishCompanyDeleted(context.Context, *models.Company) error {
+	return nil
+}
+
+// fakeTransactor runs fn and then fails the commit with err, if set
+type fakeTransactor struct {
+	err error
+}
+
+func (f fakeTransactor) WithinTransaction(
+	_ context.Context,
+	fn func(companyRepo db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error,
+) error {
+	if err := fn(nil, nopProducer{}); err != nil {
+		return err
+	}
+	return f.err
+}
+
+func TestTransactor(t *testing.T) {
+	ctx := context.Background()
+	before := models.Company{ID: uuid.New().String(), OrganizationID: uuid.New().String(), Name: "Acme", EmployeeCount: 10}
+	after := before
+	after.EmployeeCount = 20
+
+	t.Run("publishes committed changes", func(t *testing.T) {
+		var batch Batch
+		err := NewTransactor(fakeTransactor{}, &batch).WithinTransaction(ctx,
+			func(_ db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error {
+				require.NoError(t, producer.PublishCompanyCreated(ctx, before))
+				return producer.PublishCompanyUpdated(ctx, &before, &after)
+			})
+		require.NoError(t, err)
+
+		require.Len(t, batch, 2)
+		assert.Equal(t, events.EventCompanyCreated, batch[0].Type)
+		assert.Equal(t, before.ID, batch[0].CompanyID)
+		assert.Equal(t, before.OrganizationID, batch[0].OrganizationID)
+		updated := batch[1]
+		assert.Equal(t, events.EventCompanyUpdated, updated.Type)
+		assert.Equal(t, 20, updated.Data.Company.EmployeeCount)
+		assert.Equal(t, 10, updated.Data.Previous.EmployeeCount)
+		assert.Equal(t, []string{"employee_count"}, updated.Data.ChangedFields)
+	})
+
+	t.Run("drops the changes of failed transactions", func(t *testing.T) {
+		var batch Batch
+		failure := errors.New("commit failed")
+		err := NewTransactor(fakeTransactor{err: failure}, &batch).WithinTransaction(ctx,
+			func(_ db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error {
+				return producer.PublishCompanyDeleted(ctx, &before)
+			})
+		assert.ErrorIs(t, err, failure)
+		assert.Empty(t, batch)
+	})
+}
@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"context"
+	"time"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/service"
+	"xm-exercise/internal/webhook"
+	"xm-exercise/pkg/models"
+)
+
+// Publisher receives the events of committed transactions
+type Publisher interface {
+	Publish(events ...Event)
+}
+
+// Batch collects events to publish them once an enclosing transaction commits
+type Batch []Event
+
+// Publish appends events to the batch
+func (b *Batch) Publish(events ...Event) {
+	*b = append(*b, events...)
+}
+
+// Transactor wraps a service.Transactor, handing the company changes of each
+// successful transaction to a publisher once it has committed
+type Transactor struct {
+	next      service.Transactor
+	publisher Publisher
+}
+
+// NewTransactor creates a transactor publishing the changes made through next
+func NewTransactor(next service.Transactor, publisher Publisher) *Transactor {
+	return &Transactor{next: next, publisher: publisher}
+}
+
+// WithinTransaction calls fn through the wrapped transactor and publishes the
+// recorded changes if it succeeds
+func (t *Transactor) WithinTransaction(
+	ctx context.Context,
+	fn func(companyRepo db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error,
+) error {
+	var recorded []Event
+	err := t.next.WithinTransaction(ctx, func(companyRepo db.CompanyRepositoryInterface, producer events.KafkaProducerInterface) error {
+		recorded = nil
+		return fn(companyRepo, &recorder{next: producer, events: &recorded})
+	})
+	if err != nil {
+		return err
+	}
+	if len(recorded) > 0 {
+		t.publisher.Publish(recorded...)
+	}
+	return nil
+}
+
+// recorder implements events.KafkaProducerInterface by keeping each event the
+// wrapped producer accepted
+type recorder struct {
+	next   events.KafkaProducerInterface
+	events *[]Event
+}
+
+// PublishCompanyCreated records a company created event
+func (r *recorder) PublishCompanyCreated(ctx context.Context, company models.Company) error {
+	if err := r.next.PublishCompanyCreated(ctx, company); err != nil {
+		return err
+	}
+	r.record(events.EventCompanyCreated, &company, &webhook.PayloadData{Company: company.ToResponse()})
+	return nil
+}
+
+// PublishCompanyUpdated records a company updated event
+func (r *recorder) PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error {
+	if err := r.next.PublishCompanyUpdated(ctx, before, after); err != nil {
+		return err
+	}
+	r.record(events.EventCompanyUpdated, after, &webhook.PayloadData{
+		Company:       after.ToResponse(),
+		Previous:      before.ToResponse(),
+		ChangedFields: after.ChangedFields(before),
+	})
+	return nil
+}
+
+// PublishCompanyDeleted records a company deleted event
+func (r *recorder) PublishCompanyDeleted(ctx context.Context, company *models.Company) error {
+	if err := r.next.PublishCompanyDeleted(ctx, company); err != nil {
+		return err
+	}
+	r.record(events.EventCompanyDeleted, company, &webhook.PayloadData{Company: company.ToResponse()})
+	return nil
+}
+
+// record keeps an event describing a change of company
+func (r *recorder) record(eventType string, company *models.Company, data *webhook.PayloadData) {
+	*r.events = append(*r.events, Event{
+		Type:           eventType,
+		OrganizationID: company.OrganizationID,
+		CompanyID:      company.ID,
+		OccurredAt:     time.Now().UTC(),
+		Data:           data,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // GetEnv gets an environment variable or returns a default value
@@ -52,3 +53,20 @@ func GenerateRandomString(n int) string {
 
 	return sb.String()
 }
+
+// Backoff returns the delay before retry number retries+1: initial doubled
+// per earlier retry, capped at maxDelay unless that is 0, plus up to 20%
+// random jitter so that clients retrying together drift apart
+func Backoff(initial, maxDelay time.Duration, retries int) time.Duration {
+	delay := initial
+	for i := 0; i < retries && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+
+	//nolint:gosec // Jitter does not need a cryptographically secure source.
+	jitter := time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return delay + jitter
+}
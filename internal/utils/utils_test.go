@@ -3,6 +3,7 @@ package utils
 import (
 	"net/http"
 	"testing"
+	"time"
 )
 
 func TestExtractIDFromPath(t *testing.T) {
@@ -53,3 +54,26 @@ func TestExtractIDFromPath(t *testing.T) {
 		})
 	}
 }
+
+func TestBackoff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		maxDelay time.Duration
+		retries  int
+		expected time.Duration
+	}{
+		{name: "First attempt", maxDelay: time.Second, retries: 0, expected: 100 * time.Millisecond},
+		{name: "Doubled per retry", maxDelay: time.Second, retries: 1, expected: 200 * time.Millisecond},
+		{name: "Capped", maxDelay: time.Second, retries: 10, expected: time.Second},
+		{name: "Uncapped", maxDelay: 0, retries: 4, expected: 1600 * time.Millisecond},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			delay := Backoff(100*time.Millisecond, tc.maxDelay, tc.retries)
+			if delay < tc.expected || delay > tc.expected+tc.expected/5 {
+				t.Errorf("Backoff(%d) = %v; expected %v plus up to 20%%", tc.retries, delay, tc.expected)
+			}
+		})
+	}
+}
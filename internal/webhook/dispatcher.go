@@ -0,0 +1,272 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/logger"
+	"xm-exercise/internal/utils"
+	"xm-exercise/pkg/models"
+)
+
+var (
+	deliveredTotal      = expvar.NewInt("webhook_delivered_total")
+	failedAttemptsTotal = expvar.NewInt("webhook_failed_attempts_total")
+	abandonedTotal      = expvar.NewInt("webhook_abandoned_total")
+	disabledTotal       = expvar.NewInt("webhook_disabled_total")
+)
+
+// userAgent identifies webhook requests
+const userAgent = "xm-exercise-webhooks/1.0"
+
+// attempt is the outcome of one delivery attempt
+type attempt struct {
+	// statusCode is nil when no response was received
+	statusCode *int
+	err        error
+}
+
+// Dispatcher sends pending deliveries to their subscriptions, retrying
+// failed ones with exponential backoff and disabling subscriptions that keep
+// failing
+type Dispatcher struct {
+	database *db.Database
+	client   *http.Client
+	cfg      config.WebhookConfig
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(database *db.Database, cfg config.WebhookConfig) *Dispatcher {
+	return &Dispatcher{
+		database: database,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: guardedTransport(cfg.Timeout, cfg.AllowedNetworks),
+			// A redirect is reported as a failure rather than followed, since
+			// following it would resend the payload to another endpoint
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg: cfg,
+	}
+}
+
+// Run dispatches deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	logger.Info("Webhook dispatcher started",
+		zap.Duration("poll_interval", d.cfg.PollInterval),
+		zap.Int("batch_size", d.cfg.BatchSize),
+	)
+
+	for {
+		for {
+			dispatched, err := d.dispatchBatch(ctx)
+			if err != nil {
+				logger.Error("Failed to dispatch webhook batch", zap.Error(err))
+				break
+			}
+			if dispatched < d.cfg.BatchSize || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			logger.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchBatch sends one batch of due deliveries and returns how many were claimed.
+// The deliveries are leased and the claim committed before sending, so no
+// locks are held while an endpoint is slow, and each outcome is then stored
+// in a short transaction of its own.
+func (d *Dispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	// Shutting down stops sending, but the outcome of the deliveries already
+	// attempted must still be stored
+	dbCtx := context.WithoutCancel(ctx)
+	repo := db.NewWebhookRepository(d.database)
+	deliveries, err := repo.ClaimPendingDeliveries(dbCtx, d.cfg.BatchSize, time.Now().UTC(), d.cfg.Lease)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.SubscriptionID)
+	}
+	subscriptions, err := repo.SubscriptionsByID(dbCtx, ids)
+	if err != nil {
+		return len(deliveries), errors.Join(err, repo.ReleaseDeliveries(dbCtx, deliveryIDs(deliveries)))
+	}
+
+	var released []string
+	for i, result := range d.deliverAll(ctx, deliveries, subscriptions) {
+		if result == nil {
+			released = append(released, deliveries[i].ID)
+			continue
+		}
+		err := d.database.WithTransaction(dbCtx, func(tx *db.Database) error {
+			return d.recordAttempt(dbCtx, db.NewWebhookRepository(tx), deliveries[i], *result)
+		})
+		if err != nil {
+			return len(deliveries), err
+		}
+	}
+	return len(deliveries), repo.ReleaseDeliveries(dbCtx, released)
+}
+
+// deliveryIDs returns the IDs of deliveries
+func deliveryIDs(deliveries []models.WebhookDelivery) []string {
+	ids := make([]string, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.ID)
+	}
+	return ids
+}
+
+// deliverAll sends the deliveries with at most Concurrency requests in flight.
+// Deliveries not attempted before ctx was cancelled, or whose subscription was
+// deleted since they were claimed, have a nil result.
+func (d *Dispatcher) deliverAll(
+	ctx context.Context,
+	deliveries []models.WebhookDelivery,
+	subscriptions map[string]models.WebhookSubscription,
+) []*attempt {
+	results := make([]*attempt, len(deliveries))
+	slots := make(chan struct{}, d.cfg.Concurrency)
+	var wg sync.WaitGroup
+
+	for i := range deliveries {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			subscription, ok := subscriptions[deliveries[i].SubscriptionID]
+			if !ok {
+				return
+			}
+			result := d.deliver(ctx, subscription, deliveries[i])
+			if result.err != nil && ctx.Err() != nil {
+				return
+			}
+			results[i] = &result
+		}(i)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// deliver sends one signed request for delivery to the subscription's URL
+func (d *Dispatcher) deliver(
+	ctx context.Context,
+	subscription models.WebhookSubscription,
+	delivery models.WebhookDelivery,
+) attempt {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return attempt{err: fmt.Errorf("error building request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return attempt{err: err}
+	}
+	defer resp.Body.Close() //nolint:errcheck // Nothing to do about a failure to close the body.
+
+	// The body is never stored, since the delivery log would otherwise show
+	// subscribers the responses of any endpoint they point a webhook at
+	//nolint:errcheck // Draining lets the connection be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	statusCode := resp.StatusCode
+	if statusCode >= 200 && statusCode < 300 {
+		return attempt{statusCode: &statusCode}
+	}
+	return attempt{statusCode: &statusCode, err: fmt.Errorf("unexpected status %d", statusCode)}
+}
+
+// recordAttempt stores the outcome of an attempt on the delivery and its subscription
+func (d *Dispatcher) recordAttempt(
+	ctx context.Context,
+	repo *db.WebhookRepository,
+	delivery models.WebhookDelivery,
+	result attempt,
+) error {
+	now := time.Now().UTC()
+	if result.err == nil {
+		deliveredTotal.Add(1)
+		if err := repo.MarkDelivered(ctx, delivery.ID, *result.statusCode, now); err != nil {
+			return err
+		}
+		return repo.RecordSuccess(ctx, delivery.SubscriptionID)
+	}
+
+	failedAttemptsTotal.Add(1)
+	attempts := delivery.Attempts + 1
+	fields := []zap.Field{
+		zap.Error(result.err),
+		zap.String("delivery_id", delivery.ID),
+		zap.String("subscription_id", delivery.SubscriptionID),
+		zap.Int("attempts", attempts),
+	}
+
+	var next *time.Time
+	if attempts < d.cfg.MaxAttempts {
+		retryAt := now.Add(utils.Backoff(d.cfg.InitialBackoff, d.cfg.MaxBackoff, delivery.Attempts))
+		next = &retryAt
+		logger.Warn("Webhook delivery failed", append(fields, zap.Time("next_attempt_at", retryAt))...)
+	} else {
+		abandonedTotal.Add(1)
+		logger.Error("Webhook delivery failed, giving up", fields...)
+	}
+	if err := repo.MarkAttemptFailed(ctx, delivery.ID, result.statusCode, result.err, now, next); err != nil {
+		return err
+	}
+
+	disabled, err := repo.RecordFailure(ctx, delivery.SubscriptionID, d.cfg.DisableAfter, now)
+	if err != nil {
+		return err
+	}
+	if disabled {
+		disabledTotal.Add(1)
+		logger.Warn("Webhook subscription disabled after repeated failures",
+			zap.String("subscription_id", delivery.SubscriptionID),
+			zap.Int("consecutive_failures", d.cfg.DisableAfter),
+		)
+	}
+	return nil
+}
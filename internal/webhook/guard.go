@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a webhook URL resolves to an internal address
+var ErrForbiddenAddress = errors.New("webhook address is not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range, used by some clouds for
+// their metadata services
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// forbidden reports whether addr is an internal address webhooks must not
+// reach: loopback, private, link-local, shared, multicast or unspecified
+func forbidden(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
+
+// guardedTransport returns a transport that refuses to connect to internal
+// addresses outside allowed. The check runs on the address being dialled,
+// after DNS resolution, so hostnames resolving to internal addresses and DNS
+// rebinding are refused too. Proxies are not used, as the proxy's address
+// would be checked instead of the endpoint's.
+func guardedTransport(timeout time.Duration, allowed []netip.Prefix) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			addr := addrPort.Addr().Unmap()
+			for _, network := range allowed {
+				if network.Contains(addr) {
+					return nil
+				}
+			}
+			if forbidden(addr) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
@@ -0,0 +1,106 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/events"
+	"xm-exercise/pkg/models"
+)
+
+// Payload is the JSON body of a webhook request
+type Payload struct {
+	ID             string      `json:"id"`
+	Type           string      `json:"type"`
+	OrganizationID string      `json:"organization_id"`
+	OccurredAt     time.Time   `json:"occurred_at"`
+	Data           PayloadData `json:"data"`
+}
+
+// PayloadData describes the company change. Previous and ChangedFields are
+// only set for company.updated.
+type PayloadData struct {
+	Company       *models.CompanyResponse `json:"company"`
+	Previous      *models.CompanyResponse `json:"previous,omitempty"`
+	ChangedFields []string                `json:"changed_fields,omitempty"`
+}
+
+// Recorder implements events.KafkaProducerInterface by recording a pending
+// delivery for every enabled subscription of the company's organization
+// that matches the event type
+type Recorder struct {
+	repo *db.WebhookRepository
+}
+
+// NewRecorder creates a recorder writing through the given repository
+func NewRecorder(repo *db.WebhookRepository) *Recorder {
+	return &Recorder{repo: repo}
+}
+
+// PublishCompanyCreated records deliveries of a company created event
+func (r *Recorder) PublishCompanyCreated(ctx context.Context, company models.Company) error {
+	return r.record(ctx, events.EventCompanyCreated, company.OrganizationID, PayloadData{Company: company.ToResponse()})
+}
+
+// PublishCompanyUpdated records deliveries of a company updated event
+func (r *Recorder) PublishCompanyUpdated(ctx context.Context, before, after *models.Company) error {
+	return r.record(ctx, events.EventCompanyUpdated, after.OrganizationID, PayloadData{
+		Company:       after.ToResponse(),
+		Previous:      before.ToResponse(),
+		ChangedFields: after.ChangedFields(before),
+	})
+}
+
+// PublishCompanyDeleted records deliveries of a company deleted event
+func (r *Recorder) PublishCompanyDeleted(ctx context.Context, company *models.Company) error {
+	return r.record(ctx, events.EventCompanyDeleted, company.OrganizationID, PayloadData{Company: company.ToResponse()})
+}
+
+// record stores one delivery of the event per matching subscription
+func (r *Recorder) record(ctx context.Context, eventType, organizationID string, data PayloadData) error {
+	subscriptions, err := r.repo.EnabledSubscriptions(ctx, organizationID)
+	if err != nil {
+		return fmt.Errorf("error loading webhook subscriptions: %w", err)
+	}
+
+	var body []byte
+	now := time.Now().UTC()
+	eventID := uuid.New().String()
+	for _, subscription := range subscriptions {
+		if !subscription.Matches(eventType) {
+			continue
+		}
+
+		if body == nil {
+			body, err = json.Marshal(Payload{
+				ID:             eventID,
+				Type:           eventType,
+				OrganizationID: organizationID,
+				OccurredAt:     now,
+				Data:           data,
+			})
+			if err != nil {
+				return fmt.Errorf("error encoding webhook payload: %w", err)
+			}
+		}
+
+		if err := r.repo.AddDelivery(ctx, &models.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: subscription.ID,
+			EventID:        eventID,
+			EventType:      eventType,
+			Payload:        body,
+			Status:         models.DeliveryPending,
+			CreatedAt:      now,
+			NextAttemptAt:  now,
+		}); err != nil {
+			return fmt.Errorf("error recording webhook delivery: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package webhook delivers company events to the HTTP endpoints of webhook
+// subscriptions: deliveries are recorded with the change and sent, signed, by
+// a background dispatcher.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of webhook requests
+const (
+	// SignatureHeader carries the signing time and the HMAC-SHA256 signature,
+	// as t=<unix seconds>,v1=<hex signature>
+	SignatureHeader = "Webhook-Signature"
+	EventIDHeader   = "Webhook-Id"
+	EventTypeHeader = "Webhook-Event"
+	DeliveryHeader  = "Webhook-Delivery"
+)
+
+// SignatureTolerance is how old a signature receivers should accept, to reject replayed requests
+const SignatureTolerance = 5 * time.Minute
+
+// Sign returns the signature header value for body sent at timestamp. The
+// signature covers "<unix seconds>.<body>", so the timestamp cannot be
+// changed without invalidating it.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + signature(secret, unix, body)
+}
+
+// Verify checks a signature header against body, rejecting signatures older
+// or newer than tolerance
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix, signed string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signed = value
+		}
+	}
+	if unix == "" || signed == "" {
+		return errors.New("malformed signature header")
+	}
+
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return errors.New("malformed signature timestamp")
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp outside the tolerance of %s", tolerance)
+	}
+
+	if !hmac.Equal([]byte(signed), []byte(signature(secret, unix, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// signature computes the hex HMAC-SHA256 of "<unix>.<body>"
+func signature(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,416 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+	"xm-exercise/internal/db/dbtest"
+	"xm-exercise/internal/events"
+	"xm-exercise/internal/logger"
+	"xm-exercise/pkg/models"
+)
+
+func testWebhookConfig() config.WebhookConfig {
+	return config.WebhookConfig{
+		PollInterval:   time.Millisecond,
+		BatchSize:      10,
+		Concurrency:    2,
+		Timeout:        time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: time.Nanosecond,
+		MaxBackoff:     time.Nanosecond,
+		DisableAfter:   100,
+		Lease:          time.Minute,
+		// The test servers listen on loopback
+		AllowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+	}
+}
+
+// addSubscription stores an enabled subscription of organizationID
+func addSubscription(t *testing.T, repo *db.WebhookRepository, organizationID, url string, eventTypes ...string) models.WebhookSubscription {
+	t.Helper()
+	subscription := models.WebhookSubscription{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		URL:            url,
+		EventTypes:     eventTypes,
+		Secret:         "0123456789abcdef",
+		Enabled:        true,
+	}
+	require.NoError(t, repo.CreateSubscription(context.Background(), &subscription))
+	return subscription
+}
+
+func testCompany(organizationID string) models.Company {
+	registered := true
+	return models.Company{
+		ID:             uuid.New().String(),
+		OrganizationID: organizationID,
+		Name:           "Acme",
+		EmployeeCount:  10,
+		Registered:     &registered,
+		Type:           models.TypeCorporation,
+	}
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Unix(1700000000, 0)
+	header := Sign("secret", now, body)
+	assert.Regexp(t, `^t=1700000000,v1=[0-9a-f]{64}$`, header)
+
+	assert.NoError(t, Verify("secret", header, body, now.Add(time.Minute), SignatureTolerance))
+	assert.ErrorContains(t, Verify("other", header, body, now, SignatureTolerance), "mismatch")
+	assert.ErrorContains(t, Verify("secret", header, []byte(`{"id":"2"}`), now, SignatureTolerance), "mismatch")
+	assert.ErrorContains(t, Verify("secret", header, body, now.Add(time.Hour), SignatureTolerance), "tolerance")
+	assert.ErrorContains(t, Verify("secret", "v1=abc", body, now, SignatureTolerance), "malformed")
+
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.Regexp(t, `^whsec_[0-9a-f]{48}$`, secret)
+}
+
+func TestRecorder(t *testing.T) {
+	database := dbtest.NewSQLite(t)
+	repo := db.NewWebhookRepository(database)
+	organizationID := uuid.New().String()
+	all := addSubscription(t, repo, organizationID, "https://all.example.com")
+	deletes := addSubscription(t, repo, organizationID, "https://deletes.example.com", events.EventCompanyDeleted)
+	addSubscription(t, repo, uuid.New().String(), "https://other-organization.example.com")
+	disabled := addSubscription(t, repo, organizationID, "https://disabled.example.com")
+	disabled.Enabled = false
+	require.NoError(t, repo.UpdateSubscription(context.Background(), &disabled))
+
+	recorder := NewRecorder(repo)
+	before := testCompany(organizationID)
+	after := before
+	after.EmployeeCount = 20
+	require.NoError(t, recorder.PublishCompanyUpdated(context.Background(), &before, &after))
+	require.NoError(t, recorder.PublishCompanyDeleted(context.Background(), &after))
+
+	deliveries, err := repo.ListDeliveries(context.Background(), all.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	deleteDeliveries, err := repo.ListDeliveries(context.Background(), deletes.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deleteDeliveries, 1)
+	assert.Equal(t, events.EventCompanyDeleted, deleteDeliveries[0].EventType)
+	disabledDeliveries, err := repo.ListDeliveries(context.Background(), disabled.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, disabledDeliveries)
+
+	var updated *models.WebhookDelivery
+	for i := range deliveries {
+		if deliveries[i].EventType == events.EventCompanyUpdated {
+			updated = &deliveries[i]
+		}
+	}
+	require.NotNil(t, updated)
+	assert.Equal(t, models.DeliveryPending, updated.Status)
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(updated.Payload, &payload))
+	assert.Equal(t, updated.EventID, payload.ID)
+	assert.Equal(t, events.EventCompanyUpdated, payload.Type)
+	assert.Equal(t, organizationID, payload.OrganizationID)
+	assert.Equal(t, 20, payload.Data.Company.EmployeeCount)
+	assert.Equal(t, 10, payload.Data.Previous.EmployeeCount)
+	assert.Equal(t, []string{"employee_count"}, payload.Data.ChangedFields)
+}
+
+// receiver records webhook requests, answering with the statuses in turn and then 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestDispatcher(t *testing.T) {
+	require.NoError(t, logger.Init(zap.FatalLevel.String(), false))
+	ctx := context.Background()
+
+	t.Run("sends signed requests", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		rc := &receiver{}
+		server := httptest.NewServer(rc)
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		dispatcher := NewDispatcher(database, testWebhookConfig())
+		claimed, err := dispatcher.dispatchBatch(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed)
+
+		require.Len(t, rc.requests, 1)
+		request := rc.requests[0]
+		assert.Equal(t, http.MethodPost, request.Method)
+		assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+		assert.Equal(t, events.EventCompanyCreated, request.Header.Get(EventTypeHeader))
+		assert.NoError(t, Verify(subscription.Secret, request.Header.Get(SignatureHeader), rc.bodies[0], time.Now(), SignatureTolerance))
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, models.DeliverySucceeded, deliveries[0].Status)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.Equal(t, deliveries[0].ID, request.Header.Get(DeliveryHeader))
+		assert.Equal(t, deliveries[0].EventID, request.Header.Get(EventIDHeader))
+		require.NotNil(t, deliveries[0].LastStatusCode)
+		assert.Equal(t, http.StatusOK, *deliveries[0].LastStatusCode)
+		assert.NotNil(t, deliveries[0].DeliveredAt)
+	})
+
+	t.Run("leases claimed deliveries from other dispatchers while sending", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		started := make(chan struct{})
+		release := make(chan struct{})
+		rc := &receiver{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			rc.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := NewDispatcher(database, testWebhookConfig()).dispatchBatch(ctx)
+			done <- err
+		}()
+		<-started
+
+		// The claim is committed, so the database stays writable while sending
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.NotNil(t, deliveries[0].LockedUntil)
+		claimed, err := NewDispatcher(database, testWebhookConfig()).dispatchBatch(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, claimed, "leased deliveries are not claimed again")
+
+		close(release)
+		require.NoError(t, <-done)
+		assert.Len(t, rc.requests, 1)
+
+		deliveries, err = repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, models.DeliverySucceeded, deliveries[0].Status)
+		assert.Nil(t, deliveries[0].LockedUntil)
+	})
+
+	t.Run("releases deliveries not attempted before shutdown", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		rc := &receiver{}
+		server := httptest.NewServer(rc)
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		claimed, err := NewDispatcher(database, testWebhookConfig()).dispatchBatch(cancelled)
+		require.NoError(t, err)
+		assert.Equal(t, 1, claimed)
+		assert.Empty(t, rc.requests)
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, models.DeliveryPending, deliveries[0].Status)
+		assert.Zero(t, deliveries[0].Attempts)
+		assert.Nil(t, deliveries[0].LockedUntil)
+	})
+
+	t.Run("retries failures and gives up after the last attempt", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		rc := &receiver{statuses: []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusBadGateway}}
+		server := httptest.NewServer(rc)
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		dispatcher := NewDispatcher(database, testWebhookConfig())
+		for i := 0; i < 3; i++ {
+			time.Sleep(time.Millisecond)
+			claimed, err := dispatcher.dispatchBatch(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 1, claimed)
+		}
+		claimed, err := dispatcher.dispatchBatch(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, claimed)
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, models.DeliveryFailed, deliveries[0].Status)
+		assert.Equal(t, 3, deliveries[0].Attempts)
+		require.NotNil(t, deliveries[0].LastStatusCode)
+		assert.Equal(t, http.StatusBadGateway, *deliveries[0].LastStatusCode)
+		require.NotNil(t, deliveries[0].LastError)
+		assert.Equal(t, "unexpected status 502", *deliveries[0].LastError)
+
+		stored, err := repo.GetSubscription(context.Background(), organizationID, subscription.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 3, stored.ConsecutiveFailures)
+		assert.True(t, stored.Enabled)
+	})
+
+	t.Run("disables subscriptions after repeated failures", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		rc := &receiver{statuses: []int{http.StatusGone, http.StatusGone}}
+		server := httptest.NewServer(rc)
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		recorder := NewRecorder(repo)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, recorder.PublishCompanyCreated(ctx, testCompany(organizationID)))
+		}
+
+		cfg := testWebhookConfig()
+		cfg.Concurrency = 1
+		cfg.BatchSize = 2
+		cfg.DisableAfter = 2
+		dispatcher := NewDispatcher(database, cfg)
+		_, err := dispatcher.dispatchBatch(ctx)
+		require.NoError(t, err)
+
+		stored, err := repo.GetSubscription(context.Background(), organizationID, subscription.ID)
+		require.NoError(t, err)
+		assert.False(t, stored.Enabled)
+		assert.NotNil(t, stored.DisabledAt)
+
+		time.Sleep(time.Millisecond)
+		claimed, err := dispatcher.dispatchBatch(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, claimed, "deliveries of disabled subscriptions wait")
+		assert.Len(t, rc.requests, 2)
+	})
+
+	t.Run("stores the status but not the body of failed responses", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "ami-id instance-id local-ipv4", http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		_, err := NewDispatcher(database, testWebhookConfig()).dispatchBatch(ctx)
+		require.NoError(t, err)
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		require.NotNil(t, deliveries[0].LastError)
+		assert.Equal(t, "unexpected status 404", *deliveries[0].LastError)
+	})
+
+	t.Run("refuses internal addresses", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		rc := &receiver{}
+		server := httptest.NewServer(rc)
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		cfg := testWebhookConfig()
+		cfg.AllowedNetworks = nil
+		_, err := NewDispatcher(database, cfg).dispatchBatch(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, rc.requests)
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Nil(t, deliveries[0].LastStatusCode)
+		require.NotNil(t, deliveries[0].LastError)
+		assert.Contains(t, *deliveries[0].LastError, ErrForbiddenAddress.Error())
+	})
+
+	t.Run("does not follow redirects", func(t *testing.T) {
+		database := dbtest.NewSQLite(t)
+		repo := db.NewWebhookRepository(database)
+		server := httptest.NewServer(http.RedirectHandler("https://elsewhere.example.com", http.StatusTemporaryRedirect))
+		defer server.Close()
+
+		organizationID := uuid.New().String()
+		subscription := addSubscription(t, repo, organizationID, server.URL)
+		require.NoError(t, NewRecorder(repo).PublishCompanyCreated(ctx, testCompany(organizationID)))
+
+		_, err := NewDispatcher(database, testWebhookConfig()).dispatchBatch(ctx)
+		require.NoError(t, err)
+
+		deliveries, err := repo.ListDeliveries(context.Background(), subscription.ID, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, models.DeliveryPending, deliveries[0].Status)
+		require.NotNil(t, deliveries[0].LastStatusCode)
+		assert.Equal(t, http.StatusTemporaryRedirect, *deliveries[0].LastStatusCode)
+	})
+}
+
+func TestForbidden(t *testing.T) {
+	for _, address := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.100.100.200",
+		"0.0.0.0", "224.0.0.1", "::1", "::", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "::ffff:169.254.169.254",
+	} {
+		assert.True(t, forbidden(netip.MustParseAddr(address)), address)
+	}
+	for _, address := range []string{"8.8.8.8", "93.184.216.34", "2606:4700::1111", "::ffff:1.1.1.1"} {
+		assert.False(t, forbidden(netip.MustParseAddr(address)), address)
+	}
+}
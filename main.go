@@ -3,6 +3,9 @@ package main
 
 import (
 	"context"
+	"expvar"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -11,16 +14,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 
 	"xm-exercise/integration"
 	"xm-exercise/internal/api"
+	"xm-exercise/internal/cache"
 	"xm-exercise/internal/config"
 	"xm-exercise/internal/db"
 	"xm-exercise/internal/events"
+	"xm-exercise/internal/events/schemaregistry"
 	"xm-exercise/internal/logger"
+	"xm-exercise/internal/outbox"
+	"xm-exercise/internal/replay"
+	"xm-exercise/internal/stream"
 	"xm-exercise/internal/utils"
+	"xm-exercise/internal/webhook"
 )
 
 // @title           			Company Management API
@@ -46,6 +56,71 @@ const (
 )
 
 func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+	case "consume":
+	case "admin":
+	case "migrate":
+	case "seed":
+	case "-h", "-help", "--help", "help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+
+	cfg := setup()
+	//nolint:errcheck //Flushing errors are typically unrecoverable during shutdown
+	defer logger.Sync()
+
+	switch command {
+	case "serve":
+		serve(cfg)
+	case "consume":
+		consume(cfg)
+	case "admin":
+		if err := runAdmin(cfg, args); err != nil {
+			logger.Fatal("Admin command failed", zap.Error(err))
+		}
+	case "migrate":
+		if err := runMigrate(cfg, args); err != nil {
+			logger.Fatal("Migration failed", zap.Error(err))
+		}
+	case "seed":
+		if err := runSeed(cfg, args); err != nil {
+			logger.Fatal("Seeding failed", zap.Error(err))
+		}
+	}
+}
+
+// usage prints the available commands
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: app [command]
+
+Commands:
+  serve                   Run the API server, the outbox relay and the webhook
+                          dispatcher (default), and
+                          the inbound consumer when CONSUMER_ENABLED is set
+  consume                 Run the inbound company consumer on its own
+  migrate up|down|status|to
+                          Apply, revert or list the database schema migrations
+  seed                    Load users and companies from fixture files or
+                          generate fake companies
+  admin provision-topics  Check the Kafka brokers and create missing topics
+  admin replay            Publish company events again, from the current
+                          companies or the company event log
+`)
+}
+
+// setup loads the environment, initializes the logger and loads the configuration
+func setup() *config.Config {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
@@ -59,28 +134,280 @@ func main() {
 	if err := logger.Init(logLevel, isDev); err != nil {
 		log.Fatalf("Failed to initialize logger: %v", err)
 	}
-	//nolint:errcheck //Flushing errors are typically unrecoverable during shutdown
-	defer logger.Sync()
 
 	cfg, err := config.Load()
 	if err != nil {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
+	return cfg
+}
+
+// openDatabase connects to the database and applies the pending migrations or
+// checks that there are none, as DATABASE_MIGRATIONS says
+func openDatabase(cfg *config.Config) (*db.Database, error) {
+	pool := poolConfig(cfg)
+	database, err := connectDatabase(cfg, pool)
+	if err != nil {
+		return nil, err
+	}
+	database.QueryTimeout = cfg.QueryTimeout
+	logger.Info("Database connected",
+		zap.String("dialect", cfg.DatabaseDialect),
+		zap.Int("max_open_conns", pool.MaxOpenConns),
+	)
+	if len(cfg.Replicas.URLs) > 0 {
+		if err := database.UseReplicas(cfg.Replicas.URLs, cfg.Replicas.HealthInterval); err != nil {
+			//nolint:errcheck // The connection is being abandoned either way.
+			database.Close()
+			return nil, err
+		}
+		healthy, total := database.HealthyReplicas()
+		logger.Info("Read replicas connected", zap.Int("healthy", healthy), zap.Int("replicas", total))
+	}
+	if cfg.Migrations.Mode == "off" {
+		return database, nil
+	}
+
+	err = func() error {
+		// Migrations may run for longer than the statement timeout allows
+		migrating := database
+		if pool.StatementTimeout > 0 {
+			pool.StatementTimeout = 0
+			migrating, err = db.Open(cfg.DatabaseDialect, cfg.DatabaseURL, pool)
+			if err != nil {
+				return err
+			}
+			//nolint:errcheck // The migration connection is not needed anymore.
+			defer migrating.Close()
+		}
+
+		migrator, err := db.NewMigrator(migrating, cfg.Migrations.LockTimeout)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Migrations.LockTimeout+5*time.Minute)
+		defer cancel()
+
+		if cfg.Migrations.Mode == "check" {
+			if err := migrator.Check(ctx); err != nil {
+				return fmt.Errorf("%w; run app migrate up", err)
+			}
+			return nil
+		}
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, migration := range applied {
+			logger.Info("Migration applied", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+		}
+		return nil
+	}()
+	if err != nil {
+		//nolint:errcheck // The connection is being abandoned either way.
+		database.Close()
+		return nil, err
+	}
+	return database, nil
+}
+
+// connectDatabase connects to the database, waiting up to
+// DATABASE_CONNECT_TIMEOUT_SECONDS for it to become available
+func connectDatabase(cfg *config.Config, pool db.PoolConfig) (*db.Database, error) {
+	if cfg.ConnectTimeout <= 0 {
+		return db.Open(cfg.DatabaseDialect, cfg.DatabaseURL, pool)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	return db.Connect(ctx, cfg.DatabaseDialect, cfg.DatabaseURL, pool, func(err error, delay time.Duration) {
+		logger.Warn("Database unavailable, retrying", zap.Error(err), zap.Duration("delay", delay))
+	})
+}
 
-	database, err := db.NewDatabase(cfg.DatabaseDialect, cfg.DatabaseURL)
+// poolConfig returns the database connection pool configuration of cfg
+func poolConfig(cfg *config.Config) db.PoolConfig {
+	return db.PoolConfig{
+		MaxOpenConns:     cfg.Pool.MaxOpenConns,
+		MaxIdleConns:     cfg.Pool.MaxIdleConns,
+		ConnMaxLifetime:  cfg.Pool.ConnMaxLifetime,
+		ConnMaxIdleTime:  cfg.Pool.ConnMaxIdleTime,
+		StatementTimeout: cfg.Pool.StatementTimeout,
+	}
+}
+
+// openPgxPool connects the pgx pool company reads go through when
+// DATABASE_DRIVER is pgx, retrying like connectDatabase
+func openPgxPool(cfg *config.Config) (*pgxpool.Pool, error) {
+	var pool *pgxpool.Pool
+	var err error
+	if cfg.ConnectTimeout <= 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		pool, err = db.NewPgxPool(ctx, cfg.DatabaseURL, poolConfig(cfg))
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+		defer cancel()
+		pool, err = db.ConnectPgxPool(ctx, cfg.DatabaseURL, poolConfig(cfg), func(err error, delay time.Duration) {
+			logger.Warn("pgx pool unavailable, retrying", zap.Error(err), zap.Duration("delay", delay))
+		})
+	}
 	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+		return nil, err
+	}
+	logger.Info("pgx pool connected", zap.Int32("max_connections", pool.Config().MaxConns))
+	return pool, nil
+}
+
+// newCacheStore creates the store of the company cache. An unreachable Redis
+// server is only logged, as the cache is bypassed until it answers.
+func newCacheStore(cfg *config.Config) (cache.Store, error) {
+	if cfg.Cache.Backend != "redis" {
+		return cache.NewLRUStore(cfg.Cache.Size), nil
+	}
+	store, err := cache.NewRedisStore(cfg.Cache.RedisURL, cfg.Cache.RedisPoolSize, cfg.Cache.RedisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Ping(context.Background()); err != nil {
+		logger.Warn("Redis is unavailable, company cache bypassed", zap.Error(err))
+	}
+	return store, nil
+}
+
+// newEncoder creates the event encoder, registering the payload schemas when a
+// schema registry is configured
+func newEncoder(cfg *config.Config) (*events.Encoder, error) {
+	encoder, err := events.NewEncoder(cfg.EventEncoding)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EventEncoding.SchemaRegistry.URL == "" {
+		return encoder, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := encoder.RegisterSchemas(ctx, schemaregistry.NewClient(cfg.EventEncoding.SchemaRegistry)); err != nil {
+		return nil, fmt.Errorf("error registering event schemas: %w", err)
+	}
+	logger.Info("Event schemas registered", zap.String("schema_registry", cfg.EventEncoding.SchemaRegistry.URL))
+	return encoder, nil
+}
+
+// serve runs the API server, the outbox relay, the webhook dispatcher and, when
+// enabled, the inbound consumer until SIGINT or SIGTERM
+func serve(cfg *config.Config) {
+	database, err := openDatabase(cfg)
+	if err != nil {
+		logger.Fatal("Failed to open database", zap.Error(err))
 	}
 	//nolint:errcheck // Shutdown errors are typically unrecoverable.
 	defer database.Close()
-	logger.Info("Database connected", zap.String("dialect", cfg.DatabaseDialect))
+	expvar.Publish("database_pool", expvar.Func(func() any {
+		stats, _ := database.PoolStats()
+		return stats
+	}))
 
-	producer := events.NewKafkaProducer(cfg.KafkaBrokers)
-	//nolint:errcheck // Shutdown errors are typically unrecoverable.
-	defer producer.Close()
-	logger.Info("Kafka producer initialized", zap.Strings("brokers", cfg.KafkaBrokers))
+	encoder, err := newEncoder(cfg)
+	if err != nil {
+		logger.Fatal("Failed to initialize event encoder", zap.Error(err))
+	}
 
-	router := api.NewRouter(database, producer, cfg)
+	if cfg.EventBus.Backend == events.BackendKafka {
+		if err := checkKafka(cfg, requiredTopics(cfg, encoder), cfg.EventBus.Kafka.Provisioning.CreateTopics); err != nil {
+			logger.Fatal("Kafka is not ready", zap.Error(err))
+		}
+	}
+
+	backend, err := events.NewPublisher(cfg.EventBus)
+	if err != nil {
+		logger.Fatal("Failed to initialize event bus", zap.Error(err))
+	}
+	deadLetter, err := events.NewDeadLetter(cfg.EventBus.Publish.DeadLetter, backend)
+	if err != nil {
+		logger.Fatal("Failed to initialize dead-letter target", zap.Error(err))
+	}
+	if deadLetter != nil {
+		//nolint:errcheck // Shutdown errors are typically unrecoverable.
+		defer deadLetter.Close()
+	}
+	publisher := events.NewAsyncPublisher(backend, cfg.EventBus.Publish)
+	//nolint:errcheck // Flushed on graceful shutdown; this only covers fatal exits.
+	defer publisher.Close()
+	logger.Info("Event bus initialized",
+		zap.String("backend", cfg.EventBus.Backend),
+		zap.String("dead_letter", cfg.EventBus.Publish.DeadLetter.Target),
+	)
+
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	relayDone := make(chan struct{})
+	relay := outbox.NewRelay(database, publisher, deadLetter, outbox.RelayConfig{
+		PollInterval:   cfg.Outbox.PollInterval,
+		BatchSize:      cfg.Outbox.BatchSize,
+		InitialBackoff: cfg.Outbox.InitialBackoff,
+		MaxBackoff:     cfg.Outbox.MaxBackoff,
+		PublishTimeout: 10 * time.Second,
+		MaxAttempts:    cfg.Outbox.MaxAttempts,
+		Lease:          cfg.Outbox.Lease,
+	})
+	go func() {
+		defer close(relayDone)
+		relay.Run(relayCtx)
+	}()
+
+	dispatcherDone := make(chan struct{})
+	dispatcher := webhook.NewDispatcher(database, cfg.Webhook)
+	go func() {
+		defer close(dispatcherDone)
+		dispatcher.Run(relayCtx)
+	}()
+
+	hub := stream.NewHub(cfg.Stream.BufferSize, cfg.Stream.SubscriberBuffer)
+
+	var companies db.CompanyRepositoryInterface = db.NewCompanyRepository(database)
+	var pgxPool *pgxpool.Pool
+	if cfg.DatabaseDriver == "pgx" {
+		pgxPool, err = openPgxPool(cfg)
+		if err != nil {
+			logger.Fatal("Failed to open pgx pool", zap.Error(err))
+		}
+		defer pgxPool.Close()
+		companies = db.NewPgxCompanyRepository(pgxPool, cfg.QueryTimeout)
+	}
+
+	// Committed and consumed changes invalidate the cached companies on their way to the hub
+	var changes stream.Publisher = hub
+	if cfg.Cache.Backend != "none" {
+		store, err := newCacheStore(cfg)
+		if err != nil {
+			logger.Fatal("Failed to initialize company cache", zap.Error(err))
+		}
+		if closer, ok := store.(io.Closer); ok {
+			//nolint:errcheck // Shutdown errors are typically unrecoverable.
+			defer closer.Close()
+		}
+		cached := cache.NewCompanyRepository(companies, store, cfg.Cache.TTL, cfg.Cache.NegativeTTL)
+		companies, changes = cached, cache.NewInvalidator(cached, hub)
+		logger.Info("Company cache initialized", zap.String("backend", cfg.Cache.Backend))
+	}
+
+	stopConsumer := func(context.Context) {}
+	if cfg.Consumer.Enabled {
+		// The API keeps serving if the consumer stops on an error, which is logged
+		stopConsumer, _, err = startConsumer(cfg, database, encoder, changes)
+		if err != nil {
+			logger.Fatal("Failed to start consumer", zap.Error(err))
+		}
+	}
+
+	// Replays get their own queue, so a replayed message failing cannot hold
+	// back the live messages of its key in the relay's
+	replayPublisher := events.NewAsyncPublisher(backend, cfg.EventBus.Publish)
+	//nolint:errcheck // Flushed on graceful shutdown; this only covers fatal exits.
+	defer replayPublisher.Close()
+	replays := replay.NewManager(replay.NewReplayer(database, events.NewProducer(replayPublisher, encoder), cfg.Replay))
+
+	router := api.NewRouter(database, pgxPool, companies, encoder, publisher, hub, changes, replays, cfg)
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
@@ -89,6 +416,8 @@ func main() {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	// Ending the change streams lets Shutdown wait for the remaining requests
+	srv.RegisterOnShutdown(hub.Close)
 
 	go func() {
 		logger.Info("Starting server", zap.String("port", cfg.Port))
@@ -113,5 +442,32 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	stopConsumer(ctx)
+
+	if err := replays.Shutdown(ctx); err != nil {
+		logger.Warn("Event replays did not stop before the shutdown deadline")
+	}
+	if err := replayPublisher.Shutdown(ctx); err != nil {
+		logger.Error("Failed to flush replay publish queue", zap.Error(err))
+	}
+
+	stopRelay()
+	select {
+	case <-relayDone:
+	case <-ctx.Done():
+		logger.Warn("Outbox relay did not stop before the shutdown deadline")
+	}
+	select {
+	case <-dispatcherDone:
+	case <-ctx.Done():
+		logger.Warn("Webhook dispatcher did not stop before the shutdown deadline")
+	}
+
+	// Messages left unflushed are still pending in the outbox and are
+	// published again on the next start
+	if err := publisher.Shutdown(ctx); err != nil {
+		logger.Error("Failed to flush event publish queue", zap.Error(err))
+	}
+
 	logger.Info("Server exited gracefully")
 }
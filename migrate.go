@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/db"
+)
+
+// runMigrate runs a migrate subcommand. It never migrates implicitly, whatever
+// DATABASE_MIGRATIONS says.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing migrate command, expected up, down, status or to")
+	}
+
+	database, err := db.NewDatabase(cfg.DatabaseDialect, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck // Shutdown errors are typically unrecoverable.
+	defer database.Close()
+
+	migrator, err := db.NewMigrator(database, cfg.Migrations.LockTimeout)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		return printMigrations("applied", func() ([]db.Migration, error) { return migrator.Up(ctx) })
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return printMigrations("reverted", func() ([]db.Migration, error) { return migrator.Down(ctx, *steps) })
+	case "to":
+		if len(args) != 2 {
+			return errors.New("migrate to expects a version, 0 reverting every migration")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		return printMigrations("migrated", func() ([]db.Migration, error) { return migrator.To(ctx, version) })
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, status or to", args[0])
+	}
+}
+
+// printMigrations runs a migration and prints the migrations it went through
+func printMigrations(verb string, migrate func() ([]db.Migration, error)) error {
+	migrations, err := migrate()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		fmt.Fprintln(os.Stdout, "no migrations to run")
+	}
+	for _, migration := range migrations {
+		fmt.Fprintf(os.Stdout, "%s %04d_%s\n", verb, migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// printMigrationStatus prints every known or applied migration with the time
+// it was applied, and fails when migrations are pending
+func printMigrationStatus(ctx context.Context, migrator *db.Migrator) error {
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, migration := range status.Applied {
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", migration.Version, migration.Name, migration.AppliedAt.UTC().Format(time.RFC3339))
+	}
+	for _, migration := range status.Pending {
+		fmt.Fprintf(w, "%04d\t%s\tpending\n", migration.Version, migration.Name)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "\nschema version %d, latest %d\n", status.Current, status.Latest)
+	return migrator.Check(ctx)
+}
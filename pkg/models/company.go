@@ -20,14 +20,15 @@ const (
 // Company represents a company entity
 // @Description Company model with all details
 type Company struct {
-	ID            string      `gorm:"type:uuid;primaryKey"`
-	Name          string      `gorm:"size:15;uniqueIndex;not null"`
-	Description   *string     `gorm:"size:3000"`
-	EmployeeCount int         `gorm:"not null"`
-	Registered    *bool       `gorm:"not null"`
-	Type          CompanyType `gorm:"not null"`
-	CreatedAt     time.Time   `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time   `gorm:"autoUpdateTime"`
+	ID             string      `gorm:"type:uuid;primaryKey"`
+	OrganizationID string      `gorm:"type:uuid;not null;uniqueIndex:idx_companies_organization_name"`
+	Name           string      `gorm:"size:15;not null;uniqueIndex:idx_companies_organization_name"`
+	Description    *string     `gorm:"size:3000"`
+	EmployeeCount  int         `gorm:"not null"`
+	Registered     *bool       `gorm:"not null"`
+	Type           CompanyType `gorm:"not null"`
+	CreatedAt      time.Time   `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time   `gorm:"autoUpdateTime"`
 }
 
 // BeforeCreate is hook for validation and mutation before creating the object
@@ -47,3 +48,32 @@ func (c *Company) ToResponse() *CompanyResponse {
 		UpdatedAt:     c.UpdatedAt,
 	}
 }
+
+// ChangedFields returns the JSON names of the fields whose values differ from previous
+func (c *Company) ChangedFields(previous *Company) []string {
+	changed := []string{}
+	if c.Name != previous.Name {
+		changed = append(changed, "name")
+	}
+	if !equalPointers(c.Description, previous.Description) {
+		changed = append(changed, "description")
+	}
+	if c.EmployeeCount != previous.EmployeeCount {
+		changed = append(changed, "employee_count")
+	}
+	if !equalPointers(c.Registered, previous.Registered) {
+		changed = append(changed, "registered")
+	}
+	if c.Type != previous.Type {
+		changed = append(changed, "type")
+	}
+	return changed
+}
+
+// equalPointers reports whether a and b are both nil or point to equal values
+func equalPointers[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
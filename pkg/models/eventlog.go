@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// CompanyEventTypes are the types of the events describing company changes
+var CompanyEventTypes = []string{"company.created", "company.updated", "company.deleted"}
+
+// CompanyEvent is an entry of the company event log, recorded in the same
+// transaction as the change it describes so that it can be replayed later
+type CompanyEvent struct {
+	Sequence       uint64 `gorm:"primaryKey;autoIncrement"`
+	EventType      string `gorm:"size:100;not null"`
+	OrganizationID string `gorm:"type:uuid;not null;index"`
+	CompanyID      string `gorm:"type:uuid;not null;index"`
+	// Company is the state after the change, or the last known state of a deleted company
+	Company Company `gorm:"type:text;not null;serializer:json"`
+	// Previous is the state before the change of company.updated events
+	Previous   *Company  `gorm:"type:text;serializer:json"`
+	OccurredAt time.Time `gorm:"not null;index"`
+}
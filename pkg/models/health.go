@@ -0,0 +1,30 @@
+package models
+
+// Readiness reports whether the service and its dependencies can serve traffic
+// @Description Readiness of the service and its dependencies
+type Readiness struct {
+	Status string                 `json:"status" example:"ready"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one dependency check
+// @Description Dependency check result
+type CheckResult struct {
+	Status string     `json:"status"          example:"up"`
+	Error  string     `json:"error,omitempty" example:"kafka brokers unreachable"`
+	Pool   *PoolStats `json:"pool,omitempty"`
+}
+
+// PoolStats are the statistics of a database connection pool
+// @Description Database connection pool statistics
+type PoolStats struct {
+	MaxOpen           int   `json:"max_open"             example:"100"`
+	Open              int   `json:"open"                 example:"12"`
+	InUse             int   `json:"in_use"               example:"4"`
+	Idle              int   `json:"idle"                 example:"8"`
+	WaitCount         int64 `json:"wait_count"           example:"3"`
+	WaitDurationMs    int64 `json:"wait_duration_ms"     example:"42"`
+	MaxIdleClosed     int64 `json:"max_idle_closed"      example:"0"`
+	MaxIdleTimeClosed int64 `json:"max_idle_time_closed" example:"5"`
+	MaxLifetimeClosed int64 `json:"max_lifetime_closed"  example:"1"`
+}
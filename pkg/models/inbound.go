@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// ProcessedEvent records an upstream event applied by the inbound consumer, so
+// that redelivered copies are recognized and skipped
+type ProcessedEvent struct {
+	ID          string    `gorm:"size:255;primaryKey"`
+	Topic       string    `gorm:"size:255;not null"`
+	EventType   string    `gorm:"size:100;not null"`
+	ProcessedAt time.Time `gorm:"not null;index"`
+}
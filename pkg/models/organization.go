@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// Organization represents a tenant that owns users and companies. Its name is
+// only a label, which other organizations may share.
+// @Description Organization (tenant) that scopes users and companies
+type Organization struct {
+	ID        string    `gorm:"type:uuid;primaryKey"`
+	Name      string    `gorm:"size:100;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
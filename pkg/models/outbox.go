@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxMessage is an event persisted in the same transaction as the change it
+// describes, waiting to be relayed to the message broker. A relay claiming it
+// holds it until LockedUntil. Sequence is assigned by the database in
+// insertion order and orders the messages of a key.
+type OutboxMessage struct {
+	ID             string            `gorm:"type:uuid;primaryKey"`
+	Sequence       int64             `gorm:"column:sequence_number;->;uniqueIndex:idx_outbox_messages_sequence_number"`
+	Topic          string            `gorm:"size:255;not null"`
+	Key            string            `gorm:"column:message_key;size:255;index:idx_outbox_messages_message_key"`
+	EventType      string            `gorm:"size:100;not null"`
+	Headers        map[string]string `gorm:"type:text;serializer:json"`
+	Payload        []byte            `gorm:"not null"`
+	Attempts       int               `gorm:"not null;default:0"`
+	LastError      *string           `gorm:"size:1000"`
+	CreatedAt      time.Time         `gorm:"autoCreateTime;index"`
+	NextAttemptAt  time.Time         `gorm:"not null;index"`
+	SentAt         *time.Time        `gorm:"index"`
+	LockedUntil    *time.Time
+	DeadLetteredAt *time.Time
+}
+
+// OutboxStats describes how far the outbox relay is behind
+// @Description Outbox relay lag
+type OutboxStats struct {
+	Pending         int64      `json:"pending"           example:"3"`
+	Retrying        int64      `json:"retrying"          example:"1"`
+	DeadLettered    int64      `json:"dead_lettered"     example:"0"`
+	OldestPendingAt *time.Time `json:"oldest_pending_at" example:"2024-01-01T00:00:00Z"`
+	LagSeconds      float64    `json:"lag_seconds"       example:"1.5"`
+	LastSentAt      *time.Time `json:"last_sent_at"      example:"2024-01-01T00:00:00Z"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Replay modes
+const (
+	// ReplayModeSnapshot emits a company.created event per current company
+	ReplayModeSnapshot = "snapshot"
+	// ReplayModeHistory emits the events stored in the company event log
+	ReplayModeHistory = "history"
+)
+
+// Replay job statuses
+const (
+	ReplayRunning   = "running"
+	ReplayCompleted = "completed"
+	ReplayFailed    = "failed"
+	ReplayCancelled = "cancelled"
+)
+
+// ReplayRequest selects the company events to publish again
+// @Description Mode, filters and pace of an event replay
+type ReplayRequest struct {
+	Mode string `json:"mode" example:"snapshot" enums:"snapshot,history"`
+	// Only events of this organization; all organizations when empty
+	OrganizationID string `json:"organization_id,omitempty" example:"3f1c-55ab2.....b-90e1d"`
+	// Only events of these companies
+	CompanyIDs []string `json:"company_ids,omitempty" example:"5b7e-12cd4.....a-77f01"`
+	// Only these event types; history mode only
+	EventTypes []string `json:"event_types,omitempty" example:"company.updated"`
+	// Only events that occurred at or after this time; history mode only
+	Since *time.Time `json:"since,omitempty" example:"2024-01-01T00:00:00Z"`
+	// Only events that occurred before this time; history mode only
+	Until *time.Time `json:"until,omitempty" example:"2024-02-01T00:00:00Z"`
+	// Events published per second; REPLAY_RATE when zero
+	Rate int `json:"rate,omitempty" example:"100"`
+	// Counts the matching events without publishing them
+	DryRun bool `json:"dry_run" example:"false"`
+}
+
+// Validate validates the replay mode and filters
+func (c *ReplayRequest) Validate() error {
+	if c.Mode != ReplayModeSnapshot && c.Mode != ReplayModeHistory {
+		return fmt.Errorf("mode must be %s or %s", ReplayModeSnapshot, ReplayModeHistory)
+	}
+	if c.OrganizationID != "" {
+		if _, err := uuid.Parse(c.OrganizationID); err != nil {
+			return errors.New("organization_id must be a UUID")
+		}
+	}
+	for _, companyID := range c.CompanyIDs {
+		if _, err := uuid.Parse(companyID); err != nil {
+			return fmt.Errorf("invalid company ID %q", companyID)
+		}
+	}
+	if c.Mode == ReplayModeSnapshot && (len(c.EventTypes) > 0 || c.Since != nil || c.Until != nil) {
+		return errors.New("event_types, since and until only apply to history replays")
+	}
+	for _, eventType := range c.EventTypes {
+		if !slices.Contains(CompanyEventTypes, eventType) {
+			return fmt.Errorf("invalid event type %q", eventType)
+		}
+	}
+	if c.Since != nil && c.Until != nil && !c.Until.After(*c.Since) {
+		return errors.New("until must be after since")
+	}
+	if c.Rate < 0 {
+		return errors.New("rate must be positive")
+	}
+	return nil
+}
+
+// ReplayJob reports the progress of an event replay
+// @Description Status and progress of an event replay
+type ReplayJob struct {
+	ID      string        `json:"id"      example:"8d4e-01fa2.....c-3b9d0"`
+	Request ReplayRequest `json:"request"`
+	Status  string        `json:"status"  example:"running" enums:"running,completed,failed,cancelled"`
+	// Number of matching events when the replay started
+	Total int64 `json:"total" example:"1200"`
+	// Events published so far, or counted in a dry run
+	Published  int64      `json:"published"   example:"300"`
+	Error      string     `json:"error,omitempty" example:"kafka: broker not available"`
+	StartedAt  time.Time  `json:"started_at"  example:"2024-01-01T00:00:00Z"`
+	FinishedAt *time.Time `json:"finished_at" example:"2024-01-01T00:00:12Z"`
+}
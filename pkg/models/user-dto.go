@@ -12,6 +12,8 @@ type UserRegistration struct {
 	Name     string `json:"name" example:"John Doe"`
 	Password string `json:"password" example:"securepassword123"`
 	Email    string `json:"email" example:"john@example.com"`
+	// Name of a new organization to create for the user. Defaults to the user's name.
+	Organization string `json:"organization,omitempty" example:"Acme Holdings"`
 }
 
 // Validate validates user registration credentials
@@ -28,6 +30,10 @@ func (c *UserRegistration) Validate() error {
 		return errors.New("password must be at least 8 characters")
 	}
 
+	if len(c.Organization) > 100 {
+		return errors.New("organization must be 100 characters or less")
+	}
+
 	return nil
 }
 
@@ -9,12 +9,13 @@ import (
 // User represents a user in the system
 // @Description User model with authentication details
 type User struct {
-	ID           string    `gorm:"type:uuid;primaryKey"`
-	Name         string    `gorm:"size:50;uniqueIndex;not null"`
-	Email        string    `gorm:"size:255;uniqueIndex;not null"`
-	PasswordHash string    `gorm:"size:255;not null"`
-	CreatedAt    time.Time `gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+	ID             string    `gorm:"type:uuid;primaryKey"`
+	OrganizationID string    `gorm:"type:uuid;not null;index"`
+	Name           string    `gorm:"size:50;uniqueIndex;not null"`
+	Email          string    `gorm:"size:255;uniqueIndex;not null"`
+	PasswordHash   string    `gorm:"size:255;not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
 }
 
 // BeforeCreate is hook for validation and mutation before creating an object
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// WebhookEventTypes are the event types a webhook subscription can filter on
+var WebhookEventTypes = CompanyEventTypes
+
+// WebhookCreateRequest represents a webhook subscription to be created
+// @Description Endpoint, event filter and signing secret of a webhook subscription
+type WebhookCreateRequest struct {
+	URL string `json:"url" example:"https://partner.example.com/hooks/companies"`
+	// Event types to send; all events when empty
+	EventTypes []string `json:"event_types,omitempty" example:"company.created,company.deleted"`
+	// Secret signing the payloads; generated when empty
+	Secret string `json:"secret,omitempty" example:"whsec_3f9a..."`
+}
+
+// Validate validates the subscription fields
+func (c *WebhookCreateRequest) Validate() error {
+	if err := validateWebhookURL(c.URL); err != nil {
+		return err
+	}
+	if err := validateWebhookEventTypes(c.EventTypes); err != nil {
+		return err
+	}
+	return validateWebhookSecret(c.Secret)
+}
+
+// WebhookUpdateRequest represents changes to a webhook subscription
+// @Description Fields of a webhook subscription to change
+type WebhookUpdateRequest struct {
+	URL        *string   `json:"url,omitempty" example:"https://partner.example.com/hooks/companies"`
+	EventTypes *[]string `json:"event_types,omitempty" example:"company.updated"`
+	// New signing secret; returned in the response
+	Secret *string `json:"secret,omitempty" example:"whsec_3f9a..."`
+	// Re-enables a disabled subscription, or disables it
+	Enabled *bool `json:"enabled,omitempty" example:"true"`
+}
+
+// Validate validates the fields to change
+func (c *WebhookUpdateRequest) Validate() error {
+	if c.URL != nil {
+		if err := validateWebhookURL(*c.URL); err != nil {
+			return err
+		}
+	}
+	if c.EventTypes != nil {
+		if err := validateWebhookEventTypes(*c.EventTypes); err != nil {
+			return err
+		}
+	}
+	if c.Secret != nil {
+		if *c.Secret == "" {
+			return errors.New("secret must not be empty")
+		}
+		return validateWebhookSecret(*c.Secret)
+	}
+	return nil
+}
+
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return errors.New("url is required")
+	}
+	if len(raw) > 2048 {
+		return errors.New("url must be 2048 characters or less")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+func validateWebhookEventTypes(eventTypes []string) error {
+	for _, eventType := range eventTypes {
+		if !slices.Contains(WebhookEventTypes, eventType) {
+			return fmt.Errorf("invalid event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+func validateWebhookSecret(secret string) error {
+	if secret != "" && len(secret) < 16 {
+		return errors.New("secret must be at least 16 characters")
+	}
+	if len(secret) > 255 {
+		return errors.New("secret must be 255 characters or less")
+	}
+	return nil
+}
+
+// WebhookResponse represents a webhook subscription
+type WebhookResponse struct {
+	ID         string   `json:"id"          example:"5b7e-12cd4.....a-77f01"`
+	URL        string   `json:"url"         example:"https://partner.example.com/hooks/companies"`
+	EventTypes []string `json:"event_types" example:"company.created"`
+	// Only returned when the secret is set or generated
+	Secret              string     `json:"secret,omitempty" example:"whsec_3f9a..."`
+	Enabled             bool       `json:"enabled"     example:"true"`
+	ConsecutiveFailures int        `json:"consecutive_failures" example:"0"`
+	DisabledAt          *time.Time `json:"disabled_at" example:"2024-01-01T00:00:00Z"`
+	CreatedAt           time.Time  `json:"created_at"  example:"2024-01-01T00:00:00Z"`
+	UpdatedAt           time.Time  `json:"updated_at"  example:"2024-01-01T00:00:00Z"`
+}
+
+// WebhookDeliveryResponse represents a webhook delivery and its latest attempt
+type WebhookDeliveryResponse struct {
+	ID             string          `json:"id"               example:"0c2f-88ab1.....d-1e2f3"`
+	EventID        string          `json:"event_id"         example:"9a1b-22cd3.....e-4f5a6"`
+	EventType      string          `json:"event_type"       example:"company.created"`
+	Status         string          `json:"status"           example:"succeeded"`
+	Attempts       int             `json:"attempts"         example:"1"`
+	LastStatusCode *int            `json:"last_status_code" example:"200"`
+	LastError      *string         `json:"last_error"       example:"unexpected status 503"`
+	Payload        json.RawMessage `json:"payload" swaggertype:"object"`
+	CreatedAt      time.Time       `json:"created_at"       example:"2024-01-01T00:00:00Z"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"  example:"2024-01-01T00:00:00Z"`
+	DeliveredAt    *time.Time      `json:"delivered_at"     example:"2024-01-01T00:00:00Z"`
+	// Only set while the delivery is pending
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" example:"2024-01-01T00:00:00Z"`
+}
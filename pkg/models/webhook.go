@@ -0,0 +1,93 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookSubscription is an HTTP endpoint of an organization receiving company events
+type WebhookSubscription struct {
+	ID             string `gorm:"type:uuid;primaryKey"`
+	OrganizationID string `gorm:"type:uuid;not null;index"`
+	URL            string `gorm:"size:2048;not null"`
+	// EventTypes filters the events sent; empty means every event
+	EventTypes []string `gorm:"type:text;serializer:json"`
+	Secret     string   `gorm:"size:255;not null"`
+	Enabled    bool     `gorm:"not null;default:true"`
+	// ConsecutiveFailures counts failed attempts since the last successful delivery
+	ConsecutiveFailures int `gorm:"not null;default:0"`
+	DisabledAt          *time.Time
+	CreatedAt           time.Time `gorm:"autoCreateTime"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime"`
+}
+
+// Matches reports whether the subscription wants events of the given type
+func (s *WebhookSubscription) Matches(eventType string) bool {
+	return len(s.EventTypes) == 0 || slices.Contains(s.EventTypes, eventType)
+}
+
+// ToResponse converts the subscription to its API representation, without the secret
+func (s *WebhookSubscription) ToResponse() *WebhookResponse {
+	eventTypes := s.EventTypes
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+	return &WebhookResponse{
+		ID:                  s.ID,
+		URL:                 s.URL,
+		EventTypes:          eventTypes,
+		Enabled:             s.Enabled,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		DisabledAt:          s.DisabledAt,
+		CreatedAt:           s.CreatedAt,
+		UpdatedAt:           s.UpdatedAt,
+	}
+}
+
+// WebhookDelivery is one event to be sent to a subscription, along with the
+// outcome of its latest attempt. A dispatcher claiming it holds it until
+// LockedUntil.
+type WebhookDelivery struct {
+	ID             string `gorm:"type:uuid;primaryKey"`
+	SubscriptionID string `gorm:"type:uuid;not null;index"`
+	EventID        string `gorm:"type:uuid;not null"`
+	EventType      string `gorm:"size:100;not null"`
+	Payload        []byte `gorm:"not null"`
+	Status         string `gorm:"size:20;not null;index"`
+	Attempts       int    `gorm:"not null;default:0"`
+	LastStatusCode *int
+	LastError      *string   `gorm:"size:1000"`
+	CreatedAt      time.Time `gorm:"autoCreateTime;index"`
+	NextAttemptAt  time.Time `gorm:"not null;index"`
+	LastAttemptAt  *time.Time
+	DeliveredAt    *time.Time
+	LockedUntil    *time.Time
+}
+
+// ToResponse converts the delivery to its API representation
+func (d *WebhookDelivery) ToResponse() *WebhookDeliveryResponse {
+	response := &WebhookDeliveryResponse{
+		ID:             d.ID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		Payload:        d.Payload,
+		CreatedAt:      d.CreatedAt,
+		LastAttemptAt:  d.LastAttemptAt,
+		DeliveredAt:    d.DeliveredAt,
+	}
+	if d.Status == DeliveryPending {
+		response.NextAttemptAt = &d.NextAttemptAt
+	}
+	return response
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"xm-exercise/internal/config"
+	"xm-exercise/internal/outbox"
+	"xm-exercise/internal/seed"
+	"xm-exercise/internal/utils"
+)
+
+// ProductionEnv is the APP_ENV of production deployments, whose data seed never wipes
+const ProductionEnv = "production"
+
+// runSeed loads users and companies from fixture files and generates fake
+// companies, after wiping the existing data when asked to
+func runSeed(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	var files []string
+	flags.Func("file", "fixture file of users and companies, .json, .yaml or .yml (repeatable)", func(path string) error {
+		files = append(files, path)
+		return nil
+	})
+	companies := flags.Int("companies", 0, "number of fake companies to generate")
+	organization := flags.String("organization", "Demo", "organization of the generated companies")
+	randomSeed := flags.Uint64("seed", 1, "seed of the generated companies; the same seed generates the same companies")
+	reset := flags.Bool("reset", false, "delete all users, companies, events and webhooks first")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case len(files) == 0 && *companies == 0:
+		return errors.New("nothing to seed, expected -file or -companies")
+	case *companies < 0 || *companies > seed.MaxGenerated:
+		return fmt.Errorf("-companies must be between 0 and %d", seed.MaxGenerated)
+	case *reset && strings.EqualFold(utils.GetEnv(EnvAppEnv, DevEnv), ProductionEnv):
+		return fmt.Errorf("refusing to wipe the database with %s=%s", EnvAppEnv, ProductionEnv)
+	}
+
+	var fixtures seed.Fixtures
+	for _, path := range files {
+		loaded, err := seed.LoadFile(path)
+		if err != nil {
+			return err
+		}
+		fixtures.Users = append(fixtures.Users, loaded.Users...)
+		fixtures.Companies = append(fixtures.Companies, loaded.Companies...)
+	}
+	fixtures.Companies = append(fixtures.Companies, seed.Generate(*organization, *companies, *randomSeed)...)
+
+	database, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck // Shutdown errors are typically unrecoverable.
+	defer database.Close()
+
+	encoder, err := newEncoder(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *reset {
+		if err := database.Wipe(ctx); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, "wiped the existing data")
+	}
+
+	result, err := seed.NewSeeder(database, outbox.NewTransactor(database, encoder)).Seed(ctx, fixtures)
+	fmt.Fprintf(os.Stdout, "organizations: %d created\n", result.Organizations)
+	fmt.Fprintf(os.Stdout, "users: %d created, %d existing\n", result.Users, result.ExistingUsers)
+	fmt.Fprintf(os.Stdout, "companies: %d created, %d existing\n", result.Companies, result.ExistingCompanies)
+	return err
+}